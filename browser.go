@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -21,6 +22,10 @@ import (
 // aggregate measured points.
 const DefaultCollectionInterval = 15 * time.Minute
 
+// FlagSuffix is the suffix of measurements holding the quality flags of
+// another measurement, e.g. air_t_avg_flag holds the flags of air_t_avg.
+const FlagSuffix = "_flag"
+
 var (
 	ErrAuthentication    = errors.New("user not authenticated")
 	ErrDataNotFound      = errors.New("no data points")
@@ -30,6 +35,32 @@ var (
 	ErrUserNotValid      = errors.New("user is not valid")
 	ErrUserAlreadyExists = errors.New("user already exists")
 	ErrGroupsNotFound    = errors.New("no groups found")
+	ErrForbidden         = errors.New("access forbidden")
+	ErrTooLarge          = errors.New("selection too large")
+	ErrSensorNotFound    = errors.New("sensor not found")
+	ErrStationNotFound   = errors.New("station not found")
+	ErrLicenseNotSigned  = errors.New("data usage agreement not signed")
+
+	// ErrInvalidCoordinates denotes a latitude or longitude outside of
+	// [-90, 90] and [-180, 180].
+	ErrInvalidCoordinates = errors.New("invalid coordinates")
+
+	// ErrUnsupportedConversion denotes that the values of a measurement
+	// cannot be converted to the requested unit.
+	ErrUnsupportedConversion = errors.New("unsupported unit conversion")
+
+	// ErrCatalogNotPopulated denotes that the backend has not yet loaded any
+	// measurements, which is the case on a fresh deployment.
+	ErrCatalogNotPopulated = errors.New("data catalog not yet populated")
+
+	// ErrLimitExceeded denotes a limit of points greater than MaxLimit.
+	ErrLimitExceeded = errors.New("limit exceeded")
+
+	// MaxLimit is the maximum number of points per measurement and station a
+	// filter may request using Limit. A value <= 0 disables the maximum.
+	// Filters without a limit are not limited by MaxLimit, their size is
+	// bounded by the maximum number of points of an export instead.
+	MaxLimit int64 = 500000
 
 	// Location denotes the time location of the LTER stations, which is UTC+1.
 	Location = time.FixedZone("+0100", 60*60)
@@ -58,6 +89,50 @@ type Point struct {
 // TimeSeries represents a group Measurements.
 type TimeSeries []*Measurement
 
+// MeasurementIterator iterates over the measurements of a TimeSeries without
+// holding all of them in memory.
+type MeasurementIterator interface {
+	// Next returns the next Measurement. It returns io.EOF if there are no
+	// more measurements.
+	Next() (*Measurement, error)
+}
+
+// NewMeasurementIterator returns a MeasurementIterator over the given
+// TimeSeries.
+func NewMeasurementIterator(ts TimeSeries) MeasurementIterator {
+	return &seriesIterator{ts: ts}
+}
+
+// seriesIterator is a MeasurementIterator over an in memory TimeSeries.
+type seriesIterator struct {
+	ts TimeSeries
+}
+
+func (it *seriesIterator) Next() (*Measurement, error) {
+	if len(it.ts) == 0 {
+		return nil, io.EOF
+	}
+	m := it.ts[0]
+	it.ts = it.ts[1:]
+	return m, nil
+}
+
+// ReadTimeSeries reads all measurements from the given MeasurementIterator
+// until io.EOF and returns them as a TimeSeries.
+func ReadTimeSeries(it MeasurementIterator) (TimeSeries, error) {
+	var ts TimeSeries
+	for {
+		m, err := it.Next()
+		if err == io.EOF {
+			return ts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, m)
+	}
+}
+
 // Database represents a backend for retrieving time series data.
 type Database interface {
 	// Series returns a TimeSeries filtered with the given SeriesFilter. Points
@@ -65,27 +140,89 @@ type Database interface {
 	// https://gitlab.inf.unibz.it/lter/browser/issues/10
 	Series(context.Context, *SeriesFilter) (TimeSeries, error)
 
+	// SeriesStream returns the measurements of Series as a
+	// MeasurementIterator, decoding them only when requested.
+	SeriesStream(context.Context, *SeriesFilter) (MeasurementIterator, error)
+
+	// Latest returns the most recent point of each measurement and station
+	// selected by the given SeriesFilter, ignoring its time range.
+	Latest(context.Context, *SeriesFilter) (TimeSeries, error)
+
+	// Coverage returns the availability of the data of each measurement and
+	// station selected by the given SeriesFilter, within its time range if
+	// it is set.
+	Coverage(context.Context, *SeriesFilter) ([]Coverage, error)
+
 	// GroupsByStation will return a slice of groupped measurements stored in
 	// the Database for the given station.
 	GroupsByStation(context.Context, int64) ([]Group, error)
 
+	// AggregationsByStation will return for each group stored in the Database
+	// for the given station the aggregations (e.g. avg, max, tot) of its
+	// measurements.
+	AggregationsByStation(context.Context, int64) (map[Group][]string, error)
+
+	// UnitsByStation will return for each group and sub group stored in the
+	// Database for the given station the units of its measurements.
+	UnitsByStation(context.Context, int64) (map[Group][]string, error)
+
 	// Maintenance will return a list of measurement names which correspond to
 	// maintenance observations.
 	Maintenance(context.Context) ([]string, error)
 
 	// Query returns a query Stmt for the given SeriesFilter.
 	Query(context.Context, *SeriesFilter) *Stmt
+
+	// Ping checks if the Database is reachable.
+	Ping(context.Context) error
+}
+
+// Coverage describes the availability of the data of a single measurement at
+// a station: the timestamps of its first and last points and the number of
+// points in between. Missing points are not counted.
+type Coverage struct {
+	Label   string
+	Station *Station
+	First   time.Time
+	Last    time.Time
+	Points  int64
+}
+
+// CacheStatus describes the catalog of measurements a Database caches: whether
+// it has been populated, the number of stations and measurements it holds and
+// when it was last loaded.
+type CacheStatus struct {
+	Ready        bool
+	Stations     int
+	Measurements int
+	Refreshed    time.Time
 }
 
 // Stmt is a query statement composed of the actual query and the database it is
 // performed on.
 type Stmt struct {
+	// Query is a single statement selecting all measurements, e.g. for code
+	// templates.
 	Query    string
 	Database string
+
+	// Statements are the statements executed for retrieving the series of the
+	// filter, one for each measurement.
+	Statements []string
+
+	// Measurements are the measurement names resolved from the filter.
+	Measurements []string
+
+	// Start and End are the effective time range of the query in the time
+	// zone of the filter. It may differ from the range of the filter as backends
+	// adapt it to the way data is stored.
+	Start time.Time
+	End   time.Time
 }
 
 // SeriesFilter represents a filter for filtering TimeSeries.
 type SeriesFilter struct {
+	// Groups are the selected groups in the order of selection.
 	Groups   []Group
 	Stations []string
 	Landuse  []string
@@ -95,9 +232,138 @@ type SeriesFilter struct {
 	// WithSTD determines if the Series should contain standard deviations.
 	WithSTD bool
 
+	// WithFlags determines if the Series should contain the quality flags of
+	// the measurements.
+	WithFlags bool
+
+	// Limit is the maximum number of points returned per measurement and
+	// station. A value of 0 means no limit. The limit is applied when
+	// querying, before the points are filtered by TimeOfDay and DayOfWeek,
+	// which may therefore return fewer points. Series of legacy labels merged
+	// under their alias are limited separately and may return more points.
+	Limit int64
+
+	// Descending determines if the points of the series are returned newest
+	// first. By default points are returned oldest first.
+	Descending bool
+
+	// RetentionPolicy is the retention policy the series are selected from.
+	// An empty policy selects from the default retention policy.
+	RetentionPolicy string
+
 	// Maintenance is a list of raw label names corresponding to measurements
 	// used for maintenance technicians.
 	Maintenance []string
+
+	// TimeOfDay and DayOfWeek restrict the series to points measured at the
+	// given time of day and day of week. Empty values select all points.
+	// InfluxQL offers no functions on the time of a point and does not
+	// support multiple time ranges in a single query, therefore backends
+	// filter the points after retrieving the full time range.
+	TimeOfDay TimeOfDay
+	DayOfWeek DayOfWeek
+
+	// Labels restricts the series to the measurements of the groups with the
+	// given labels, e.g. the measurements recorded by a single sensor. An
+	// empty list selects all measurements of the groups.
+	Labels []string
+
+	// Measurements are labels of single measurements selected in addition to
+	// the measurements of the groups, e.g. air_t_avg. They are not restricted
+	// by Labels, WithSTD or WithFlags. Labels not part of any group or which
+	// the user is not allowed to access are ignored.
+	Measurements []string
+
+	// Units maps a group to the unit the values of its measurements are
+	// converted to, e.g. m/s for WindSpeed. Measurements of groups not
+	// present keep their unit. See ConvertUnit for supported conversions.
+	Units map[Group]string
+
+	// TZ is the time zone of the dates of the filter and of the timestamps
+	// of the series. If nil LTER local time (Location) is used.
+	TZ *time.Location
+}
+
+// Location returns the time zone of the filter.
+func (f *SeriesFilter) Location() *time.Location {
+	if f.TZ == nil {
+		return Location
+	}
+	return f.TZ
+}
+
+// TimeOfDay selects points measured during the day or during the night in
+// LTER local time (Location). Night is a fixed window from NightStartHour
+// until NightEndHour which does not follow sunrise and sunset.
+type TimeOfDay string
+
+const (
+	AnyTime   TimeOfDay = ""
+	Daytime   TimeOfDay = "day"
+	Nighttime TimeOfDay = "night"
+)
+
+// NightStartHour and NightEndHour are the hours in LTER local time enclosing
+// the night.
+const (
+	NightStartHour = 20
+	NightEndHour   = 6
+)
+
+// Includes reports whether the given time is selected by d.
+func (d TimeOfDay) Includes(t time.Time) bool {
+	h := t.In(Location).Hour()
+	night := h >= NightStartHour || h < NightEndHour
+
+	switch d {
+	case Daytime:
+		return !night
+	case Nighttime:
+		return night
+	default:
+		return true
+	}
+}
+
+// DayOfWeek selects points measured on weekdays or on weekends (Saturday and
+// Sunday) in LTER local time (Location).
+type DayOfWeek string
+
+const (
+	AnyDay   DayOfWeek = ""
+	Weekdays DayOfWeek = "weekday"
+	Weekends DayOfWeek = "weekend"
+)
+
+// Includes reports whether the given time is selected by d.
+func (d DayOfWeek) Includes(t time.Time) bool {
+	w := t.In(Location).Weekday()
+	weekend := w == time.Saturday || w == time.Sunday
+
+	switch d {
+	case Weekdays:
+		return !weekend
+	case Weekends:
+		return weekend
+	default:
+		return true
+	}
+}
+
+// EstimatePoints estimates the number of points selected by the filter, given
+// the number of measurements selected per station. It assumes that stations
+// collect points with DefaultCollectionInterval during the whole range from the
+// start until the end of the end date and respects Limit.
+func (f *SeriesFilter) EstimatePoints(measurements int) int64 {
+	if f.End.Before(f.Start) {
+		return 0
+	}
+
+	points := int64(f.End.AddDate(0, 0, 1).Sub(f.Start) / DefaultCollectionInterval)
+	if f.Limit > 0 && f.Limit < points {
+		points = f.Limit
+	}
+	return points * int64(measurements) * int64(len(f.Stations))
 }
 
 // ParseSeriesFilterFromRequest parses form values from the given http.Request
@@ -108,12 +374,27 @@ func ParseSeriesFilterFromRequest(r *http.Request) (*SeriesFilter, error) {
 		return nil, err
 	}
 
-	start, err := time.ParseInLocation("2006-01-02", r.FormValue("startDate"), Location)
+	// The dates are days in the requested time zone, therefore it is parsed
+	// first.
+	var tz *time.Location
+	switch v := r.FormValue("tz"); v {
+	case "":
+	case "UTC":
+		tz = time.UTC
+	default:
+		return nil, fmt.Errorf("unknown time zone %q", v)
+	}
+	loc := Location
+	if tz != nil {
+		loc = tz
+	}
+
+	start, err := time.ParseInLocation("2006-01-02", r.FormValue("startDate"), loc)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse start date %v", err)
 	}
 
-	end, err := time.ParseInLocation("2006-01-02", r.FormValue("endDate"), Location)
+	end, err := time.ParseInLocation("2006-01-02", r.FormValue("endDate"), loc)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse end date %v", err)
 	}
@@ -122,7 +403,7 @@ func ParseSeriesFilterFromRequest(r *http.Request) (*SeriesFilter, error) {
 		return nil, errors.New("error: end date is in the future")
 	}
 
-	if r.Form["measurements"] == nil && r.Form["maintenance"] == nil {
+	if r.Form["measurements"] == nil && r.Form["fields"] == nil && r.Form["maintenance"] == nil {
 		return nil, errors.New("at least one measurement must be given")
 	}
 
@@ -134,26 +415,70 @@ func ParseSeriesFilterFromRequest(r *http.Request) (*SeriesFilter, error) {
 	if len(r.Form["showStd"]) == 1 && strings.EqualFold(r.Form["showStd"][0], "on") {
 		showStd = true
 	}
+	if r.FormValue("std") == "1" {
+		showStd = true
+	}
+
+	showFlags := false
+	if len(r.Form["showFlags"]) == 1 && strings.EqualFold(r.Form["showFlags"][0], "on") {
+		showFlags = true
+	}
+	if r.FormValue("withFlags") == "1" {
+		showFlags = true
+	}
+
+	var limit int64
+	if l := r.FormValue("limit"); l != "" {
+		limit, err = strconv.ParseInt(l, 10, 64)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("could not parse limit %q", l)
+		}
+		if MaxLimit > 0 && limit > MaxLimit {
+			return nil, fmt.Errorf("%w: at most %d points per measurement and station can be requested", ErrLimitExceeded, MaxLimit)
+		}
+	}
+
+	tod := TimeOfDay(r.FormValue("timeOfDay"))
+	switch tod {
+	case AnyTime, Daytime, Nighttime:
+	default:
+		return nil, fmt.Errorf("unknown time of day %q", tod)
+	}
+
+	dow := DayOfWeek(r.FormValue("dayOfWeek"))
+	switch dow {
+	case AnyDay, Weekdays, Weekends:
+	default:
+		return nil, fmt.Errorf("unknown day of week %q", dow)
+	}
 
 	return &SeriesFilter{
-		Groups:      parseGroups(r.Form["measurements"]),
-		Stations:    r.Form["stations"],
-		Landuse:     r.Form["landuse"],
-		Start:       start,
-		End:         end,
-		Maintenance: r.Form["maintenance"],
-		WithSTD:     showStd,
+		Groups:          parseGroups(r.Form["measurements"]),
+		Stations:        r.Form["stations"],
+		Landuse:         r.Form["landuse"],
+		Start:           start,
+		End:             end,
+		Maintenance:     r.Form["maintenance"],
+		Measurements:    r.Form["fields"],
+		WithSTD:         showStd,
+		WithFlags:       showFlags,
+		Limit:           limit,
+		RetentionPolicy: r.FormValue("retentionPolicy"),
+		TimeOfDay:       tod,
+		DayOfWeek:       dow,
+		TZ:              tz,
 	}, nil
 }
 
 // parseGroups will parse each string in the given string slice into a group and
-// return a unique slice of Groups.
+// return a unique slice of Groups in the order of their first occurrence.
+// Strings which are not a known group are skipped.
 func parseGroups(str []string) []Group {
 	var g []Group
 
 	for _, s := range str {
-		i, err := strconv.ParseUint(s, 10, 8)
-		if err != nil {
+		i, err := strconv.ParseUint(strings.TrimSpace(s), 10, 8)
+		if err != nil || Group(i) >= NoGroup {
 			continue
 		}
 
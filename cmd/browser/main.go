@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -15,6 +16,7 @@ import (
 	"github.com/euracresearch/browser"
 	"github.com/euracresearch/browser/internal/http"
 	"github.com/euracresearch/browser/internal/influx"
+	"github.com/euracresearch/browser/internal/metrics"
 	"github.com/euracresearch/browser/internal/middleware"
 	"github.com/euracresearch/browser/internal/oauth2"
 	"github.com/euracresearch/browser/internal/snipeit"
@@ -39,20 +41,50 @@ func main() {
 	var (
 		listenAddr        = fs.String("listen", defaultAddr, "Server listen address.")
 		https             = fs.Bool("https", false, "Serve HTTPS.")
+		readTimeout       = fs.Duration("http.readtimeout", http.DefaultReadTimeout, "Maximum duration for reading an entire request.")
+		writeTimeout      = fs.Duration("http.writetimeout", http.DefaultWriteTimeout, "Maximum duration for writing a response of any route, must allow for large downloads (0 means no limit).")
+		handlerTimeout    = fs.Duration("http.timeout", http.DefaultTimeout, "Maximum duration for handling requests, except for downloads and live data streams (0 means no limit).")
+		idleTimeout       = fs.Duration("http.idletimeout", http.DefaultIdleTimeout, "Maximum duration to wait for the next request on keep-alive connections.")
 		domain            = fs.String("domain", "", "Domain used for getting LetsEncrypt certificate.")
 		influxAddr        = fs.String("influx.addr", "http://127.0.0.1:8086", "Influx (http:https)://host:port")
 		influxUser        = fs.String("influx.username", "", "Influx username")
 		influxPass        = fs.String("influx.password", "", "Influx password")
 		influxDatabase    = fs.String("influx.database", "", "Influx database name")
+		influxStatements  = fs.Int("influx.statements", influx.MaxStatementsPerQuery, "Maximum number of statements in a single Influx query.")
+		influxLimit       = fs.Int64("influx.limit", browser.MaxLimit, "Maximum number of points per measurement and station a request may ask for.")
+		influxDeny        = fs.String("influx.deny", "", "File listing measurements hidden from all users, one per line (optional).")
+		influxCheck       = fs.Bool("influx.checkschema", false, "Check that the Influx database has the tag and field keys the browser relies on, report missing ones and exit.")
+		influxAliases     = fs.String("influx.aliases", "", "Comma separated list of legacy=canonical measurement label aliases.")
 		usersDatabase     = fs.String("users.database", "", "Database name for storing user information.")
 		usersEnvironment  = fs.String("users.env", "testing", "The environment the app is running.")
+		usersRevalidate   = fs.Duration("users.revalidate", 0, "Interval in which signed in users are checked against the user database, expiring sessions of deleted users (0 disables the check).")
+		usersRefreshRole  = fs.Bool("users.refreshrole", false, "Apply role changes of signed in users without signing in again, looking users up every users.revalidate or on every request if it is 0.")
 		snipeitAddr       = fs.String("snipeit.addr", "", "SnipeIT API URL")
 		snipeitToken      = fs.String("snipeit.token", "", "SnipeIT API Token")
+		snipeitExclude    = fs.String("snipeit.exclude", "LTER", "Comma separated list of SnipeIT location names which are not stations.")
+		snipeitCacheTTL   = fs.Duration("snipeit.cachettl", 15*time.Minute, "Duration stations are cached before being refreshed from SnipeIT, 0 disables the cache.")
+		stationIntervals  = fs.String("stations.intervals", "", "Comma separated list of station=interval pairs for stations not logging every 15m, e.g. 12=10m.")
 		jwtKey            = fs.String("jwt.key", "", "Secret key used to create a JWT. Don't share it.")
 		xsrfKey           = fs.String("xsrf.key", "d71404b42640716b0050ad187489c128ec3d611179cf14a29ddd6ea0d536a2c1", "Random string used for generating XSRF token.")
+		robotsFile        = fs.String("robots.file", "", "Path to a robots.txt file with the robots policy (default allows all crawlers). A reference to /sitemap.xml is added.")
 		analyticsCode     = fs.String("analytics.code", "", "Google Analytics Code")
+		maxPoints         = fs.Int64("download.maxpoints", http.DefaultMaxPoints, "Maximum number of points a single download may select, estimated before querying (0 means no limit).")
+		maxDownloads      = fs.Int("download.maxconcurrent", http.DefaultMaxDownloads, "Maximum number of downloads served concurrently, further downloads are rejected until one finishes (0 means no limit).")
+		maxMeasurements   = fs.Int("download.maxmeasurements", 0, "Maximum number of measurements per station a single download may select, users with full access are exempt (0 means no limit).")
+		downloadOrder     = fs.String("download.order", "", "Comma separated list of measurement labels shown first in downloads, e.g. air_t_avg,air_rh_avg,precip_rt_nrt_tot. Other measurements follow by group and label.")
+		downloadFormats   = fs.String("download.formats", "", "Comma separated list of role=format pairs setting the default download format of a role, e.g. FullAccess=grouped-json. Formats are csv, wide, grouped-json, xlsx and ndjson.")
+		liveInterval      = fs.Duration("live.interval", http.DefaultLiveInterval, "Interval in which the latest points are polled for live data streams.")
+		dateRange         = fs.Duration("ui.daterange", 0, "Length of the date range preselected in the download form, e.g. 720h (default six months).")
+		uiLanguages       = fs.String("ui.languages", strings.Join(http.DefaultLanguages, ","), "Comma separated list of languages of the user interface, the first is the default, e.g. en,de,it,fr.")
+		uiPages           = fs.String("ui.pages", strings.Join(http.DefaultPages, ","), "Comma separated list of the static pages of the user interface, each an embedded directory below templates.")
+		publicGroups      = fs.String("groups.public", "", "Comma separated list of the numeric values of the groups public users may access, e.g. 0,1,43,44 (default air temperature, relative humidity, wind, global radiation, precipitation and snow height).")
+		templateRoles     = fs.String("templates.roles", "FullAccess", "Comma separated list of roles allowed to download code templates, e.g. FullAccess,External.")
+		maintenance       = fs.Bool("maintenance", false, "Start in maintenance mode, rejecting downloads. It can be toggled at runtime using /api/v1/maintenance.")
+		maintenanceMsg    = fs.String("maintenance.message", "", "Message shown to users in maintenance mode (optional).")
 		cookieHashKey     = fs.String("cookie.hash", "3998130314e70d9037e05bf872881156da20e07f344f6d9ae58f92e4be85a07dbdb8949c2eee7e0498247176df3d7785200e586c1b52b7f87210119297f77552", "Hash key used for securing the HTTP cookie. Should be at least 32 bytes long.")
 		cookieBlockKey    = fs.String("cookie.block", "e48f59d35c3871586f68d788bcff6c45", "Block keys should be 16 bytes (AES-128) or 32 bytes (AES-256) long. Shorter keys may weaken the encryption used.")
+		cookieName        = fs.String("cookie.name", oauth2.DefaultCookieName, "Name of the session cookie. Instances sharing a domain need distinct names.")
+		langCookieName    = fs.String("cookie.language", http.DefaultLanguageCookieName, "Name of the cookie storing the language of the user interface.")
 		oauthState        = fs.String("oauth2.state", "", "Random string used for OAuth2 state code.")
 		oauthNonce        = fs.String("oauth2.nonce", "", "Random string for ID token verification.")
 		microsoftClientID = fs.String("microsoft.clientid", "", "Microsoft OAuth2 client ID.")
@@ -100,40 +132,133 @@ func main() {
 	}
 
 	// Initialize services.
-	db, err := influx.NewDB(ic, *influxDatabase)
+	influx.MaxStatementsPerQuery = *influxStatements
+	browser.MaxLimit = *influxLimit
+	aliases, err := influx.ParseAliases(*influxAliases)
+	if err != nil {
+		log.Fatal(err)
+	}
+	intervals, err := browser.ParseCollectionIntervals(*stationIntervals)
+	if err != nil {
+		log.Fatal(err)
+	}
+	public, err := browser.ParseGroups(*publicGroups)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbOptions := []influx.Option{
+		influx.WithAliases(aliases),
+		influx.WithCollectionIntervals(intervals),
+		influx.WithPublicGroups(public),
+	}
+	if *influxDeny != "" {
+		dbOptions = append(dbOptions, influx.WithDenyList(*influxDeny))
+	}
+	db, err := influx.NewDB(ic, *influxDatabase, dbOptions...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	missing, err := db.CheckSchema(context.Background())
+	if err != nil {
+		log.Fatalf("influx: could not check schema: %v\n", err)
+	}
+	for _, key := range missing {
+		log.Printf("influx: expected tag or field key %q not found in database %q\n", key, *influxDatabase)
+	}
+	if *influxCheck {
+		if len(missing) > 0 {
+			os.Exit(1)
+		}
+		log.Println("influx: schema ok")
+		os.Exit(0)
+	}
+
+	stationService, err := snipeit.NewStationService(*snipeitAddr, *snipeitToken,
+		snipeit.WithExcluded(snipeit.ParseExcluded(*snipeitExclude)...),
+		snipeit.WithCollectionIntervals(intervals),
+		snipeit.WithCacheTTL(*snipeitCacheTTL),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	userService := &influx.UserService{
+		Client:   ic,
+		Database: *usersDatabase,
+		Env:      *usersEnvironment,
+	}
+
+	formats, err := http.ParseDefaultFormats(*downloadFormats)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	stationService, err := snipeit.NewStationService(*snipeitAddr, *snipeitToken)
+	roles, err := http.ParseRoles(*templateRoles)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	var order browser.MeasurementOrder
+	if *downloadOrder != "" {
+		order = strings.Split(*downloadOrder, ",")
+	}
+
+	var frontendOptions []http.Option
+	if *maintenance {
+		frontendOptions = append(frontendOptions, http.WithMaintenance(*maintenanceMsg))
+	}
+	if *uiLanguages != "" {
+		frontendOptions = append(frontendOptions, http.WithLanguages(strings.Split(*uiLanguages, ",")))
+	}
+	if *uiPages != "" {
+		frontendOptions = append(frontendOptions, http.WithPages(strings.Split(*uiPages, ",")))
+	}
+	if *robotsFile != "" {
+		robots, err := os.ReadFile(*robotsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		frontendOptions = append(frontendOptions, http.WithRobots(string(robots)))
+	}
+
 	// Initialize HTTP endpoints.
-	frontend := http.NewHandler(
+	frontend := http.NewHandler(append([]http.Option{
 		http.WithDatabase(db),
 		http.WithStationService(stationService),
+		http.WithUserService(userService),
 		http.WithAnalyticsCode(*analyticsCode),
-	)
+		http.WithDefaultDateRange(*dateRange),
+		http.WithLiveInterval(*liveInterval),
+		http.WithTimeout(*handlerTimeout),
+		http.WithMaxPoints(*maxPoints),
+		http.WithMaxMeasurements(*maxMeasurements),
+		http.WithMaxDownloads(*maxDownloads),
+		http.WithMeasurementOrder(order),
+		http.WithDefaultFormats(formats),
+		http.WithTemplateRoles(roles),
+		http.WithPublicGroups(public),
+		http.WithLanguageCookieName(*langCookieName),
+	}, frontendOptions...)...)
 
-	// Initialize authentication handler.
+	// Initialize authentication handler. Requests are logged after the user
+	// has been authenticated so that the user's role is known.
 	handler := &oauth2.Handler{
-		Next:  frontend,
+		Next:  middleware.LoggerWithStats(os.Stdout, metrics.DefaultStats)(frontend),
 		State: *oauthState,
 		Nonce: *oauthNonce,
 		Auth: &oauth2.Cookie{
 			Secret: *jwtKey,
 			Cookie: securecookie.New([]byte(*cookieHashKey), []byte(*cookieBlockKey)),
+			Name:   *cookieName,
 		},
-		Users: &influx.UserService{
-			Client:   ic,
-			Database: *usersDatabase,
-			Env:      *usersEnvironment,
-		},
+		Users:              userService,
+		RevalidateInterval: *usersRevalidate,
+		RefreshRole:        *usersRefreshRole,
 	}
 
-	// Initialize OAuth2 providers.
+	// Initialize OAuth2 providers. Providers without client ID or secret are
+	// skipped.
 	handler.Register(&oauth2.Microsoft{
 		Provider:    "microsoft",
 		ClientID:    *microsoftClientID,
@@ -160,12 +285,18 @@ func main() {
 		middleware.XSRFProtect(*xsrfKey),
 	)
 
+	srv := http.NewServer(*listenAddr, mw(handler),
+		http.WithReadTimeout(*readTimeout),
+		http.WithWriteTimeout(*writeTimeout),
+		http.WithIdleTimeout(*idleTimeout),
+	)
+
 	log.Printf("Starting server on %s\n", *listenAddr)
 	if *https && *domain != "" {
-		log.Fatal(http.ServeAutoCert(*listenAddr, mw(handler), *domain))
+		log.Fatal(http.ServeAutoCert(srv, *domain))
 	}
 
-	log.Fatal(http.ListenAndServe(*listenAddr, mw(handler)))
+	log.Fatal(srv.ListenAndServe())
 }
 
 func required(name, value string) {
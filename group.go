@@ -4,6 +4,13 @@
 
 package browser
 
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
 const (
 	AirTemperature Group = iota
 	RelativeHumidity
@@ -165,6 +172,136 @@ func (g Group) Public() string {
 	}
 }
 
+// MeasurementRegex returns the regular expression matching the labels of the
+// measurements of the group, e.g. for use in a "SHOW MEASUREMENTS WITH
+// MEASUREMENT =~" query. An empty string is returned for NoGroup.
+func (g Group) MeasurementRegex() string {
+	switch g {
+	default:
+		return ""
+	case AirTemperature:
+		return `air_t`
+	case RelativeHumidity:
+		return `air_rh`
+	case SoilTemperature:
+		return `^st_.*|_st_.*$`
+	// The depth of a sub group is delimited by underscores, so that e.g.
+	// st_105_avg is not matched as 5 cm.
+	case SoilTemperatureDepth00:
+		return `st_(.*_)?00_.*$`
+	case SoilTemperatureDepth02:
+		return `st_(.*_)?02_.*$`
+	case SoilTemperatureDepth05:
+		return `st_(.*_)?05_.*$`
+	case SoilTemperatureDepth10:
+		return `st_(.*_)?10_.*$`
+	case SoilTemperatureDepth20:
+		return `st_(.*_)?20_.*$`
+	case SoilTemperatureDepth40:
+		return `st_(.*_)?40_.*$`
+	case SoilTemperatureDepth50:
+		return `st_(.*_)?50_.*$`
+	case SoilWaterContent:
+		return `^swc_[^dp_|ec_|st_]`
+	case SoilWaterContentDepth02:
+		return `^swc_[^dp_|ec_|st_].*_02_.*$`
+	case SoilWaterContentDepth05:
+		return `^swc_[^dp_|ec_|st_].*_05_.*$`
+	case SoilWaterContentDepth20:
+		return `^swc_[^dp_|ec_|st_].*_20_.*$`
+	case SoilWaterContentDepth40:
+		return `^swc_[^dp_|ec_|st_].*_40_.*$`
+	case SoilWaterContentDepth50:
+		return `^swc_[^dp_|ec_|st_].*_50_.*$`
+	case SoilElectricalConductivity:
+		return `^swc_ec_.*$`
+	case SoilElectricalConductivityDepth02:
+		return `^swc_ec_(.*_)?02_.*$`
+	case SoilElectricalConductivityDepth05:
+		return `^swc_ec_(.*_)?05_.*$`
+	case SoilElectricalConductivityDepth20:
+		return `^swc_ec_(.*_)?20_.*$`
+	case SoilElectricalConductivityDepth40:
+		return `^swc_ec_(.*_)?40_.*$`
+	case SoilElectricalConductivityDepth50:
+		return `^swc_ec_(.*_)?50_.*$`
+	case SoilDielectricPermittivity:
+		return `^swc_dp_.*$`
+	case SoilDielectricPermittivityDepth02:
+		return `^swc_dp_(.*_)?02_.*$`
+	case SoilDielectricPermittivityDepth05:
+		return `^swc_dp_(.*_)?05_.*$`
+	case SoilDielectricPermittivityDepth20:
+		return `^swc_dp_(.*_)?20_.*$`
+	case SoilDielectricPermittivityDepth40:
+		return `^swc_dp_(.*_)?40_.*$`
+	case SoilDielectricPermittivityDepth50:
+		return `^swc_dp_(.*_)?50_.*$`
+	case SoilWaterPotential:
+		return `^swp.[^_st_].*$`
+	case SoilWaterPotentialDepth05:
+		return `^swp.[^_st_].*_05_.*$`
+	case SoilWaterPotentialDepth20:
+		return `^swp.[^_st_].*_20_.*$`
+	case SoilWaterPotentialDepth40:
+		return `^swp.[^_st_].*_40_.*$`
+	case SoilWaterPotentialDepth50:
+		return `^swp.[^_st_].*_50_.*$`
+	case SoilHeatFlux:
+		return `^shf.*$`
+	// SoilSurfaceTemperature does not match the raw sensor signal in mV
+	// nor the temperature of the sensor body.
+	case SoilSurfaceTemperature:
+		return `surf_t\d*(_(avg|std|min|max))?$`
+	case Wind:
+		return `^wind.*$`
+	// WindSpeed matches the bare wind_speed and the avg and std
+	// aggregations, but not max which has its own group.
+	case WindSpeed:
+		return `^wind_speed$|wind_speed.*_(avg|std)$`
+	case WindSpeedMax:
+		return `^wind_speed.*_max$`
+	case WindDirection:
+		return `^wind_dir.*`
+	case Precipitation:
+		return `^precip.*(_tot|_int).*$`
+	case PrecipitationTotal:
+		return `^precip.*(_tot).*$`
+	case PrecipitationIntensity:
+		return `^precip.*(_int).*$`
+	case SnowHeight:
+		return `snow_height`
+	case LeafWetnessDuration:
+		return `^lwm`
+	case SunshineDuration:
+		return `^sun`
+	case PhotosyntheticallyActiveRadiation:
+		return `^par_.*$`
+	case PhotosyntheticallyActiveRadiationTotal:
+		return `^par_[^dif|soil].*$|par_std`
+	case PhotosyntheticallyActiveRadiationDiffuse:
+		return `^par_.*dif_.*$`
+	case PhotosyntheticallyActiveRadiationAtSoilLevel:
+		return `^par_.*soil_.*$`
+	case NDVIRadiations:
+		return `^ndvi_.*`
+	case PRIRadiations:
+		return `^pri_.*$`
+	case ShortWaveRadiation:
+		return `^sr_|.*_sw_.*$`
+	case ShortWaveRadiationIncoming:
+		return `^.*_dn.*_sw_.*$`
+	case ShortWaveRadiationOutgoing:
+		return `^.*_up.*_sw_.*$`
+	case LongWaveRadiation:
+		return `.*_lw_.*$`
+	case LongWaveRadiationIncoming:
+		return `.*_dn.*_lw_.*$`
+	case LongWaveRadiationOutgoing:
+		return `.*_up.*_lw_.*$`
+	}
+}
+
 // SubGroups will return a list of sub groups. An empty slice indicates that no
 // sub groups are defined.
 func (g Group) SubGroups() []Group {
@@ -315,24 +452,51 @@ func GroupsByType(t GroupType) []Group {
 	}
 }
 
-// GroupsByRole will return a list of groups for the given role.
-func GroupsByRole(r Role) []Group {
+// DefaultPublicGroups is the list of groups the Public role is allowed to
+// access if none are configured.
+var DefaultPublicGroups = []Group{
+	AirTemperature,
+	RelativeHumidity,
+	WindDirection,
+	WindSpeed,
+	WindSpeedMax,
+	ShortWaveRadiationOutgoing,
+	PrecipitationTotal,
+	SnowHeight,
+}
+
+// GroupsByRole will return a list of groups for the given role. The Public
+// role is allowed to access the given public groups, or DefaultPublicGroups if
+// none are given.
+func GroupsByRole(r Role, public []Group) []Group {
 	if r == Public {
-		return []Group{
-			AirTemperature,
-			RelativeHumidity,
-			WindDirection,
-			WindSpeed,
-			WindSpeedMax,
-			ShortWaveRadiationOutgoing,
-			PrecipitationTotal,
-			SnowHeight,
+		if len(public) == 0 {
+			return DefaultPublicGroups
 		}
+		return public
 	}
 
 	return GroupsByType(ParentGroup)
 }
 
+// ParseGroups parses a comma separated list of groups given by their numeric
+// value, e.g. "0,1,43", as used for identifying groups in requests.
+func ParseGroups(s string) ([]Group, error) {
+	var groups []Group
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(f, 10, 8)
+		if err != nil || Group(n) >= NoGroup {
+			return nil, fmt.Errorf("unknown group %q", f)
+		}
+		groups = AppendGroupIfMissing(groups, Group(n))
+	}
+	return groups, nil
+}
+
 // AppendGroupIfMissing will append the given to group to the given slice if it
 // is missing.
 func AppendGroupIfMissing(slice []Group, g Group) []Group {
@@ -345,12 +509,13 @@ func AppendGroupIfMissing(slice []Group, g Group) []Group {
 }
 
 // FilterGroupsByRole will filter the give groups by the given role returning
-// only groups the role is allowed to access.
-func FilterGroupsByRole(groups []Group, r Role) []Group {
+// only groups the role is allowed to access, see GroupsByRole.
+func FilterGroupsByRole(groups []Group, r Role, public []Group) []Group {
 	var filtered []Group
 
+	allowed := GroupsByRole(r, public)
 	for _, group := range groups {
-		if present(group, GroupsByRole(r)) {
+		if present(group, allowed) {
 			filtered = append(filtered, group)
 		}
 	}
@@ -367,3 +532,53 @@ func present(g Group, groups []Group) bool {
 	}
 	return false
 }
+
+// groupRegexps holds the compiled MeasurementRegex of each group, indexed by
+// the group.
+var groupRegexps = func() []*regexp.Regexp {
+	res := make([]*regexp.Regexp, NoGroup)
+	for g := AirTemperature; g < NoGroup; g++ {
+		res[g] = regexp.MustCompile(g.MeasurementRegex())
+	}
+	return res
+}()
+
+// groupOf returns the first group in logical order whose measurements include
+// the given label. NoGroup is returned if no group matches.
+func groupOf(label string) Group {
+	for g, re := range groupRegexps {
+		if re.MatchString(label) {
+			return Group(g)
+		}
+	}
+	return NoGroup
+}
+
+// MeasurementOrder is an explicit display order of measurement labels, e.g.
+// for the columns of an export. Labels present in the order are displayed
+// first in the given order, all others follow ordered by their group and then
+// alphabetically.
+type MeasurementOrder []string
+
+// Less reports whether the measurement with label a is displayed before the
+// one with label b.
+func (o MeasurementOrder) Less(a, b string) bool {
+	if ia, ib := o.index(a), o.index(b); ia != ib {
+		return ia < ib
+	}
+	if ga, gb := groupOf(a), groupOf(b); ga != gb {
+		return ga < gb
+	}
+	return a < b
+}
+
+// index returns the position of the given label in the order or the length of
+// the order if it is not present.
+func (o MeasurementOrder) index(label string) int {
+	for i, l := range o {
+		if l == label {
+			return i
+		}
+	}
+	return len(o)
+}
@@ -0,0 +1,34 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package browser
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterGroupsByRole(t *testing.T) {
+	groups := []Group{AirTemperature, LeafWetnessDuration, SoilTemperature, SunshineDuration}
+
+	testCases := map[string]struct {
+		role   Role
+		public []Group
+		want   []Group
+	}{
+		"default":    {Public, nil, []Group{AirTemperature}},
+		"custom":     {Public, []Group{LeafWetnessDuration, SunshineDuration}, []Group{LeafWetnessDuration, SunshineDuration}},
+		"fullaccess": {FullAccess, []Group{SunshineDuration}, []Group{AirTemperature, LeafWetnessDuration, SoilTemperature, SunshineDuration}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := FilterGroupsByRole(groups, tc.role, tc.public)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
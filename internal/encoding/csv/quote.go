@@ -0,0 +1,81 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// QuoteMode controls how fields are quoted in the CSV output.
+type QuoteMode int
+
+const (
+	// QuoteMinimal quotes only fields which require quoting. This is the
+	// default and the behaviour of the standard library.
+	QuoteMinimal QuoteMode = iota
+
+	// QuoteAll quotes all fields.
+	QuoteAll
+
+	// QuoteNone never quotes fields. Fields containing a comma, quote or
+	// newline are written as they are.
+	QuoteNone
+)
+
+// ParseQuoteMode returns the QuoteMode for the given name, which is one of
+// "minimal", "all" or "none". An empty name returns QuoteMinimal.
+func ParseQuoteMode(s string) (QuoteMode, error) {
+	switch strings.ToLower(s) {
+	case "", "minimal":
+		return QuoteMinimal, nil
+	case "all":
+		return QuoteAll, nil
+	case "none":
+		return QuoteNone, nil
+	}
+	return QuoteMinimal, fmt.Errorf("unknown quote mode %q", s)
+}
+
+// RecordWriter writes CSV records.
+type RecordWriter interface {
+	// WriteAll writes all records and flushes the output.
+	WriteAll(records [][]string) error
+}
+
+// NewRecordWriter returns a RecordWriter that writes to w and quotes fields
+// according to the given mode.
+func NewRecordWriter(w io.Writer, mode QuoteMode) RecordWriter {
+	if mode == QuoteMinimal {
+		return csv.NewWriter(w)
+	}
+	return &quoteWriter{w: bufio.NewWriter(w), mode: mode}
+}
+
+// quoteWriter writes records either with all fields quoted or with none.
+type quoteWriter struct {
+	w    *bufio.Writer
+	mode QuoteMode
+}
+
+func (q *quoteWriter) WriteAll(records [][]string) error {
+	for _, record := range records {
+		for i, field := range record {
+			if i > 0 {
+				q.w.WriteByte(',')
+			}
+
+			if q.mode == QuoteAll {
+				field = `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+			}
+			q.w.WriteString(field)
+		}
+		q.w.WriteByte('\n')
+	}
+	return q.w.Flush()
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/euracresearch/browser"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseQuoteMode(t *testing.T) {
+	testCases := map[string]struct {
+		in      string
+		want    QuoteMode
+		wantErr bool
+	}{
+		"empty":   {"", QuoteMinimal, false},
+		"minimal": {"minimal", QuoteMinimal, false},
+		"all":     {"all", QuoteAll, false},
+		"upper":   {"ALL", QuoteAll, false},
+		"none":    {"none", QuoteNone, false},
+		"unknown": {"sometimes", QuoteMinimal, true},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			got, err := ParseQuoteMode(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriteQuoteMode(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		m := testMeasurement("a_avg", "s1", "c", 2)
+		m.Station.Landuse = `me, "s1"`
+		return browser.TimeSeries{m}
+	}
+
+	testCases := map[string]struct {
+		mode QuoteMode
+		want string
+	}{
+		"minimal": {
+			QuoteMinimal,
+			`time,station,landuse,elevation,latitude,longitude,a_avg
+,,,,,,c
+2020-01-01 00:15:00,s1,"me, ""s1""",1000,3.14159,2.71828,0
+2020-01-01 00:30:00,s1,"me, ""s1""",1000,3.14159,2.71828,1
+`,
+		},
+		"all": {
+			QuoteAll,
+			`"time","station","landuse","elevation","latitude","longitude","a_avg"
+"","","","","","","c"
+"2020-01-01 00:15:00","s1","me, ""s1""","1000","3.14159","2.71828","0"
+"2020-01-01 00:30:00","s1","me, ""s1""","1000","3.14159","2.71828","1"
+`,
+		},
+		"none": {
+			QuoteNone,
+			`time,station,landuse,elevation,latitude,longitude,a_avg
+,,,,,,c
+2020-01-01 00:15:00,s1,me, "s1",1000,3.14159,2.71828,0
+2020-01-01 00:30:00,s1,me, "s1",1000,3.14159,2.71828,1
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, WithQuoteMode(tc.mode))
+			if err := w.Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
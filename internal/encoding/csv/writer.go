@@ -19,10 +19,12 @@
 package csv
 
 import (
-	"encoding/csv"
 	"fmt"
 	"io"
+	"math"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/euracresearch/browser"
@@ -32,10 +34,15 @@ import (
 // output.
 const DefaultTimeFormat = "2006-01-02 15:04:05"
 
-// Writer writes a browser.TimeSeries as a CSV file. It wraps a default
-// csv.Writer.
+// Suffixes of the labels of averages and their standard deviations.
+const (
+	avgSuffix = "_avg"
+	stdSuffix = "_std"
+)
+
+// Writer writes a browser.TimeSeries as a CSV file. It wraps a RecordWriter.
 type Writer struct {
-	w *csv.Writer
+	w RecordWriter
 
 	// rows represent a buffer for holding individual rows of the CSV file.
 	rows [][]string
@@ -43,13 +50,183 @@ type Writer struct {
 	// pos records the column position of a measurement and ensures that the
 	// measurement is written only once to the header.
 	pos map[string]int
+
+	// flags determines if a companion flag column is written for each
+	// measurement.
+	flags bool
+
+	// quote determines how fields are quoted.
+	quote QuoteMode
+
+	// sideBySide determines if stations are written in blocks next to each
+	// other instead of one below the other.
+	sideBySide bool
+
+	// dropEmpty determines if columns of measurements without any value are
+	// omitted.
+	dropEmpty bool
+
+	// order determines the order of the measurement columns if set.
+	order browser.MeasurementOrder
+
+	// precision is the number of decimals of values. If negative values are
+	// written with full precision.
+	precision int
+
+	// aliases maps measurement labels to the names of their columns. Labels
+	// not present are used as they are.
+	aliases map[string]string
+
+	// metadata is written as comment block before the header if set.
+	metadata *Metadata
+
+	// out is the writer of the default RecordWriter. Comment lines are written
+	// to it directly, so that they are not quoted. It is nil if the records
+	// are written with another RecordWriter.
+	out io.Writer
+}
+
+// Metadata is the provenance information written as comment block before the
+// header, see WithMetadata.
+type Metadata struct {
+	// Exported is the time of the export. It is written in the time zone of
+	// Start.
+	Exported time.Time
+
+	// Start and End are the requested date range.
+	Start time.Time
+	End   time.Time
+
+	// Citation is the text for citing the data.
+	Citation string
+
+	// Note is an optional remark on the exported data, e.g. how it was
+	// processed.
+	Note string
+}
+
+// lines returns the comment lines of the metadata block for the given station
+// names.
+func (m *Metadata) lines(stations []string) []string {
+	lines := []string{
+		"# Exported: " + m.Exported.In(m.Start.Location()).Format(time.RFC3339),
+		"# Date range: " + m.Start.Format("2006-01-02") + " - " + m.End.Format("2006-01-02"),
+		"# Stations: " + strings.Join(stations, ", "),
+	}
+	if m.Citation != "" {
+		lines = append(lines, "# Citation: "+m.Citation)
+	}
+	if m.Note != "" {
+		lines = append(lines, "# Note: "+m.Note)
+	}
+	return lines
 }
 
 // NewWriter returns a new Writer that writes to w.
-func NewWriter(w io.Writer) *Writer {
-	return &Writer{
-		w:   csv.NewWriter(w),
-		pos: make(map[string]int),
+func NewWriter(w io.Writer, options ...Option) *Writer {
+	cw := &Writer{
+		pos:       make(map[string]int),
+		precision: -1,
+	}
+
+	for _, option := range options {
+		option(cw)
+	}
+
+	if cw.w == nil {
+		cw.w = NewRecordWriter(w, cw.quote)
+		cw.out = w
+	}
+
+	return cw
+}
+
+// Option controls some aspects of the Writer.
+type Option func(w *Writer)
+
+// WithFlags returns an option function which adds a companion flag column
+// after each measurement column, e.g. air_t_avg,air_t_avg_flag. The values of
+// the flag column are read from the measurement with the browser.FlagSuffix.
+// Measurements without such a measurement for any station get no flag column.
+// By default flag measurements are omitted.
+func WithFlags() Option {
+	return func(w *Writer) {
+		w.flags = true
+	}
+}
+
+// WithAliases returns an option function which names the columns of the
+// measurements with the given labels by their alias, e.g. air_temperature_avg
+// instead of air_t_avg. Flag columns are named by the alias of their
+// measurement. By default the raw labels are used.
+func WithAliases(aliases map[string]string) Option {
+	return func(w *Writer) {
+		w.aliases = aliases
+	}
+}
+
+// WithPrecision returns an option function which writes values rounded to the
+// given number of decimals. NaN values and flags are written as they are. By
+// default values are written with full precision.
+func WithPrecision(n int) Option {
+	return func(w *Writer) {
+		w.precision = n
+	}
+}
+
+// WithSideBySide returns an option function which writes each station as a
+// block of columns with its own time column next to the other stations,
+// instead of stacking the stations vertically.
+func WithSideBySide() Option {
+	return func(w *Writer) {
+		w.sideBySide = true
+	}
+}
+
+// WithDropEmptyColumns returns an option function which omits the column and
+// unit of measurements whose values are all missing (NaN) for all stations,
+// together with their flag columns. By default all requested measurements are
+// written.
+func WithDropEmptyColumns() Option {
+	return func(w *Writer) {
+		w.dropEmpty = true
+	}
+}
+
+// WithRecordWriter returns an option function for writing the records with
+// the given RecordWriter instead of as CSV, e.g. for writing spreadsheets. The
+// quote mode does not apply.
+func WithRecordWriter(rw RecordWriter) Option {
+	return func(w *Writer) {
+		w.w = rw
+	}
+}
+
+// WithMetadata returns an option function which prepends a block of comment
+// lines, starting with #, containing the given metadata and the names of the
+// exported stations to the header. By default no comment lines are written,
+// so that the output stays machine readable.
+func WithMetadata(m Metadata) Option {
+	return func(w *Writer) {
+		w.metadata = &m
+	}
+}
+
+// WithOrder returns an option function which orders the measurement columns
+// by the given order, falling back to the group and then the label for
+// measurements not listed. By default columns are ordered by the first
+// appearance of their measurement.
+func WithOrder(o browser.MeasurementOrder) Option {
+	return func(w *Writer) {
+		w.order = o
+	}
+}
+
+// WithQuoteMode returns an option function for setting how fields are quoted.
+// By default QuoteMinimal is used.
+func WithQuoteMode(mode QuoteMode) Option {
+	return func(w *Writer) {
+		w.quote = mode
 	}
 }
 
@@ -57,25 +234,50 @@ type stationRange struct {
 	start, end int
 }
 
+// stationKey identifies the rows of a station in the row buffer. The name is
+// not unique among stations, therefore the id is part of the key.
+type stationKey struct {
+	id   int64
+	name string
+}
+
 // Write writes the given browser.TimeSeries as CSV file.
 func (w *Writer) Write(ts browser.TimeSeries) error {
 	if len(ts) == 0 {
 		return browser.ErrDataNotFound
 	}
-	// Sort timeseries by station.
-	sort.Slice(ts, func(i, j int) bool { return ts[i].Station.Name < ts[j].Station.Name })
+	if w.dropEmpty {
+		ts = dropEmpty(ts)
+		if len(ts) == 0 {
+			return w.WriteHeader()
+		}
+	}
+	// Sort timeseries by station. name and by id for stations sharing the same
+	// name.
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].Station.Name == ts[j].Station.Name {
+			return ts[i].Station.ID < ts[j].Station.ID
+		}
+		return ts[i].Station.Name < ts[j].Station.Name
+	})
 
 	w.writeHeaderAndUnits(ts)
 
 	// stationPosMap is map which stores the starting and ending line number of
 	// a station in the row buffer.
-	stationPosMap := make(map[string]*stationRange)
+	stationPosMap := make(map[stationKey]*stationRange)
 
 	for _, m := range ts {
+		// Skip measurements without a column, e.g. flags if not requested.
+		if _, ok := w.pos[m.Label]; !ok {
+			continue
+		}
+
 		// Sort points by timestamp.
 		sort.Slice(m.Points, func(i, j int) bool { return m.Points[i].Timestamp.Before(m.Points[j].Timestamp) })
 
-		row, ok := stationPosMap[m.Station.Name]
+		key := stationKey{m.Station.ID, m.Station.Name}
+		row, ok := stationPosMap[key]
 		if !ok {
 			// Station is not present in the row buffer. For each point append a
 			// new line to the buffer.
@@ -85,63 +287,186 @@ func (w *Writer) Write(ts browser.TimeSeries) error {
 				// Store the staring row number of the current station on the
 				// first processed point.
 				if i == 0 {
-					stationPosMap[m.Station.Name] = &stationRange{start: len(w.rows) - 1}
+					stationPosMap[key] = &stationRange{start: len(w.rows) - 1}
 				}
 
-				stationPosMap[m.Station.Name].end = len(w.rows)
+				stationPosMap[key].end = len(w.rows)
 			}
 			continue
 		}
 
-		// Station is already present in the row buffer.
+		// Station is already present in the row buffer. Its rows are the last
+		// ones of the buffer, since the time series is sorted by station.
 		for i, p := range m.Points {
-			current := row.start + i
-
-			// If measurements of the same station have differenet lengths of
-			// points, it can happen that we overflow the current row buffer so
-			// a newline must be added rather than appending only the value to a
-			// existing one.
-			if len(w.rows) <= current {
-				w.rows = append(w.rows, w.newLine(m, p))
-				stationPosMap[m.Station.Name].end = len(w.rows)
-				continue
-			}
-
-			// Scan each row of the current station and check where to insert or
-			// append the point according to its timestamp.
-			for j := current; j <= row.end; j++ {
-				t, err := time.ParseInLocation(DefaultTimeFormat, w.rows[j][0], browser.Location)
+			// Timestamps of the points are always sorted, therefore the row of
+			// the i-th point cannot be before the i-th row of the station.
+			j := row.start + i
+
+			// Scan the rows of the current station for the row of the point's
+			// timestamp or the position where to insert it.
+			for ; j < row.end; j++ {
+				t, err := time.ParseInLocation(DefaultTimeFormat, w.rows[j][0], p.Timestamp.Location())
 				if err != nil {
 					continue
 				}
-
-				// If the current timestamp of the point is before the current
-				// lines timestamp add it at the current position and shift all
-				// lines by one. Timestamps of the points are always sorted.
-				if p.Timestamp.Before(t) {
-					// insert a row at the given current row number.
-					// https://github.com/golang/go/wiki/SliceTricks#insert
-					w.rows = append(w.rows, []string{})
-					copy(w.rows[j+1:], w.rows[j:])
-					w.rows[j] = w.newLine(m, p)
+				if !p.Timestamp.After(t) {
 					break
 				}
+			}
 
-				if p.Timestamp.Equal(t) {
-					column, ok := w.pos[m.Label]
-					if !ok {
-						break
-					}
-					w.rows[j][column] = fmt.Sprint(p.Value)
-					break
+			if j < row.end {
+				t, err := time.ParseInLocation(DefaultTimeFormat, w.rows[j][0], p.Timestamp.Location())
+				if err == nil && p.Timestamp.Equal(t) {
+					w.rows[j][w.pos[m.Label]] = w.formatValue(m.Label, p.Value)
+					continue
 				}
 			}
+
+			// If measurements of the same station cover different time
+			// ranges, the point has no row yet and one is inserted, shifting
+			// all following lines by one.
+			// https://github.com/golang/go/wiki/SliceTricks#insert
+			w.rows = append(w.rows, nil)
+			copy(w.rows[j+1:], w.rows[j:])
+			w.rows[j] = w.newLine(m, p)
+			row.end++
+		}
+	}
+
+	if w.sideBySide {
+		w.rows = sideBySide(w.rows)
+	}
+
+	return w.writeAll(stationNames(ts))
+}
+
+// stationNames returns the unique names of the stations of the given sorted
+// browser.TimeSeries.
+func stationNames(ts browser.TimeSeries) []string {
+	var names []string
+	for _, m := range ts {
+		if n := len(names); n > 0 && names[n-1] == m.Station.Name {
+			continue
+		}
+		names = append(names, m.Station.Name)
+	}
+	return names
+}
+
+// dropEmpty returns the measurements of the given time series which have at
+// least one value for any station. Flags are kept only together with their
+// measurement.
+func dropEmpty(ts browser.TimeSeries) browser.TimeSeries {
+	values := make(map[string]bool)
+	for _, m := range ts {
+		if values[m.Label] {
+			continue
+		}
+		for _, p := range m.Points {
+			if !math.IsNaN(p.Value) {
+				values[m.Label] = true
+				break
+			}
 		}
 	}
 
+	var res browser.TimeSeries
+	for _, m := range ts {
+		if values[strings.TrimSuffix(m.Label, browser.FlagSuffix)] {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// writeAll writes the metadata block, if requested, followed by the buffered
+// rows.
+func (w *Writer) writeAll(stations []string) error {
+	if w.metadata == nil {
+		return w.w.WriteAll(w.rows)
+	}
+
+	lines := w.metadata.lines(stations)
+	if w.out == nil {
+		comments := make([][]string, 0, len(lines))
+		for _, l := range lines {
+			comments = append(comments, []string{l})
+		}
+		return w.w.WriteAll(append(comments, w.rows...))
+	}
+
+	for _, l := range lines {
+		if _, err := io.WriteString(w.out, l+"\n"); err != nil {
+			return err
+		}
+	}
 	return w.w.WriteAll(w.rows)
 }
 
+// sideBySide rearranges the given rows, consisting of the header, the units
+// and the data rows of all stations one below the other, into blocks of
+// stations placed next to each other. Shorter blocks are padded with empty
+// fields.
+func sideBySide(rows [][]string) [][]string {
+	if len(rows) < 2 {
+		return rows
+	}
+
+	var (
+		stations []string
+		blocks   = make(map[string][][]string)
+	)
+	for _, row := range rows[2:] {
+		name := row[1]
+		if _, ok := blocks[name]; !ok {
+			stations = append(stations, name)
+		}
+		blocks[name] = append(blocks[name], row)
+	}
+
+	width := len(rows[0])
+	height := 0
+	for _, b := range blocks {
+		if len(b) > height {
+			height = len(b)
+		}
+	}
+
+	out := make([][]string, height+2)
+	for _, name := range stations {
+		out[0] = append(out[0], rows[0]...)
+		out[1] = append(out[1], rows[1]...)
+
+		for i := 0; i < height; i++ {
+			if i < len(blocks[name]) {
+				out[i+2] = append(out[i+2], blocks[name][i]...)
+				continue
+			}
+			out[i+2] = append(out[i+2], make([]string, width)...)
+		}
+	}
+
+	return out
+}
+
+// WriteStream writes the measurements of the given iterator as CSV file. The
+// header and the rows depend on all measurements, therefore the iterator is
+// read until io.EOF before anything is written.
+func (w *Writer) WriteStream(it browser.MeasurementIterator) error {
+	ts, err := browser.ReadTimeSeries(it)
+	if err != nil {
+		return err
+	}
+	return w.Write(ts)
+}
+
+// WriteHeader writes only the header and unit rows without any measurement,
+// resulting in a valid but empty CSV file.
+func (w *Writer) WriteHeader() error {
+	w.writeHeaderAndUnits(nil)
+	return w.writeAll(nil)
+}
+
 // newLine creates a new line from the given browser.Measurement.
 func (w *Writer) newLine(m *browser.Measurement, p *browser.Point) []string {
 	length := w.rows[0]
@@ -161,29 +486,96 @@ func (w *Writer) newLine(m *browser.Measurement, p *browser.Point) []string {
 
 	pos, ok := w.pos[m.Label]
 	if ok {
-		line[pos] = fmt.Sprint(p.Value)
+		line[pos] = w.formatValue(m.Label, p.Value)
 	}
 
 	return line
 }
 
+// columnName returns the name of the column of the measurement with the given
+// label.
+func (w *Writer) columnName(label string) string {
+	if alias, ok := w.aliases[label]; ok {
+		return alias
+	}
+	return label
+}
+
+// formatValue formats the given value of the measurement with the given label
+// according to the precision of the writer.
+func (w *Writer) formatValue(label string, v float64) string {
+	if w.precision < 0 || math.IsNaN(v) || strings.HasSuffix(label, browser.FlagSuffix) {
+		return fmt.Sprint(v)
+	}
+	return strconv.FormatFloat(v, 'f', w.precision, 64)
+}
+
 // writeHeaderAndUnits writes the header and unit rows to the line buffer.
 func (w *Writer) writeHeaderAndUnits(ts browser.TimeSeries) {
 	// Write header and empty unit line.
 	w.rows = append(w.rows, []string{"time", "station", "landuse", "elevation", "latitude", "longitude"})
 	w.rows = append(w.rows, []string{"", "", "", "", "", ""})
 
+	// Flag columns are only added for measurements with flags.
+	flagged := make(map[string]bool)
+	// Standard deviations are added next to the average of their measurement.
+	std := make(map[string]*browser.Measurement)
+	labels := make(map[string]bool)
 	for _, m := range ts {
-		_, ok := w.pos[m.Label]
-		if !ok {
-			// Label is not present in the header so we will add it and store
-			// its column position.
-			w.appendToLine(0, m.Label)
-			w.pos[m.Label] = len(w.rows[0]) - 1
+		if strings.HasSuffix(m.Label, browser.FlagSuffix) {
+			flagged[m.Label] = true
+		}
+		if _, ok := std[m.Label]; !ok && strings.HasSuffix(m.Label, stdSuffix) {
+			std[m.Label] = m
+		}
+		labels[m.Label] = true
+	}
+
+	columns := ts
+	if w.order != nil {
+		columns = make(browser.TimeSeries, len(ts))
+		copy(columns, ts)
+		sort.SliceStable(columns, func(i, j int) bool {
+			return w.order.Less(columns[i].Label, columns[j].Label)
+		})
+	}
+
+	for _, m := range columns {
+		// Flag columns are added next to their measurement.
+		if strings.HasSuffix(m.Label, browser.FlagSuffix) {
+			continue
+		}
+		if strings.HasSuffix(m.Label, stdSuffix) && labels[strings.TrimSuffix(m.Label, stdSuffix)+avgSuffix] {
+			continue
+		}
 
-			// Write unit below label.
-			w.appendToLine(1, m.Unit)
+		// Label is present in the header if it was added for another
+		// station.
+		if _, ok := w.pos[m.Label]; ok {
+			continue
 		}
+
+		w.appendColumn(m, flagged)
+		if s, ok := std[strings.TrimSuffix(m.Label, avgSuffix)+stdSuffix]; ok && strings.HasSuffix(m.Label, avgSuffix) {
+			w.appendColumn(s, flagged)
+		}
+	}
+}
+
+// appendColumn adds the column of the given measurement to the header and
+// stores its position, together with its flag column if the measurement has
+// flags.
+func (w *Writer) appendColumn(m *browser.Measurement, flagged map[string]bool) {
+	w.appendToLine(0, w.columnName(m.Label))
+	w.pos[m.Label] = len(w.rows[0]) - 1
+
+	// Write unit below label.
+	w.appendToLine(1, m.Unit)
+
+	if flag := m.Label + browser.FlagSuffix; w.flags && flagged[flag] {
+		w.appendToLine(0, w.columnName(m.Label)+browser.FlagSuffix)
+		w.pos[flag] = len(w.rows[0]) - 1
+		w.appendToLine(1, "")
 	}
 }
 
@@ -5,6 +5,7 @@
 package csv
 
 import (
+	"math"
 	"strings"
 	"testing"
 	"time"
@@ -381,6 +382,672 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestWriteFlags(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		return browser.TimeSeries{
+			testMeasurement("a_avg", "s1", "c", 2),
+			testMeasurement("a_avg"+browser.FlagSuffix, "s1", "", 2),
+			testMeasurement("wind_speed", "s1", "km/h", 2),
+		}
+	}
+
+	testCases := map[string]struct {
+		options []Option
+		want    string
+	}{
+		"without_flags": {
+			nil,
+			`time,station,landuse,elevation,latitude,longitude,a_avg,wind_speed
+,,,,,,c,km/h
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,1
+`,
+		},
+		"with_flags": {
+			[]Option{WithFlags()},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,a_avg_flag,wind_speed
+,,,,,,c,,km/h
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,1,1
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, tc.options...)
+			if err := w.Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteSTD(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		return browser.TimeSeries{
+			testMeasurement("a_avg", "s1", "c", 2),
+			testMeasurement("a_avg"+browser.FlagSuffix, "s1", "", 2),
+			testMeasurement("a_max", "s1", "c", 2),
+			testMeasurement("a_std", "s1", "c", 2),
+			testMeasurement("b_std", "s1", "%", 2),
+		}
+	}
+
+	testCases := map[string]struct {
+		options []Option
+		want    string
+	}{
+		"default": {
+			nil,
+			`time,station,landuse,elevation,latitude,longitude,a_avg,a_std,a_max,b_std
+,,,,,,c,c,c,%
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0,0,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,1,1,1
+`,
+		},
+		"with_flags": {
+			[]Option{WithFlags()},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,a_avg_flag,a_std,a_max,b_std
+,,,,,,c,,c,c,%
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0,0,0,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,1,1,1,1
+`,
+		},
+		"order": {
+			[]Option{WithOrder(browser.MeasurementOrder{"a_max", "a_std"})},
+			`time,station,landuse,elevation,latitude,longitude,a_max,a_avg,a_std,b_std
+,,,,,,c,c,c,%
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0,0,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,1,1,1
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, tc.options...)
+			if err := w.Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteSideBySide(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		s2 := testMeasurement("a_avg", "s2", "c", 3)
+		s2.Station.Elevation = 50
+		return browser.TimeSeries{
+			testMeasurement("a_avg", "s1", "c", 2),
+			s2,
+		}
+	}
+
+	testCases := map[string]struct {
+		options []Option
+		want    string
+	}{
+		"vertical": {
+			nil,
+			`time,station,landuse,elevation,latitude,longitude,a_avg
+,,,,,,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1
+2020-01-01 00:15:00,s2,me_s2,50,3.14159,2.71828,0
+2020-01-01 00:30:00,s2,me_s2,50,3.14159,2.71828,1
+2020-01-01 00:45:00,s2,me_s2,50,3.14159,2.71828,2
+`,
+		},
+		"side_by_side": {
+			[]Option{WithSideBySide()},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,time,station,landuse,elevation,latitude,longitude,a_avg
+,,,,,,c,,,,,,,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,2020-01-01 00:15:00,s2,me_s2,50,3.14159,2.71828,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,2020-01-01 00:30:00,s2,me_s2,50,3.14159,2.71828,1
+,,,,,,,2020-01-01 00:45:00,s2,me_s2,50,3.14159,2.71828,2
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, tc.options...)
+			if err := w.Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteOrder(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		return browser.TimeSeries{
+			testMeasurement("b_avg", "s1", "c", 1),
+			testMeasurement("wind_speed", "s1", "km/h", 1),
+			testMeasurement("a_avg", "s1", "c", 1),
+			testMeasurement("precip_tot", "s1", "mm", 1),
+			testMeasurement("air_rh_avg", "s1", "%", 1),
+			testMeasurement("a_avg"+browser.FlagSuffix, "s1", "", 1),
+			testMeasurement("wind_speed"+browser.FlagSuffix, "s1", "", 1),
+		}
+	}
+
+	testCases := map[string]struct {
+		options []Option
+		want    string
+	}{
+		"appearance": {
+			nil,
+			`time,station,landuse,elevation,latitude,longitude,b_avg,wind_speed,a_avg,precip_tot,air_rh_avg
+,,,,,,c,km/h,c,mm,%
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0,0,0,0
+`,
+		},
+		"custom": {
+			[]Option{WithOrder(browser.MeasurementOrder{"precip_tot", "a_avg"})},
+			`time,station,landuse,elevation,latitude,longitude,precip_tot,a_avg,air_rh_avg,wind_speed,b_avg
+,,,,,,mm,c,%,km/h,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0,0,0,0
+`,
+		},
+		"unknown": {
+			[]Option{WithOrder(browser.MeasurementOrder{"unknown"})},
+			`time,station,landuse,elevation,latitude,longitude,air_rh_avg,wind_speed,precip_tot,a_avg,b_avg
+,,,,,,%,km/h,mm,c,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0,0,0,0
+`,
+		},
+		"flags": {
+			[]Option{WithFlags(), WithOrder(browser.MeasurementOrder{"wind_speed"})},
+			`time,station,landuse,elevation,latitude,longitude,wind_speed,wind_speed_flag,air_rh_avg,precip_tot,a_avg,a_avg_flag,b_avg
+,,,,,,km/h,,%,mm,c,,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0,0,0,0,0,0
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, tc.options...)
+			if err := w.Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteDropEmptyColumns(t *testing.T) {
+	empty := func(label, station string) *browser.Measurement {
+		m := testMeasurement(label, station, "%", 2)
+		for _, p := range m.Points {
+			p.Value = math.NaN()
+		}
+		return m
+	}
+
+	testCases := map[string]struct {
+		in      browser.TimeSeries
+		options []Option
+		want    string
+	}{
+		"keep": {
+			browser.TimeSeries{
+				testMeasurement("a_avg", "s1", "c", 2),
+				empty("b_avg", "s1"),
+				testMeasurement("a_avg", "s2", "c", 2),
+			},
+			nil,
+			`time,station,landuse,elevation,latitude,longitude,a_avg,b_avg
+,,,,,,c,%
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,NaN
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,NaN
+2020-01-01 00:15:00,s2,me_s2,1000,3.14159,2.71828,0,NaN
+2020-01-01 00:30:00,s2,me_s2,1000,3.14159,2.71828,1,NaN
+`,
+		},
+		"drop": {
+			browser.TimeSeries{
+				testMeasurement("a_avg", "s1", "c", 2),
+				empty("b_avg", "s1"),
+				testMeasurement("a_avg", "s2", "c", 2),
+			},
+			[]Option{WithDropEmptyColumns()},
+			`time,station,landuse,elevation,latitude,longitude,a_avg
+,,,,,,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1
+2020-01-01 00:15:00,s2,me_s2,1000,3.14159,2.71828,0
+2020-01-01 00:30:00,s2,me_s2,1000,3.14159,2.71828,1
+`,
+		},
+		"one_station_with_values": {
+			browser.TimeSeries{
+				testMeasurement("a_avg", "s1", "c", 2),
+				testMeasurement("a_avg", "s2", "c", 2),
+				testMeasurement("b_avg", "s2", "%", 2),
+			},
+			[]Option{WithDropEmptyColumns()},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,b_avg
+,,,,,,c,%
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,NaN
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,NaN
+2020-01-01 00:15:00,s2,me_s2,1000,3.14159,2.71828,0,0
+2020-01-01 00:30:00,s2,me_s2,1000,3.14159,2.71828,1,1
+`,
+		},
+		"flags": {
+			browser.TimeSeries{
+				testMeasurement("a_avg", "s1", "c", 2),
+				empty("b_avg", "s1"),
+				testMeasurement("b_avg"+browser.FlagSuffix, "s1", "", 2),
+			},
+			[]Option{WithFlags(), WithDropEmptyColumns()},
+			`time,station,landuse,elevation,latitude,longitude,a_avg
+,,,,,,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1
+`,
+		},
+		"all_empty": {
+			browser.TimeSeries{
+				empty("b_avg", "s1"),
+			},
+			[]Option{WithDropEmptyColumns()},
+			`time,station,landuse,elevation,latitude,longitude
+,,,,,
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, tc.options...)
+			if err := w.Write(tc.in); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteStream(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		return browser.TimeSeries{
+			testMeasurement("a_avg", "s1", "c", 3),
+			testMeasurement("b_avg", "s1", "%", 3),
+			testMeasurement("a_avg", "s2", "c", 2),
+		}
+	}
+
+	var want strings.Builder
+	if err := NewWriter(&want).Write(ts()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got strings.Builder
+	if err := NewWriter(&got).WriteStream(browser.NewMeasurementIterator(ts())); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := cmp.Diff(want.String(), got.String())
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+
+	err := NewWriter(&got).WriteStream(browser.NewMeasurementIterator(nil))
+	if err != browser.ErrDataNotFound {
+		t.Fatalf("got error %v on empty stream, want %v", err, browser.ErrDataNotFound)
+	}
+}
+
+func TestWriteDifferentExtents(t *testing.T) {
+	measurement := func(label, station string, points ...*browser.Point) *browser.Measurement {
+		m := testMeasurement(label, station, "c", 0)
+		m.Points = points
+		return m
+	}
+
+	testCases := map[string]struct {
+		in   browser.TimeSeries
+		want string
+	}{
+		"later_measurement_wider": {
+			browser.TimeSeries{
+				measurement("a_avg", "s1",
+					testPoint("2020-01-01T00:30:00+01:00", 1),
+					testPoint("2020-01-01T00:45:00+01:00", 2),
+				),
+				measurement("b_avg", "s1",
+					testPoint("2020-01-01T00:15:00+01:00", 10),
+					testPoint("2020-01-01T00:30:00+01:00", 11),
+					testPoint("2020-01-01T00:45:00+01:00", 12),
+					testPoint("2020-01-01T01:00:00+01:00", 13),
+				),
+				measurement("a_avg", "s2",
+					testPoint("2020-01-01T00:15:00+01:00", 20),
+				),
+			},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,b_avg
+,,,,,,c,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,NaN,10
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,1,11
+2020-01-01 00:45:00,s1,me_s1,1000,3.14159,2.71828,2,12
+2020-01-01 01:00:00,s1,me_s1,1000,3.14159,2.71828,NaN,13
+2020-01-01 00:15:00,s2,me_s2,1000,3.14159,2.71828,20,NaN
+`,
+		},
+		"overlapping": {
+			browser.TimeSeries{
+				measurement("a_avg", "s1",
+					testPoint("2020-01-01T00:15:00+01:00", 1),
+					testPoint("2020-01-01T00:30:00+01:00", 2),
+					testPoint("2020-01-01T00:45:00+01:00", 3),
+				),
+				measurement("b_avg", "s1",
+					testPoint("2020-01-01T00:30:00+01:00", 10),
+					testPoint("2020-01-01T00:45:00+01:00", 11),
+					testPoint("2020-01-01T01:00:00+01:00", 12),
+				),
+				measurement("a_avg", "s2",
+					testPoint("2020-01-01T00:15:00+01:00", 20),
+				),
+			},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,b_avg
+,,,,,,c,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,1,NaN
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,2,10
+2020-01-01 00:45:00,s1,me_s1,1000,3.14159,2.71828,3,11
+2020-01-01 01:00:00,s1,me_s1,1000,3.14159,2.71828,NaN,12
+2020-01-01 00:15:00,s2,me_s2,1000,3.14159,2.71828,20,NaN
+`,
+		},
+		"disjoint": {
+			browser.TimeSeries{
+				measurement("a_avg", "s1",
+					testPoint("2020-01-01T01:00:00+01:00", 1),
+				),
+				measurement("b_avg", "s1",
+					testPoint("2020-01-01T00:15:00+01:00", 10),
+					testPoint("2020-01-01T00:30:00+01:00", 11),
+				),
+			},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,b_avg
+,,,,,,c,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,NaN,10
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,NaN,11
+2020-01-01 01:00:00,s1,me_s1,1000,3.14159,2.71828,1,NaN
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			if err := NewWriter(&buf).Write(tc.in); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.want, buf.String()); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteSameStationName(t *testing.T) {
+	station := func(id int64) *browser.Measurement {
+		m := testMeasurement("a_avg", "s1", "c", 1)
+		m.Station.ID = id
+		m.Points[0].Value = float64(id)
+		return m
+	}
+
+	want := `time,station,landuse,elevation,latitude,longitude,a_avg
+,,,,,,c
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,1
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,2
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,3
+`
+
+	for _, ts := range []browser.TimeSeries{
+		{station(1), station(2), station(3)},
+		{station(3), station(1), station(2)},
+		{station(2), station(3), station(1)},
+	} {
+		var got strings.Builder
+		if err := NewWriter(&got).Write(ts); err != nil {
+			t.Fatal(err)
+		}
+
+		diff := cmp.Diff(want, got.String())
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestWriteMetadata(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		return browser.TimeSeries{
+			testMeasurement("a_avg", "s2", "c", 1),
+			testMeasurement("a_avg", "s1", "c", 1),
+			testMeasurement("wind_speed", "s1", "km/h", 1),
+		}
+	}
+
+	metadata := Metadata{
+		Exported: time.Date(2021, time.June, 1, 10, 0, 0, 0, time.UTC),
+		Start:    time.Date(2020, time.January, 1, 0, 0, 0, 0, browser.Location),
+		End:      time.Date(2020, time.January, 31, 0, 0, 0, 0, browser.Location),
+		Citation: "We thank Eurac research, for providing the data",
+	}
+
+	withNote := metadata
+	withNote.Note = "trimmed"
+
+	const data = `time,station,landuse,elevation,latitude,longitude,a_avg,wind_speed
+,,,,,,c,km/h
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,0,0
+2020-01-01 00:15:00,s2,me_s2,1000,3.14159,2.71828,0,NaN
+`
+
+	const block = `# Exported: 2021-06-01T11:00:00+01:00
+# Date range: 2020-01-01 - 2020-01-31
+# Stations: s1, s2
+# Citation: We thank Eurac research, for providing the data
+`
+
+	testCases := map[string]struct {
+		options []Option
+		want    string
+	}{
+		"default":           {nil, data},
+		"metadata":          {[]Option{WithMetadata(metadata)}, block + data},
+		"metadata_note":     {[]Option{WithMetadata(withNote)}, block + "# Note: trimmed\n" + data},
+		"metadata_quoteall": {[]Option{WithMetadata(metadata), WithQuoteMode(QuoteAll)}, block + `"time","station","landuse","elevation","latitude","longitude","a_avg","wind_speed"` + "\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, tc.options...)
+			if err := w.Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			got := buf.String()
+			if !strings.HasPrefix(got, tc.want) {
+				t.Fatalf("mismatch (-want +got):\n%s", cmp.Diff(tc.want, got))
+			}
+			if tc.options == nil && strings.Contains(got, "#") {
+				t.Fatalf("got comment lines without metadata:\n%s", got)
+			}
+		})
+	}
+
+	t.Run("header_only", func(t *testing.T) {
+		var buf strings.Builder
+		if err := NewWriter(&buf, WithMetadata(metadata)).WriteHeader(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := strings.Replace(block, "# Stations: s1, s2", "# Stations: ", 1) + "time,station,landuse,elevation,latitude,longitude\n,,,,,\n"
+		if diff := cmp.Diff(want, buf.String()); diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("record_writer", func(t *testing.T) {
+		rw := new(recordBuffer)
+		if err := NewWriter(nil, WithRecordWriter(rw), WithMetadata(metadata)).Write(ts()); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, r := range rw.records[:5] {
+			got = append(got, r[0])
+		}
+		want := append(strings.Split(strings.TrimSuffix(block, "\n"), "\n"), "time")
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// recordBuffer is a RecordWriter keeping the written records.
+type recordBuffer struct {
+	records [][]string
+}
+
+func (b *recordBuffer) WriteAll(records [][]string) error {
+	b.records = append(b.records, records...)
+	return nil
+}
+
+func TestWritePrecision(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		m := testMeasurement("a_avg", "s1", "c", 3)
+		m.Points[0].Value = 7.379999999
+		m.Points[1].Value = math.NaN()
+		m.Points[2].Value = -0.625
+		f := testMeasurement("a_avg"+browser.FlagSuffix, "s1", "", 3)
+		return browser.TimeSeries{m, f}
+	}
+
+	testCases := map[string]struct {
+		options []Option
+		want    string
+	}{
+		"full": {
+			[]Option{WithFlags()},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,a_avg_flag
+,,,,,,c,
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,7.379999999,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,NaN,1
+2020-01-01 00:45:00,s1,me_s1,1000,3.14159,2.71828,-0.625,2
+`,
+		},
+		"two": {
+			[]Option{WithFlags(), WithPrecision(2)},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,a_avg_flag
+,,,,,,c,
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,7.38,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,NaN,1
+2020-01-01 00:45:00,s1,me_s1,1000,3.14159,2.71828,-0.62,2
+`,
+		},
+		"zero": {
+			[]Option{WithFlags(), WithPrecision(0)},
+			`time,station,landuse,elevation,latitude,longitude,a_avg,a_avg_flag
+,,,,,,c,
+2020-01-01 00:15:00,s1,me_s1,1000,3.14159,2.71828,7,0
+2020-01-01 00:30:00,s1,me_s1,1000,3.14159,2.71828,NaN,1
+2020-01-01 00:45:00,s1,me_s1,1000,3.14159,2.71828,-1,2
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, tc.options...)
+			if err := w.Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteAliases(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		return browser.TimeSeries{
+			testMeasurement("nr_up_sw_avg", "s1", "W/m2", 1),
+			testMeasurement("nr_up_sw_avg"+browser.FlagSuffix, "s1", "", 1),
+			testMeasurement("a_avg", "s1", "c", 1),
+		}
+	}
+	aliases := map[string]string{"nr_up_sw_avg": "shortwave_radiation_incoming_avg"}
+
+	testCases := map[string]struct {
+		options []Option
+		header  string
+	}{
+		"raw":         {[]Option{WithFlags()}, "time,station,landuse,elevation,latitude,longitude,nr_up_sw_avg,nr_up_sw_avg_flag,a_avg\n"},
+		"aliased":     {[]Option{WithFlags(), WithAliases(aliases)}, "time,station,landuse,elevation,latitude,longitude,shortwave_radiation_incoming_avg,shortwave_radiation_incoming_avg_flag,a_avg\n"},
+		"empty":       {[]Option{WithAliases(map[string]string{})}, "time,station,landuse,elevation,latitude,longitude,nr_up_sw_avg,a_avg\n"},
+		"aliased_raw": {[]Option{WithAliases(aliases)}, "time,station,landuse,elevation,latitude,longitude,shortwave_radiation_incoming_avg,a_avg\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf strings.Builder
+			w := NewWriter(&buf, tc.options...)
+			if err := w.Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buf.String(); !strings.HasPrefix(got, tc.header) {
+				t.Fatalf("got %q, want header %q", got, tc.header)
+			}
+		})
+	}
+}
+
 func testMeasurement(label, station, unit string, n int) *browser.Measurement {
 	m := &browser.Measurement{
 		Label: label,
@@ -27,34 +27,112 @@
 package csvf
 
 import (
-	"encoding/csv"
-	"errors"
 	"fmt"
 	"io"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/encoding/csv"
 )
 
 // DefaultTimeFormat defines the default format to timestamp in the CSV output.
 const DefaultTimeFormat = "2006-01-02 15:04:05"
 
-// Writer writes a browser.TimeSeries as a friendly CSV file. It wraps a default
-// csv.Writer.
+// header are the names of the vertical header rows.
+var header = []string{"station", "landuse", "latitude", "longitude", "elevation", "parameter", "depth", "aggregation", "unit"}
+
+// Writer writes a browser.TimeSeries as a friendly CSV file. It wraps a
+// csv.RecordWriter.
 type Writer struct {
-	w *csv.Writer
+	w csv.RecordWriter
 
 	// rows is used as a buffer holding all rows for appending values.
 	rows [][]string
+
+	// quote determines how fields are quoted.
+	quote csv.QuoteMode
+
+	// landuse translates the landuse code of a station into a label. If nil
+	// the raw code is written.
+	landuse func(code string) string
+
+	// order determines the order of the measurements of a station if set.
+	order browser.MeasurementOrder
+
+	// byDepth determines if the measurements of a station are ordered by
+	// parameter and depth.
+	byDepth bool
+
+	// precision is the number of decimals of values. If negative values are
+	// written with full precision.
+	precision int
 }
 
 // NewWriter returns a new Writer that writes too w.
-func NewWriter(w io.Writer) *Writer {
-	return &Writer{
-		w: csv.NewWriter(w),
+func NewWriter(w io.Writer, options ...Option) *Writer {
+	cw := &Writer{
+		precision: -1,
+	}
+
+	for _, option := range options {
+		option(cw)
+	}
+
+	cw.w = csv.NewRecordWriter(w, cw.quote)
+
+	return cw
+}
+
+// Option controls some aspects of the Writer.
+type Option func(w *Writer)
+
+// WithQuoteMode returns an option function for setting how fields are quoted.
+// By default csv.QuoteMinimal is used.
+func WithQuoteMode(mode csv.QuoteMode) Option {
+	return func(w *Writer) {
+		w.quote = mode
+	}
+}
+
+// WithLanduseLabels returns an option function which writes the landuse of a
+// station as the label returned by the given function instead of the raw code,
+// e.g. "Meadows" instead of "me".
+func WithLanduseLabels(label func(code string) string) Option {
+	return func(w *Writer) {
+		w.landuse = label
+	}
+}
+
+// WithOrder returns an option function which orders the measurement columns
+// of each station by the given order, falling back to the group and then the
+// label for measurements not listed. By default the order of the time series
+// is kept.
+func WithOrder(o browser.MeasurementOrder) Option {
+	return func(w *Writer) {
+		w.order = o
+	}
+}
+
+// WithDepthOrder returns an option function which orders the measurement
+// columns of each station by parameter and then by depth, so that e.g. the soil
+// temperatures of a profile follow each other from top to bottom. It takes
+// precedence over WithOrder.
+func WithDepthOrder() Option {
+	return func(w *Writer) {
+		w.byDepth = true
+	}
+}
+
+// WithPrecision returns an option function which writes values rounded to the
+// given number of decimals. NaN values and flags are written as they are. By
+// default values are written with full precision.
+func WithPrecision(n int) Option {
+	return func(w *Writer) {
+		w.precision = n
 	}
 }
 
@@ -64,16 +142,60 @@ func (w *Writer) Write(ts browser.TimeSeries) error {
 		return browser.ErrDataNotFound
 	}
 
-	// Sort time series by station.
-	sort.Slice(ts, func(i, j int) bool { return ts[i].Station.Name < ts[j].Station.Name })
+	// Sort time series by station. name and by id for stations sharing the same
+	// name. If an order is given the measurements of a station are sorted by
+	// it.
+	sort.SliceStable(ts, func(i, j int) bool {
+		if ts[i].Station.Name != ts[j].Station.Name {
+			return ts[i].Station.Name < ts[j].Station.Name
+		}
+		if ts[i].Station.ID != ts[j].Station.ID {
+			return ts[i].Station.ID < ts[j].Station.ID
+		}
+		switch {
+		case w.byDepth:
+			return lessByDepth(ts[i], ts[j])
+		case w.order != nil:
+			return w.order.Less(ts[i].Label, ts[j].Label)
+		}
+		return false
+	})
 
-	w.writeHeader("station", "landuse", "latitude", "longitude", "elevation", "parameter", "depth", "aggregation", "unit")
+	w.writeHeader(header...)
+
+	// Measurements may cover different time ranges, therefore a row is
+	// written for each timestamp of any measurement, ordered by time. rows
+	// maps the timestamps to the index of their row.
+	var (
+		times []time.Time
+		rows  = make(map[int64]int)
+	)
+	for _, m := range ts {
+		for _, p := range m.Points {
+			if _, ok := rows[p.Timestamp.UnixNano()]; !ok {
+				rows[p.Timestamp.UnixNano()] = 0
+				times = append(times, p.Timestamp)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
 
 	// maxColumns is the length of the time series plus the header.
 	maxColumns := len(ts) + 1
+	for _, t := range times {
+		row := make([]string, maxColumns)
+		for j := 0; j < maxColumns; j++ {
+			row[j] = "NaN"
+		}
+		row[0] = t.Format(DefaultTimeFormat)
+
+		rows[t.UnixNano()] = len(w.rows)
+		w.appendRow(row)
+	}
+
 	for k, m := range ts {
 		w.appendToRow(0, m.Station.Name)
-		w.appendToRow(1, m.Station.Landuse)
+		w.appendToRow(1, w.landuseLabel(m.Station.Landuse))
 		w.appendToRow(2, fmt.Sprint(m.Station.Latitude))
 		w.appendToRow(3, fmt.Sprint(m.Station.Longitude))
 		w.appendToRow(4, fmt.Sprint(m.Station.Elevation))
@@ -82,49 +204,51 @@ func (w *Writer) Write(ts browser.TimeSeries) error {
 		w.appendToRow(7, m.Aggregation)
 		w.appendToRow(8, m.Unit)
 
-		// Sort points by timestamp.
-		sort.Slice(m.Points, func(i, j int) bool { return m.Points[i].Timestamp.Before(m.Points[j].Timestamp) })
-
-		for i, p := range m.Points {
-			current := 9 + i
-
-			// For the first measurement or if the current measurement has more
-			// points than previous ones, create a new row and write the
-			// timestamp and the value at the specific column.
-			if k == 0 || len(w.rows) <= current {
-				row := make([]string, maxColumns)
-				for j := 0; j < maxColumns; j++ {
-					row[j] = "NaN"
-				}
-
-				row[0] = p.Timestamp.Format(DefaultTimeFormat)
-				row[k+1] = fmt.Sprint(p.Value)
-				w.appendRow(row)
-				continue
-			}
-
-			t, err := time.ParseInLocation(DefaultTimeFormat, w.rows[current][0], browser.Location)
-			if err != nil {
-				return err
-			}
+		// Add the values to the rows of their timestamps at the column of
+		// the measurement.
+		for _, p := range m.Points {
+			w.rows[rows[p.Timestamp.UnixNano()]][k+1] = w.formatValue(m.Label, p.Value)
+		}
+	}
 
-			// Check if the timestamp of the current row is equal to the
-			// timestamp of the point. If not means that the measurements do not
-			// have a continuous time range. This is currently not supported and
-			// will through an error.
-			// TODO: add support for non continuous time ranges.
-			if !p.Timestamp.Equal(t) {
-				return errors.New("not continuous timerange")
-			}
+	return w.w.WriteAll(w.rows)
+}
 
-			// Add value to the current row at the given column.
-			w.rows[current][k+1] = fmt.Sprint(p.Value)
-		}
+// WriteStream writes the measurements of the given iterator as friendly CSV file. The
+// header and the rows depend on all measurements, therefore the iterator is
+// read until io.EOF before anything is written.
+func (w *Writer) WriteStream(it browser.MeasurementIterator) error {
+	ts, err := browser.ReadTimeSeries(it)
+	if err != nil {
+		return err
 	}
+	return w.Write(ts)
+}
 
+// WriteHeader writes only the vertical header without any measurement,
+// resulting in a valid but empty CSV file.
+func (w *Writer) WriteHeader() error {
+	w.writeHeader(header...)
 	return w.w.WriteAll(w.rows)
 }
 
+// landuseLabel returns the label of the given landuse code.
+// formatValue formats the given value of the measurement with the given label
+// according to the precision of the writer.
+func (w *Writer) formatValue(label string, v float64) string {
+	if w.precision < 0 || math.IsNaN(v) || strings.HasSuffix(label, browser.FlagSuffix) {
+		return fmt.Sprint(v)
+	}
+	return strconv.FormatFloat(v, 'f', w.precision, 64)
+}
+
+func (w *Writer) landuseLabel(code string) string {
+	if w.landuse == nil {
+		return code
+	}
+	return w.landuse(code)
+}
+
 // writeHeader writes the given names in vertical order, line by line.
 func (w *Writer) writeHeader(names ...string) {
 	for _, n := range names {
@@ -159,6 +283,18 @@ func name(m *browser.Measurement) string {
 	return strings.ReplaceAll(m.Label, "_"+m.Aggregation, "")
 }
 
+// lessByDepth reports whether measurement a is written before b if ordered by
+// parameter and then by depth.
+func lessByDepth(a, b *browser.Measurement) bool {
+	if na, nb := name(a), name(b); na != nb {
+		return na < nb
+	}
+	if a.Depth != b.Depth {
+		return a.Depth < b.Depth
+	}
+	return a.Label < b.Label
+}
+
 // depth will return the depth as string.
 func depth(d int64) string {
 	if d == 0 {
@@ -6,10 +6,13 @@ package csvf
 
 import (
 	"bytes"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/encoding/csv"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -125,6 +128,31 @@ unit,c,b,a
 2020-01-01 00:45:00,2,2,2
 2020-01-01 01:00:00,3,NaN,3
 2020-01-01 01:15:00,4,NaN,NaN
+`,
+		},
+		"two_with_different_ranges": {
+			browser.TimeSeries{
+				testMeasurement("a_avg", "s1", "c", 3),
+				func() *browser.Measurement {
+					m := testMeasurement("a_avg", "s2", "c", 5)
+					m.Points = m.Points[2:]
+					return m
+				}(),
+			},
+			`station,s1,s2
+landuse,me_s1,me_s2
+latitude,3.14159,3.14159
+longitude,2.71828,2.71828
+elevation,1000,1000
+parameter,a,a
+depth,,
+aggregation,avg,avg
+unit,c,c
+2020-01-01 00:15:00,0,NaN
+2020-01-01 00:30:00,1,NaN
+2020-01-01 00:45:00,2,2
+2020-01-01 01:00:00,NaN,3
+2020-01-01 01:15:00,NaN,4
 `,
 		},
 	}
@@ -143,6 +171,62 @@ unit,c,b,a
 	}
 }
 
+func TestWriteQuoteAll(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithQuoteMode(csv.QuoteAll))
+	if err := w.Write(browser.TimeSeries{testMeasurement("a_avg", "s1", "c", 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `"station","s1"
+"landuse","me_s1"
+"latitude","3.14159"
+"longitude","2.71828"
+"elevation","1000"
+"parameter","a"
+"depth",""
+"aggregation","avg"
+"unit","c"
+"2020-01-01 00:15:00","0"
+`
+	diff := cmp.Diff(want, buf.String())
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWritePrecision(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		m := testMeasurement("a_avg", "s1", "c", 3)
+		m.Points[0].Value = 7.379999999
+		m.Points[1].Value = math.NaN()
+		m.Points[2].Value = 1.005
+		return browser.TimeSeries{m}
+	}
+
+	testCases := map[string]struct {
+		options []Option
+		values  string
+	}{
+		"full":  {nil, "2020-01-01 00:15:00,7.379999999\n2020-01-01 00:30:00,NaN\n2020-01-01 00:45:00,1.005\n"},
+		"one":   {[]Option{WithPrecision(1)}, "2020-01-01 00:15:00,7.4\n2020-01-01 00:30:00,NaN\n2020-01-01 00:45:00,1.0\n"},
+		"three": {[]Option{WithPrecision(3)}, "2020-01-01 00:15:00,7.380\n2020-01-01 00:30:00,NaN\n2020-01-01 00:45:00,1.005\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewWriter(&buf, tc.options...).Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasSuffix(buf.String(), "unit,c\n"+tc.values) {
+				t.Fatalf("got %q, want values %q", buf.String(), tc.values)
+			}
+		})
+	}
+}
+
 func testMeasurement(label, station, unit string, n int) *browser.Measurement {
 	m := &browser.Measurement{
 		Label: label,
@@ -169,3 +253,159 @@ func testMeasurement(label, station, unit string, n int) *browser.Measurement {
 
 	return m
 }
+
+func TestWriteDepthOrder(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		var ts browser.TimeSeries
+		for _, m := range []struct {
+			label string
+			depth int64
+		}{
+			{"st_20_avg", 20},
+			{"air_t_avg", 0},
+			{"swc_bk_05_avg", 5},
+			{"st_50_avg", 50},
+			{"st_05_avg", 5},
+			{"swc_bk_02_avg", 2},
+			{"st_02_avg", 2},
+		} {
+			tm := testMeasurement(m.label, "s1", "c", 1)
+			tm.Depth = m.depth
+			ts = append(ts, tm)
+		}
+		return ts
+	}
+
+	testCases := map[string]struct {
+		options []Option
+		want    string
+	}{
+		"default": {
+			nil,
+			`station,s1,s1,s1,s1,s1,s1,s1
+landuse,me_s1,me_s1,me_s1,me_s1,me_s1,me_s1,me_s1
+latitude,3.14159,3.14159,3.14159,3.14159,3.14159,3.14159,3.14159
+longitude,2.71828,2.71828,2.71828,2.71828,2.71828,2.71828,2.71828
+elevation,1000,1000,1000,1000,1000,1000,1000
+parameter,st,air_t,swc_bk,st,st,swc_bk,st
+depth,20,,5,50,5,2,2
+aggregation,avg,avg,avg,avg,avg,avg,avg
+unit,c,c,c,c,c,c,c
+2020-01-01 00:15:00,0,0,0,0,0,0,0
+`,
+		},
+		"depth": {
+			[]Option{WithDepthOrder()},
+			`station,s1,s1,s1,s1,s1,s1,s1
+landuse,me_s1,me_s1,me_s1,me_s1,me_s1,me_s1,me_s1
+latitude,3.14159,3.14159,3.14159,3.14159,3.14159,3.14159,3.14159
+longitude,2.71828,2.71828,2.71828,2.71828,2.71828,2.71828,2.71828
+elevation,1000,1000,1000,1000,1000,1000,1000
+parameter,air_t,st,st,st,st,swc_bk,swc_bk
+depth,,2,5,20,50,2,5
+aggregation,avg,avg,avg,avg,avg,avg,avg
+unit,c,c,c,c,c,c,c
+2020-01-01 00:15:00,0,0,0,0,0,0,0
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewWriter(&buf, tc.options...).Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteLanduseLabels(t *testing.T) {
+	labels := map[string]string{"me_s1": "Wiese"}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithLanduseLabels(func(code string) string { return labels[code] }))
+	if err := w.Write(browser.TimeSeries{testMeasurement("a_avg", "s1", "c", 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `station,s1
+landuse,Wiese
+latitude,3.14159
+longitude,2.71828
+elevation,1000
+parameter,a
+depth,
+aggregation,avg
+unit,c
+2020-01-01 00:15:00,0
+`
+	diff := cmp.Diff(want, buf.String())
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteOrder(t *testing.T) {
+	ts := func() browser.TimeSeries {
+		return browser.TimeSeries{
+			testMeasurement("b_avg", "s1", "c", 1),
+			testMeasurement("a_avg", "s1", "c", 1),
+			testMeasurement("air_rh_avg", "s1", "%", 1),
+			testMeasurement("precip_tot", "s1", "mm", 1),
+		}
+	}
+
+	testCases := map[string]struct {
+		order browser.MeasurementOrder
+		want  string
+	}{
+		"custom": {
+			browser.MeasurementOrder{"precip_tot", "b_avg"},
+			`station,s1,s1,s1,s1
+landuse,me_s1,me_s1,me_s1,me_s1
+latitude,3.14159,3.14159,3.14159,3.14159
+longitude,2.71828,2.71828,2.71828,2.71828
+elevation,1000,1000,1000,1000
+parameter,precip_tot,b,air_rh,a
+depth,,,,
+aggregation,avg,avg,avg,avg
+unit,mm,c,%,c
+2020-01-01 00:15:00,0,0,0,0
+`,
+		},
+		"unknown": {
+			browser.MeasurementOrder{"unknown"},
+			`station,s1,s1,s1,s1
+landuse,me_s1,me_s1,me_s1,me_s1
+latitude,3.14159,3.14159,3.14159,3.14159
+longitude,2.71828,2.71828,2.71828,2.71828
+elevation,1000,1000,1000,1000
+parameter,air_rh,precip_tot,a,b
+depth,,,,
+aggregation,avg,avg,avg,avg
+unit,%,mm,c,c
+2020-01-01 00:15:00,0,0,0,0
+`,
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewWriter(&buf, WithOrder(tc.order)).Write(ts()); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := cmp.Diff(tc.want, buf.String())
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package ndjson writes time series as newline delimited JSON (NDJSON), also
+// known as JSON Lines.
+//
+// Each point is written as a JSON object on a line of its own, e.g.:
+//
+//	{"station":"b1","label":"air_t_avg","timestamp":"2020-01-01T00:15:00+01:00","value":1.5,"unit":"deg c"}
+//	{"station":"b1","label":"air_t_avg","timestamp":"2020-01-01T00:30:00+01:00","value":1.6,"unit":"deg c"}
+//
+// Missing values (NaN) cannot be represented in JSON and are skipped, so each
+// line holds a value.
+package ndjson
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"time"
+
+	"github.com/euracresearch/browser"
+)
+
+// ContentType is the media type of NDJSON files.
+const ContentType = "application/x-ndjson"
+
+// Writer writes a browser.TimeSeries as NDJSON.
+type Writer struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	bw := bufio.NewWriter(w)
+	return &Writer{
+		w:   bw,
+		enc: json.NewEncoder(bw),
+	}
+}
+
+// point is a single line of the output.
+type point struct {
+	Station   string    `json:"station"`
+	Label     string    `json:"label"`
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Unit      string    `json:"unit"`
+}
+
+// Write writes the points of the given browser.TimeSeries in the order of its
+// measurements.
+func (w *Writer) Write(ts browser.TimeSeries) error {
+	if len(ts) == 0 {
+		return browser.ErrDataNotFound
+	}
+	return w.WriteStream(browser.NewMeasurementIterator(ts))
+}
+
+// WriteStream writes the points of the measurements of the given iterator.
+// Each measurement is written as soon as it is read, so the series is never
+// held in memory as a whole.
+func (w *Writer) WriteStream(it browser.MeasurementIterator) error {
+	var n int
+	for {
+		m, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		n++
+
+		if err := w.writeMeasurement(m); err != nil {
+			return err
+		}
+	}
+
+	if n == 0 {
+		return browser.ErrDataNotFound
+	}
+	return nil
+}
+
+// WriteHeader writes nothing, since an empty file is valid NDJSON without any
+// point.
+func (w *Writer) WriteHeader() error {
+	return nil
+}
+
+// writeMeasurement writes a line for each point of the given measurement,
+// skipping missing values.
+func (w *Writer) writeMeasurement(m *browser.Measurement) error {
+	var station string
+	if m.Station != nil {
+		station = m.Station.Name
+	}
+
+	for _, p := range m.Points {
+		if math.IsNaN(p.Value) {
+			continue
+		}
+
+		err := w.enc.Encode(point{
+			Station:   station,
+			Label:     m.Label,
+			Timestamp: p.Timestamp,
+			Value:     p.Value,
+			Unit:      m.Unit,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.w.Flush()
+}
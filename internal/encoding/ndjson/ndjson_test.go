@@ -0,0 +1,100 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package ndjson
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWrite(t *testing.T) {
+	ts := browser.TimeSeries{
+		&browser.Measurement{
+			Label:   "air_t_avg",
+			Unit:    "deg c",
+			Station: &browser.Station{ID: 1, Name: "b1"},
+			Points: []*browser.Point{
+				{Timestamp: time.Date(2020, 1, 1, 0, 15, 0, 0, browser.Location), Value: 1.5},
+				{Timestamp: time.Date(2020, 1, 1, 0, 30, 0, 0, browser.Location), Value: math.NaN()},
+				{Timestamp: time.Date(2020, 1, 1, 0, 45, 0, 0, browser.Location), Value: -0.25},
+			},
+		},
+		&browser.Measurement{
+			Label:   "air_rh_avg",
+			Unit:    "%",
+			Station: &browser.Station{ID: 2, Name: "p2"},
+			Points: []*browser.Point{
+				{Timestamp: time.Date(2020, 1, 1, 0, 15, 0, 0, browser.Location), Value: math.NaN()},
+				{Timestamp: time.Date(2020, 1, 1, 0, 30, 0, 0, browser.Location), Value: 80},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Write(ts); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+
+	// One line per non NaN point.
+	want := []string{
+		`{"station":"b1","label":"air_t_avg","timestamp":"2020-01-01T00:15:00+01:00","value":1.5,"unit":"deg c"}`,
+		`{"station":"b1","label":"air_t_avg","timestamp":"2020-01-01T00:45:00+01:00","value":-0.25,"unit":"deg c"}`,
+		`{"station":"p2","label":"air_rh_avg","timestamp":"2020-01-01T00:30:00+01:00","value":80,"unit":"%"}`,
+	}
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	testCases := map[string]func(w *Writer) error{
+		"Write": func(w *Writer) error {
+			return w.Write(nil)
+		},
+		"WriteStream": func(w *Writer) error {
+			return w.WriteStream(browser.NewMeasurementIterator(nil))
+		},
+	}
+
+	for k, write := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := write(NewWriter(&buf)); !errors.Is(err, browser.ErrDataNotFound) {
+				t.Fatalf("got error %v, want %v", err, browser.ErrDataNotFound)
+			}
+			if buf.Len() != 0 {
+				t.Fatalf("got output %q, want none", buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteOnlyNaN(t *testing.T) {
+	ts := browser.TimeSeries{
+		&browser.Measurement{
+			Label:   "air_t_avg",
+			Station: &browser.Station{Name: "b1"},
+			Points: []*browser.Point{
+				{Timestamp: time.Date(2020, 1, 1, 0, 15, 0, 0, browser.Location), Value: math.NaN()},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Write(ts); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("got output %q, want none", buf.String())
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package xlsx writes records as Office Open XML spreadsheet (XLSX) files.
+//
+// Each file consists of a single worksheet with one row per record. Fields
+// which are numbers are written as numeric cells, all others as inline
+// strings. Empty fields and missing values (NaN) are written as empty cells.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+)
+
+// ContentType is the media type of XLSX files.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// RecordWriter writes records as XLSX file. It implements csv.RecordWriter.
+type RecordWriter struct {
+	w io.Writer
+}
+
+// NewRecordWriter returns a RecordWriter writing to w.
+func NewRecordWriter(w io.Writer) *RecordWriter {
+	return &RecordWriter{w: w}
+}
+
+// The static parts of a workbook with a single worksheet.
+const (
+	contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+
+	rels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	workbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Data" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+
+	workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+)
+
+// WriteAll writes the given records as a complete XLSX file.
+func (rw *RecordWriter) WriteAll(records [][]string) error {
+	z := zip.NewWriter(rw.w)
+
+	for _, f := range []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	} {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return err
+		}
+	}
+
+	fw, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if err := writeSheet(fw, records); err != nil {
+		return err
+	}
+
+	return z.Close()
+}
+
+// writeSheet writes the worksheet containing the given records.
+func writeSheet(w io.Writer, records [][]string) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, record := range records {
+		row := strconv.Itoa(i + 1)
+		bw.WriteString(`<row r="` + row + `">`)
+		for j, field := range record {
+			ref := columnName(j) + row
+
+			f, err := strconv.ParseFloat(field, 64)
+			switch {
+			case field == "", err == nil && math.IsNaN(f):
+				continue
+			case err == nil && !math.IsInf(f, 0):
+				bw.WriteString(`<c r="` + ref + `"><v>` + field + `</v></c>`)
+			default:
+				bw.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+				if err := xml.EscapeText(bw, []byte(field)); err != nil {
+					return err
+				}
+				bw.WriteString(`</t></is></c>`)
+			}
+		}
+		bw.WriteString(`</row>`)
+	}
+	bw.WriteString(`</sheetData></worksheet>`)
+
+	return bw.Flush()
+}
+
+// columnName returns the name of the column with the given zero based index,
+// e.g. A for 0 and AA for 26.
+func columnName(i int) string {
+	var name []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = append([]byte{byte('A' + (i-1)%26)}, name...)
+	}
+	return string(name)
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteAll(t *testing.T) {
+	records := [][]string{
+		{"time", "station", "a&b"},
+		{"", "", "°C"},
+		{"2020-01-01 00:15:00", "s1", "1.5"},
+		{"2020-01-01 00:30:00", "s1", "NaN"},
+	}
+
+	var buf bytes.Buffer
+	if err := NewRecordWriter(&buf).WriteAll(records); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing part %q", name)
+		}
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">time</t></is></c><c r="B1" t="inlineStr"><is><t xml:space="preserve">station</t></is></c><c r="C1" t="inlineStr"><is><t xml:space="preserve">a&amp;b</t></is></c></row>` +
+		`<row r="2"><c r="C2" t="inlineStr"><is><t xml:space="preserve">°C</t></is></c></row>` +
+		`<row r="3"><c r="A3" t="inlineStr"><is><t xml:space="preserve">2020-01-01 00:15:00</t></is></c><c r="B3" t="inlineStr"><is><t xml:space="preserve">s1</t></is></c><c r="C3"><v>1.5</v></c></row>` +
+		`<row r="4"><c r="A4" t="inlineStr"><is><t xml:space="preserve">2020-01-01 00:30:00</t></is></c><c r="B4" t="inlineStr"><is><t xml:space="preserve">s1</t></is></c></row>` +
+		`</sheetData></worksheet>`
+	if diff := cmp.Diff(want, files["xl/worksheets/sheet1.xml"]); diff != "" {
+		t.Errorf("sheet mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	testCases := map[int]string{
+		0:   "A",
+		1:   "B",
+		25:  "Z",
+		26:  "AA",
+		27:  "AB",
+		51:  "AZ",
+		52:  "BA",
+		701: "ZZ",
+		702: "AAA",
+	}
+
+	for in, want := range testCases {
+		if got := columnName(in); got != want {
+			t.Errorf("columnName(%d): got %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/euracresearch/browser"
+)
+
+// denier is implemented by backends hiding measurements from all users.
+type denier interface {
+	// DeniedMeasurements returns the currently hidden measurements.
+	DeniedMeasurements() []string
+}
+
+// denyListValidator is implemented by backends which can validate a deny list
+// file before it is applied.
+type denyListValidator interface {
+	// ValidateDenyList reads a candidate deny list file and returns its
+	// measurement names and the problems found.
+	ValidateDenyList(r io.Reader) ([]string, []string, error)
+}
+
+// maxDenyListSize is the maximum size of a candidate deny list file.
+const maxDenyListSize = 1 << 20
+
+// handleAccessValidate validates a candidate deny list file, either uploaded as
+// multipart form field "file" or sent as request body, the same way as the
+// backend loads it, without applying it. The response lists the measurement
+// names read and the problems found, so that typos are caught before the file
+// replaces the loaded one.
+func (h *Handler) handleAccessValidate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apiError(w, r, errors.New("Expected POST request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		v, ok := h.db.(denyListValidator)
+		if !ok {
+			apiError(w, r, errors.New("the database does not support deny lists"), http.StatusNotImplemented)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxDenyListSize)
+		var body io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				apiError(w, r, err, http.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			body = f
+		}
+
+		names, problems, err := v.ValidateDenyList(body)
+		if err != nil {
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		resp := struct {
+			Valid        bool     `json:"valid"`
+			Measurements []string `json:"measurements"`
+			Errors       []string `json:"errors"`
+		}{
+			Valid:        len(problems) == 0,
+			Measurements: names,
+			Errors:       problems,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("access: %v", err)
+		}
+	}
+}
+
+// handleAccess returns the currently loaded access configuration as JSON, so
+// that it can be reviewed without access to the server: the roles, the
+// measurements hidden by the deny list of the backend, which reflects its
+// reloads, and the default export format of each role. The configuration
+// contains no secrets.
+func (h *Handler) handleAccess() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(w, r, errors.New("Expected GET request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp := struct {
+			Roles              []browser.Role          `json:"roles"`
+			DeniedMeasurements []string                `json:"deniedMeasurements"`
+			DefaultFormats     map[browser.Role]string `json:"defaultFormats"`
+		}{
+			Roles:              browser.Roles,
+			DeniedMeasurements: []string{},
+			DefaultFormats:     make(map[browser.Role]string),
+		}
+
+		if d, ok := h.db.(denier); ok {
+			if names := d.DeniedMeasurements(); names != nil {
+				resp.DeniedMeasurements = names
+			}
+		}
+
+		for role, format := range h.formats {
+			if format == "" {
+				format = "csv"
+			}
+			resp.DefaultFormats[role] = format
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("access: %v", err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleAccess(t *testing.T) {
+	denied := []string{"wind_speed_avg"}
+	h := NewHandler(
+		WithDatabase(&mock.Database{
+			DeniedMeasurementsFn: func() []string { return denied },
+		}),
+		WithDefaultFormats(map[browser.Role]string{
+			browser.FullAccess: "grouped-json",
+			browser.Public:     "",
+		}),
+	)
+
+	get := func(t *testing.T, method string, role browser.Role) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, "/api/v1/access", nil)
+		req = req.WithContext(withCTX(role))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	decode := func(t *testing.T, resp *http.Response) map[string]interface{} {
+		t.Helper()
+		defer resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("got unexpected status code: %d, want %d", got, want)
+		}
+		var got map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	for _, role := range []browser.Role{browser.Public, browser.External} {
+		if got, want := get(t, http.MethodGet, role).StatusCode, http.StatusNotFound; got != want {
+			t.Fatalf("%s: got unexpected status code: %d, want %d", role, got, want)
+		}
+	}
+	if got, want := get(t, http.MethodPost, browser.FullAccess).StatusCode, http.StatusMethodNotAllowed; got != want {
+		t.Fatalf("POST: got unexpected status code: %d, want %d", got, want)
+	}
+
+	want := map[string]interface{}{
+		"roles":              []interface{}{"Public", "External", "FullAccess"},
+		"deniedMeasurements": []interface{}{"wind_speed_avg"},
+		"defaultFormats":     map[string]interface{}{"FullAccess": "grouped-json", "Public": "csv"},
+	}
+	if diff := cmp.Diff(want, decode(t, get(t, http.MethodGet, browser.FullAccess))); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// A reloaded deny list must be returned on the next request.
+	denied = []string{"air_t_avg", "wind_dir"}
+	want["deniedMeasurements"] = []interface{}{"air_t_avg", "wind_dir"}
+	if diff := cmp.Diff(want, decode(t, get(t, http.MethodGet, browser.FullAccess))); diff != "" {
+		t.Fatalf("mismatch after reload (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleAccessValidate(t *testing.T) {
+	var applied bool
+	h := NewHandler(
+		WithDatabase(&mock.Database{
+			DeniedMeasurementsFn: func() []string {
+				applied = true
+				return nil
+			},
+			ValidateDenyListFn: func(r io.Reader) ([]string, []string, error) {
+				b, err := ioutil.ReadAll(r)
+				if err != nil {
+					return nil, nil, err
+				}
+				names, problems := []string{}, []string{}
+				for i, name := range strings.Fields(string(b)) {
+					names = append(names, name)
+					if name != "wind_speed_avg" && name != "air_t_avg" {
+						problems = append(problems, fmt.Sprintf("line %d: unknown measurement %q", i+1, name))
+					}
+				}
+				return names, problems, nil
+			},
+		}),
+	)
+
+	post := func(t *testing.T, role browser.Role, contentType string, body io.Reader) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/access/validate", body)
+		req.Header.Set("Content-Type", contentType)
+		req = req.WithContext(withCTX(role))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	multipartBody := func(t *testing.T, content string) (string, io.Reader) {
+		t.Helper()
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		fw, err := mw.CreateFormFile("file", "deny")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+		if err := mw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return mw.FormDataContentType(), &buf
+	}
+
+	for _, role := range []browser.Role{browser.Public, browser.External} {
+		if got, want := post(t, role, "text/plain", strings.NewReader("wind_speed_avg\n")).StatusCode, http.StatusNotFound; got != want {
+			t.Fatalf("%s: got unexpected status code: %d, want %d", role, got, want)
+		}
+	}
+
+	testCases := map[string]struct {
+		multipart bool
+		body      string
+		want      map[string]interface{}
+	}{
+		"Valid": {
+			body: "wind_speed_avg\nair_t_avg\n",
+			want: map[string]interface{}{
+				"valid":        true,
+				"measurements": []interface{}{"wind_speed_avg", "air_t_avg"},
+				"errors":       []interface{}{},
+			},
+		},
+		"Invalid": {
+			body: "wind_speed_avg\nwind_sped_avg\n",
+			want: map[string]interface{}{
+				"valid":        false,
+				"measurements": []interface{}{"wind_speed_avg", "wind_sped_avg"},
+				"errors":       []interface{}{`line 2: unknown measurement "wind_sped_avg"`},
+			},
+		},
+		"ValidUpload": {
+			multipart: true,
+			body:      "air_t_avg\n",
+			want: map[string]interface{}{
+				"valid":        true,
+				"measurements": []interface{}{"air_t_avg"},
+				"errors":       []interface{}{},
+			},
+		},
+		"InvalidUpload": {
+			multipart: true,
+			body:      "air_t_agv\n",
+			want: map[string]interface{}{
+				"valid":        false,
+				"measurements": []interface{}{"air_t_agv"},
+				"errors":       []interface{}{`line 1: unknown measurement "air_t_agv"`},
+			},
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			contentType, body := "text/plain", io.Reader(strings.NewReader(tc.body))
+			if tc.multipart {
+				contentType, body = multipartBody(t, tc.body)
+			}
+
+			resp := post(t, browser.FullAccess, contentType, body)
+			defer resp.Body.Close()
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			var got map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if applied {
+		t.Error("validating read the loaded deny list")
+	}
+
+	t.Run("MissingFile", func(t *testing.T) {
+		_, body := multipartBody(t, "")
+		resp := post(t, browser.FullAccess, "multipart/form-data; boundary=other", body)
+		if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+			t.Fatalf("got unexpected status code: %d, want %d", got, want)
+		}
+	})
+
+	t.Run("NotImplemented", func(t *testing.T) {
+		h := NewHandler(WithDatabase(&testBackend{}))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/access/validate", strings.NewReader("air_t_avg\n"))
+		req = req.WithContext(withCTX(browser.FullAccess))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got, want := w.Result().StatusCode, http.StatusNotImplemented; got != want {
+			t.Fatalf("got unexpected status code: %d, want %d", got, want)
+		}
+	})
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/access/validate", nil)
+		req = req.WithContext(withCTX(browser.FullAccess))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got, want := w.Result().StatusCode, http.StatusMethodNotAllowed; got != want {
+			t.Fatalf("got unexpected status code: %d, want %d", got, want)
+		}
+	})
+}
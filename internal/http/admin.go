@@ -0,0 +1,61 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/euracresearch/browser"
+)
+
+// cacheRefresher is implemented by backends caching the catalog of
+// measurements which can be reloaded on demand.
+type cacheRefresher interface {
+	// RefreshCache reloads the cache and returns its new status.
+	RefreshCache(ctx context.Context) (browser.CacheStatus, error)
+}
+
+// cacheStatusJSON is the JSON representation of browser.CacheStatus.
+type cacheStatusJSON struct {
+	Ready        bool      `json:"ready"`
+	Stations     int       `json:"stations"`
+	Measurements int       `json:"measurements"`
+	Refreshed    time.Time `json:"refreshed"`
+}
+
+// handleRefresh reloads the cached catalog of measurements of the backend, so
+// that stations added to the database are available without waiting for the
+// next scheduled refresh, and writes the new status of the cache as JSON.
+func (h *Handler) handleRefresh() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apiError(w, r, errors.New("Expected POST request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		c, ok := h.db.(cacheRefresher)
+		if !ok {
+			apiError(w, r, errors.New("the database does not cache measurements"), http.StatusNotImplemented)
+			return
+		}
+
+		status, err := c.RefreshCache(r.Context())
+		if err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+		if err := json.NewEncoder(w).Encode(cacheStatusJSON(status)); err != nil {
+			log.Printf("refresh: %v", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleRefresh(t *testing.T) {
+	var (
+		refreshes int
+		fail      bool
+		refreshed = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	)
+	h := NewHandler(WithDatabase(&mock.Database{
+		RefreshCacheFn: func(ctx context.Context) (browser.CacheStatus, error) {
+			refreshes++
+			if fail {
+				return browser.CacheStatus{}, errors.New("influx unreachable")
+			}
+			return browser.CacheStatus{Ready: true, Stations: 2, Measurements: 5, Refreshed: refreshed}, nil
+		},
+	}))
+
+	testCases := map[string]struct {
+		role       browser.Role
+		method     string
+		fail       bool
+		statusCode int
+		refreshes  int
+	}{
+		"Public":     {browser.Public, http.MethodPost, false, http.StatusNotFound, 0},
+		"External":   {browser.External, http.MethodPost, false, http.StatusNotFound, 0},
+		"GET":        {browser.FullAccess, http.MethodGet, false, http.StatusMethodNotAllowed, 0},
+		"FullAccess": {browser.FullAccess, http.MethodPost, false, http.StatusOK, 1},
+		"Error":      {browser.FullAccess, http.MethodPost, true, http.StatusInternalServerError, 1},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			refreshes, fail = 0, tc.fail
+
+			req := httptest.NewRequest(tc.method, "/api/v1/admin/refresh", nil)
+			req = req.WithContext(withCTX(tc.role))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if got, want := refreshes, tc.refreshes; got != want {
+				t.Fatalf("cache refreshed %d times, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var got cacheStatusJSON
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			want := cacheStatusJSON{Ready: true, Stations: 2, Measurements: 5, Refreshed: refreshed}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("status mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -5,67 +5,864 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/euracresearch/browser"
 	"github.com/euracresearch/browser/internal/encoding/csv"
 	"github.com/euracresearch/browser/internal/encoding/csvf"
+	"github.com/euracresearch/browser/internal/encoding/ndjson"
+	"github.com/euracresearch/browser/internal/encoding/xlsx"
 )
 
+// citation is the acknowledgement requested by the data usage agreement, which
+// is part of the metadata block of CSV files.
+const citation = "We thank Eurac research, long-term socio-ecological research site LT(S)ER IT25 - Matsch / Mazia - Italy, for providing the data, DEIMS.iD: https://deims.org/11696de6-0ab9-4c94-a06b-7ce40f56c964"
+
+// seriesWriter is the common interface of all writers encoding a
+// browser.TimeSeries.
+type seriesWriter interface {
+	// Write writes the given browser.TimeSeries.
+	Write(browser.TimeSeries) error
+
+	// WriteStream writes the measurements of the given iterator. Only NDJSON
+	// is written while reading, the CSV, JSON and archive formats depend on
+	// all measurements and read the iterator until io.EOF first.
+	WriteStream(browser.MeasurementIterator) error
+
+	// WriteHeader writes only the header, resulting in a valid but empty
+	// file.
+	WriteHeader() error
+}
+
+// handleSeries writes the measurements selected by the form values. HEAD
+// requests, with the form values given as query parameters, are answered with
+// the headers of the same export and its estimated number of points, but
+// without querying the data.
 func (h *Handler) handleSeries() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Expected POST request", http.StatusMethodNotAllowed)
+		if r.Method != http.MethodPost && r.Method != http.MethodHead {
+			http.Error(w, "Expected POST or HEAD request", http.StatusMethodNotAllowed)
 			return
 		}
 
-		f, err := browser.ParseSeriesFilterFromRequest(r)
+		f, code, err := h.parseSeriesFilter(r)
 		if err != nil {
-			Error(w, err, http.StatusInternalServerError)
+			Error(w, err, code)
 			return
 		}
 
-		ctx := r.Context()
-		ts, err := h.db.Series(ctx, f)
-		if errors.Is(err, browser.ErrDataNotFound) {
-			Error(w, err, http.StatusBadRequest)
+		// If explain is set the generated query is returned instead of
+		// executed. This is only available to users with full access.
+		if r.FormValue("explain") == "1" {
+			if !isAllowed(r, browser.FullAccess) {
+				Error(w, browser.ErrForbidden, http.StatusForbidden)
+				return
+			}
+			h.explainSeries(w, r, f)
 			return
 		}
+
+		quote, err := csv.ParseQuoteMode(r.FormValue("quote"))
 		if err != nil {
-			Error(w, err, http.StatusInternalServerError)
+			Error(w, err, http.StatusBadRequest)
 			return
 		}
 
-		filename := fmt.Sprintf("LTSER_IT25_Matsch_Mazia_%d.csv", time.Now().Unix())
-		w.Header().Set("Content-Type", "text/csv")
-		w.Header().Set("Content-Description", "File Transfer")
-		w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+		var sideBySide bool
+		switch r.FormValue("layout") {
+		case "", "vertical":
+		case "sidebyside":
+			sideBySide = true
+		default:
+			Error(w, fmt.Errorf("unknown layout %q", r.FormValue("layout")), http.StatusBadRequest)
+			return
+		}
+
+		// If emptyOK is set a selection without data results in a file
+		// containing only the header instead of an error.
+		emptyOK := r.FormValue("emptyOK") == "1"
+
+		// If trim is set the leading and trailing points without value of
+		// each measurement are dropped instead of being written as NaN.
+		trim := r.FormValue("trim") == "1"
+
+		// If header is full a comment block with provenance information is
+		// written before the header of CSV files.
+		var fullHeader bool
+		switch r.FormValue("header") {
+		case "":
+		case "full":
+			fullHeader = true
+		default:
+			Error(w, fmt.Errorf("unknown header %q", r.FormValue("header")), http.StatusBadRequest)
+			return
+		}
+
+		// If order is selected the measurement columns are ordered by the
+		// selection of their groups instead of the configured order. If order
+		// is depth the columns of wide CSV files are ordered by parameter and
+		// depth.
+		var selectedOrder, depthOrder bool
+		switch r.FormValue("order") {
+		case "":
+		case "selected":
+			selectedOrder = true
+		case "depth":
+			depthOrder = true
+		default:
+			Error(w, fmt.Errorf("unknown order %q", r.FormValue("order")), http.StatusBadRequest)
+			return
+		}
+
+		// If labels is friendly the measurement columns of CSV and XLSX files
+		// are named by their alias instead of the raw label.
+		var friendlyLabels bool
+		switch r.FormValue("labels") {
+		case "", "raw":
+		case "friendly":
+			friendlyLabels = true
+		default:
+			Error(w, fmt.Errorf("unknown labels %q", r.FormValue("labels")), http.StatusBadRequest)
+			return
+		}
+
+		// If precision is set values of CSV and XLSX files are rounded to
+		// the given number of decimals, clamped to maxPrecision.
+		precision := -1
+		if v := r.FormValue("precision"); v != "" {
+			precision, err = strconv.Atoi(v)
+			if err != nil {
+				Error(w, fmt.Errorf("could not parse precision %q", v), http.StatusBadRequest)
+				return
+			}
+			if precision < 0 {
+				precision = 0
+			}
+			if precision > maxPrecision {
+				precision = maxPrecision
+			}
+		}
+
+		// If bundle is zip the export is written as file of a ZIP archive. If
+		// checksum is set as well, a sidecar file holding the SHA-256 checksum
+		// of the export is added to the archive.
+		var zipped bool
+		switch r.FormValue("bundle") {
+		case "":
+		case "zip":
+			zipped = true
+		default:
+			Error(w, fmt.Errorf("unknown bundle %q", r.FormValue("bundle")), http.StatusBadRequest)
+			return
+		}
+		checksum := r.FormValue("checksum") == "1"
+		if checksum && !zipped {
+			Error(w, errors.New("checksum requires bundle=zip"), http.StatusBadRequest)
+			return
+		}
 
-		switch r.FormValue("format") {
+		// If splitBy is year a ZIP archive with one CSV file per calendar
+		// year is written.
+		var splitYears bool
+		switch r.FormValue("splitBy") {
+		case "":
+		case "year":
+			splitYears = true
 		default:
-			writer := csv.NewWriter(w)
-			if err := writer.Write(ts); err != nil {
+			Error(w, fmt.Errorf("unknown splitBy %q", r.FormValue("splitBy")), http.StatusBadRequest)
+			return
+		}
+		if splitYears && (zipped || r.FormValue("format") != "") {
+			Error(w, errors.New("splitBy=year writes CSV files and cannot be combined with format or bundle"), http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+
+		// The form value takes precedence over the Accept header, so that
+		// existing clients keep their format. Without a known media type the
+		// default format of the role of the user is used.
+		format := r.FormValue("format")
+		if format == "" {
+			var ok bool
+			format, ok = negotiateFormat(r.Header.Get("Accept"))
+			if !ok {
+				format = h.formats[browser.UserFromContext(ctx).Role]
+			}
+			w.Header().Add("Vary", "Accept")
+		}
+
+		// JSON clients expect an empty list instead of an error for a
+		// selection without data.
+		if format == "grouped-json" {
+			emptyOK = true
+		}
+		if splitYears {
+			format = "years"
+		}
+		// The zip format is an archive of its own.
+		if format == "zip" && zipped {
+			Error(w, errors.New("format zip cannot be bundled"), http.StatusBadRequest)
+			return
+		}
+
+		if err := h.checkExportSize(ctx, f); err != nil {
+			Error(w, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// HEAD requests are answered from the estimated size of the export
+		// without querying the data.
+		head := r.Method == http.MethodHead
+
+		var it browser.MeasurementIterator
+		if !head {
+			if !h.acquireDownload() {
+				w.Header().Set("Retry-After", downloadRetryAfter)
+				Error(w, errTooManyDownloads, http.StatusServiceUnavailable)
+				return
+			}
+			defer h.releaseDownload()
+
+			it, err = h.db.SeriesStream(ctx, f)
+			if errors.Is(err, browser.ErrDataNotFound) && !emptyOK {
+				Error(w, err, http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, browser.ErrCatalogNotPopulated) {
+				Error(w, err, http.StatusServiceUnavailable)
+				return
+			}
+			if err != nil && !errors.Is(err, browser.ErrDataNotFound) {
 				Error(w, err, http.StatusInternalServerError)
+				return
+			}
+			// The database returns an empty result without error for a
+			// selection without data, which is therefore detected by reading
+			// the first measurement.
+			if it != nil {
+				it, err = peekMeasurement(it)
+				if err != nil {
+					Error(w, err, http.StatusInternalServerError)
+					return
+				}
+			}
+			if it == nil && !emptyOK {
+				Error(w, browser.ErrDataNotFound, http.StatusBadRequest)
+				return
+			}
+			if trim && it != nil {
+				it = &trimIterator{it: it}
+			}
+		}
+
+		// newExport returns the export of the selected format writing to out,
+		// dated with the given export time.
+		newExport := func(out io.Writer, exported time.Time) (*export, error) {
+			var bundle *bundleWriter
+			if zipped {
+				bundle = newBundleWriter(out, checksum)
+				out = bundle
+			}
+
+			var (
+				writer      seriesWriter
+				contentType = "text/csv"
+				ext         = "csv"
+			)
+			order := h.order
+			if selectedOrder {
+				order = h.selectionOrder(ctx, f)
+			}
+			csvOpts := csvOptions(f, quote, sideBySide, order)
+			if r.FormValue("dropEmpty") == "1" {
+				csvOpts = append(csvOpts, csv.WithDropEmptyColumns())
+			}
+			if precision >= 0 {
+				csvOpts = append(csvOpts, csv.WithPrecision(precision))
+			}
+			if friendlyLabels {
+				csvOpts = append(csvOpts, csv.WithAliases(h.aliases))
+			}
+			if fullHeader {
+				m := csv.Metadata{
+					Exported: exported,
+					Start:    f.Start,
+					End:      f.End,
+					Citation: citation,
+				}
+				if trim {
+					m.Note = trimNote
+				}
+				csvOpts = append(csvOpts, csv.WithMetadata(m))
+			}
+
+			switch format {
+			default:
+				writer = csv.NewWriter(out, csvOpts...)
+			case "wide":
+				opts := []csvf.Option{csvf.WithQuoteMode(quote), csvf.WithOrder(order)}
+				if depthOrder {
+					opts = append(opts, csvf.WithDepthOrder())
+				}
+				if precision >= 0 {
+					opts = append(opts, csvf.WithPrecision(precision))
+				}
+				if r.FormValue("landuseLabels") == "1" {
+					lang := h.languageFromRequest(r)
+					opts = append(opts, csvf.WithLanduseLabels(func(code string) string {
+						return browser.Landuse(code, lang)
+					}))
+				}
+				writer = csvf.NewWriter(out, opts...)
+			case "grouped-json":
+				writer = newGroupedWriter(out, h.groupLookup(ctx, f), browser.UserFromContext(ctx).Role)
+				contentType = "application/json"
+				ext = "json"
+			case "zip":
+				writer = newStationsWriter(out, csvOpts...)
+				contentType = "application/zip"
+				ext = "zip"
+			case "years":
+				writer = newYearsWriter(out, f.Location(), csvOpts...)
+				contentType = "application/zip"
+				ext = "zip"
+			case "ndjson":
+				writer = ndjson.NewWriter(out)
+				contentType = ndjson.ContentType
+				ext = "ndjson"
+			case "xlsx":
+				opts := append(csvOpts, csv.WithRecordWriter(xlsx.NewRecordWriter(out)))
+				writer = csv.NewWriter(out, opts...)
+				contentType = xlsx.ContentType
+				ext = "xlsx"
+			}
+
+			filename := fmt.Sprintf("LTSER_IT25_Matsch_Mazia_%d.%s", exported.Unix(), ext)
+			if bundle != nil {
+				if err := bundle.Create(filename); err != nil {
+					return nil, err
+				}
+				filename = strings.TrimSuffix(filename, ext) + "zip"
+				contentType = "application/zip"
 			}
 
-		case "wide":
-			writer := csvf.NewWriter(w)
-			if err := writer.Write(ts); err != nil {
+			return &export{
+				writer:      writer,
+				bundle:      bundle,
+				contentType: contentType,
+				filename:    filename,
+			}, nil
+		}
+
+		// setHeaders sets the response headers describing the given export.
+		setHeaders := func(e *export) {
+			w.Header().Set("Content-Type", e.contentType)
+			if h.maxPoints > 0 {
+				w.Header().Set("Accept-Ranges", "bytes")
+			}
+			// Grouped JSON is meant for charting and only downloaded as
+			// part of a bundle.
+			if format != "grouped-json" || zipped {
+				w.Header().Set("Content-Description", "File Transfer")
+				w.Header().Set("Content-Disposition", "attachment; filename="+e.filename)
+			}
+		}
+
+		now := h.now()
+		switch {
+		case head:
+			e, err := newExport(io.Discard, now)
+			if err != nil {
+				Error(w, err, http.StatusInternalServerError)
+				return
+			}
+			setHeaders(e)
+			measurements := len(h.db.Query(ctx, f).Measurements)
+			w.Header().Set("X-Estimated-Points", strconv.FormatInt(f.EstimatePoints(measurements), 10))
+
+		case h.maxPoints > 0 && r.Header.Get("Range") != "":
+			// Streamed exports cannot be resumed, therefore range requests
+			// are answered from the buffered export. Its size is bounded by
+			// the maximum number of points, so without such a limit range
+			// requests are ignored and the export is sent in full.
+			var (
+				ts  browser.TimeSeries
+				err error
+			)
+			if it != nil {
+				ts, err = browser.ReadTimeSeries(it)
+				if err != nil {
+					Error(w, err, http.StatusInternalServerError)
+					return
+				}
+			}
+			render := func(exported time.Time) (*export, []byte, string, error) {
+				var buf bytes.Buffer
+				e, err := newExport(&buf, exported)
+				if err != nil {
+					return nil, nil, "", err
+				}
+				if ts == nil {
+					err = e.writeTo(nil)
+				} else {
+					err = e.writeTo(browser.NewMeasurementIterator(ts))
+				}
+				if err != nil {
+					return nil, nil, "", err
+				}
+				return e, buf.Bytes(), exportETag(exported, buf.Bytes()), nil
+			}
+
+			// The ETag holds the export time, so that an export resumed
+			// using If-Range is written again with its original time. If
+			// the data has changed since, a new export is sent in full,
+			// since http.ServeContent checks If-Range only for GET
+			// requests.
+			var (
+				e    *export
+				b    []byte
+				etag string
+			)
+			ir := r.Header.Get("If-Range")
+			if exported, ok := parseExportETag(ir); ok && !exported.After(now) {
+				e, b, etag, err = render(exported)
+			}
+			if err == nil && (e == nil || etag != ir) {
+				if ir != "" {
+					r.Header.Del("Range")
+				}
+				e, b, etag, err = render(now)
+			}
+			if err != nil {
+				Error(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			setHeaders(e)
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, e.filename, time.Time{}, bytes.NewReader(b))
+
+		default:
+			e, err := newExport(w, now)
+			if err != nil {
+				Error(w, err, http.StatusInternalServerError)
+				return
+			}
+			setHeaders(e)
+			if err := e.writeTo(it); err != nil {
 				Error(w, err, http.StatusInternalServerError)
 			}
 		}
 	}
 }
 
+// export is a single download of series in one of the formats of
+// handleSeries.
+type export struct {
+	writer      seriesWriter
+	bundle      *bundleWriter
+	contentType string
+	filename    string
+}
+
+// writeTo writes the measurements of the given iterator. Without any
+// measurement only the header is written, resulting in a valid but empty file.
+func (e *export) writeTo(it browser.MeasurementIterator) error {
+	var err error
+	if it == nil {
+		err = e.writer.WriteHeader()
+	} else {
+		err = e.writer.WriteStream(it)
+	}
+	if err == nil && e.bundle != nil {
+		err = e.bundle.Close()
+	}
+	return err
+}
+
+// exportETag returns the ETag of the given buffered export, consisting of its
+// export time and the checksum of its content.
+func exportETag(exported time.Time, b []byte) string {
+	return fmt.Sprintf(`"%d-%x"`, exported.Unix(), sha256.Sum256(b))
+}
+
+// parseExportETag returns the export time of the given ETag returned by
+// exportETag.
+func parseExportETag(etag string) (time.Time, bool) {
+	i := strings.Index(etag, "-")
+	if i < 0 || !strings.HasPrefix(etag, `"`) {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(etag[1:i], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
+
+// sensorLabels returns the labels of the measurements recorded by the sensor
+// with the given ID installed at the given station. ErrSensorNotFound is
+// returned if the station has no such sensor.
+func (h *Handler) sensorLabels(ctx context.Context, station, sensor string) ([]string, error) {
+	id, err := strconv.ParseInt(sensor, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", browser.ErrSensorNotFound, sensor)
+	}
+	stationID, err := strconv.ParseInt(station, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d at station %q", browser.ErrSensorNotFound, id, station)
+	}
+
+	sensors, err := h.stationService.Sensors(ctx, stationID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sensors {
+		if s.ID != id {
+			continue
+		}
+		if len(s.Measurements) == 0 {
+			return nil, fmt.Errorf("%w: sensor %d records no measurements", browser.ErrDataNotFound, id)
+		}
+		return s.Measurements, nil
+	}
+
+	return nil, fmt.Errorf("%w: %d at station %d", browser.ErrSensorNotFound, id, stationID)
+}
+
+// checkExportSize returns an error if the number of measurements per station
+// or the estimated number of points selected by the given filter exceeds the
+// maximum of the handler. The number of measurements is not limited for users
+// with full access.
+func (h *Handler) checkExportSize(ctx context.Context, f *browser.SeriesFilter) error {
+	maxMeasurements := h.maxMeasurements
+	if browser.UserFromContext(ctx).Role == browser.FullAccess {
+		maxMeasurements = 0
+	}
+	if h.maxPoints <= 0 && maxMeasurements <= 0 {
+		return nil
+	}
+
+	measurements := len(h.db.Query(ctx, f).Measurements)
+	if maxMeasurements > 0 && measurements > maxMeasurements {
+		return fmt.Errorf("%w: the selection contains %d measurements per station, but at most %d are allowed for a single download. Please select fewer measurements or split the download", browser.ErrTooLarge, measurements, maxMeasurements)
+	}
+	if h.maxPoints <= 0 {
+		return nil
+	}
+	if n := f.EstimatePoints(measurements); n > h.maxPoints {
+		return fmt.Errorf("%w: the selection contains about %d points, but at most %d are allowed for a single download. Please select a shorter time range, fewer stations or measurements, or limit the number of points", browser.ErrTooLarge, n, h.maxPoints)
+	}
+	return nil
+}
+
+// downloadRetryAfter is the value of the Retry-After header of exports rejected
+// because the maximum number of concurrent downloads is reached.
+const downloadRetryAfter = "30"
+
+var errTooManyDownloads = errors.New("too many downloads in progress, please try again later")
+
+// acquireDownload reserves a slot for an export without waiting. It reports
+// false if the maximum number of concurrent downloads is reached.
+func (h *Handler) acquireDownload() bool {
+	if h.downloads == nil {
+		return true
+	}
+
+	select {
+	case h.downloads <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseDownload frees the slot reserved by acquireDownload.
+func (h *Handler) releaseDownload() {
+	if h.downloads != nil {
+		<-h.downloads
+	}
+}
+
+// maxPrecision is the maximum number of decimals of values which can be
+// requested for exports.
+const maxPrecision = 10
+
+// trimNote is the note of the metadata block of trimmed exports.
+const trimNote = "Each measurement is trimmed to the time range of its data, missing values before its first and after its last value are omitted."
+
+// peekMeasurement reads the first measurement of the given iterator and returns
+// an iterator over all of its measurements, or nil if it has none.
+func peekMeasurement(it browser.MeasurementIterator) (browser.MeasurementIterator, error) {
+	m, err := it.Next()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &peekedIterator{first: m, it: it}, nil
+}
+
+// peekedIterator returns the already read first measurement before those of
+// the wrapped iterator.
+type peekedIterator struct {
+	first *browser.Measurement
+	it    browser.MeasurementIterator
+}
+
+func (p *peekedIterator) Next() (*browser.Measurement, error) {
+	if m := p.first; m != nil {
+		p.first = nil
+		return m, nil
+	}
+	return p.it.Next()
+}
+
+// trimIterator drops the leading and trailing points without value (NaN) of
+// each measurement of the wrapped iterator, so that measurements cover only
+// the time range of their data. Measurements without any value keep no points.
+type trimIterator struct {
+	it browser.MeasurementIterator
+}
+
+func (t *trimIterator) Next() (*browser.Measurement, error) {
+	m, err := t.it.Next()
+	if err != nil {
+		return nil, err
+	}
+	m.Points = trimPoints(m.Points)
+	return m, nil
+}
+
+// trimPoints returns the given points without the leading and trailing points
+// whose value is NaN.
+func trimPoints(points []*browser.Point) []*browser.Point {
+	start, end := 0, len(points)
+	for start < end && math.IsNaN(points[start].Value) {
+		start++
+	}
+	for end > start && math.IsNaN(points[end-1].Value) {
+		end--
+	}
+	return points[start:end]
+}
+
+// csvOptions returns the options of the CSV writer for the given filter.
+func csvOptions(f *browser.SeriesFilter, quote csv.QuoteMode, sideBySide bool, order browser.MeasurementOrder) []csv.Option {
+	opts := []csv.Option{csv.WithQuoteMode(quote), csv.WithOrder(order)}
+	if f.WithFlags {
+		opts = append(opts, csv.WithFlags())
+	}
+	if sideBySide {
+		opts = append(opts, csv.WithSideBySide())
+	}
+	return opts
+}
+
+// seriesFormats maps the media types which can be requested by the Accept
+// header to the corresponding format of the series endpoint.
+var seriesFormats = map[string]string{
+	"text/csv":         "",
+	"application/json": "grouped-json",
+	xlsx.ContentType:   "xlsx",
+	ndjson.ContentType: "ndjson",
+}
+
+// negotiateFormat returns the format of the series endpoint for the media type
+// with the highest quality in the given Accept header. The boolean is false if
+// the header contains no known media type.
+func negotiateFormat(accept string) (string, bool) {
+	var (
+		format string
+		best   float64
+	)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		f, ok := seriesFormats[mediaType]
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > best {
+			best, format = q, f
+		}
+	}
+	return format, best > 0
+}
+
+// roleFormats maps the names of the formats which can be configured as
+// default of a role to the corresponding format of the series endpoint.
+var roleFormats = map[string]string{
+	"csv":          "",
+	"wide":         "wide",
+	"grouped-json": "grouped-json",
+	"xlsx":         "xlsx",
+	"ndjson":       "ndjson",
+}
+
+// ParseDefaultFormats parses a comma separated list of role=format pairs,
+// e.g. "FullAccess=grouped-json", as used by WithDefaultFormats. Valid formats
+// are csv, wide, grouped-json, xlsx and ndjson.
+func ParseDefaultFormats(s string) (map[browser.Role]string, error) {
+	formats := make(map[browser.Role]string)
+	if strings.TrimSpace(s) == "" {
+		return formats, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("http: invalid default format %q", pair)
+		}
+
+		role := browser.Role(strings.TrimSpace(kv[0]))
+		if browser.NewRole(string(role)) != role {
+			return nil, fmt.Errorf("http: unknown role %q", role)
+		}
+		format, ok := roleFormats[strings.TrimSpace(kv[1])]
+		if !ok {
+			return nil, fmt.Errorf("http: unknown format %q", strings.TrimSpace(kv[1]))
+		}
+		formats[role] = format
+	}
+
+	return formats, nil
+}
+
+// ParseRoles parses a comma separated list of roles, e.g. "FullAccess,External",
+// as used by WithTemplateRoles.
+func ParseRoles(s string) ([]browser.Role, error) {
+	var roles []browser.Role
+	for _, r := range strings.Split(s, ",") {
+		role := browser.Role(strings.TrimSpace(r))
+		if role == "" {
+			continue
+		}
+		if browser.NewRole(string(role)) != role {
+			return nil, fmt.Errorf("http: unknown role %q", role)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// parseSeriesFilter parses the filter of the series selected by the form values
+// of the given request. If the sensor form value is set the series are
+// restricted to the measurements recorded by the sensor. On error the status
+// code to answer with is returned.
+func (h *Handler) parseSeriesFilter(r *http.Request) (*browser.SeriesFilter, int, error) {
+	f, err := browser.ParseSeriesFilterFromRequest(r)
+	if errors.Is(err, browser.ErrLimitExceeded) {
+		return nil, http.StatusBadRequest, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	sensor := r.FormValue("sensor")
+	if sensor == "" {
+		return f, http.StatusOK, nil
+	}
+
+	if len(f.Stations) != 1 {
+		return nil, http.StatusBadRequest, errors.New("a sensor can only be selected together with its station")
+	}
+
+	f.Labels, err = h.sensorLabels(r.Context(), f.Stations[0], sensor)
+	if errors.Is(err, browser.ErrSensorNotFound) || errors.Is(err, browser.ErrDataNotFound) {
+		return nil, http.StatusBadRequest, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return f, http.StatusOK, nil
+}
+
+// handleQuery writes the query generated for the series selected by the form
+// values as JSON without executing it, as with the explain form value of
+// handleSeries. Unlike downloads it is available in maintenance mode.
+func (h *Handler) handleQuery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apiError(w, r, errors.New("Expected POST request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		f, code, err := h.parseSeriesFilter(r)
+		if err != nil {
+			apiError(w, r, err, code)
+			return
+		}
+
+		h.explainSeries(w, r, f)
+	}
+}
+
+// explainSeries writes the statements executed for the given filter together
+// with the resolved measurements and stations and the estimated number of
+// points as JSON.
+func (h *Handler) explainSeries(w http.ResponseWriter, r *http.Request, f *browser.SeriesFilter) {
+	stmt := h.db.Query(r.Context(), f)
+
+	resp := struct {
+		Statements   []string `json:"statements"`
+		Database     string   `json:"database"`
+		Measurements []string `json:"measurements"`
+		Stations     []string `json:"stations"`
+		Points       int64    `json:"points"`
+		Start        string   `json:"start,omitempty"`
+		End          string   `json:"end,omitempty"`
+	}{
+		Statements:   stmt.Statements,
+		Database:     stmt.Database,
+		Measurements: stmt.Measurements,
+		Stations:     f.Stations,
+		Points:       f.EstimatePoints(len(stmt.Measurements)),
+	}
+
+	// The effective time range is reported in the time zone of the filter, so
+	// that users know the exact window the query selects.
+	if !stmt.Start.IsZero() && !stmt.End.IsZero() {
+		resp.Start = stmt.Start.In(f.Location()).Format(time.RFC3339)
+		resp.End = stmt.End.In(f.Location()).Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		Error(w, err, http.StatusInternalServerError)
+	}
+}
+
 func (h *Handler) handleCodeTemplate() http.HandlerFunc {
 	var (
 		tmpl struct {
-			python, rlang *template.Template
+			python, rlang, matlab, julia *template.Template
 		}
 		err error
 	)
@@ -80,6 +877,16 @@ func (h *Handler) handleCodeTemplate() http.HandlerFunc {
 		log.Fatal(err)
 	}
 
+	tmpl.matlab, err = template.ParseFS(templateFS, "templates/matlab.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tmpl.julia, err = template.ParseFS(templateFS, "templates/julia.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Expected POST request", http.StatusMethodNotAllowed)
@@ -87,22 +894,37 @@ func (h *Handler) handleCodeTemplate() http.HandlerFunc {
 		}
 
 		var (
-			t   *template.Template
-			ext string
+			t        *template.Template
+			ext      string
+			notebook bool
 		)
 		switch r.FormValue("language") {
 		case "python":
 			t = tmpl.python
 			ext = "py"
+		case "notebook":
+			t = tmpl.python
+			ext = "ipynb"
+			notebook = true
 		case "r":
 			t = tmpl.rlang
 			ext = "r"
+		case "matlab":
+			t = tmpl.matlab
+			ext = "m"
+		case "julia":
+			t = tmpl.julia
+			ext = "jl"
 		default:
 			Error(w, browser.ErrInternal, http.StatusInternalServerError)
 			return
 		}
 
 		f, err := browser.ParseSeriesFilterFromRequest(r)
+		if errors.Is(err, browser.ErrLimitExceeded) {
+			Error(w, err, http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			Error(w, err, http.StatusInternalServerError)
 			return
@@ -111,10 +933,8 @@ func (h *Handler) handleCodeTemplate() http.HandlerFunc {
 		ctx := r.Context()
 		stmt := h.db.Query(ctx, f)
 
-		filename := fmt.Sprintf("LTSER_IT25_Matsch_Mazia_%d.%s", time.Now().Unix(), ext)
-		w.Header().Set("Content-Description", "File Transfer")
-		w.Header().Set("Content-Disposition", "attachment; filename="+filename)
-		err = t.Execute(w, struct {
+		var buf bytes.Buffer
+		err = t.Execute(&buf, struct {
 			Query    string
 			Database string
 		}{
@@ -123,6 +943,92 @@ func (h *Handler) handleCodeTemplate() http.HandlerFunc {
 		})
 		if err != nil {
 			Error(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// A notebook wraps the Python code inside a code cell.
+		if notebook {
+			b, err := newNotebook(buf.String())
+			if err != nil {
+				Error(w, err, http.StatusInternalServerError)
+				return
+			}
+			buf.Reset()
+			buf.Write(b)
+			w.Header().Set("Content-Type", "application/x-ipynb+json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		}
+
+		filename := fmt.Sprintf("LTSER_IT25_Matsch_Mazia_%d.%s", time.Now().Unix(), ext)
+		w.Header().Set("Content-Description", "File Transfer")
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+		buf.WriteTo(w)
+	}
+}
+
+// notebookPlotCode is the source of the notebook cell plotting the result of
+// the query cell.
+const notebookPlotCode = `import matplotlib.pyplot as plt
+
+# Plot each returned measurement in its own figure.
+for name, df in result.items():
+    df.select_dtypes(include='number').plot(title=str(name), figsize=(12, 4))
+
+plt.show()
+`
+
+// newNotebook returns a minimal Jupyter notebook (nbformat 4) containing the
+// given Python code in a code cell followed by a cell plotting the result.
+func newNotebook(code string) ([]byte, error) {
+	codeCell := func(src string) map[string]interface{} {
+		return map[string]interface{}{
+			"cell_type":       "code",
+			"execution_count": nil,
+			"metadata":        struct{}{},
+			"outputs":         []interface{}{},
+			"source":          notebookSource(src),
+		}
+	}
+
+	nb := struct {
+		Cells         []map[string]interface{} `json:"cells"`
+		Metadata      map[string]interface{}   `json:"metadata"`
+		NBFormat      int                      `json:"nbformat"`
+		NBFormatMinor int                      `json:"nbformat_minor"`
+	}{
+		Cells: []map[string]interface{}{
+			{
+				"cell_type": "markdown",
+				"metadata":  struct{}{},
+				"source":    notebookSource("# LTSER IT25 Matsch | Mazia\n\nQuery the selected data from InfluxDB and plot it."),
+			},
+			codeCell(code),
+			codeCell(notebookPlotCode),
+		},
+		Metadata: map[string]interface{}{
+			"kernelspec": map[string]string{
+				"display_name": "Python 3",
+				"language":     "python",
+				"name":         "python3",
+			},
+			"language_info": map[string]string{
+				"name": "python",
+			},
+		},
+		NBFormat:      4,
+		NBFormatMinor: 4,
+	}
+
+	return json.MarshalIndent(nb, "", " ")
+}
+
+// notebookSource splits the given source into lines keeping the line endings,
+// as expected by the notebook format.
+func notebookSource(src string) []string {
+	lines := strings.SplitAfter(src, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
 	}
+	return lines
 }
@@ -7,9 +7,12 @@ package http
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -18,6 +21,11 @@ import (
 	"time"
 
 	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/encoding/ndjson"
+	"github.com/euracresearch/browser/internal/encoding/xlsx"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 type testBackend struct{}
@@ -49,14 +57,42 @@ func (tb *testBackend) Series(ctx context.Context, m *browser.SeriesFilter) (bro
 	return append(ts, measure), nil
 }
 
+func (tb *testBackend) SeriesStream(ctx context.Context, m *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+	ts, err := tb.Series(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	return browser.NewMeasurementIterator(ts), nil
+}
+
 func (tb *testBackend) GroupsByStation(ctx context.Context, id int64) ([]browser.Group, error) {
 	return []browser.Group{}, errors.New("not yet implemented")
 }
 
+func (tb *testBackend) AggregationsByStation(ctx context.Context, id int64) (map[browser.Group][]string, error) {
+	return nil, errors.New("not yet implemented")
+}
+
+func (tb *testBackend) Latest(ctx context.Context, m *browser.SeriesFilter) (browser.TimeSeries, error) {
+	return nil, errors.New("not yet implemented")
+}
+
+func (tb *testBackend) Coverage(ctx context.Context, m *browser.SeriesFilter) ([]browser.Coverage, error) {
+	return nil, errors.New("not yet implemented")
+}
+
+func (tb *testBackend) UnitsByStation(ctx context.Context, id int64) (map[browser.Group][]string, error) {
+	return nil, errors.New("not yet implemented")
+}
+
 func (tb *testBackend) Maintenance(ctx context.Context) ([]string, error) {
 	return []string{}, errors.New("not yet implemented")
 }
 
+func (tb *testBackend) Ping(ctx context.Context) error {
+	return nil
+}
+
 func (tb *testBackend) Query(ctx context.Context, m *browser.SeriesFilter) *browser.Stmt {
 	return &browser.Stmt{
 		Database: "testdb",
@@ -78,7 +114,7 @@ func TestHandleSeries(t *testing.T) {
 	}{
 		"GET":                            {http.MethodGet, http.StatusMethodNotAllowed, "text/plain; charset=utf-8", "", nil},
 		"PUT":                            {http.MethodPut, http.StatusMethodNotAllowed, "text/plain; charset=utf-8", "", nil},
-		"HEAD":                           {http.MethodHead, http.StatusMethodNotAllowed, "text/plain; charset=utf-8", "", nil},
+		"HEADIncomplete":                 {http.MethodHead, http.StatusInternalServerError, "text/plain; charset=utf-8", "", nil},
 		"PATCH":                          {http.MethodPatch, http.StatusMethodNotAllowed, "text/plain; charset=utf-8", "", nil},
 		"DELETE":                         {http.MethodDelete, http.StatusMethodNotAllowed, "text/plain; charset=utf-8", "", nil},
 		"OPTIONS":                        {http.MethodOptions, http.StatusMethodNotAllowed, "text/plain; charset=utf-8", "", nil},
@@ -122,6 +158,218 @@ func TestHandleSeries(t *testing.T) {
 	}
 }
 
+func TestHandleSeriesEmptyOK(t *testing.T) {
+	h := NewHandler(WithDatabase(&mock.Database{
+		SeriesFn: func() (browser.TimeSeries, error) {
+			return nil, browser.ErrDataNotFound
+		},
+	}))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	testCases := map[string]struct {
+		reqBody    string
+		statusCode int
+		respBody   []byte
+	}{
+		"NoData":        {filter, http.StatusBadRequest, nil},
+		"NoDataEmptyOK": {filter + "&emptyOK=1", http.StatusOK, []byte("time,station,landuse,elevation,latitude,longitude\n,,,,,\n")},
+		"NoDataWide":    {filter + "&emptyOK=1&format=wide", http.StatusOK, []byte("station\nlanduse\nlatitude\nlongitude\nelevation\nparameter\ndepth\naggregation\nunit\n")},
+		"NoDataJSON":    {filter + "&format=grouped-json", http.StatusOK, []byte("[]\n")},
+	}
+
+	// The database returns an empty result without error for a selection
+	// without data.
+	empty := NewHandler(WithDatabase(&mock.Database{
+		SeriesFn: func() (browser.TimeSeries, error) {
+			return browser.TimeSeries{}, nil
+		},
+	}))
+
+	for k, tc := range testCases {
+		for name, h := range map[string]*Handler{"NotFound": h, "Empty": empty} {
+			t.Run(k+"/"+name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				resp := w.Result()
+
+				if got, want := resp.StatusCode, tc.statusCode; got != want {
+					t.Fatalf("got unexpected status code: %d, want %d", got, want)
+				}
+
+				if tc.respBody != nil {
+					defer resp.Body.Close()
+					b, err := ioutil.ReadAll(resp.Body)
+					if err != nil {
+						t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+					}
+
+					if !bytes.Equal(b, tc.respBody) {
+						t.Fatalf("got unexpected body: %q; want %q", b, tc.respBody)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestHandleSeriesExplain(t *testing.T) {
+	h := NewHandler(WithDatabase(&mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			return &browser.Stmt{
+				Query:        "SELECT a_avg FROM a_avg",
+				Database:     "testdb",
+				Statements:   []string{"SELECT a_avg FROM a_avg GROUP BY station"},
+				Measurements: []string{"a_avg"},
+				Start:        time.Date(2019, 7, 23, 0, 0, 0, 0, browser.Location),
+				End:          time.Date(2020, 1, 23, 23, 59, 59, 0, browser.Location),
+			}
+		},
+		SeriesFn: func() (browser.TimeSeries, error) {
+			t.Fatal("Series must not be called when explaining a query")
+			return nil, nil
+		},
+	}))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&stations=2&measurements=a&explain=1"
+
+	testCases := map[string]struct {
+		ctx        context.Context
+		statusCode int
+		respBody   string
+	}{
+		"Public":     {withCTX(browser.Public), http.StatusForbidden, "access forbidden\n"},
+		"External":   {withCTX(browser.External), http.StatusForbidden, "access forbidden\n"},
+		"FullAccess": {withCTX(browser.FullAccess), http.StatusOK, `{"statements":["SELECT a_avg FROM a_avg GROUP BY station"],"database":"testdb","measurements":["a_avg"],"stations":["1","2"],"points":35520,"start":"2019-07-23T00:00:00+01:00","end":"2020-01-23T23:59:59+01:00"}` + "\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(filter))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(tc.ctx)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+
+			if got := string(b); got != tc.respBody {
+				t.Fatalf("got unexpected body: %q; want %q", got, tc.respBody)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesSTD(t *testing.T) {
+	var got bool
+	h := NewHandler(WithDatabase(&mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			got = f.WithSTD
+			return &browser.Stmt{}
+		},
+	}))
+
+	testCases := map[string]struct {
+		form string
+		want bool
+	}{
+		"none":    {"", false},
+		"std":     {"&std=1", true},
+		"std_0":   {"&std=0", false},
+		"showStd": {"&showStd=on", true},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			got = false
+			body := "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=0&explain=1" + tc.form
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(withCTX(browser.FullAccess))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got unexpected status code: %d, want %d", w.Code, http.StatusOK)
+			}
+			if got != tc.want {
+				t.Fatalf("WithSTD: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleQuery(t *testing.T) {
+	h := NewHandler(WithMaintenance(""), WithDatabase(&mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			return &browser.Stmt{
+				Query:        "SELECT a_avg FROM a_avg",
+				Database:     "testdb",
+				Statements:   []string{"SELECT a_avg FROM a_avg GROUP BY station"},
+				Measurements: []string{"a_avg"},
+			}
+		},
+		SeriesFn: func() (browser.TimeSeries, error) {
+			t.Fatal("Series must not be called when showing a query")
+			return nil, nil
+		},
+	}))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	testCases := map[string]struct {
+		method     string
+		ctx        context.Context
+		statusCode int
+		respBody   string
+	}{
+		"Public":     {http.MethodPost, withCTX(browser.Public), http.StatusNotFound, "404 page not found\n"},
+		"External":   {http.MethodPost, withCTX(browser.External), http.StatusNotFound, "404 page not found\n"},
+		"GET":        {http.MethodGet, withCTX(browser.FullAccess), http.StatusMethodNotAllowed, "Expected POST request\n"},
+		"FullAccess": {http.MethodPost, withCTX(browser.FullAccess), http.StatusOK, `{"statements":["SELECT a_avg FROM a_avg GROUP BY station"],"database":"testdb","measurements":["a_avg"],"stations":["1"],"points":17760}` + "\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/v1/query", strings.NewReader(filter))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(tc.ctx)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+
+			if got := string(b); got != tc.respBody {
+				t.Fatalf("got unexpected body: %q; want %q", got, tc.respBody)
+			}
+		})
+	}
+}
+
 func TestHandleTemplate(t *testing.T) {
 	h := NewHandler(func(h *Handler) {
 		h.db = new(testBackend)
@@ -137,6 +385,16 @@ func TestHandleTemplate(t *testing.T) {
 		log.Fatal(err)
 	}
 
+	tmplMatlab, err := template.ParseFS(templateFS, "templates/matlab.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tmplJulia, err := template.ParseFS(templateFS, "templates/julia.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	testCases := map[string]struct {
 		method     string
 		ctx        context.Context
@@ -157,6 +415,8 @@ func TestHandleTemplate(t *testing.T) {
 		"EmtpyLanguage":   {http.MethodPost, withCTX(browser.FullAccess), http.StatusInternalServerError, []byte(`startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&language=`), nil},
 		"R":               {http.MethodPost, withCTX(browser.FullAccess), http.StatusOK, []byte(`startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&language=r`), tmplRlang},
 		"Python":          {http.MethodPost, withCTX(browser.FullAccess), http.StatusOK, []byte(`startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&landuse=me&language=python`), tmplPython},
+		"Matlab":          {http.MethodPost, withCTX(browser.FullAccess), http.StatusOK, []byte(`startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&language=matlab`), tmplMatlab},
+		"Julia":           {http.MethodPost, withCTX(browser.FullAccess), http.StatusOK, []byte(`startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&language=julia`), tmplJulia},
 	}
 
 	for k, tc := range testCases {
@@ -206,6 +466,1435 @@ func TestHandleTemplate(t *testing.T) {
 }
 
 func withCTX(role browser.Role) context.Context {
-	u := &browser.User{Role: role}
+	u := &browser.User{Role: role, License: true}
 	return context.WithValue(context.Background(), browser.UserContextKey, u)
 }
+
+func TestHandleTemplateRoles(t *testing.T) {
+	const body = `startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&language=python`
+
+	testCases := map[string]struct {
+		roles      []browser.Role
+		role       browser.Role
+		statusCode int
+	}{
+		"DefaultFullAccess":    {nil, browser.FullAccess, http.StatusOK},
+		"DefaultExternal":      {nil, browser.External, http.StatusNotFound},
+		"ConfiguredExternal":   {[]browser.Role{browser.FullAccess, browser.External}, browser.External, http.StatusOK},
+		"ConfiguredFullAccess": {[]browser.Role{browser.FullAccess, browser.External}, browser.FullAccess, http.StatusOK},
+		"ConfiguredPublic":     {[]browser.Role{browser.FullAccess, browser.External}, browser.Public, http.StatusNotFound},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := NewHandler(WithTemplateRoles(tc.roles), func(h *Handler) {
+				h.db = new(testBackend)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/templates", strings.NewReader(body))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(withCTX(tc.role))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got, want := w.Result().StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleTemplateLicense(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	const body = `startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&language=python`
+
+	testCases := map[string]struct {
+		user       *browser.User
+		statusCode int
+	}{
+		"Signed":   {&browser.User{Role: browser.FullAccess, License: true}, http.StatusOK},
+		"Unsigned": {&browser.User{Role: browser.FullAccess}, http.StatusForbidden},
+		"Public":   {&browser.User{Role: browser.Public}, http.StatusNotFound},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/templates", strings.NewReader(body))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(context.WithValue(context.Background(), browser.UserContextKey, tc.user))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusForbidden {
+				return
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(b), "/en/hello/"; !strings.Contains(got, want) {
+				t.Fatalf("got body %q, want pointer to %s", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleTemplateNotebook(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	body := `startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&language=notebook`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/templates", strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(withCTX(browser.FullAccess))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "application/x-ipynb+json"; got != want {
+		t.Fatalf("response header content-type: got %s, want %s", got, want)
+	}
+	if got := resp.Header.Get("Content-Disposition"); !strings.HasSuffix(got, ".ipynb") {
+		t.Fatalf("response header content-disposition: got %s, want .ipynb file", got)
+	}
+
+	var nb struct {
+		Cells []struct {
+			CellType       string        `json:"cell_type"`
+			ExecutionCount *int          `json:"execution_count"`
+			Outputs        []interface{} `json:"outputs"`
+			Source         []string      `json:"source"`
+		} `json:"cells"`
+		Metadata      map[string]interface{} `json:"metadata"`
+		NBFormat      int                    `json:"nbformat"`
+		NBFormatMinor int                    `json:"nbformat_minor"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&nb); err != nil {
+		t.Fatalf("notebook is not valid JSON: %v", err)
+	}
+
+	if nb.NBFormat != 4 {
+		t.Fatalf("got nbformat %d, want 4", nb.NBFormat)
+	}
+	if _, ok := nb.Metadata["kernelspec"]; !ok {
+		t.Fatal("notebook metadata has no kernelspec")
+	}
+
+	var types []string
+	for _, c := range nb.Cells {
+		types = append(types, c.CellType)
+	}
+	if got, want := strings.Join(types, ","), "markdown,code,code"; got != want {
+		t.Fatalf("got cells %s, want %s", got, want)
+	}
+
+	query := strings.Join(nb.Cells[1].Source, "")
+	if !strings.Contains(query, `client.query("querytestbackend")`) || !strings.Contains(query, "database='testdb'") {
+		t.Fatalf("query cell does not contain the query and database:\n%s", query)
+	}
+	if plot := strings.Join(nb.Cells[2].Source, ""); !strings.Contains(plot, "plt.show()") {
+		t.Fatalf("plot cell does not plot:\n%s", plot)
+	}
+}
+
+func TestHandleSeriesLanduseLabels(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&format=wide"
+
+	testCases := map[string]struct {
+		reqBody string
+		lang    string
+		want    string
+	}{
+		"Raw":     {filter, "de", "landuse,me\n"},
+		"German":  {filter + "&landuseLabels=1", "de", "landuse,Wiese\n"},
+		"English": {filter + "&landuseLabels=1", "en", "landuse,Meadows\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: DefaultLanguageCookieName, Value: tc.lang})
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+
+			if !strings.Contains(string(b), tc.want) {
+				t.Fatalf("body does not contain %q:\n%s", tc.want, b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesAccept(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	testCases := map[string]struct {
+		reqBody     string
+		accept      string
+		contentType string
+		prefix      string
+	}{
+		"None":            {filter, "", "text/csv", "time,station"},
+		"CSV":             {filter, "text/csv", "text/csv", "time,station"},
+		"JSON":            {filter, "application/json", "application/json", "["},
+		"XLSX":            {filter, xlsx.ContentType, xlsx.ContentType, "PK"},
+		"Any":             {filter, "*/*", "text/csv", "time,station"},
+		"Unknown":         {filter, "text/html", "text/csv", "time,station"},
+		"Quality":         {filter, "application/json;q=0.5, text/csv;q=0.8", "text/csv", "time,station"},
+		"NotAcceptable":   {filter, "application/json;q=0, " + xlsx.ContentType, xlsx.ContentType, "PK"},
+		"FirstKnown":      {filter, "text/html, application/json, text/csv", "application/json", "["},
+		"FormWide":        {filter + "&format=wide", "application/json", "text/csv", "station,"},
+		"FormGroupedJSON": {filter + "&format=grouped-json", "text/csv", "application/json", "["},
+		"FormXLSX":        {filter + "&format=xlsx", "application/json", xlsx.ContentType, "PK"},
+		"NDJSON":          {filter, ndjson.ContentType, ndjson.ContentType, `{"station":"station"`},
+		"FormNDJSON":      {filter + "&format=ndjson", "text/csv", ndjson.ContentType, `{"station":"station"`},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			if tc.accept != "" {
+				req.Header.Add("Accept", tc.accept)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			if got, want := resp.Header.Get("Content-Type"), tc.contentType; got != want {
+				t.Fatalf("response header content-type: got %s, want %s", got, want)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+
+			if !bytes.HasPrefix(b, []byte(tc.prefix)) {
+				t.Fatalf("body does not start with %q:\n%q", tc.prefix, b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesDefaultFormat(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	}, WithDefaultFormats(map[browser.Role]string{browser.FullAccess: "grouped-json"}))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	testCases := map[string]struct {
+		role        browser.Role
+		reqBody     string
+		accept      string
+		contentType string
+		prefix      string
+	}{
+		"RoleDefault":  {browser.FullAccess, filter, "", "application/json", "["},
+		"AnyAccept":    {browser.FullAccess, filter, "*/*", "application/json", "["},
+		"FormOverride": {browser.FullAccess, filter + "&format=wide", "", "text/csv", "station,"},
+		"Accept":       {browser.FullAccess, filter, "text/csv", "text/csv", "time,station"},
+		"NoDefault":    {browser.Public, filter, "", "text/csv", "time,station"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req = req.WithContext(withCTX(tc.role))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			if tc.accept != "" {
+				req.Header.Add("Accept", tc.accept)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			if got, want := resp.Header.Get("Content-Type"), tc.contentType; got != want {
+				t.Fatalf("response header content-type: got %s, want %s", got, want)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+
+			if !bytes.HasPrefix(b, []byte(tc.prefix)) {
+				t.Fatalf("body does not start with %q:\n%q", tc.prefix, b)
+			}
+		})
+	}
+}
+
+func TestParseDefaultFormats(t *testing.T) {
+	testCases := map[string]struct {
+		in      string
+		want    map[browser.Role]string
+		wantErr bool
+	}{
+		"Empty":         {"", map[browser.Role]string{}, false},
+		"Single":        {"FullAccess=grouped-json", map[browser.Role]string{browser.FullAccess: "grouped-json"}, false},
+		"NDJSON":        {"External=ndjson", map[browser.Role]string{browser.External: "ndjson"}, false},
+		"Multiple":      {"FullAccess=xlsx, Public=csv", map[browser.Role]string{browser.FullAccess: "xlsx", browser.Public: ""}, false},
+		"UnknownRole":   {"Admin=csv", nil, true},
+		"UnknownFormat": {"Public=pdf", nil, true},
+		"Invalid":       {"Public", nil, true},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			got, err := ParseDefaultFormats(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseRoles(t *testing.T) {
+	testCases := map[string]struct {
+		in      string
+		want    []browser.Role
+		wantErr bool
+	}{
+		"Empty":       {"", nil, false},
+		"Single":      {"FullAccess", []browser.Role{browser.FullAccess}, false},
+		"Multiple":    {"FullAccess, External", []browser.Role{browser.FullAccess, browser.External}, false},
+		"UnknownRole": {"FullAccess,Admin", nil, true},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			got, err := ParseRoles(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// blockingBackend is a testBackend whose SeriesStream blocks until release is
+// closed, signaling on started when called.
+type blockingBackend struct {
+	testBackend
+	started chan struct{}
+	release chan struct{}
+}
+
+func (bb *blockingBackend) SeriesStream(ctx context.Context, m *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+	bb.started <- struct{}{}
+	<-bb.release
+	return bb.testBackend.SeriesStream(ctx, m)
+}
+
+func TestHandleSeriesMaxDownloads(t *testing.T) {
+	db := &blockingBackend{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	h := NewHandler(WithMaxDownloads(1), func(h *Handler) {
+		h.db = db
+	})
+
+	const body = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+	download := func() *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(withCTX(browser.FullAccess))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	first := make(chan *http.Response)
+	go func() { first <- download() }()
+	<-db.started
+
+	// The semaphore is saturated by the first download.
+	resp := download()
+	if got, want := resp.StatusCode, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+	if got, want := resp.Header.Get("Retry-After"), downloadRetryAfter; got != want {
+		t.Fatalf("got Retry-After %q, want %q", got, want)
+	}
+
+	close(db.release)
+	if got, want := (<-first).StatusCode, http.StatusOK; got != want {
+		t.Fatalf("first download: got unexpected status code: %d, want %d", got, want)
+	}
+
+	// The slot is released after the response has been written.
+	go func() { <-db.started }()
+	if got, want := download().StatusCode, http.StatusOK; got != want {
+		t.Fatalf("download after release: got unexpected status code: %d, want %d", got, want)
+	}
+}
+
+func TestHandleSeriesHead(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+	// The data of HEAD requests is not queried.
+	estimate := NewHandler(WithDatabase(&mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			return &browser.Stmt{Measurements: []string{"a_avg", "a_std"}}
+		},
+		SeriesFn: func() (browser.TimeSeries, error) {
+			t.Fatal("Series must not be called for HEAD requests")
+			return nil, nil
+		},
+	}))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	testCases := map[string]struct {
+		query  string
+		accept string
+	}{
+		"CSV":         {filter, ""},
+		"Wide":        {filter + "&format=wide", ""},
+		"GroupedJSON": {filter, "application/json"},
+		"XLSX":        {filter + "&format=xlsx", ""},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			// The same export requested by POST, for comparing the headers.
+			post := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.query))
+			post.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			head := httptest.NewRequest(http.MethodHead, "/api/v1/series?"+tc.query, nil)
+			if tc.accept != "" {
+				post.Header.Add("Accept", tc.accept)
+				head.Header.Add("Accept", tc.accept)
+			}
+
+			pw := httptest.NewRecorder()
+			h.ServeHTTP(pw, post)
+			want := pw.Result()
+			defer want.Body.Close()
+
+			hw := httptest.NewRecorder()
+			estimate.ServeHTTP(hw, head)
+			got := hw.Result()
+			defer got.Body.Close()
+
+			if got.StatusCode != http.StatusOK {
+				t.Fatalf("got unexpected status code: %d, want %d", got.StatusCode, http.StatusOK)
+			}
+
+			for _, header := range []string{"Content-Type", "Content-Description", "Vary"} {
+				if diff := cmp.Diff(want.Header.Get(header), got.Header.Get(header)); diff != "" {
+					t.Errorf("header %s mismatch (-want +got):\n%s", header, diff)
+				}
+			}
+			if (want.Header.Get("Content-Disposition") == "") != (got.Header.Get("Content-Disposition") == "") {
+				t.Errorf("got Content-Disposition %q, want like %q", got.Header.Get("Content-Disposition"), want.Header.Get("Content-Disposition"))
+			}
+
+			// One station and two measurements from 2019-07-23 until the
+			// end of 2020-01-23, 185 days of 96 points.
+			if got, want := got.Header.Get("X-Estimated-Points"), "35520"; got != want {
+				t.Errorf("got X-Estimated-Points %s, want %s", got, want)
+			}
+
+			b, err := ioutil.ReadAll(got.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(got.Body): %v", err)
+			}
+			if len(b) != 0 {
+				t.Errorf("got body %q, want none", b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesSelectedOrder(t *testing.T) {
+	labels := map[browser.Group]string{
+		browser.AirTemperature:   "air_t_avg",
+		browser.RelativeHumidity: "air_rh_avg",
+	}
+
+	var queried [][]browser.Group
+	db := &mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			queried = append(queried, f.Groups)
+
+			stmt := &browser.Stmt{}
+			for _, g := range f.Groups {
+				stmt.Measurements = append(stmt.Measurements, labels[g])
+			}
+			return stmt
+		},
+		SeriesFn: func() (browser.TimeSeries, error) {
+			var ts browser.TimeSeries
+			for _, l := range []string{"air_t_avg", "air_rh_avg"} {
+				ts = append(ts, &browser.Measurement{
+					Label:   l,
+					Station: &browser.Station{ID: 1, Name: "s1"},
+					Points: []*browser.Point{
+						{Timestamp: time.Date(2020, time.January, 1, 0, 15, 0, 0, browser.Location), Value: 1},
+					},
+				})
+			}
+			return ts, nil
+		},
+	}
+	h := NewHandler(WithDatabase(db))
+
+	// Duplicates and unknown groups are dropped, the order of the first
+	// occurrence is kept.
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=1&measurements=0&measurements=1&measurements=255"
+
+	testCases := map[string]struct {
+		reqBody    string
+		statusCode int
+		header     string
+	}{
+		"Default":  {filter, http.StatusOK, "time,station,landuse,elevation,latitude,longitude,air_t_avg,air_rh_avg\n"},
+		"Selected": {filter + "&order=selected", http.StatusOK, "time,station,landuse,elevation,latitude,longitude,air_rh_avg,air_t_avg\n"},
+		"Unknown":  {filter + "&order=random", http.StatusBadRequest, ""},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			queried = nil
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			if len(queried) == 0 {
+				t.Fatal("the filter was not queried")
+			}
+			want := []browser.Group{browser.RelativeHumidity, browser.AirTemperature}
+			if diff := cmp.Diff(want, queried[0]); diff != "" {
+				t.Fatalf("groups mismatch (-want +got):\n%s", diff)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if !bytes.HasPrefix(b, []byte(tc.header)) {
+				t.Fatalf("body does not start with %q:\n%q", tc.header, b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesDropEmpty(t *testing.T) {
+	db := &mock.Database{
+		SeriesFn: func() (browser.TimeSeries, error) {
+			var ts browser.TimeSeries
+			for _, v := range []float64{1, math.NaN()} {
+				ts = append(ts, &browser.Measurement{
+					Label:   fmt.Sprintf("m%v", v),
+					Station: &browser.Station{ID: 1, Name: "s1"},
+					Points: []*browser.Point{
+						{Timestamp: time.Date(2020, time.January, 1, 0, 15, 0, 0, browser.Location), Value: v},
+					},
+				})
+			}
+			return ts, nil
+		},
+	}
+	h := NewHandler(WithDatabase(db))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=1"
+
+	testCases := map[string]struct {
+		reqBody string
+		header  string
+	}{
+		"Keep": {filter, "time,station,landuse,elevation,latitude,longitude,m1,mNaN\n"},
+		"Drop": {filter + "&dropEmpty=1", "time,station,landuse,elevation,latitude,longitude,m1\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if !bytes.HasPrefix(b, []byte(tc.header)) {
+				t.Fatalf("body does not start with %q:\n%q", tc.header, b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesTrim(t *testing.T) {
+	nan := math.NaN()
+	measurement := func(label string, values ...float64) *browser.Measurement {
+		m := &browser.Measurement{
+			Label:   label,
+			Station: &browser.Station{ID: 1, Name: "s1"},
+		}
+		ts := time.Date(2020, time.January, 1, 0, 0, 0, 0, browser.Location)
+		for _, v := range values {
+			ts = ts.Add(15 * time.Minute)
+			m.Points = append(m.Points, &browser.Point{Timestamp: ts, Value: v})
+		}
+		return m
+	}
+	db := &mock.Database{
+		SeriesFn: func() (browser.TimeSeries, error) {
+			return browser.TimeSeries{
+				measurement("a", nan, 1, nan, 3, nan),
+				measurement("b", 10, 11, 12, nan, nan),
+				measurement("c", nan, nan, nan, nan, nan),
+			}, nil
+		},
+	}
+	h := NewHandler(WithDatabase(db))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=1"
+
+	testCases := map[string]struct {
+		reqBody string
+		want    string
+	}{
+		"Padded": {filter, `time,station,landuse,elevation,latitude,longitude,a,b,c
+,,,,,,,,
+2020-01-01 00:15:00,s1,,0,0,0,NaN,10,NaN
+2020-01-01 00:30:00,s1,,0,0,0,1,11,NaN
+2020-01-01 00:45:00,s1,,0,0,0,NaN,12,NaN
+2020-01-01 01:00:00,s1,,0,0,0,3,NaN,NaN
+2020-01-01 01:15:00,s1,,0,0,0,NaN,NaN,NaN
+`},
+		"Trim": {filter + "&trim=1", `time,station,landuse,elevation,latitude,longitude,a,b,c
+,,,,,,,,
+2020-01-01 00:15:00,s1,,0,0,0,NaN,10,NaN
+2020-01-01 00:30:00,s1,,0,0,0,1,11,NaN
+2020-01-01 00:45:00,s1,,0,0,0,NaN,12,NaN
+2020-01-01 01:00:00,s1,,0,0,0,3,NaN,NaN
+`},
+		"TrimWide": {filter + "&trim=1&format=wide", `station,s1,s1,s1
+landuse,,,
+latitude,0,0,0
+longitude,0,0,0
+elevation,0,0,0
+parameter,a,b,c
+depth,,,
+aggregation,,,
+unit,,,
+2020-01-01 00:15:00,NaN,10,NaN
+2020-01-01 00:30:00,1,11,NaN
+2020-01-01 00:45:00,NaN,12,NaN
+2020-01-01 01:00:00,3,NaN,NaN
+`},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if diff := cmp.Diff(tc.want, string(b)); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTrimPoints(t *testing.T) {
+	nan := math.NaN()
+	testCases := map[string]struct {
+		in   []float64
+		want []float64
+	}{
+		"Empty":    {nil, nil},
+		"AllNaN":   {[]float64{nan, nan}, nil},
+		"NoNaN":    {[]float64{1, 2}, []float64{1, 2}},
+		"Leading":  {[]float64{nan, nan, 1, 2}, []float64{1, 2}},
+		"Trailing": {[]float64{1, 2, nan}, []float64{1, 2}},
+		"Inner":    {[]float64{nan, 1, nan, 2, nan}, []float64{1, nan, 2}},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var points []*browser.Point
+			for _, v := range tc.in {
+				points = append(points, &browser.Point{Value: v})
+			}
+
+			var got []float64
+			for _, p := range trimPoints(points) {
+				got = append(got, p.Value)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateNaNs()); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesPrecision(t *testing.T) {
+	db := &mock.Database{
+		SeriesFn: func() (browser.TimeSeries, error) {
+			return browser.TimeSeries{
+				&browser.Measurement{
+					Label:   "a_avg",
+					Station: &browser.Station{ID: 1, Name: "s1"},
+					Points: []*browser.Point{
+						{Timestamp: time.Date(2020, time.January, 1, 0, 15, 0, 0, browser.Location), Value: 7.379999999},
+					},
+				},
+			}, nil
+		},
+	}
+	h := NewHandler(WithDatabase(db))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=1"
+
+	testCases := map[string]struct {
+		reqBody    string
+		statusCode int
+		value      string
+	}{
+		"Full":     {filter, http.StatusOK, ",7.379999999\n"},
+		"Two":      {filter + "&precision=2", http.StatusOK, ",7.38\n"},
+		"Negative": {filter + "&precision=-3", http.StatusOK, ",7\n"},
+		"Clamped":  {filter + "&precision=99", http.StatusOK, ",7.3799999990\n"},
+		"Wide":     {filter + "&precision=1&format=wide", http.StatusOK, ",7.4\n"},
+		"Invalid":  {filter + "&precision=a", http.StatusBadRequest, ""},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if !bytes.HasSuffix(b, []byte(tc.value)) {
+				t.Fatalf("body does not end with %q:\n%q", tc.value, b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesLabels(t *testing.T) {
+	db := &mock.Database{
+		SeriesFn: func() (browser.TimeSeries, error) {
+			var ts browser.TimeSeries
+			for _, label := range []string{"nr_up_sw_avg", "a_avg"} {
+				ts = append(ts, &browser.Measurement{
+					Label:   label,
+					Station: &browser.Station{ID: 1, Name: "s1"},
+					Points: []*browser.Point{
+						{Timestamp: time.Date(2020, time.January, 1, 0, 15, 0, 0, browser.Location), Value: 1},
+					},
+				})
+			}
+			return ts, nil
+		},
+	}
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=1"
+
+	testCases := map[string]struct {
+		options    []Option
+		reqBody    string
+		statusCode int
+		header     string
+	}{
+		"Default":  {nil, filter, http.StatusOK, "time,station,landuse,elevation,latitude,longitude,nr_up_sw_avg,a_avg\n"},
+		"Raw":      {nil, filter + "&labels=raw", http.StatusOK, "time,station,landuse,elevation,latitude,longitude,nr_up_sw_avg,a_avg\n"},
+		"Friendly": {nil, filter + "&labels=friendly", http.StatusOK, "time,station,landuse,elevation,latitude,longitude,shortwave_radiation_incoming_avg,a_avg\n"},
+		"Custom":   {[]Option{WithColumnAliases(map[string]string{"a_avg": "a"})}, filter + "&labels=friendly", http.StatusOK, "time,station,landuse,elevation,latitude,longitude,nr_up_sw_avg,a\n"},
+		"Unknown":  {nil, filter + "&labels=short", http.StatusBadRequest, ""},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := NewHandler(append([]Option{WithDatabase(db)}, tc.options...)...)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if !bytes.HasPrefix(b, []byte(tc.header)) {
+				t.Fatalf("body does not start with %q:\n%q", tc.header, b)
+			}
+		})
+	}
+}
+
+func TestDefaultAliases(t *testing.T) {
+	aliases := defaultAliases()
+	if len(aliases) == 0 {
+		t.Fatal("aliases.json contains no aliases")
+	}
+
+	// Aliases must be unique, since each names a column of its own.
+	seen := make(map[string]string)
+	for label, alias := range aliases {
+		if other, ok := seen[alias]; ok {
+			t.Errorf("alias %q is used by %q and %q", alias, label, other)
+		}
+		seen[alias] = label
+	}
+}
+
+func TestHandleSeriesFlags(t *testing.T) {
+	var withFlags bool
+	db := &mock.Database{
+		SeriesStreamFn: func(ctx context.Context, f *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+			withFlags = f.WithFlags
+
+			var ts browser.TimeSeries
+			for _, label := range []string{"a_avg", "a_avg" + browser.FlagSuffix, "b_avg"} {
+				ts = append(ts, &browser.Measurement{
+					Label:   label,
+					Station: &browser.Station{ID: 1, Name: "s1"},
+					Points: []*browser.Point{
+						{Timestamp: time.Date(2020, time.January, 1, 0, 15, 0, 0, browser.Location), Value: 1},
+					},
+				})
+			}
+			return browser.NewMeasurementIterator(ts), nil
+		},
+	}
+	h := NewHandler(WithDatabase(db))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=1"
+
+	testCases := map[string]struct {
+		reqBody   string
+		withFlags bool
+		header    string
+	}{
+		"None":      {filter, false, "time,station,landuse,elevation,latitude,longitude,a_avg,b_avg\n"},
+		"WithFlags": {filter + "&withFlags=1", true, "time,station,landuse,elevation,latitude,longitude,a_avg,a_avg_flag,b_avg\n"},
+		"ShowFlags": {filter + "&showFlags=on", true, "time,station,landuse,elevation,latitude,longitude,a_avg,a_avg_flag,b_avg\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			withFlags = false
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if withFlags != tc.withFlags {
+				t.Fatalf("got filter with flags %v, want %v", withFlags, tc.withFlags)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if !bytes.HasPrefix(b, []byte(tc.header)) {
+				t.Fatalf("body does not start with %q:\n%q", tc.header, b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesTimeZone(t *testing.T) {
+	var filter *browser.SeriesFilter
+	db := &mock.Database{
+		SeriesStreamFn: func(ctx context.Context, f *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+			filter = f
+
+			// The second measurement misses the first point, so that its
+			// values are merged into the rows by timestamp.
+			start := f.Start.Add(15 * time.Minute)
+			ts := browser.TimeSeries{
+				&browser.Measurement{Label: "a_avg", Station: &browser.Station{ID: 1, Name: "s1"}},
+				&browser.Measurement{Label: "b_avg", Station: &browser.Station{ID: 1, Name: "s1"}},
+			}
+			for i := 0; i < 2; i++ {
+				for j, m := range ts {
+					if j == 1 && i == 0 {
+						continue
+					}
+					m.Points = append(m.Points, &browser.Point{
+						Timestamp: start.Add(time.Duration(i) * 15 * time.Minute),
+						Value:     float64(i),
+					})
+				}
+			}
+			return browser.NewMeasurementIterator(ts), nil
+		},
+	}
+	h := NewHandler(WithDatabase(db))
+
+	const form = "startDate=2020-01-15&endDate=2020-01-15&stations=1&measurements=1"
+
+	testCases := map[string]struct {
+		reqBody    string
+		statusCode int
+		start      time.Time
+		body       string
+	}{
+		"Local": {form, http.StatusOK, time.Date(2020, 1, 15, 0, 0, 0, 0, browser.Location), `time,station,landuse,elevation,latitude,longitude,a_avg,b_avg
+,,,,,,,
+2020-01-15 00:15:00,s1,,0,0,0,0,NaN
+2020-01-15 00:30:00,s1,,0,0,0,1,1
+`},
+		"UTC": {form + "&tz=UTC", http.StatusOK, time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), `time,station,landuse,elevation,latitude,longitude,a_avg,b_avg
+,,,,,,,
+2020-01-15 00:15:00,s1,,0,0,0,0,NaN
+2020-01-15 00:30:00,s1,,0,0,0,1,1
+`},
+		"Unknown": {form + "&tz=CET", http.StatusInternalServerError, time.Time{}, ""},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			filter = nil
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			if !filter.Start.Equal(tc.start) || filter.Start.Location() != tc.start.Location() {
+				t.Fatalf("got start %v, want %v", filter.Start, tc.start)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if diff := cmp.Diff(tc.body, string(b)); diff != "" {
+				t.Fatalf("body mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesSensor(t *testing.T) {
+	var labels []string
+	db := &mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			labels = f.Labels
+			return &browser.Stmt{Measurements: f.Labels}
+		},
+		SeriesFn: func() (browser.TimeSeries, error) {
+			return new(testBackend).Series(context.Background(), nil)
+		},
+	}
+	stations := &mock.StationService{
+		SensorsFn: func(ctx context.Context, id int64) ([]*browser.Sensor, error) {
+			switch id {
+			case 2:
+				return []*browser.Sensor{
+					{ID: 7, Name: "Datalogger", StationID: 2},
+					{ID: 12, Name: "Thermohygrometer", StationID: 2, Measurements: []string{"air_t_avg", "air_rh_avg"}},
+				}, nil
+			case 3:
+				return nil, errors.New("snipeit unavailable")
+			}
+			return nil, nil
+		},
+	}
+	h := NewHandler(WithDatabase(db), WithStationService(stations))
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&measurements=0&measurements=1"
+
+	testCases := map[string]struct {
+		reqBody    string
+		statusCode int
+		labels     []string
+	}{
+		"NoSensor":       {filter + "&stations=2", http.StatusOK, nil},
+		"Sensor":         {filter + "&stations=2&sensor=12", http.StatusOK, []string{"air_t_avg", "air_rh_avg"}},
+		"NoMeasurements": {filter + "&stations=2&sensor=7", http.StatusBadRequest, nil},
+		"OtherStation":   {filter + "&stations=1&sensor=12", http.StatusBadRequest, nil},
+		"TwoStations":    {filter + "&stations=1&stations=2&sensor=12", http.StatusBadRequest, nil},
+		"Invalid":        {filter + "&stations=2&sensor=a", http.StatusBadRequest, nil},
+		"ServiceError":   {filter + "&stations=3&sensor=12", http.StatusInternalServerError, nil},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			labels = nil
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got, want := w.Result().StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if diff := cmp.Diff(tc.labels, labels); diff != "" {
+				t.Fatalf("labels mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesMaxPoints(t *testing.T) {
+	db := &mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			return &browser.Stmt{Measurements: []string{"air_t_avg", "air_rh_avg"}}
+		},
+		SeriesFn: func() (browser.TimeSeries, error) {
+			return new(testBackend).Series(context.Background(), nil)
+		},
+	}
+
+	// 185 days with 96 points each for two measurements are 35520 points per
+	// station.
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&measurements=1&stations=1"
+
+	testCases := map[string]struct {
+		maxPoints  int64
+		reqBody    string
+		statusCode int
+	}{
+		"Under":            {40000, filter, http.StatusOK},
+		"Exact":            {35520, filter, http.StatusOK},
+		"Over":             {30000, filter, http.StatusRequestEntityTooLarge},
+		"OverTwoStations":  {40000, filter + "&stations=2", http.StatusRequestEntityTooLarge},
+		"UnderWithLimit":   {30000, filter + "&limit=100", http.StatusOK},
+		"MaxLimit":         {40000, filter + fmt.Sprintf("&limit=%d", browser.MaxLimit), http.StatusOK},
+		"LimitExceeded":    {40000, filter + fmt.Sprintf("&limit=%d", browser.MaxLimit+1), http.StatusBadRequest},
+		"OverShorterRange": {30000, "startDate=2019-07-23&endDate=2019-12-23&measurements=1&stations=1", http.StatusOK},
+		"Disabled":         {0, filter + "&stations=2", http.StatusOK},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := NewHandler(WithDatabase(db), WithMaxPoints(tc.maxPoints))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusRequestEntityTooLarge {
+				return
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if !strings.Contains(string(b), "shorter time range") {
+				t.Fatalf("got message %q, want a suggestion for a shorter time range", b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesMaxMeasurements(t *testing.T) {
+	db := &mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			return &browser.Stmt{Measurements: []string{"air_t_avg", "air_rh_avg", "wind_speed_avg"}}
+		},
+		SeriesFn: func() (browser.TimeSeries, error) {
+			return new(testBackend).Series(context.Background(), nil)
+		},
+	}
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&measurements=1&stations=1"
+
+	testCases := map[string]struct {
+		maxMeasurements int
+		ctx             context.Context
+		statusCode      int
+	}{
+		"Under":      {4, withCTX(browser.Public), http.StatusOK},
+		"Exact":      {3, withCTX(browser.Public), http.StatusOK},
+		"Over":       {2, withCTX(browser.Public), http.StatusRequestEntityTooLarge},
+		"External":   {2, withCTX(browser.External), http.StatusRequestEntityTooLarge},
+		"FullAccess": {2, withCTX(browser.FullAccess), http.StatusOK},
+		"Disabled":   {0, withCTX(browser.Public), http.StatusOK},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := NewHandler(WithDatabase(db), WithMaxPoints(0), WithMaxMeasurements(tc.maxMeasurements))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(filter))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusRequestEntityTooLarge {
+				return
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if !strings.Contains(string(b), "fewer measurements") {
+				t.Fatalf("got message %q, want a suggestion for fewer measurements", b)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesRange(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	do := func(t *testing.T, header map[string]string) (*http.Response, []byte) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(filter))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range header {
+			req.Header.Add(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		resp := w.Result()
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+		}
+		return resp, b
+	}
+
+	full, body := do(t, nil)
+	if got := full.Header.Get("Accept-Ranges"); got != "bytes" {
+		t.Fatalf("got Accept-Ranges %q, want %q", got, "bytes")
+	}
+	size := len(body)
+
+	// The ETag is only known after buffering the export.
+	resp, _ := do(t, map[string]string{"Range": "bytes=0-"})
+	tag := resp.Header.Get("ETag")
+	if tag == "" {
+		t.Fatal("got no ETag for range request")
+	}
+
+	testCases := map[string]struct {
+		header       map[string]string
+		statusCode   int
+		contentRange string
+		want         []byte
+	}{
+		"Slice":          {map[string]string{"Range": "bytes=10-19"}, http.StatusPartialContent, fmt.Sprintf("bytes 10-19/%d", size), body[10:20]},
+		"Resume":         {map[string]string{"Range": "bytes=100-"}, http.StatusPartialContent, fmt.Sprintf("bytes 100-%d/%d", size-1, size), body[100:]},
+		"Suffix":         {map[string]string{"Range": "bytes=-5"}, http.StatusPartialContent, fmt.Sprintf("bytes %d-%d/%d", size-5, size-1, size), body[size-5:]},
+		"IfRangeMatch":   {map[string]string{"Range": "bytes=10-19", "If-Range": tag}, http.StatusPartialContent, fmt.Sprintf("bytes 10-19/%d", size), body[10:20]},
+		"IfRangeChanged": {map[string]string{"Range": "bytes=10-19", "If-Range": `"changed"`}, http.StatusOK, "", body},
+		"Unsatisfiable":  {map[string]string{"Range": fmt.Sprintf("bytes=%d-", size+10)}, http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("bytes */%d", size), nil},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			resp, b := do(t, tc.header)
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if got, want := resp.Header.Get("Content-Range"), tc.contentRange; got != want {
+				t.Errorf("got Content-Range %q, want %q", got, want)
+			}
+			if tc.want != nil && !bytes.Equal(b, tc.want) {
+				t.Errorf("got body %q, want %q", b, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesResume(t *testing.T) {
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	now := time.Date(2021, time.June, 1, 10, 0, 0, 0, time.UTC)
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+		h.now = func() time.Time { return now }
+	})
+
+	do := func(t *testing.T, h *Handler, body string, header map[string]string) (*http.Response, []byte) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range header {
+			req.Header.Add(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result(), w.Body.Bytes()
+	}
+
+	filename := func(ts time.Time, ext string) string {
+		return fmt.Sprintf("attachment; filename=LTSER_IT25_Matsch_Mazia_%d.%s", ts.Unix(), ext)
+	}
+
+	testCases := map[string]struct {
+		body string
+		ext  string
+	}{
+		"CSV":        {filter, "csv"},
+		"Zip":        {filter + "&bundle=zip", "zip"},
+		"FullHeader": {filter + "&header=full", "csv"},
+		"All":        {filter + "&bundle=zip&checksum=1&header=full", "zip"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			exported := time.Date(2021, time.June, 1, 10, 0, 0, 0, time.UTC)
+			now = exported
+			first, body := do(t, h, tc.body, map[string]string{"Range": "bytes=0-"})
+			if got, want := first.StatusCode, http.StatusPartialContent; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if got, want := first.Header.Get("Content-Disposition"), filename(exported, tc.ext); got != want {
+				t.Errorf("got Content-Disposition %q, want %q", got, want)
+			}
+			tag := first.Header.Get("ETag")
+
+			// Resuming a day later returns the rest of the same export.
+			now = exported.Add(24 * time.Hour)
+			resp, b := do(t, h, tc.body, map[string]string{"Range": "bytes=10-", "If-Range": tag})
+			if got, want := resp.StatusCode, http.StatusPartialContent; got != want {
+				t.Fatalf("resume: got unexpected status code: %d, want %d", got, want)
+			}
+			if !bytes.Equal(b, body[10:]) {
+				t.Errorf("resume: got body %q, want %q", b, body[10:])
+			}
+			if got, want := resp.Header.Get("Content-Disposition"), filename(exported, tc.ext); got != want {
+				t.Errorf("resume: got Content-Disposition %q, want %q", got, want)
+			}
+			if got := resp.Header.Get("ETag"); got != tag {
+				t.Errorf("resume: got ETag %q, want %q", got, tag)
+			}
+
+			// A changed export is sent in full and dated with the current
+			// time.
+			changed := fmt.Sprintf(`"%d-changed"`, exported.Unix())
+			resp, _ = do(t, h, tc.body, map[string]string{"Range": "bytes=10-", "If-Range": changed})
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("changed: got unexpected status code: %d, want %d", got, want)
+			}
+			if got, want := resp.Header.Get("Content-Disposition"), filename(now, tc.ext); got != want {
+				t.Errorf("changed: got Content-Disposition %q, want %q", got, want)
+			}
+		})
+	}
+
+	t.Run("ExportedLine", func(t *testing.T) {
+		now = time.Date(2021, time.June, 1, 10, 0, 0, 0, time.UTC)
+		_, b := do(t, h, filter+"&header=full", map[string]string{"Range": "bytes=0-"})
+		if want := "# Exported: 2021-06-01T11:00:00+01:00\n"; !bytes.Contains(b, []byte(want)) {
+			t.Errorf("body does not contain %q:\n%s", want, b)
+		}
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		h := NewHandler(WithMaxPoints(0), func(h *Handler) {
+			h.db = new(testBackend)
+		})
+		resp, _ := do(t, h, filter, map[string]string{"Range": "bytes=0-9"})
+
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("got unexpected status code: %d, want %d", got, want)
+		}
+		for _, header := range []string{"Accept-Ranges", "Content-Range", "ETag"} {
+			if got := resp.Header.Get(header); got != "" {
+				t.Errorf("got %s %q, want none", header, got)
+			}
+		}
+	})
+}
+
+func TestHandleSeriesFullHeader(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	testCases := map[string]struct {
+		reqBody    string
+		statusCode int
+		prefix     string
+	}{
+		"Default": {filter, http.StatusOK, "time,station"},
+		"Full":    {filter + "&header=full", http.StatusOK, "# Exported: "},
+		"Unknown": {filter + "&header=short", http.StatusBadRequest, ""},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if !bytes.HasPrefix(b, []byte(tc.prefix)) {
+				t.Fatalf("body does not start with %q:\n%s", tc.prefix, b)
+			}
+
+			full := strings.Contains(tc.reqBody, "header=full")
+			for _, line := range []string{"# Date range: 2019-07-23 - 2020-01-23\n", "# Stations: station\n", "# Citation: " + citation + "\n"} {
+				if got := bytes.Contains(b, []byte(line)); got != full {
+					t.Errorf("got line %q in body %t, want %t", line, got, full)
+				}
+			}
+		})
+	}
+}
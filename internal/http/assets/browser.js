@@ -17,6 +17,18 @@
 //	mapEl - map element
 //	scrollToTopEl - element for scrolling back to top
 //	stationModal - modal dialog for showing station information
+// validCoordinates reports whether the given latitude and longitude are
+// within [-90, 90] and [-180, 180] and not -1, -1.
+function validCoordinates(lat, lon) {
+	if (typeof lat !== 'number' || typeof lon !== 'number') {
+		return false;
+	}
+	if (lat === -1 && lon === -1) {
+		return false;
+	}
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180;
+}
+
 function browser(opts) {
 	const mapMarkers = {};
 
@@ -75,6 +87,12 @@ function browser(opts) {
 		Object.keys(opts.data).map(function(k) {
 			let item = opts.data[k];
 
+			// Skip stations without valid coordinates, -1, -1 is used for
+			// coordinates which could not be parsed.
+			if (!validCoordinates(item.Latitude, item.Longitude)) {
+				return;
+			}
+
 			let marker = L.marker([item.Latitude, item.Longitude]).addTo(map);
 			marker.on('click', function(e) {
 				$('.modal-content').load("/api/v1/stations/"+item.ID, function(result) {
@@ -208,6 +226,9 @@ function browser(opts) {
 		$(opts.stationEl).children('option').map(function() {
 			let el = $(this)
 			let m = mapMarkers[el.val()];
+			if (m === undefined) {
+				return;
+			}
 
 			if (el.prop('selected')) {
 				m.setIcon(yellow);
@@ -387,8 +408,10 @@ function browser(opts) {
 					stations.add(item.ID);
 					landuse.add(item.Landuse);
 
-					marker.setOpacity(1.0);
-				} else {
+					if (marker !== undefined) {
+						marker.setOpacity(1.0);
+					}
+				} else if (marker !== undefined) {
 					marker.setOpacity(0.4);
 				}
 			});
@@ -0,0 +1,279 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/encoding/csv"
+)
+
+// bundleWriter writes an export as single file of a ZIP archive. If a checksum
+// is requested, the SHA-256 checksum of the export is computed while writing
+// and added as sidecar file in the format of sha256sum, so that large exports
+// need not be buffered.
+type bundleWriter struct {
+	zw   *zip.Writer
+	w    io.Writer
+	name string
+	hash hash.Hash
+}
+
+// newBundleWriter returns a bundleWriter writing the archive to w. The file
+// of the export must be created with Create before writing.
+func newBundleWriter(w io.Writer, checksum bool) *bundleWriter {
+	b := &bundleWriter{
+		zw: zip.NewWriter(w),
+	}
+	if checksum {
+		b.hash = sha256.New()
+	}
+	return b
+}
+
+// Create creates the file of the export with the given name inside the
+// archive.
+func (b *bundleWriter) Create(name string) error {
+	fw, err := b.zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	b.name = name
+	b.w = fw
+	if b.hash != nil {
+		b.w = io.MultiWriter(fw, b.hash)
+	}
+	return nil
+}
+
+func (b *bundleWriter) Write(p []byte) (int, error) {
+	if b.w == nil {
+		return 0, errors.New("bundle: no file created")
+	}
+	return b.w.Write(p)
+}
+
+// Close adds the checksum file, if requested, and finishes the archive.
+func (b *bundleWriter) Close() error {
+	if b.hash != nil {
+		fw, err := b.zw.Create(b.name + ".sha256")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(fw, "%x  %s\n", b.hash.Sum(nil), b.name); err != nil {
+			return err
+		}
+	}
+	return b.zw.Close()
+}
+
+// stationsWriter writes the time series of each station as separate CSV file
+// of a ZIP archive, named by the station. The measurements are partitioned by
+// station, therefore the whole time series is read before writing.
+type stationsWriter struct {
+	zw   *zip.Writer
+	opts []csv.Option
+}
+
+// newStationsWriter returns a stationsWriter writing the archive to w. The CSV
+// files are written with the given options.
+func newStationsWriter(w io.Writer, options ...csv.Option) *stationsWriter {
+	return &stationsWriter{
+		zw:   zip.NewWriter(w),
+		opts: options,
+	}
+}
+
+// Write writes one CSV file for each station of the given browser.TimeSeries
+// and finishes the archive.
+func (s *stationsWriter) Write(ts browser.TimeSeries) error {
+	if len(ts) == 0 {
+		return browser.ErrDataNotFound
+	}
+
+	for _, p := range partitionByStation(ts) {
+		fw, err := s.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if err := csv.NewWriter(fw, s.opts...).Write(p.ts); err != nil {
+			return err
+		}
+	}
+
+	return s.zw.Close()
+}
+
+// WriteStream reads the given iterator until io.EOF and writes the
+// measurements as with Write.
+func (s *stationsWriter) WriteStream(it browser.MeasurementIterator) error {
+	ts, err := browser.ReadTimeSeries(it)
+	if err != nil {
+		return err
+	}
+	return s.Write(ts)
+}
+
+// WriteHeader writes an archive without any file.
+func (s *stationsWriter) WriteHeader() error {
+	return s.zw.Close()
+}
+
+// stationPartition holds the measurements of a single station and the name of
+// its file.
+type stationPartition struct {
+	name string
+	ts   browser.TimeSeries
+}
+
+// partitionByStation splits the given time series by station, ordered by name
+// and by id for stations sharing the same name. Files are named by the
+// station, the id is added to the names shared by multiple stations.
+func partitionByStation(ts browser.TimeSeries) []*stationPartition {
+	var (
+		parts []*stationPartition
+		byID  = make(map[int64]*stationPartition)
+		names = make(map[string]int)
+	)
+	for _, m := range ts {
+		p, ok := byID[m.Station.ID]
+		if !ok {
+			p = &stationPartition{}
+			byID[m.Station.ID] = p
+			parts = append(parts, p)
+			names[m.Station.Name]++
+		}
+		p.ts = append(p.ts, m)
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		a, b := parts[i].ts[0].Station, parts[j].ts[0].Station
+		if a.Name == b.Name {
+			return a.ID < b.ID
+		}
+		return a.Name < b.Name
+	})
+
+	for _, p := range parts {
+		st := p.ts[0].Station
+		name := strings.NewReplacer("/", "_", "\\", "_").Replace(st.Name)
+		if names[st.Name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, st.ID)
+		}
+		p.name = name + ".csv"
+	}
+
+	return parts
+}
+
+// yearsWriter writes the time series of each calendar year as separate CSV
+// file of a ZIP archive, named by the year. Years are those of the given
+// location, so that the first hour of a year in LTER local time, which is still
+// the previous year in UTC, ends up in the file of its year. The measurements
+// are partitioned by year, therefore the whole time series is read before
+// writing.
+type yearsWriter struct {
+	zw   *zip.Writer
+	loc  *time.Location
+	opts []csv.Option
+}
+
+// newYearsWriter returns a yearsWriter writing the archive to w. The CSV files
+// are written with the given options.
+func newYearsWriter(w io.Writer, loc *time.Location, options ...csv.Option) *yearsWriter {
+	return &yearsWriter{
+		zw:   zip.NewWriter(w),
+		loc:  loc,
+		opts: options,
+	}
+}
+
+// Write writes one CSV file for each calendar year of the given
+// browser.TimeSeries and finishes the archive.
+func (y *yearsWriter) Write(ts browser.TimeSeries) error {
+	if len(ts) == 0 {
+		return browser.ErrDataNotFound
+	}
+
+	for _, p := range partitionByYear(ts, y.loc) {
+		fw, err := y.zw.Create(fmt.Sprintf("%d.csv", p.year))
+		if err != nil {
+			return err
+		}
+		if err := csv.NewWriter(fw, y.opts...).Write(p.ts); err != nil {
+			return err
+		}
+	}
+
+	return y.zw.Close()
+}
+
+// WriteStream reads the given iterator until io.EOF and writes the
+// measurements as with Write.
+func (y *yearsWriter) WriteStream(it browser.MeasurementIterator) error {
+	ts, err := browser.ReadTimeSeries(it)
+	if err != nil {
+		return err
+	}
+	return y.Write(ts)
+}
+
+// WriteHeader writes an archive without any file.
+func (y *yearsWriter) WriteHeader() error {
+	return y.zw.Close()
+}
+
+// yearPartition holds the points of the measurements within a single calendar
+// year.
+type yearPartition struct {
+	year int
+	ts   browser.TimeSeries
+}
+
+// partitionByYear splits the points of the given time series by their calendar
+// year in the given location, ordered by year. Each partition holds a copy of
+// every measurement having points in the year.
+func partitionByYear(ts browser.TimeSeries, loc *time.Location) []*yearPartition {
+	var (
+		parts  []*yearPartition
+		byYear = make(map[int]*yearPartition)
+	)
+	for _, m := range ts {
+		subsets := make(map[int]*browser.Measurement)
+		for _, p := range m.Points {
+			year := p.Timestamp.In(loc).Year()
+
+			sub, ok := subsets[year]
+			if !ok {
+				c := *m
+				c.Points = nil
+				sub = &c
+				subsets[year] = sub
+
+				part, ok := byYear[year]
+				if !ok {
+					part = &yearPartition{year: year}
+					byYear[year] = part
+					parts = append(parts, part)
+				}
+				part.ts = append(part.ts, sub)
+			}
+			sub.Points = append(sub.Points, p)
+		}
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].year < parts[j].year })
+	return parts
+}
@@ -0,0 +1,393 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/encoding/csv"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleSeriesBundle(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	post := func(t *testing.T, body string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	readAll := func(t *testing.T, resp *http.Response) []byte {
+		t.Helper()
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+		}
+		return b
+	}
+
+	plain := readAll(t, post(t, filter))
+
+	testCases := map[string]struct {
+		reqBody  string
+		checksum bool
+	}{
+		"Bundle":         {filter + "&bundle=zip", false},
+		"BundleChecksum": {filter + "&bundle=zip&checksum=1", true},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			resp := post(t, tc.reqBody)
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if got, want := resp.Header.Get("Content-Type"), "application/zip"; got != want {
+				t.Fatalf("response header content-type: got %s, want %s", got, want)
+			}
+			if got := resp.Header.Get("Content-Disposition"); !strings.HasSuffix(got, ".zip") {
+				t.Fatalf("got Content-Disposition %q, want a .zip file", got)
+			}
+
+			b := readAll(t, resp)
+			z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := make(map[string][]byte)
+			var names []string
+			for _, f := range z.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				content, err := ioutil.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				files[f.Name] = content
+				names = append(names, f.Name)
+			}
+			sort.Strings(names)
+
+			if len(names) == 0 || !strings.HasSuffix(names[0], ".csv") {
+				t.Fatalf("bundle has no CSV file: %v", names)
+			}
+			name := names[0]
+
+			if !bytes.Equal(files[name], plain) {
+				t.Fatalf("got CSV %q, want %q", files[name], plain)
+			}
+
+			want := []string{name}
+			if tc.checksum {
+				want = append(want, name+".sha256")
+			}
+			if diff := cmp.Diff(want, names); diff != "" {
+				t.Fatalf("files mismatch (-want +got):\n%s", diff)
+			}
+
+			if !tc.checksum {
+				return
+			}
+			wantSum := fmt.Sprintf("%x  %s\n", sha256.Sum256(files[name]), name)
+			if diff := cmp.Diff(wantSum, string(files[name+".sha256"])); diff != "" {
+				t.Fatalf("checksum mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesBundleInvalid(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	testCases := map[string]string{
+		"ChecksumWithoutBundle": filter + "&checksum=1",
+		"UnknownBundle":         filter + "&bundle=tar",
+	}
+
+	for k, body := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got, want := w.Result().StatusCode, http.StatusBadRequest; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+// stationsBackend returns a measurement for each of its stations.
+type stationsBackend struct {
+	testBackend
+	stations []*browser.Station
+}
+
+func (b *stationsBackend) Series(ctx context.Context, f *browser.SeriesFilter) (browser.TimeSeries, error) {
+	var ts browser.TimeSeries
+	for _, st := range b.stations {
+		m := &browser.Measurement{
+			Label:   "a_avg",
+			Station: st,
+			Unit:    "c",
+		}
+		for i := 0; i < 2; i++ {
+			m.Points = append(m.Points, &browser.Point{
+				Timestamp: time.Date(2020, time.January, 1, 0, 15*i, 0, 0, browser.Location),
+				Value:     float64(st.ID*10) + float64(i),
+			})
+		}
+		ts = append(ts, m)
+	}
+	return ts, nil
+}
+
+func (b *stationsBackend) SeriesStream(ctx context.Context, f *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+	ts, err := b.Series(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return browser.NewMeasurementIterator(ts), nil
+}
+
+func TestHandleSeriesZip(t *testing.T) {
+	db := &stationsBackend{
+		stations: []*browser.Station{
+			{ID: 2, Name: "s2"},
+			{ID: 1, Name: "s1"},
+			{ID: 4, Name: "s3"},
+			{ID: 3, Name: "s3"},
+		},
+	}
+	h := NewHandler(func(h *Handler) {
+		h.db = db
+	})
+
+	body := "startDate=2019-07-23&endDate=2020-01-23&stations=1,2,3,4&measurements=a&format=zip"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "application/zip"; got != want {
+		t.Fatalf("response header content-type: got %s, want %s", got, want)
+	}
+	if got := resp.Header.Get("Content-Disposition"); !strings.HasSuffix(got, ".zip") {
+		t.Fatalf("got Content-Disposition %q, want a .zip file", got)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	var names []string
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[f.Name] = string(content)
+		names = append(names, f.Name)
+	}
+
+	if diff := cmp.Diff([]string{"s1.csv", "s2.csv", "s3_3.csv", "s3_4.csv"}, names); diff != "" {
+		t.Fatalf("files mismatch (-want +got):\n%s", diff)
+	}
+
+	ts, err := db.Series(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]string)
+	for _, m := range ts {
+		name := m.Station.Name + ".csv"
+		if m.Station.Name == "s3" {
+			name = fmt.Sprintf("s3_%d.csv", m.Station.ID)
+		}
+		var buf bytes.Buffer
+		if err := csv.NewWriter(&buf).Write(browser.TimeSeries{m}); err != nil {
+			t.Fatal(err)
+		}
+		want[name] = buf.String()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("content mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleSeriesZipBundle(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	body := "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a&format=zip&bundle=zip"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got, want := w.Result().StatusCode, http.StatusBadRequest; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+}
+
+func TestHandleSeriesSplitByYear(t *testing.T) {
+	// The last point of 2019 in UTC is the first point of 2020 in LTER local
+	// time (UTC+1).
+	utc := []time.Time{
+		time.Date(2019, time.December, 31, 22, 45, 0, 0, time.UTC),
+		time.Date(2019, time.December, 31, 23, 0, 0, 0, time.UTC),
+		time.Date(2019, time.December, 31, 23, 15, 0, 0, time.UTC),
+	}
+
+	db := &mock.Database{
+		SeriesStreamFn: func(ctx context.Context, f *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+			m := &browser.Measurement{
+				Label:   "a_avg",
+				Station: &browser.Station{ID: 1, Name: "s1"},
+				Unit:    "c",
+			}
+			for i, t := range utc {
+				m.Points = append(m.Points, &browser.Point{Timestamp: t.In(f.Location()), Value: float64(i)})
+			}
+			return browser.NewMeasurementIterator(browser.TimeSeries{m}), nil
+		},
+	}
+	h := NewHandler(WithDatabase(db))
+
+	const filter = "startDate=2019-12-31&endDate=2020-01-01&stations=1&measurements=a&splitBy=year"
+
+	testCases := map[string]struct {
+		reqBody string
+		want    map[string]string
+	}{
+		"Local": {filter, map[string]string{
+			"2019.csv": "time,station,landuse,elevation,latitude,longitude,a_avg\n,,,,,,c\n2019-12-31 23:45:00,s1,,0,0,0,0\n",
+			"2020.csv": "time,station,landuse,elevation,latitude,longitude,a_avg\n,,,,,,c\n2020-01-01 00:00:00,s1,,0,0,0,1\n2020-01-01 00:15:00,s1,,0,0,0,2\n",
+		}},
+		"UTC": {filter + "&tz=UTC", map[string]string{
+			"2019.csv": "time,station,landuse,elevation,latitude,longitude,a_avg\n,,,,,,c\n2019-12-31 22:45:00,s1,,0,0,0,0\n2019-12-31 23:00:00,s1,,0,0,0,1\n2019-12-31 23:15:00,s1,,0,0,0,2\n",
+		}},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(tc.reqBody))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if got, want := resp.Header.Get("Content-Type"), "application/zip"; got != want {
+				t.Fatalf("response header content-type: got %s, want %s", got, want)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]string)
+			for _, f := range z.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				content, err := ioutil.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[f.Name] = string(content)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("files mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesSplitByYearInvalid(t *testing.T) {
+	h := NewHandler(func(h *Handler) {
+		h.db = new(testBackend)
+	})
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	testCases := map[string]string{
+		"Unknown": filter + "&splitBy=month",
+		"Format":  filter + "&splitBy=year&format=wide",
+		"Bundle":  filter + "&splitBy=year&bundle=zip",
+	}
+
+	for k, body := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got, want := w.Result().StatusCode, http.StatusBadRequest; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/euracresearch/browser"
+)
+
+// coverageJSON is the availability of the data of a measurement at a station
+// as returned by the coverage endpoint.
+type coverageJSON struct {
+	StationID int64     `json:"stationId"`
+	Station   string    `json:"station"`
+	Label     string    `json:"label"`
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+	Points    int64     `json:"points"`
+}
+
+// handleCoverage returns for the measurements and stations given by the query
+// parameters measurements and stations the timestamps of the first and last
+// points and the number of points as JSON, so that users know which date
+// ranges have data before downloading. The optional query parameters
+// startDate and endDate restrict the coverage to the given days. Measurements
+// are filtered by the role of the user like for downloads.
+func (h *Handler) handleCoverage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(w, r, errors.New("Expected GET request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter, err := parseCoverageFilter(r)
+		if err != nil {
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		coverage, err := h.db.Coverage(r.Context(), filter)
+		if errors.Is(err, browser.ErrCatalogNotPopulated) {
+			apiError(w, r, err, http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil && !errors.Is(err, browser.ErrDataNotFound) {
+			apiError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		resp := make([]coverageJSON, len(coverage))
+		for i, c := range coverage {
+			resp[i] = coverageJSON{
+				Label:  c.Label,
+				First:  c.First,
+				Last:   c.Last,
+				Points: c.Points,
+			}
+			if c.Station != nil {
+				resp[i].StationID = c.Station.ID
+				resp[i].Station = c.Station.Name
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("coverage: %v", err)
+		}
+	}
+}
+
+// parseCoverageFilter parses the stations and measurements and the optional
+// date range of a coverage request from the given request. Either both dates
+// or none must be given.
+func parseCoverageFilter(r *http.Request) (*browser.SeriesFilter, error) {
+	filter, err := parseLiveFilter(r)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := r.FormValue("startDate"), r.FormValue("endDate")
+	if start == "" && end == "" {
+		return filter, nil
+	}
+
+	filter.Start, err = time.ParseInLocation("2006-01-02", start, browser.Location)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse start date %v", err)
+	}
+	filter.End, err = time.ParseInLocation("2006-01-02", end, browser.Location)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse end date %v", err)
+	}
+	if filter.End.Before(filter.Start) {
+		return nil, errors.New("end date is before start date")
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleCoverage(t *testing.T) {
+	var got *browser.SeriesFilter
+	h := NewHandler(WithDatabase(&mock.Database{
+		CoverageFn: func(ctx context.Context, f *browser.SeriesFilter) ([]browser.Coverage, error) {
+			got = f
+			if f.Stations[0] == "2" {
+				return nil, browser.ErrDataNotFound
+			}
+			return []browser.Coverage{
+				{
+					Label:   "air_t_avg",
+					Station: &browser.Station{ID: 1, Name: "b1"},
+					First:   time.Date(2019, time.January, 1, 0, 15, 0, 0, browser.Location),
+					Last:    time.Date(2020, time.May, 4, 12, 30, 0, 0, browser.Location),
+					Points:  48000,
+				},
+			}, nil
+		},
+	}))
+
+	testCases := map[string]struct {
+		query      string
+		statusCode int
+		body       string
+		start, end time.Time
+	}{
+		"AllTime": {
+			query:      "stations=1&measurements=1",
+			statusCode: http.StatusOK,
+			body:       `[{"stationId":1,"station":"b1","label":"air_t_avg","first":"2019-01-01T00:15:00+01:00","last":"2020-05-04T12:30:00+01:00","points":48000}]` + "\n",
+		},
+		"Range": {
+			query:      "stations=1&measurements=1&startDate=2019-01-01&endDate=2020-12-31",
+			statusCode: http.StatusOK,
+			body:       `[{"stationId":1,"station":"b1","label":"air_t_avg","first":"2019-01-01T00:15:00+01:00","last":"2020-05-04T12:30:00+01:00","points":48000}]` + "\n",
+			start:      time.Date(2019, time.January, 1, 0, 0, 0, 0, browser.Location),
+			end:        time.Date(2020, time.December, 31, 0, 0, 0, 0, browser.Location),
+		},
+		"NoData":        {query: "stations=2&measurements=1", statusCode: http.StatusOK, body: "[]\n"},
+		"NoStation":     {query: "measurements=1", statusCode: http.StatusBadRequest},
+		"NoMeasurement": {query: "stations=1", statusCode: http.StatusBadRequest},
+		"OnlyStart":     {query: "stations=1&measurements=1&startDate=2019-01-01", statusCode: http.StatusBadRequest},
+		"InvalidDate":   {query: "stations=1&measurements=1&startDate=2019-01-01&endDate=2020-13-01", statusCode: http.StatusBadRequest},
+		"Reversed":      {query: "stations=1&measurements=1&startDate=2020-01-01&endDate=2019-01-01", statusCode: http.StatusBadRequest},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/coverage?"+tc.query, nil)
+			req = req.WithContext(withCTX(browser.External))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				t.Fatalf("got unexpected status code: %d, want %d", resp.StatusCode, tc.statusCode)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			if got, want := resp.Header.Get("Content-Type"), "application/json"; got != want {
+				t.Errorf("got Content-Type %q, want %q", got, want)
+			}
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+			if diff := cmp.Diff(tc.body, string(b)); diff != "" {
+				t.Fatalf("body mismatch (-want +got):\n%s", diff)
+			}
+
+			if !got.Start.Equal(tc.start) || !got.End.Equal(tc.end) {
+				t.Errorf("got range %v - %v, want %v - %v", got.Start, got.End, tc.start, tc.end)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/coverage?stations=1&measurements=1", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got, want := w.Result().StatusCode, http.StatusMethodNotAllowed; got != want {
+		t.Fatalf("POST: got unexpected status code: %d, want %d", got, want)
+	}
+}
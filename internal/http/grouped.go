@@ -0,0 +1,201 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/euracresearch/browser"
+)
+
+// groupedWriter writes a browser.TimeSeries as JSON nested by group and
+// measurement, which is convenient for charting.
+type groupedWriter struct {
+	w      io.Writer
+	lookup map[string]browser.Group
+	role   browser.Role
+}
+
+// newGroupedWriter returns a groupedWriter writing to w. Measurements are
+// assigned to their group by label using the given lookup, measurements not
+// present in the lookup are grouped under browser.NoGroup. Group names are
+// chosen for the given role.
+func newGroupedWriter(w io.Writer, lookup map[string]browser.Group, role browser.Role) *groupedWriter {
+	return &groupedWriter{
+		w:      w,
+		lookup: lookup,
+		role:   role,
+	}
+}
+
+type groupedSeries struct {
+	ID           browser.Group        `json:"id"`
+	Name         string               `json:"name"`
+	Measurements []groupedMeasurement `json:"measurements"`
+}
+
+type groupedMeasurement struct {
+	Label       string         `json:"label"`
+	Aggregation string         `json:"aggregation"`
+	Unit        string         `json:"unit"`
+	Depth       int64          `json:"depth"`
+	Station     groupedStation `json:"station"`
+	Points      []groupedPoint `json:"points"`
+}
+
+// groupedStation is the station of a measurement. Invalid coordinates are
+// omitted, see browser.Station.ValidCoordinates.
+type groupedStation struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	Landuse   string   `json:"landuse"`
+	Elevation int64    `json:"elevation"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// groupedPoint is a single point. Missing values (NaN) cannot be represented
+// in JSON and are written as null.
+type groupedPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     *float64  `json:"value"`
+}
+
+// Write writes the given browser.TimeSeries. Groups are ordered as defined in
+// package browser, measurements by station and label.
+func (gw *groupedWriter) Write(ts browser.TimeSeries) error {
+	if len(ts) == 0 {
+		return browser.ErrDataNotFound
+	}
+
+	sort.SliceStable(ts, func(i, j int) bool {
+		a, b := ts[i], ts[j]
+		if a.Station.Name != b.Station.Name {
+			return a.Station.Name < b.Station.Name
+		}
+		if a.Station.ID != b.Station.ID {
+			return a.Station.ID < b.Station.ID
+		}
+		return a.Label < b.Label
+	})
+
+	var (
+		groups []*groupedSeries
+		index  = make(map[browser.Group]*groupedSeries)
+	)
+	for _, m := range ts {
+		g, ok := gw.lookup[m.Label]
+		if !ok {
+			g = browser.NoGroup
+		}
+
+		gs, ok := index[g]
+		if !ok {
+			gs = &groupedSeries{
+				ID:   g,
+				Name: groupName(g, gw.role),
+			}
+			index[g] = gs
+			groups = append(groups, gs)
+		}
+
+		gs.Measurements = append(gs.Measurements, newGroupedMeasurement(m))
+	}
+
+	// NoGroup is defined last, so measurements without a group end up last.
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+
+	return json.NewEncoder(gw.w).Encode(groups)
+}
+
+// WriteStream reads all measurements of the given iterator and writes them
+// with Write, since measurements of a group can be spread over the stream.
+func (gw *groupedWriter) WriteStream(it browser.MeasurementIterator) error {
+	ts, err := browser.ReadTimeSeries(it)
+	if err != nil {
+		return err
+	}
+	return gw.Write(ts)
+}
+
+// WriteHeader writes an empty list of groups.
+func (gw *groupedWriter) WriteHeader() error {
+	return json.NewEncoder(gw.w).Encode([]groupedSeries{})
+}
+
+func newGroupedMeasurement(m *browser.Measurement) groupedMeasurement {
+	gm := groupedMeasurement{
+		Label:       m.Label,
+		Aggregation: m.Aggregation,
+		Unit:        m.Unit,
+		Depth:       m.Depth,
+		Station: groupedStation{
+			ID:        m.Station.ID,
+			Name:      m.Station.Name,
+			Landuse:   m.Station.Landuse,
+			Elevation: m.Station.Elevation,
+		},
+		Points: make([]groupedPoint, 0, len(m.Points)),
+	}
+	if m.Station.ValidCoordinates() {
+		lat, lon := m.Station.Latitude, m.Station.Longitude
+		gm.Station.Latitude, gm.Station.Longitude = &lat, &lon
+	}
+
+	for _, p := range m.Points {
+		gp := groupedPoint{Timestamp: p.Timestamp}
+		if !math.IsNaN(p.Value) {
+			v := p.Value
+			gp.Value = &v
+		}
+		gm.Points = append(gm.Points, gp)
+	}
+
+	return gm
+}
+
+// groupLookup maps the labels of the measurements selected by the given filter
+// to the group they were selected by. If a measurement is part of multiple
+// selected groups, e.g. a group and one of its sub groups, the first selected
+// group is used.
+func (h *Handler) groupLookup(ctx context.Context, f *browser.SeriesFilter) map[string]browser.Group {
+	lookup := make(map[string]browser.Group)
+	for _, g := range f.Groups {
+		gf := *f
+		gf.Groups = []browser.Group{g}
+		gf.Maintenance = nil
+		gf.Measurements = nil
+
+		for _, label := range h.db.Query(ctx, &gf).Measurements {
+			if _, ok := lookup[label]; !ok {
+				lookup[label] = g
+			}
+		}
+	}
+	return lookup
+}
+
+// selectionOrder returns the measurements of the groups of the given filter as
+// order, so that measurements are ordered by the selection of their groups and
+// by label within a group.
+func (h *Handler) selectionOrder(ctx context.Context, f *browser.SeriesFilter) browser.MeasurementOrder {
+	var order browser.MeasurementOrder
+	for _, g := range f.Groups {
+		gf := *f
+		gf.Groups = []browser.Group{g}
+		gf.Maintenance = nil
+		gf.Measurements = nil
+
+		for _, label := range h.db.Query(ctx, &gf).Measurements {
+			order = browser.AppendStringIfMissing(order, label)
+		}
+	}
+	return order
+}
@@ -0,0 +1,254 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/influx"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+func TestHandleSeriesGroupedJSON(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 15, 0, 0, browser.Location)
+	s1 := &browser.Station{ID: 1, Name: "s1", Landuse: "me", Elevation: 1000}
+	s2 := &browser.Station{ID: 2, Name: "s2", Landuse: "pa", Elevation: 2000}
+
+	measurement := func(label, unit string, s *browser.Station, values ...float64) *browser.Measurement {
+		m := &browser.Measurement{Label: label, Unit: unit, Station: s}
+		for i, v := range values {
+			m.Points = append(m.Points, &browser.Point{
+				Timestamp: ts.Add(time.Duration(i) * 15 * time.Minute),
+				Value:     v,
+			})
+		}
+		return m
+	}
+
+	h := NewHandler(WithDatabase(&mock.Database{
+		QueryFn: func(ctx context.Context, f *browser.SeriesFilter) *browser.Stmt {
+			stmt := &browser.Stmt{}
+			for _, g := range f.Groups {
+				switch g {
+				case browser.AirTemperature:
+					stmt.Measurements = append(stmt.Measurements, "air_t_avg")
+				case browser.Wind:
+					stmt.Measurements = append(stmt.Measurements, "wind_dir", "wind_speed_avg")
+				}
+			}
+			return stmt
+		},
+		SeriesFn: func() (browser.TimeSeries, error) {
+			return browser.TimeSeries{
+				measurement("wind_speed_avg", "m/s", s2, 1.5, math.NaN()),
+				measurement("air_t_avg", "deg C", s2, 3),
+				measurement("wind_dir", "deg", s1, 180),
+				measurement("battery", "V", s1, 12),
+				measurement("air_t_avg", "deg C", s1, 2, 4),
+			}, nil
+		},
+	}))
+
+	value := func(v float64) *float64 { return &v }
+	station := func(s *browser.Station) groupedStation {
+		return groupedStation{ID: s.ID, Name: s.Name, Landuse: s.Landuse, Elevation: s.Elevation, Latitude: value(0), Longitude: value(0)}
+	}
+
+	want := []groupedSeries{
+		{ID: browser.AirTemperature, Name: "Air Temperature", Measurements: []groupedMeasurement{
+			{Label: "air_t_avg", Unit: "deg C", Station: station(s1), Points: []groupedPoint{
+				{Timestamp: ts, Value: value(2)},
+				{Timestamp: ts.Add(15 * time.Minute), Value: value(4)},
+			}},
+			{Label: "air_t_avg", Unit: "deg C", Station: station(s2), Points: []groupedPoint{
+				{Timestamp: ts, Value: value(3)},
+			}},
+		}},
+		{ID: browser.Wind, Name: "Wind", Measurements: []groupedMeasurement{
+			{Label: "wind_dir", Unit: "deg", Station: station(s1), Points: []groupedPoint{
+				{Timestamp: ts, Value: value(180)},
+			}},
+			{Label: "wind_speed_avg", Unit: "m/s", Station: station(s2), Points: []groupedPoint{
+				{Timestamp: ts, Value: value(1.5)},
+				{Timestamp: ts.Add(15 * time.Minute)},
+			}},
+		}},
+		{ID: browser.NoGroup, Name: "No Group", Measurements: []groupedMeasurement{
+			{Label: "battery", Unit: "V", Station: station(s1), Points: []groupedPoint{
+				{Timestamp: ts, Value: value(12)},
+			}},
+		}},
+	}
+
+	body := fmt.Sprintf("startDate=2020-01-01&endDate=2020-01-01&stations=1&stations=2&measurements=%d&measurements=%d&maintenance=battery&format=grouped-json",
+		browser.Wind, browser.AirTemperature)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(withCTX(browser.FullAccess))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "application/json"; got != want {
+		t.Fatalf("got unexpected content type: %q, want %q", got, want)
+	}
+
+	var got []groupedSeries
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGroupedStationCoordinates(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+
+	testCases := map[string]struct {
+		lat, lon float64
+		want     groupedStation
+	}{
+		"Valid":      {46.68, 10.58, groupedStation{ID: 1, Latitude: value(46.68), Longitude: value(10.58)}},
+		"Unparsed":   {-1, -1, groupedStation{ID: 1}},
+		"Latitude":   {-90.1, 10.58, groupedStation{ID: 1}},
+		"Longitude":  {46.68, 181, groupedStation{ID: 1}},
+		"NaN":        {math.NaN(), 10.58, groupedStation{ID: 1}},
+		"OneNegated": {-1, 10.58, groupedStation{ID: 1, Latitude: value(-1), Longitude: value(10.58)}},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			m := &browser.Measurement{Station: &browser.Station{ID: 1, Latitude: tc.lat, Longitude: tc.lon}}
+			if diff := cmp.Diff(tc.want, newGroupedMeasurement(m).Station); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleSeriesOverlappingGroups(t *testing.T) {
+	// The series are selected by the InfluxDB backend, which returns one
+	// series for each queried measurement. A measurement selected by
+	// overlapping groups or by differently cased maintenance labels is
+	// therefore written multiple times, unless it is queried only once.
+	catalog := []string{"wind_dir", "wind_speed_avg", "wind_speed_max", "batt_v_avg"}
+	from := regexp.MustCompile(`FROM (\w+) `)
+	c := &mock.InfluxClient{
+		QueryFn: func(q client.Query) (*client.Response, error) {
+			resp := new(client.Response)
+			if strings.HasPrefix(q.Command, "SHOW TAG VALUES") {
+				var rows []models.Row
+				for _, m := range catalog {
+					rows = append(rows, models.Row{
+						Name:    m,
+						Columns: []string{"key", "value"},
+						Values:  [][]interface{}{{"aggr", "avg"}, {"snipeit_location_ref", "1"}, {"unit", "u"}},
+					})
+				}
+				resp.Results = append(resp.Results, client.Result{Series: rows})
+				return resp, nil
+			}
+
+			for _, stmt := range strings.Split(q.Command, ";") {
+				if strings.TrimSpace(stmt) == "" {
+					continue
+				}
+				m := from.FindStringSubmatch(stmt)
+				if m == nil {
+					return nil, fmt.Errorf("unexpected query %q", stmt)
+				}
+				resp.Results = append(resp.Results, client.Result{Series: []models.Row{{
+					Name:    m[1],
+					Tags:    map[string]string{"station": "s1", "snipeit_location_ref": "1", "landuse": "me", "unit": "u", "aggr": "avg"},
+					Columns: []string{"time", m[1], "elevation", "latitude", "longitude", "depth"},
+					Values:  [][]interface{}{{"2020-01-01T00:15:00+01:00", json.Number("1"), json.Number("1000"), json.Number("46.6"), json.Number("10.5"), nil}},
+				}}})
+			}
+			return resp, nil
+		},
+	}
+	db, err := influx.NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+	h := NewHandler(WithDatabase(db))
+
+	body := fmt.Sprintf("startDate=2020-01-01&endDate=2020-01-01&stations=1&measurements=%d&measurements=%d&maintenance=Batt_V_Avg&maintenance=batt_v_avg&maintenance=BATT_V_AVG",
+		browser.Wind, browser.WindSpeed)
+
+	do := func(t *testing.T, query string) []byte {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(body+query))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(withCTX(browser.FullAccess))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		resp := w.Result()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("got unexpected status code: %d, want %d", got, want)
+		}
+		return w.Body.Bytes()
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		for _, query := range []string{"", "&order=selected"} {
+			b := string(do(t, query))
+			for _, label := range catalog {
+				if n := strings.Count(b, label); n != 1 {
+					t.Errorf("%q: got %q %d times, want 1:\n%s", query, label, n, b)
+				}
+			}
+		}
+	})
+
+	t.Run("WideCSV", func(t *testing.T) {
+		b := string(do(t, "&format=wide"))
+		if want := "\nparameter,wind_dir,wind_speed,wind_speed_max,batt_v\n"; !strings.Contains(b, want) {
+			t.Errorf("body does not contain %q:\n%s", want, b)
+		}
+	})
+
+	t.Run("GroupedJSON", func(t *testing.T) {
+		var got []groupedSeries
+		if err := json.Unmarshal(do(t, "&format=grouped-json"), &got); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+
+		want := map[browser.Group][]string{
+			browser.Wind:    {"wind_dir", "wind_speed_avg", "wind_speed_max"},
+			browser.NoGroup: {"batt_v_avg"},
+		}
+		labels := make(map[browser.Group][]string)
+		for _, g := range got {
+			for _, m := range g.Measurements {
+				labels[g.ID] = append(labels[g.ID], m.Label)
+			}
+		}
+		if diff := cmp.Diff(want, labels); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
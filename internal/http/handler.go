@@ -6,69 +6,272 @@ package http
 
 import (
 	"embed"
+	"encoding/json"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/metrics"
+	"golang.org/x/text/language"
 )
 
 var (
-	//go:embed templates/* locale/*
+	//go:embed templates/*
 	templateFS embed.FS
 
 	//go:embed assets/*
 	publicFS embed.FS
+
+	//go:embed openapi.json
+	openAPISpec []byte
+
+	//go:embed aliases.json
+	aliasesJSON []byte
 )
 
+// DefaultTimeout is the default time limit for handling requests, except for
+// exports and live data streams.
+const DefaultTimeout = 1 * time.Minute
+
+// DefaultMaxPoints is the default maximum number of points a single export may
+// select. It allows for example 30 measurements of ten stations over four
+// years.
+const DefaultMaxPoints = 50000000
+
+// DefaultMaxDownloads is the default maximum number of exports which are
+// queried and written concurrently.
+const DefaultMaxDownloads = 10
+
+// DefaultLanguages are the languages of the user interface if none are
+// configured. The first is used if a user has not chosen a language and the
+// browser accepts none of them.
+var DefaultLanguages = []string{"en", "de", "it"}
+
+// DefaultPages are the static pages served and listed in the sitemap if none
+// are configured.
+var DefaultPages = []string{"impressum", "info", "license", "privacy"}
+
+// DefaultTemplateRoles are the roles allowed to download code templates if
+// none are configured.
+var DefaultTemplateRoles = []browser.Role{browser.FullAccess}
+
+// untimedRoutes are the patterns of routes which are not bound by the handler's
+// timeout. Exports of large selections take long to write and live data
+// streams are kept open.
+var untimedRoutes = map[string]bool{
+	"/api/v1/series": true,
+	"/api/v1/live":   true,
+}
+
 // Handler serves various HTTP endpoints.
 type Handler struct {
 	mux *http.ServeMux
 
+	// timed serves the routes bound by the timeout. It is nil if the timeout
+	// is disabled.
+	timed http.Handler
+
+	// timeout is the time limit for handling requests, except for the
+	// untimedRoutes. If zero requests are not limited.
+	timeout time.Duration
+
+	// maxPoints is the maximum number of points an export may select,
+	// estimated before querying. If zero exports are not limited.
+	maxPoints int64
+
+	// maxMeasurements is the maximum number of measurements per station an
+	// export may select. Users with full access are exempt. If zero exports
+	// are not limited.
+	maxMeasurements int
+
+	// maxDownloads is the maximum number of concurrent exports and downloads
+	// the semaphore limiting them. If zero exports are not limited.
+	maxDownloads int
+	downloads    chan struct{}
+
+	// order is the display order of the measurement columns of exports. If
+	// nil the columns are in the order the measurements are returned.
+	order browser.MeasurementOrder
+
+	// aliases maps measurement labels to the friendly names of their columns
+	// in CSV and XLSX exports, if requested.
+	aliases map[string]string
+
+	// formats maps a role to the format of exports of its users if the
+	// request specifies none. Roles not present get CSV.
+	formats map[browser.Role]string
+
+	// languages are the valid languages of the user interface. The first is
+	// the fallback for users without or with an unknown language.
+	languages []string
+
+	// matcher matches the Accept-Language header of requests against the
+	// languages.
+	matcher language.Matcher
+
+	// publicGroups are the groups the public role is allowed to access.
+	publicGroups []browser.Group
+
+	// pages are the names of the static pages, each a directory below
+	// templates.
+	pages []string
+
+	// robots is the robots policy.
+	robots string
+
+	// languageCookie is the name of the cookie storing the language chosen
+	// by the user.
+	languageCookie string
+
+	// templateRoles are the roles allowed to download code templates.
+	templateRoles []browser.Role
+
 	// analytics is a Google Analytics code.
 	analytics string
 
+	// dateRange is the length of the date range preselected in the download
+	// form, ending today. If zero the last six months are preselected.
+	dateRange time.Duration
+
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+
+	// liveInterval is the interval in which the latest points are polled for
+	// live data streams.
+	liveInterval time.Duration
+
+	// maintenance rejects exports while the backends are under maintenance.
+	maintenance maintenanceMode
+
+	// apiRoutes are the patterns registered below /api/v1.
+	apiRoutes []string
+
 	db             browser.Database
 	stationService browser.StationService
+	users          browser.UserService
+	metrics        *metrics.Registry
+	stats          *metrics.Stats
 }
 
 // NewHandler creates a new HTTP handler with the given options and initializes
 // all routes.
 func NewHandler(options ...Option) *Handler {
-	h := new(Handler)
+	h := &Handler{
+		timeout:      DefaultTimeout,
+		maxPoints:    DefaultMaxPoints,
+		maxDownloads: DefaultMaxDownloads,
+	}
 
 	for _, option := range options {
 		option(h)
 	}
 
+	if h.maxDownloads > 0 {
+		h.downloads = make(chan struct{}, h.maxDownloads)
+	}
+
+	if h.metrics == nil {
+		h.metrics = metrics.DefaultRegistry
+	}
+
+	if h.stats == nil {
+		h.stats = metrics.DefaultStats
+	}
+
+	if h.now == nil {
+		h.now = time.Now
+	}
+
+	if h.liveInterval <= 0 {
+		h.liveInterval = DefaultLiveInterval
+	}
+
+	if h.aliases == nil {
+		h.aliases = defaultAliases()
+	}
+
+	if len(h.languages) == 0 {
+		h.languages = DefaultLanguages
+	}
+
+	if len(h.pages) == 0 {
+		h.pages = DefaultPages
+	}
+	if h.robots == "" {
+		h.robots = DefaultRobots
+	}
+
+	if h.languageCookie == "" {
+		h.languageCookie = DefaultLanguageCookieName
+	}
+
+	if len(h.templateRoles) == 0 {
+		h.templateRoles = DefaultTemplateRoles
+	}
+	tags := make([]language.Tag, len(h.languages))
+	for i, l := range h.languages {
+		tags[i] = language.Make(l)
+	}
+	h.matcher = language.NewMatcher(tags)
+
 	h.mux = http.NewServeMux()
 	h.mux.HandleFunc("/", h.handleIndex())
 
-	h.mux.HandleFunc("/en/hello/", h.handleHello())
-	h.mux.HandleFunc("/it/hello/", h.handleHello())
-	h.mux.HandleFunc("/de/hello/", h.handleHello())
-
-	h.mux.HandleFunc("/en/", h.handleStaticPage())
-	h.mux.HandleFunc("/it/", h.handleStaticPage())
-	h.mux.HandleFunc("/de/", h.handleStaticPage())
+	hello, page := h.handleHello(), h.handleStaticPage()
+	for _, l := range h.languages {
+		h.mux.HandleFunc("/"+l+"/hello/", hello)
+		h.mux.HandleFunc("/"+l+"/", page)
+	}
 
-	h.mux.HandleFunc("/l/", handleLanguage())
+	h.mux.HandleFunc("/l/", h.handleLanguage())
 
-	h.mux.HandleFunc("/api/v1/stations/", h.handleStations())
-	h.mux.HandleFunc("/api/v1/series", h.handleSeries())
-	h.mux.HandleFunc("/api/v1/templates", grantAccess(h.handleCodeTemplate(), browser.FullAccess))
+	h.handleAPI("/api/v1/stations/", h.handleStations())
+	h.handleAPI("/api/v1/landuse", h.handleLanduse())
+	h.handleAPI("/api/v1/series", h.rejectInMaintenance(h.handleSeries()))
+	h.handleAPI("/api/v1/query", grantAccess(h.handleQuery(), browser.FullAccess))
+	h.handleAPI("/api/v1/live", h.handleLive())
+	h.handleAPI("/api/v1/coverage", h.handleCoverage())
+	h.handleAPI("/api/v1/templates", h.grantLicensedAccess(h.rejectInMaintenance(h.handleCodeTemplate()), h.templateRoles...))
+	if h.users != nil {
+		h.handleAPI("/api/v1/users/import", grantAccess(h.handleUserImport(), browser.FullAccess))
+	}
+	h.handleAPI("/api/v1/access", grantAccess(h.handleAccess(), browser.FullAccess))
+	h.handleAPI("/api/v1/access/validate", grantAccess(h.handleAccessValidate(), browser.FullAccess))
+	h.handleAPI("/api/v1/maintenance", grantAccess(h.handleMaintenance(), browser.FullAccess))
+	h.handleAPI("/api/v1/admin/refresh", grantAccess(h.handleRefresh(), browser.FullAccess))
+	h.handleAPI("/api/v1/debug/stats", h.handleStats())
+	h.handleAPI("/api/v1/openapi.json", handleOpenAPI())
 
-	h.mux.HandleFunc("robots.txt", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/assets/robots.txt", http.StatusMovedPermanently)
-	})
+	h.mux.HandleFunc("/robots.txt", h.handleRobots())
+	h.mux.HandleFunc("/sitemap.xml", h.handleSitemap())
 
 	// Setup endpoint to display deployed version.
 	h.mux.HandleFunc("/debug/version", h.handleVersion)
 	h.mux.HandleFunc("/debug/commit", h.handleCommit)
 
+	// Setup endpoint for liveness and readiness checks.
+	h.mux.HandleFunc("/healthz", h.handleHealth)
+
+	// Setup endpoint exposing Prometheus metrics.
+	h.mux.Handle("/metrics", h.metrics.Handler())
+
 	h.mux.Handle("/assets/", http.FileServer(http.FS(publicFS)))
 
+	if h.timeout > 0 {
+		h.timed = http.TimeoutHandler(h.mux, h.timeout, "Request timed out")
+	}
+
 	return h
 }
 
+// handleAPI registers the given handler for the given pattern below /api/v1.
+// All API routes must be documented in the OpenAPI document.
+func (h *Handler) handleAPI(pattern string, handler http.Handler) {
+	h.apiRoutes = append(h.apiRoutes, pattern)
+	h.mux.Handle(pattern, handler)
+}
+
 // Option controls some aspects of the Handler.
 type Option func(h *Handler)
 
@@ -88,6 +291,199 @@ func WithStationService(s browser.StationService) Option {
 	}
 }
 
+// WithUserService returns an option function for setting the handler's
+// userService. It enables the endpoint for bulk importing users.
+func WithUserService(s browser.UserService) Option {
+	return func(h *Handler) {
+		h.users = s
+	}
+}
+
+// WithMetrics returns an option function for setting the registry of the
+// metrics exposed on /metrics. By default metrics.DefaultRegistry is used.
+func WithMetrics(r *metrics.Registry) Option {
+	return func(h *Handler) {
+		h.metrics = r
+	}
+}
+
+// WithStats returns an option function for setting the summary exposed on
+// /api/v1/debug/stats. By default metrics.DefaultStats is used.
+func WithStats(s *metrics.Stats) Option {
+	return func(h *Handler) {
+		h.stats = s
+	}
+}
+
+// WithDefaultDateRange returns an option function for setting the length of
+// the date range preselected in the download form, ending today. By default
+// the last six months are preselected.
+func WithDefaultDateRange(d time.Duration) Option {
+	return func(h *Handler) {
+		h.dateRange = d
+	}
+}
+
+// defaultDateRange returns the start and end date preselected in the download
+// form.
+func (h *Handler) defaultDateRange() (time.Time, time.Time) {
+	end := h.now()
+	if h.dateRange > 0 {
+		return end.Add(-h.dateRange), end
+	}
+	return end.AddDate(0, -6, 0), end
+}
+
+// WithLiveInterval returns an option function for setting the interval in
+// which the latest points are polled for live data streams. By default
+// DefaultLiveInterval is used.
+func WithLiveInterval(d time.Duration) Option {
+	return func(h *Handler) {
+		h.liveInterval = d
+	}
+}
+
+// WithTimeout returns an option function for setting the time limit for
+// handling requests. Exports and live data streams are not limited, since they
+// are expected to take long. A timeout of zero disables the limit. By default
+// DefaultTimeout is used.
+func WithTimeout(d time.Duration) Option {
+	return func(h *Handler) {
+		h.timeout = d
+	}
+}
+
+// WithMaxDownloads returns an option function for setting the maximum number of
+// exports which are queried and written concurrently, so that many large
+// downloads cannot exhaust the connections to the database. Further exports
+// are answered with http.StatusServiceUnavailable. A maximum of zero disables
+// the limit. By default DefaultMaxDownloads is used.
+func WithMaxDownloads(n int) Option {
+	return func(h *Handler) {
+		h.maxDownloads = n
+	}
+}
+
+// WithMaxPoints returns an option function for setting the maximum number of
+// points a single export may select. Larger exports are rejected before
+// querying. A maximum of zero disables the limit. By default DefaultMaxPoints
+// is used.
+func WithMaxPoints(n int64) Option {
+	return func(h *Handler) {
+		h.maxPoints = n
+	}
+}
+
+// WithMaxMeasurements returns an option function for setting the maximum
+// number of measurements per station a single export may select. Users with
+// full access are exempt. A maximum of zero disables the limit, which is the
+// default.
+func WithMaxMeasurements(n int) Option {
+	return func(h *Handler) {
+		h.maxMeasurements = n
+	}
+}
+
+// WithMaintenance starts the handler in maintenance mode showing the given
+// message. Maintenance mode can be toggled at runtime by users with full
+// access using the /api/v1/maintenance endpoint.
+func WithMaintenance(message string) Option {
+	return func(h *Handler) {
+		h.maintenance.set(true, message)
+	}
+}
+
+// WithColumnAliases sets the friendly names of the measurement columns of CSV
+// and XLSX exports, keyed by measurement label. By default the names embedded
+// in aliases.json are used.
+func WithColumnAliases(aliases map[string]string) Option {
+	return func(h *Handler) {
+		h.aliases = aliases
+	}
+}
+
+// defaultAliases returns the friendly column names embedded in aliases.json.
+func defaultAliases() map[string]string {
+	aliases := make(map[string]string)
+	if err := json.Unmarshal(aliasesJSON, &aliases); err != nil {
+		log.Printf("http: invalid aliases.json: %v", err)
+	}
+	return aliases
+}
+
+// WithMeasurementOrder sets the order of the measurement columns of CSV and
+// XLSX exports, see browser.MeasurementOrder.
+func WithMeasurementOrder(o browser.MeasurementOrder) Option {
+	return func(h *Handler) {
+		h.order = o
+	}
+}
+
+// WithDefaultFormats sets the format of exports used for users of the given
+// roles if a request specifies neither a format nor a known media type in the
+// Accept header, see ParseDefaultFormats. By default CSV is used.
+func WithDefaultFormats(formats map[browser.Role]string) Option {
+	return func(h *Handler) {
+		h.formats = formats
+	}
+}
+
+// WithLanguages sets the valid languages of the user interface, e.g. "en" or
+// "fr". Users who have not chosen a language get the best match of the
+// Accept-Language header of their browser, or else the first language. Texts
+// are translated using the locale file of a language and pages missing in a
+// language are shown in the first one. By default DefaultLanguages are used.
+func WithLanguages(languages []string) Option {
+	return func(h *Handler) {
+		h.languages = languages
+	}
+}
+
+// WithLanguageCookieName sets the name of the cookie storing the language
+// chosen by the user, so that multiple instances can share a domain. By
+// default DefaultLanguageCookieName is used.
+func WithLanguageCookieName(name string) Option {
+	return func(h *Handler) {
+		h.languageCookie = name
+	}
+}
+
+// WithTemplateRoles sets the roles allowed to download code templates, see
+// ParseRoles. Users of other roles neither see nor can use them. By default
+// DefaultTemplateRoles are used.
+func WithTemplateRoles(roles []browser.Role) Option {
+	return func(h *Handler) {
+		h.templateRoles = roles
+	}
+}
+
+// WithPublicGroups sets the groups offered to public users, which must match
+// those the database allows them to access. By default
+// browser.DefaultPublicGroups are used.
+func WithPublicGroups(groups []browser.Group) Option {
+	return func(h *Handler) {
+		h.publicGroups = groups
+	}
+}
+
+// WithPages sets the names of the static pages served below each language and
+// listed in the sitemap, e.g. "impressum" or "privacy". Each page must be an
+// embedded directory below templates. By default DefaultPages are used.
+func WithPages(pages []string) Option {
+	return func(h *Handler) {
+		h.pages = pages
+	}
+}
+
+// WithRobots sets the robots policy written as robots.txt, e.g. for excluding
+// crawlers from some pages. A reference to the sitemap is added. By default
+// DefaultRobots is used.
+func WithRobots(policy string) Option {
+	return func(h *Handler) {
+		h.robots = policy
+	}
+}
+
 // WithAnalyticsCode sets the Google Analytics code.
 func WithAnalyticsCode(analytics string) Option {
 	return func(h *Handler) {
@@ -105,6 +501,85 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(browser.Commit))
 }
 
+// handleStats writes the summary of the requests per endpoint and the number
+// of InfluxDB queries since startup as JSON.
+func (h *Handler) handleStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Expected GET request", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+		if err := json.NewEncoder(w).Encode(h.stats.Summary()); err != nil {
+			log.Printf("stats: %v", err)
+		}
+	}
+}
+
+// readier is implemented by backends which populate caches after they have
+// been created and should not receive traffic before.
+type readier interface {
+	// Ready reports whether the initial caches have been populated.
+	Ready() bool
+}
+
+// handleHealth checks if all backends are reachable and ready. It responds with
+// http.StatusOK if all are healthy and http.StatusServiceUnavailable otherwise.
+func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Expected GET request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	resp := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{
+		Status: "ok",
+		Checks: map[string]string{
+			"influx":  "ok",
+			"catalog": "ok",
+			"snipeit": "ok",
+		},
+	}
+
+	code := http.StatusOK
+	if err := h.db.Ping(ctx); err != nil {
+		log.Printf("healthz: influx: %v", err)
+		resp.Checks["influx"] = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+	if r, ok := h.db.(readier); ok && !r.Ready() {
+		resp.Checks["catalog"] = "loading"
+		code = http.StatusServiceUnavailable
+	}
+	if err := h.stationService.Ping(ctx); err != nil {
+		log.Printf("healthz: snipeit: %v", err)
+		resp.Checks["snipeit"] = "unavailable"
+		code = http.StatusServiceUnavailable
+	} else if r, ok := h.stationService.(readier); ok && !r.Ready() {
+		resp.Checks["snipeit"] = "loading"
+		code = http.StatusServiceUnavailable
+	}
+	if code != http.StatusOK {
+		resp.Status = "degraded"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("healthz: %v", err)
+	}
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.mux.ServeHTTP(w, r)
+	if _, pattern := h.mux.Handler(r); h.timed == nil || untimedRoutes[pattern] {
+		h.mux.ServeHTTP(w, r)
+		return
+	}
+	h.timed.ServeHTTP(w, r)
 }
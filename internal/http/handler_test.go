@@ -0,0 +1,204 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/metrics"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleHealth(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	fail := func(ctx context.Context) error { return errors.New("unreachable") }
+
+	testCases := map[string]struct {
+		method     string
+		dbPing     func(ctx context.Context) error
+		dbReady    func() bool
+		snipePing  func(ctx context.Context) error
+		snipeReady func() bool
+		statusCode int
+		want       map[string]interface{}
+	}{
+		"POST": {http.MethodPost, ok, nil, ok, nil, http.StatusMethodNotAllowed, nil},
+		"Healthy": {http.MethodGet, ok, nil, ok, nil, http.StatusOK, map[string]interface{}{
+			"status": "ok",
+			"checks": map[string]interface{}{"influx": "ok", "catalog": "ok", "snipeit": "ok"},
+		}},
+		"InfluxDown": {http.MethodGet, fail, nil, ok, nil, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "degraded",
+			"checks": map[string]interface{}{"influx": "unavailable", "catalog": "ok", "snipeit": "ok"},
+		}},
+		"CatalogLoading": {http.MethodGet, ok, func() bool { return false }, ok, nil, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "degraded",
+			"checks": map[string]interface{}{"influx": "ok", "catalog": "loading", "snipeit": "ok"},
+		}},
+		"SnipeITDown": {http.MethodGet, ok, nil, fail, nil, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "degraded",
+			"checks": map[string]interface{}{"influx": "ok", "catalog": "ok", "snipeit": "unavailable"},
+		}},
+		"StationsLoading": {http.MethodGet, ok, nil, ok, func() bool { return false }, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "degraded",
+			"checks": map[string]interface{}{"influx": "ok", "catalog": "ok", "snipeit": "loading"},
+		}},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := NewHandler(
+				WithDatabase(&mock.Database{PingFn: tc.dbPing, ReadyFn: tc.dbReady}),
+				WithStationService(&mock.StationService{PingFn: tc.snipePing, ReadyFn: tc.snipeReady}),
+			)
+
+			req := httptest.NewRequest(tc.method, "/healthz", nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			if tc.want == nil {
+				return
+			}
+
+			if got, want := resp.Header.Get("Content-Type"), "application/json"; got != want {
+				t.Fatalf("response header content-type: got %s, want %s", got, want)
+			}
+
+			var got map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			diff := cmp.Diff(tc.want, got)
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	const (
+		timeout = 50 * time.Millisecond
+		delay   = 4 * timeout
+	)
+
+	// sleep waits for the delay or until the request is canceled.
+	sleep := func(ctx context.Context) error {
+		select {
+		case <-time.After(delay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	db := &mock.Database{
+		SeriesStreamFn: func(ctx context.Context, m *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+			if err := sleep(ctx); err != nil {
+				return nil, err
+			}
+			return new(testBackend).SeriesStream(ctx, m)
+		},
+	}
+	stations := &mock.StationService{
+		StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+			if err := sleep(ctx); err != nil {
+				return nil, err
+			}
+			return browser.Stations{}, nil
+		},
+	}
+
+	testCases := map[string]struct {
+		options    []Option
+		method     string
+		path       string
+		body       string
+		statusCode int
+	}{
+		"SlowExport":                {nil, http.MethodPost, "/api/v1/series", "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=1", http.StatusOK},
+		"SlowStations":              {nil, http.MethodGet, "/api/v1/stations/", "", http.StatusServiceUnavailable},
+		"SlowStationsWithoutLimit":  {[]Option{WithTimeout(0)}, http.MethodGet, "/api/v1/stations/", "", http.StatusOK},
+		"SlowStationsLargerTimeout": {[]Option{WithTimeout(10 * delay)}, http.MethodGet, "/api/v1/stations/", "", http.StatusOK},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			options := append([]Option{
+				WithDatabase(db),
+				WithStationService(stations),
+				WithTimeout(timeout),
+			}, tc.options...)
+			h := NewHandler(options...)
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleStats(t *testing.T) {
+	stats := metrics.NewStats()
+	stats.ObserveRequest("/api/v1/series", 20*time.Millisecond)
+	stats.ObserveRequest("/api/v1/series", 40*time.Millisecond)
+	stats.ObserveRequest("/api/v1/stations/1", 10*time.Millisecond)
+	stats.IncQueries()
+	stats.IncQueries()
+
+	h := NewHandler(WithStats(stats))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/debug/stats", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "application/json"; got != want {
+		t.Fatalf("got Content-Type %q, want %q", got, want)
+	}
+
+	var got map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	delete(got, "since")
+
+	want := map[string]interface{}{
+		"requests": 3.0,
+		"endpoints": []interface{}{
+			map[string]interface{}{"endpoint": "/api/v1/series", "requests": 2.0, "avgLatencyMs": 30.0},
+			map[string]interface{}{"endpoint": "/api/v1/stations/{id}", "requests": 1.0, "avgLatencyMs": 10.0},
+		},
+		"influxQueries": 2.0,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
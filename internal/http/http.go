@@ -6,35 +6,97 @@
 package http
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"mime"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/euracresearch/browser"
 	"golang.org/x/crypto/acme/autocert"
 )
 
-const languageCookieName = "browser_lter_lang"
+// DefaultLanguageCookieName is the default name of the cookie storing the
+// language chosen by the user.
+const DefaultLanguageCookieName = "browser_lter_lang"
+
+// Default timeouts of the HTTP server. The write timeout bounds the time for
+// writing a whole response of any route, so by default there is none and big
+// exports are not cut off. Other routes are bound by the Handler's timeout.
+const (
+	DefaultReadTimeout  = 1 * time.Minute
+	DefaultWriteTimeout = 0
+	DefaultIdleTimeout  = 2 * time.Minute
+)
+
+// ServerOption controls some aspects of the HTTP server.
+type ServerOption func(s *http.Server)
+
+// WithReadTimeout returns an option function for setting the maximum duration
+// for reading an entire request, including the body.
+func WithReadTimeout(d time.Duration) ServerOption {
+	return func(s *http.Server) {
+		s.ReadTimeout = d
+	}
+}
+
+// WithWriteTimeout returns an option function for setting the maximum
+// duration before timing out writes of a response.
+func WithWriteTimeout(d time.Duration) ServerOption {
+	return func(s *http.Server) {
+		s.WriteTimeout = d
+	}
+}
+
+// WithIdleTimeout returns an option function for setting the maximum amount
+// of time to wait for the next request on keep-alive connections.
+func WithIdleTimeout(d time.Duration) ServerOption {
+	return func(s *http.Server) {
+		s.IdleTimeout = d
+	}
+}
 
-// ListenAndServe is a wrapper for http.ListenAndServe.
-func ListenAndServe(addr string, handler http.Handler) error {
-	return http.ListenAndServe(addr, handler)
+// NewServer returns a new HTTP server for the given address and handler. If
+// not set by an option the default timeouts are used.
+func NewServer(addr string, handler http.Handler, options ...ServerOption) *http.Server {
+	s := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  DefaultReadTimeout,
+		WriteTimeout: DefaultWriteTimeout,
+		IdleTimeout:  DefaultIdleTimeout,
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
 }
 
-// ServeAutoCert will serve on the standard TLS port (443) with LetsEncrypt
-// certificates for the provided domain or domains. Incoming traffic on port 80
-// will be automatically forwared to 443.
-func ServeAutoCert(addr string, handler http.Handler, domains ...string) error {
+// ServeAutoCert will serve the given server on the standard TLS port (443)
+// with LetsEncrypt certificates for the provided domain or domains. Incoming
+// traffic on port 80 will be automatically forwared to 443.
+func ServeAutoCert(srv *http.Server, domains ...string) error {
 	go func() {
-		host, _, err := net.SplitHostPort(addr)
+		host, _, err := net.SplitHostPort(srv.Addr)
 		if err != nil || host == "" {
 			host = "0.0.0.0"
 		}
 		log.Println("Redirecting traffic from HTTP to HTTPS.")
-		log.Fatal(http.ListenAndServe(host+":80", redirectHandler()))
+		redirect := NewServer(host+":80", redirectHandler(),
+			WithReadTimeout(srv.ReadTimeout),
+			WithWriteTimeout(srv.WriteTimeout),
+			WithIdleTimeout(srv.IdleTimeout),
+		)
+		log.Fatal(redirect.ListenAndServe())
 	}()
 
-	return http.Serve(autocert.NewListener(domains...), handler)
+	return srv.Serve(autocert.NewListener(domains...))
 }
 
 func redirectHandler() http.Handler {
@@ -58,6 +120,48 @@ func Error(w http.ResponseWriter, err error, code int) {
 	http.Error(w, err.Error(), code)
 }
 
+// apiError writes an error message to the response like Error. If the request
+// accepts JSON the message is written as JSON object {"error": message,
+// "code": code} instead, which clients of the JSON API can parse.
+func apiError(w http.ResponseWriter, r *http.Request, err error, code int) {
+	if !acceptsJSON(r.Header.Get("Accept")) {
+		Error(w, err, code)
+		return
+	}
+
+	log.Printf("http error: %s (code=%d)", err, code)
+
+	if code == http.StatusInternalServerError || code == http.StatusNotFound {
+		err = browser.ErrInternal
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+		Code  int    `json:"code"`
+	}{err.Error(), code})
+}
+
+// acceptsJSON reports whether the given Accept header explicitly accepts
+// application/json. Wildcards, as sent by browsers, do not count.
+func acceptsJSON(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != "application/json" {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // grantAccess is a HTTP middleware function which grants access to the given
 // handler to the given roles.
 func grantAccess(h http.HandlerFunc, roles ...browser.Role) http.HandlerFunc {
@@ -71,6 +175,22 @@ func grantAccess(h http.HandlerFunc, roles ...browser.Role) http.HandlerFunc {
 	}
 }
 
+// grantLicensedAccess is like grantAccess but additionally requires users to
+// have signed the data usage agreement. Users who have not are answered with
+// http.StatusForbidden and the page for signing it. Public users cannot sign
+// the agreement and are not required to, as on the index page.
+func (h *Handler) grantLicensedAccess(next http.HandlerFunc, roles ...browser.Role) http.HandlerFunc {
+	return grantAccess(func(w http.ResponseWriter, r *http.Request) {
+		u := browser.UserFromContext(r.Context())
+		if u.Role != browser.Public && !u.License {
+			Error(w, fmt.Errorf("%w, please sign it at /%s/hello/", browser.ErrLicenseNotSigned, h.languageFromRequest(r)), http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}, roles...)
+}
+
 // isAllowed checks if the current user makes part of the allowed roles.
 func isAllowed(r *http.Request, roles ...browser.Role) bool {
 	u := browser.UserFromContext(r.Context())
@@ -0,0 +1,131 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewServer(t *testing.T) {
+	testCases := map[string]struct {
+		options []ServerOption
+		read    time.Duration
+		write   time.Duration
+		idle    time.Duration
+	}{
+		"default": {nil, DefaultReadTimeout, DefaultWriteTimeout, DefaultIdleTimeout},
+		"custom": {
+			[]ServerOption{WithReadTimeout(5 * time.Second), WithWriteTimeout(time.Hour), WithIdleTimeout(time.Minute)},
+			5 * time.Second, time.Hour, time.Minute,
+		},
+		"partial": {
+			[]ServerOption{WithWriteTimeout(time.Hour)},
+			DefaultReadTimeout, time.Hour, DefaultIdleTimeout,
+		},
+	}
+
+	handler := http.NotFoundHandler()
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			s := NewServer("localhost:8888", handler, tc.options...)
+
+			if s.Addr != "localhost:8888" {
+				t.Errorf("got address %q, want %q", s.Addr, "localhost:8888")
+			}
+			if s.Handler == nil {
+				t.Error("server has no handler")
+			}
+			if s.ReadTimeout != tc.read {
+				t.Errorf("got read timeout %v, want %v", s.ReadTimeout, tc.read)
+			}
+			if s.WriteTimeout != tc.write {
+				t.Errorf("got write timeout %v, want %v", s.WriteTimeout, tc.write)
+			}
+			if s.IdleTimeout != tc.idle {
+				t.Errorf("got idle timeout %v, want %v", s.IdleTimeout, tc.idle)
+			}
+		})
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	h := NewHandler(WithStationService(&mock.StationService{
+		StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+			return nil, errors.New("snipeit unreachable")
+		},
+	}))
+
+	testCases := map[string]struct {
+		query       string
+		accept      string
+		statusCode  int
+		contentType string
+		body        string
+	}{
+		"ValidationJSON":  {"?minElevation=high", "application/json", http.StatusBadRequest, "application/json", `{"error":"could not parse elevation \"high\"","code":400}` + "\n"},
+		"InternalJSON":    {"", "application/json", http.StatusInternalServerError, "application/json", `{"error":"internal error","code":500}` + "\n"},
+		"ValidationPlain": {"?minElevation=high", "", http.StatusBadRequest, "text/plain; charset=utf-8", "could not parse elevation \"high\"\n"},
+		"InternalPlain":   {"", "text/html, */*", http.StatusInternalServerError, "text/plain; charset=utf-8", "internal error\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/stations/"+tc.query, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if got, want := resp.Header.Get("Content-Type"), tc.contentType; got != want {
+				t.Fatalf("got content type %q, want %q", got, want)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.body, string(b)); diff != "" {
+				t.Fatalf("body mismatch (-want +got):\n%s", diff)
+			}
+			if tc.contentType == "application/json" && !json.Valid(b) {
+				t.Fatalf("body is not valid JSON: %s", b)
+			}
+		})
+	}
+}
+
+func TestAcceptsJSON(t *testing.T) {
+	testCases := map[string]bool{
+		"":                                  false,
+		"application/json":                  true,
+		"text/html, application/json;q=0.9": true,
+		"application/json;q=0":              false,
+		"*/*":                               false,
+		"text/csv":                          false,
+		"application/json;q=x":              false,
+	}
+
+	for in, want := range testCases {
+		if got := acceptsJSON(in); got != want {
+			t.Errorf("acceptsJSON(%q): got %v, want %v", in, got, want)
+		}
+	}
+}
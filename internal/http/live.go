@@ -0,0 +1,187 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"golang.org/x/net/websocket"
+)
+
+// DefaultLiveInterval is the default interval in which the latest points are
+// polled for live data streams. LTER stations aggregate points every 15
+// minutes, so polling more often only shortens the delay of a new point.
+const DefaultLiveInterval = time.Minute
+
+// livePoint is a single new point pushed to live data streams.
+type livePoint struct {
+	Station     string    `json:"station"`
+	Label       string    `json:"label"`
+	Aggregation string    `json:"aggregation"`
+	Unit        string    `json:"unit"`
+	Timestamp   time.Time `json:"timestamp"`
+	Value       float64   `json:"value"`
+}
+
+// handleLive streams the latest points of the measurements and stations given
+// by the query parameters measurements and stations over a WebSocket. The
+// latest points are polled every liveInterval and each point not sent before
+// is pushed as part of a JSON array. Measurements are filtered by the role of
+// the user like for downloads.
+func (h *Handler) handleLive() http.Handler {
+	ws := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler:   h.streamLive,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(w, r, errors.New("Expected GET request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, err := parseLiveFilter(r); err != nil {
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		ws.ServeHTTP(w, r)
+	})
+}
+
+// streamLive pushes new points to the given connection until the client
+// closes it or the request context is done.
+func (h *Handler) streamLive(conn *websocket.Conn) {
+	defer conn.Close()
+
+	r := conn.Request()
+	filter, err := parseLiveFilter(r)
+	if err != nil {
+		return
+	}
+
+	// The connection outlives the request, so the deadlines set by the
+	// server's read and write timeouts must not apply.
+	conn.SetDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Clients are not expected to send anything, reading only detects when
+	// the connection is closed.
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		cancel()
+	}()
+
+	ticker := time.NewTicker(h.liveInterval)
+	defer ticker.Stop()
+
+	sent := make(map[string]time.Time)
+	for {
+		ts, err := h.db.Latest(ctx, filter)
+		if err != nil && !errors.Is(err, browser.ErrDataNotFound) {
+			log.Printf("live: %v", err)
+		}
+
+		if points := newLivePoints(ts, sent); len(points) > 0 {
+			if err := websocket.JSON.Send(conn, points); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newLivePoints returns the points of the given time series newer than the
+// ones recorded in sent and records them.
+func newLivePoints(ts browser.TimeSeries, sent map[string]time.Time) []livePoint {
+	var points []livePoint
+	for _, m := range ts {
+		key := fmt.Sprintf("%d/%s/%s", m.Station.ID, m.Station.Name, m.Label)
+		for _, p := range m.Points {
+			// NaN cannot be represented in JSON.
+			if math.IsNaN(p.Value) {
+				continue
+			}
+			if last, ok := sent[key]; ok && !p.Timestamp.After(last) {
+				continue
+			}
+			sent[key] = p.Timestamp
+
+			points = append(points, livePoint{
+				Station:     m.Station.Name,
+				Label:       m.Label,
+				Aggregation: m.Aggregation,
+				Unit:        m.Unit,
+				Timestamp:   p.Timestamp,
+				Value:       p.Value,
+			})
+		}
+	}
+	return points
+}
+
+// parseLiveFilter parses the stations and measurements of a live data stream
+// from the given request.
+func parseLiveFilter(r *http.Request) (*browser.SeriesFilter, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	if r.Form["stations"] == nil {
+		return nil, errors.New("at least one station must be given")
+	}
+
+	groups, err := browser.ParseGroups(strings.Join(r.Form["measurements"], ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, errors.New("at least one measurement must be given")
+	}
+
+	return &browser.SeriesFilter{
+		Groups:   groups,
+		Stations: r.Form["stations"],
+	}, nil
+}
+
+// checkSameOrigin rejects WebSocket handshakes from other origins, since
+// browsers send the authentication cookie along with cross origin WebSocket
+// requests.
+func checkSameOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Host != r.Host {
+		return fmt.Errorf("origin %q not allowed", origin)
+	}
+
+	config.Origin = u
+	return nil
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/middleware"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/websocket"
+)
+
+func TestHandleLive(t *testing.T) {
+	const interval = 10 * time.Millisecond
+	ts := time.Date(2020, 1, 1, 0, 15, 0, 0, browser.Location)
+
+	var (
+		mu    sync.Mutex
+		calls int
+		roles []browser.Role
+	)
+	db := &mock.Database{
+		LatestFn: func(ctx context.Context, f *browser.SeriesFilter) (browser.TimeSeries, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			calls++
+			roles = append(roles, browser.UserFromContext(ctx).Role)
+
+			// The latest point changes only after the second poll.
+			latest := ts
+			if calls > 2 {
+				latest = ts.Add(15 * time.Minute)
+			}
+			return browser.TimeSeries{
+				{
+					Label:   "air_t_avg",
+					Unit:    "deg C",
+					Station: &browser.Station{Name: "s1"},
+					Points:  []*browser.Point{{Timestamp: latest, Value: float64(calls)}},
+				},
+			}, nil
+		},
+	}
+	h := NewHandler(WithDatabase(db), WithLiveInterval(interval))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(withCTX(browser.External)))
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/live?stations=1&measurements=0"
+
+	t.Run("BadRequest", func(t *testing.T) {
+		for _, query := range []string{
+			"measurements=0",
+			"stations=1",
+			"stations=1&measurements=x",
+			"stations=1&measurements=0&measurements=-1",
+			fmt.Sprintf("stations=1&measurements=%d", browser.NoGroup),
+		} {
+			resp, err := http.Get(srv.URL + "/api/v1/live?" + query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+				t.Fatalf("%s: got unexpected status code: %d, want %d", query, got, want)
+			}
+		}
+	})
+
+	t.Run("CrossOrigin", func(t *testing.T) {
+		if _, err := websocket.Dial(wsURL, "", "http://example.com"); err == nil {
+			t.Fatal("expected handshake from another origin to fail")
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		conn, err := websocket.Dial(wsURL, "", srv.URL)
+		if err != nil {
+			t.Fatalf("websocket.Dial: %v", err)
+		}
+
+		// The first frame is sent right away, the second once the latest
+		// point changed. Unchanged points are not sent again.
+		want := [][]livePoint{
+			{{Station: "s1", Label: "air_t_avg", Unit: "deg C", Timestamp: ts, Value: 1}},
+			{{Station: "s1", Label: "air_t_avg", Unit: "deg C", Timestamp: ts.Add(15 * time.Minute), Value: 3}},
+		}
+		for i, w := range want {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+
+			var got []livePoint
+			if err := websocket.JSON.Receive(conn, &got); err != nil {
+				t.Fatalf("receiving frame %d: %v", i, err)
+			}
+			if diff := cmp.Diff(w, got); diff != "" {
+				t.Fatalf("frame %d mismatch (-want +got):\n%s", i, diff)
+			}
+		}
+		conn.Close()
+
+		// After the client closed the connection polling must stop.
+		count := func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return calls
+		}
+		time.Sleep(5 * interval)
+		before := count()
+		time.Sleep(10 * interval)
+		if after := count(); after != before {
+			t.Fatalf("Latest called %d times after the connection was closed", after-before)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, r := range roles {
+			if r != browser.External {
+				t.Fatalf("Latest called with role %q, want %q", r, browser.External)
+			}
+		}
+	})
+}
+
+func TestParseLiveFilter(t *testing.T) {
+	testCases := map[string]struct {
+		query   string
+		want    *browser.SeriesFilter
+		wantErr bool
+	}{
+		"Valid": {
+			query: "stations=1&stations=2&measurements=1&measurements=0&measurements=1",
+			want: &browser.SeriesFilter{
+				Groups:   []browser.Group{browser.RelativeHumidity, browser.AirTemperature},
+				Stations: []string{"1", "2"},
+			},
+		},
+		"NoStations":     {query: "measurements=0", wantErr: true},
+		"NoMeasurements": {query: "stations=1", wantErr: true},
+		"Empty":          {query: "stations=1&measurements=", wantErr: true},
+		"Invalid":        {query: "stations=1&measurements=0&measurements=x", wantErr: true},
+		"Unknown":        {query: fmt.Sprintf("stations=1&measurements=%d", browser.NoGroup), wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/live?"+tc.query, nil)
+			got, err := parseLiveFilter(req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestHandleLiveMiddleware streams through the middlewares wrapping the
+// handler in cmd/browser, which must let the WebSocket hijack the connection.
+func TestHandleLiveMiddleware(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 15, 0, 0, browser.Location)
+	db := &mock.Database{
+		LatestFn: func(ctx context.Context, f *browser.SeriesFilter) (browser.TimeSeries, error) {
+			return browser.TimeSeries{
+				{
+					Label:   "air_t_avg",
+					Unit:    "deg C",
+					Station: &browser.Station{Name: "s1"},
+					Points:  []*browser.Point{{Timestamp: ts, Value: 1}},
+				},
+			}, nil
+		},
+	}
+	h := NewHandler(WithDatabase(db), WithLiveInterval(10*time.Millisecond))
+
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(withCTX(browser.External)))
+		})
+	}
+	mw := middleware.Chain(
+		middleware.SecureHeaders(),
+		middleware.XSRFProtect("test"),
+		authenticate,
+		middleware.LoggerWithStats(ioutil.Discard, nil),
+	)
+	srv := httptest.NewServer(mw(h))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/live?stations=1&measurements=0"
+	conn, err := websocket.Dial(wsURL, "", srv.URL)
+	if err != nil {
+		t.Fatalf("websocket.Dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var got []livePoint
+	if err := websocket.JSON.Receive(conn, &got); err != nil {
+		t.Fatalf("receiving frame: %v", err)
+	}
+	want := []livePoint{{Station: "s1", Label: "air_t_avg", Unit: "deg C", Timestamp: ts, Value: 1}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("frame mismatch (-want +got):\n%s", diff)
+	}
+}
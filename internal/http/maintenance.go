@@ -0,0 +1,102 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultMaintenanceMessage is shown if maintenance mode is enabled without a
+// message.
+const DefaultMaintenanceMessage = "The Data Browser is under maintenance. Downloads are temporarily unavailable, please try again later."
+
+// maintenanceMode is toggled at runtime while the backends are under
+// maintenance. If enabled, exports are rejected and the index shows a banner
+// with the message.
+type maintenanceMode struct {
+	mu      sync.RWMutex
+	enabled bool
+	message string
+}
+
+// get reports whether maintenance mode is enabled and its message.
+func (m *maintenanceMode) get() (bool, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled, m.message
+}
+
+// set enables or disables maintenance mode. An empty message is replaced by
+// DefaultMaintenanceMessage.
+func (m *maintenanceMode) set(enabled bool, message string) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		message = DefaultMaintenanceMessage
+	}
+
+	m.mu.Lock()
+	m.enabled = enabled
+	m.message = message
+	m.mu.Unlock()
+
+	log.Printf("http: maintenance mode enabled: %t", enabled)
+}
+
+// rejectInMaintenance is a HTTP middleware function which responds with
+// http.StatusServiceUnavailable and the maintenance message instead of calling
+// the given handler while maintenance mode is enabled.
+func (h *Handler) rejectInMaintenance(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if enabled, message := h.maintenance.get(); enabled {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, message, http.StatusServiceUnavailable)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handleMaintenance reports the state of maintenance mode on GET and changes
+// it on POST. The form value enabled turns it on (1) or off (0), message sets
+// the text shown to users.
+func (h *Handler) handleMaintenance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var enabled bool
+			switch r.FormValue("enabled") {
+			case "1":
+				enabled = true
+			case "0":
+			default:
+				apiError(w, r, errors.New("enabled must be 1 or 0"), http.StatusBadRequest)
+				return
+			}
+			h.maintenance.set(enabled, r.FormValue("message"))
+		default:
+			apiError(w, r, errors.New("Expected GET or POST request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		enabled, message := h.maintenance.get()
+		resp := struct {
+			Enabled bool   `json:"enabled"`
+			Message string `json:"message"`
+		}{enabled, message}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("maintenance: %v", err)
+		}
+	}
+}
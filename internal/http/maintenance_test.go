@@ -0,0 +1,138 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+// indexBackend is a testBackend which can render the index.
+type indexBackend struct {
+	testBackend
+}
+
+func (b *indexBackend) Maintenance(ctx context.Context) ([]string, error) {
+	return []string{}, nil
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	h := NewHandler(
+		WithDatabase(&indexBackend{}),
+		WithStationService(&mock.StationService{
+			StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+				return browser.Stations{}, nil
+			},
+		}),
+	)
+
+	const filter = "startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"
+
+	do := func(t *testing.T, method, target, body string, role browser.Role) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(withCTX(role))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		resp := w.Result()
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+		}
+		return resp.StatusCode, string(b)
+	}
+
+	exports := map[string]struct {
+		target string
+		body   string
+	}{
+		"Series":   {"/api/v1/series", filter},
+		"Template": {"/api/v1/templates", filter + "&language=python"},
+	}
+
+	for k, tc := range exports {
+		if got, _ := do(t, http.MethodPost, tc.target, tc.body, browser.FullAccess); got != http.StatusOK {
+			t.Fatalf("%s: got unexpected status code before maintenance: %d", k, got)
+		}
+	}
+
+	// Only users with full access may toggle maintenance mode.
+	if got, _ := do(t, http.MethodPost, "/api/v1/maintenance", "enabled=1", browser.Public); got != http.StatusNotFound {
+		t.Fatalf("Public: got unexpected status code: %d, want %d", got, http.StatusNotFound)
+	}
+	if got, _ := do(t, http.MethodPost, "/api/v1/maintenance", "enabled=yes", browser.FullAccess); got != http.StatusBadRequest {
+		t.Fatalf("invalid value: got unexpected status code: %d, want %d", got, http.StatusBadRequest)
+	}
+
+	const message = "InfluxDB is being upgraded."
+	code, body := do(t, http.MethodPost, "/api/v1/maintenance", "enabled=1&message="+message, browser.FullAccess)
+	if code != http.StatusOK {
+		t.Fatalf("got unexpected status code: %d, want %d", code, http.StatusOK)
+	}
+	var state map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &state); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]interface{}{"enabled": true, "message": message}, state); diff != "" {
+		t.Fatalf("state mismatch (-want +got):\n%s", diff)
+	}
+
+	for k, tc := range exports {
+		code, body := do(t, http.MethodPost, tc.target, tc.body, browser.FullAccess)
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("%s: got unexpected status code in maintenance: %d, want %d", k, code, http.StatusServiceUnavailable)
+		}
+		if !strings.Contains(body, message) {
+			t.Fatalf("%s: body %q does not contain the maintenance message", k, body)
+		}
+	}
+
+	code, body = do(t, http.MethodGet, "/", "", browser.Public)
+	if code != http.StatusOK {
+		t.Fatalf("index: got unexpected status code: %d, want %d", code, http.StatusOK)
+	}
+	if !strings.Contains(body, message) {
+		t.Fatal("index does not show the maintenance banner")
+	}
+
+	if got, _ := do(t, http.MethodPost, "/api/v1/maintenance", "enabled=0", browser.FullAccess); got != http.StatusOK {
+		t.Fatalf("got unexpected status code: %d, want %d", got, http.StatusOK)
+	}
+	for k, tc := range exports {
+		if got, _ := do(t, http.MethodPost, tc.target, tc.body, browser.FullAccess); got != http.StatusOK {
+			t.Fatalf("%s: got unexpected status code after maintenance: %d", k, got)
+		}
+	}
+	if _, body := do(t, http.MethodGet, "/", "", browser.Public); strings.Contains(body, "maintenance-banner") {
+		t.Fatal("index shows the maintenance banner after maintenance")
+	}
+}
+
+func TestWithMaintenance(t *testing.T) {
+	h := NewHandler(WithDatabase(&testBackend{}), WithMaintenance(""))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader("startDate=2019-07-23&endDate=2020-01-23&stations=1&measurements=a"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got, want := w.Result().StatusCode, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+	if got := w.Body.String(); !strings.Contains(got, DefaultMaintenanceMessage) {
+		t.Fatalf("got body %q, want the default maintenance message", got)
+	}
+}
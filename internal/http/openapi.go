@@ -0,0 +1,68 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// openAPIDocument is the part of an OpenAPI 3 document needed for validating
+// it.
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// parseOpenAPI parses and validates the given OpenAPI 3 document.
+func parseOpenAPI(b []byte) (*openAPIDocument, error) {
+	var doc openAPIDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("openapi: %v", err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("openapi: unsupported version %q", doc.OpenAPI)
+	}
+	if doc.Info.Title == "" || doc.Info.Version == "" {
+		return nil, errors.New("openapi: info title and version are required")
+	}
+	if len(doc.Paths) == 0 {
+		return nil, errors.New("openapi: no paths documented")
+	}
+	for p, ops := range doc.Paths {
+		if len(ops) == 0 {
+			return nil, fmt.Errorf("openapi: no operations documented for %q", p)
+		}
+	}
+
+	return &doc, nil
+}
+
+// handleOpenAPI serves the embedded OpenAPI document describing the API
+// endpoints.
+func handleOpenAPI() http.HandlerFunc {
+	if _, err := parseOpenAPI(openAPISpec); err != nil {
+		log.Fatal(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Expected GET request", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleOpenAPI(t *testing.T) {
+	h := NewHandler(
+		WithDatabase(&mock.Database{}),
+		WithStationService(&mock.StationService{}),
+		WithUserService(&mock.UserService{}),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Fatalf("got Content-Type %q, want %q", got, "application/json")
+	}
+
+	var doc openAPIDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each documented path must be served by an API route and each API route
+	// must be documented by at least one path.
+	routes := make(map[string]bool)
+	for _, r := range h.apiRoutes {
+		routes[r] = true
+	}
+
+	documented := make(map[string]bool)
+	for p := range doc.Paths {
+		u := strings.NewReplacer("{id}", "1").Replace(p)
+		_, pattern := h.mux.Handler(httptest.NewRequest(http.MethodGet, u, nil))
+		if !routes[pattern] {
+			t.Errorf("documented path %q is served by %q, which is not an API route", p, pattern)
+		}
+		documented[pattern] = true
+	}
+
+	var undocumented []string
+	for _, r := range h.apiRoutes {
+		if !documented[r] {
+			undocumented = append(undocumented, r)
+		}
+	}
+	sort.Strings(undocumented)
+	if diff := cmp.Diff([]string(nil), undocumented); diff != "" {
+		t.Errorf("undocumented API routes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseOpenAPI(t *testing.T) {
+	testCases := map[string]struct {
+		in      string
+		wantErr bool
+	}{
+		"Embedded":     {string(openAPISpec), false},
+		"Invalid":      {`{"openapi":`, true},
+		"Swagger":      {`{"swagger":"2.0","info":{"title":"t","version":"1"},"paths":{"/":{"get":{}}}}`, true},
+		"NoInfo":       {`{"openapi":"3.0.3","paths":{"/":{"get":{}}}}`, true},
+		"NoPaths":      {`{"openapi":"3.0.3","info":{"title":"t","version":"1"}}`, true},
+		"NoOperations": {`{"openapi":"3.0.3","info":{"title":"t","version":"1"},"paths":{"/":{}}}`, true},
+		"Valid":        {`{"openapi":"3.0.3","info":{"title":"t","version":"1"},"paths":{"/":{"get":{}}}}`, false},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			_, err := parseOpenAPI([]byte(tc.in))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultRobots is the robots policy if none is configured. It allows all
+// crawlers to index all pages.
+const DefaultRobots = "User-agent: *\nAllow: /\n"
+
+// sitemapURLSet is the root element of a sitemap, see
+// https://www.sitemaps.org/protocol.html.
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+// handleRobots writes the robots policy, referring crawlers to the sitemap.
+func (h *Handler) handleRobots() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, strings.TrimRight(h.robots, "\n")+"\n")
+		fmt.Fprintf(w, "Sitemap: %s/sitemap.xml\n", baseURL(r))
+	}
+}
+
+// handleSitemap writes a sitemap listing the index page and the static pages
+// in each language of the user interface.
+func (h *Handler) handleSitemap() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		base := baseURL(r)
+
+		set := sitemapURLSet{
+			Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
+			URLs:  []sitemapURL{{Loc: base + "/"}},
+		}
+		for _, l := range h.languages {
+			for _, p := range h.pages {
+				set.URLs = append(set.URLs, sitemapURL{Loc: fmt.Sprintf("%s/%s/%s/", base, l, p)})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		fmt.Fprint(w, xml.Header)
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(set); err != nil {
+			Error(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// baseURL returns the scheme and host the given request was sent to. Behind a
+// proxy terminating TLS the scheme is read from the X-Forwarded-Proto header.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleRobots(t *testing.T) {
+	testCases := map[string]struct {
+		options []Option
+		proto   string
+		want    string
+	}{
+		"Default": {nil, "", "User-agent: *\nAllow: /\nSitemap: http://example.com/sitemap.xml\n"},
+		"Custom":  {[]Option{WithRobots("User-agent: *\nDisallow: /api/")}, "", "User-agent: *\nDisallow: /api/\nSitemap: http://example.com/sitemap.xml\n"},
+		"HTTPS":   {nil, "https", "User-agent: *\nAllow: /\nSitemap: https://example.com/sitemap.xml\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := NewHandler(tc.options...)
+
+			req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+			if tc.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got, want := w.Result().StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if diff := cmp.Diff(tc.want, w.Body.String()); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleSitemap(t *testing.T) {
+	h := NewHandler(WithLanguages([]string{"en", "de"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got, want := w.Result().StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>http://example.com/</loc>
+  </url>
+  <url>
+    <loc>http://example.com/en/impressum/</loc>
+  </url>
+  <url>
+    <loc>http://example.com/en/info/</loc>
+  </url>
+  <url>
+    <loc>http://example.com/en/license/</loc>
+  </url>
+  <url>
+    <loc>http://example.com/en/privacy/</loc>
+  </url>
+  <url>
+    <loc>http://example.com/de/impressum/</loc>
+  </url>
+  <url>
+    <loc>http://example.com/de/info/</loc>
+  </url>
+  <url>
+    <loc>http://example.com/de/license/</loc>
+  </url>
+  <url>
+    <loc>http://example.com/de/privacy/</loc>
+  </url>
+</urlset>`
+	if diff := cmp.Diff(want, w.Body.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleSitemapPages(t *testing.T) {
+	h := NewHandler(WithLanguages([]string{"en"}), WithPages([]string{"privacy"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "<loc>http://example.com/en/privacy/</loc>") {
+		t.Errorf("sitemap does not list the configured page:\n%s", body)
+	}
+	if strings.Contains(body, "impressum") {
+		t.Errorf("sitemap lists a page not configured:\n%s", body)
+	}
+}
@@ -5,20 +5,24 @@
 package http
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/euracresearch/browser"
 )
 
 func (h *Handler) handleStations() http.HandlerFunc {
 	funcMap := template.FuncMap{
-		"T":  translate,
-		"Is": isRole,
+		"T":    translate,
+		"Is":   isRole,
+		"Join": strings.Join,
 		"Mod": func(i int) bool {
 			i++
 			return (i % 2) == 0
@@ -30,7 +34,32 @@ func (h *Handler) handleStations() http.HandlerFunc {
 		log.Fatal(err)
 	}
 
+	stationList := h.handleStationList()
+	stationGroups := h.handleStationGroups()
+	stationSensors := h.handleStationSensors()
+	stationNearest := h.handleStationNearest()
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/stations/" {
+			stationList(w, r)
+			return
+		}
+
+		if path.Base(r.URL.Path) == "groups" {
+			stationGroups(w, r)
+			return
+		}
+
+		if path.Base(r.URL.Path) == "sensors" {
+			stationSensors(w, r)
+			return
+		}
+
+		if r.URL.Path == "/api/v1/stations/nearest" {
+			stationNearest(w, r)
+			return
+		}
+
 		id, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
 		if err != nil {
 			Error(w, err, http.StatusInternalServerError)
@@ -50,16 +79,24 @@ func (h *Handler) handleStations() http.HandlerFunc {
 			return
 		}
 
+		aggregations, err := h.db.AggregationsByStation(ctx, id)
+		if err != nil && !errors.Is(err, browser.ErrGroupsNotFound) {
+			Error(w, err, http.StatusInternalServerError)
+			return
+		}
+
 		err = tmpl.Execute(w, struct {
-			Station  *browser.Station
-			Groups   []browser.Group
-			Language string
-			User     *browser.User
+			Station      *browser.Station
+			Groups       []browser.Group
+			Aggregations map[browser.Group][]string
+			Language     string
+			User         *browser.User
 		}{
-			Station:  station,
-			Groups:   groups,
-			Language: languageFromCookie(r),
-			User:     browser.UserFromContext(ctx),
+			Station:      station,
+			Groups:       groups,
+			Aggregations: aggregations,
+			Language:     h.languageFromRequest(r),
+			User:         browser.UserFromContext(ctx),
 		})
 		if err != nil {
 			Error(w, err, http.StatusInternalServerError)
@@ -67,3 +104,264 @@ func (h *Handler) handleStations() http.HandlerFunc {
 
 	}
 }
+
+// stationJSON is the JSON representation of a station in the station list.
+// Invalid coordinates are omitted, see browser.Station.ValidCoordinates. The
+// landuse is labeled in the language of the user interface.
+type stationJSON struct {
+	*browser.Station
+	LanduseLabel string
+	Latitude     *float64 `json:",omitempty"`
+	Longitude    *float64 `json:",omitempty"`
+}
+
+func newStationJSON(s *browser.Station, lang string) stationJSON {
+	sj := stationJSON{Station: s, LanduseLabel: browser.Landuse(s.Landuse, lang)}
+	if s.ValidCoordinates() {
+		sj.Latitude, sj.Longitude = &s.Latitude, &s.Longitude
+	}
+	return sj
+}
+
+// handleStationList writes the stations matching the filter given by the query
+// parameters landuse, name, minElevation and maxElevation as JSON. Invalid
+// coordinates are omitted.
+func (h *Handler) handleStationList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(w, r, errors.New("Expected GET request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter, err := browser.ParseStationFilterFromRequest(r)
+		if err != nil {
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		stations, err := h.stationService.Stations(r.Context(), filter)
+		if err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		lang := h.languageFromRequest(r)
+		resp := make([]stationJSON, 0, len(stations))
+		for _, s := range stations {
+			resp = append(resp, newStationJSON(s, lang))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// stationGroup is the JSON representation of a group measured at a station.
+type stationGroup struct {
+	ID        browser.Group  `json:"id"`
+	Name      string         `json:"name"`
+	Units     []string       `json:"units"`
+	SubGroups []stationGroup `json:"subgroups,omitempty"`
+}
+
+// handleStationGroups writes the groups of measurements stored for the station
+// of the path /api/v1/stations/{id}/groups as JSON. Only groups the user has
+// access to are included, each with its units and the sub groups measured at
+// the station.
+func (h *Handler) handleStationGroups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(w, r, errors.New("Expected GET request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseInt(path.Base(path.Dir(r.URL.Path)), 10, 64)
+		if err != nil {
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		groups, err := h.db.GroupsByStation(ctx, id)
+		if errors.Is(err, browser.ErrGroupsNotFound) {
+			apiError(w, r, err, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		units, err := h.db.UnitsByStation(ctx, id)
+		if err != nil && !errors.Is(err, browser.ErrGroupsNotFound) {
+			apiError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		role := browser.UserFromContext(ctx).Role
+
+		resp := []stationGroup{}
+		for _, g := range groups {
+			sg := stationGroup{
+				ID:    g,
+				Name:  groupName(g, role),
+				Units: units[g],
+			}
+			for _, sub := range g.SubGroups() {
+				u, ok := units[sub]
+				if !ok {
+					continue
+				}
+				sg.SubGroups = append(sg.SubGroups, stationGroup{
+					ID:    sub,
+					Name:  groupName(sub, role),
+					Units: u,
+				})
+			}
+			resp = append(resp, sg)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// handleStationSensors writes the sensors installed at the station of the
+// path /api/v1/stations/{id}/sensors as JSON. The ID of a sensor can be given
+// as sensor form value of the series endpoint.
+func (h *Handler) handleStationSensors() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(w, r, errors.New("Expected GET request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseInt(path.Base(path.Dir(r.URL.Path)), 10, 64)
+		if err != nil {
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		sensors, err := h.stationService.Sensors(r.Context(), id)
+		if err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		if sensors == nil {
+			sensors = []*browser.Sensor{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(sensors); err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// groupName returns the display name of the given group for the given role.
+func groupName(g browser.Group, r browser.Role) string {
+	if r == browser.Public {
+		return g.Public()
+	}
+	return g.String()
+}
+
+// nearestJSON is the JSON representation of the station nearest to the given
+// coordinates.
+type nearestJSON struct {
+	Station  stationJSON `json:"station"`
+	Distance float64     `json:"distance"`
+}
+
+// handleStationNearest writes the station nearest to the coordinates given by
+// the query parameters lat and lon together with its distance in kilometers as
+// JSON.
+func (h *Handler) handleStationNearest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(w, r, errors.New("Expected GET request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		lat, err := parseCoordinate(r, "lat")
+		if err != nil {
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		}
+		lon, err := parseCoordinate(r, "lon")
+		if err != nil {
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		station, distance, err := h.stationService.Nearest(r.Context(), lat, lon)
+		switch {
+		case errors.Is(err, browser.ErrInvalidCoordinates):
+			apiError(w, r, err, http.StatusBadRequest)
+			return
+		case errors.Is(err, browser.ErrStationNotFound):
+			apiError(w, r, err, http.StatusNotFound)
+			return
+		case err != nil:
+			apiError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(nearestJSON{newStationJSON(station, h.languageFromRequest(r)), distance}); err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// landuseJSON is a landuse code together with its label in the language of the
+// user interface.
+type landuseJSON struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+// handleLanduse writes the landuse codes of all stations with their labels as
+// JSON, e.g. for filtering stations and downloads by landuse.
+func (h *Handler) handleLanduse() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apiError(w, r, errors.New("Expected GET request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		codes, err := h.stationService.Landuses(r.Context())
+		if err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		lang := h.languageFromRequest(r)
+		landuse := make([]landuseJSON, len(codes))
+		for i, c := range codes {
+			landuse[i] = landuseJSON{Code: c, Label: browser.Landuse(c, lang)}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(landuse); err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// parseCoordinate parses the query parameter with the given name as
+// coordinate in decimal degrees.
+func parseCoordinate(r *http.Request, name string) (float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, fmt.Errorf("missing %s", name)
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return f, nil
+}
@@ -0,0 +1,384 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleStationGroups(t *testing.T) {
+	db := &mock.Database{
+		GroupsByStationFn: func(ctx context.Context, id int64) ([]browser.Group, error) {
+			if id != 6 {
+				return nil, browser.ErrGroupsNotFound
+			}
+
+			var groups []browser.Group
+			user := browser.UserFromContext(ctx)
+			for _, g := range browser.GroupsByRole(user.Role, nil) {
+				switch g {
+				case browser.AirTemperature, browser.Wind, browser.WindSpeed, browser.WindDirection:
+					groups = append(groups, g)
+				}
+			}
+			return groups, nil
+		},
+		UnitsByStationFn: func(ctx context.Context, id int64) (map[browser.Group][]string, error) {
+			return map[browser.Group][]string{
+				browser.AirTemperature: {"deg C"},
+				browser.Wind:           {"deg", "m/s"},
+				browser.WindSpeed:      {"m/s"},
+				browser.WindDirection:  {"deg"},
+			}, nil
+		},
+	}
+	h := NewHandler(WithDatabase(db))
+
+	testCases := map[string]struct {
+		ctx        context.Context
+		method     string
+		path       string
+		statusCode int
+		want       []stationGroup
+	}{
+		"notfound": {withCTX(browser.FullAccess), http.MethodGet, "/api/v1/stations/8888/groups", http.StatusNotFound, nil},
+		"invalid":  {withCTX(browser.FullAccess), http.MethodGet, "/api/v1/stations/a/groups", http.StatusBadRequest, nil},
+		"POST":     {withCTX(browser.FullAccess), http.MethodPost, "/api/v1/stations/6/groups", http.StatusMethodNotAllowed, nil},
+		"Public": {withCTX(browser.Public), http.MethodGet, "/api/v1/stations/6/groups", http.StatusOK, []stationGroup{
+			{ID: browser.AirTemperature, Name: browser.AirTemperature.Public(), Units: []string{"deg C"}},
+			{ID: browser.WindDirection, Name: browser.WindDirection.Public(), Units: []string{"deg"}},
+			{ID: browser.WindSpeed, Name: browser.WindSpeed.Public(), Units: []string{"m/s"}},
+		}},
+		"FullAccess": {withCTX(browser.FullAccess), http.MethodGet, "/api/v1/stations/6/groups", http.StatusOK, []stationGroup{
+			{ID: browser.AirTemperature, Name: browser.AirTemperature.String(), Units: []string{"deg C"}},
+			{ID: browser.Wind, Name: browser.Wind.String(), Units: []string{"deg", "m/s"}, SubGroups: []stationGroup{
+				{ID: browser.WindSpeed, Name: browser.WindSpeed.String(), Units: []string{"m/s"}},
+				{ID: browser.WindDirection, Name: browser.WindDirection.String(), Units: []string{"deg"}},
+			}},
+		}},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req = req.WithContext(tc.ctx)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var got []stationGroup
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleStationSensors(t *testing.T) {
+	sensors := []*browser.Sensor{
+		{ID: 12, Name: "Thermohygrometer", Serial: "TH-0815", Model: "HC2A-S3", StationID: 2, Measurements: []string{"air_t_avg", "air_rh_avg"}},
+	}
+	h := NewHandler(WithStationService(&mock.StationService{
+		SensorsFn: func(ctx context.Context, id int64) ([]*browser.Sensor, error) {
+			if id != 2 {
+				return nil, nil
+			}
+			return sensors, nil
+		},
+	}))
+
+	testCases := map[string]struct {
+		method     string
+		path       string
+		statusCode int
+		want       []*browser.Sensor
+	}{
+		"OK":      {http.MethodGet, "/api/v1/stations/2/sensors", http.StatusOK, sensors},
+		"None":    {http.MethodGet, "/api/v1/stations/3/sensors", http.StatusOK, []*browser.Sensor{}},
+		"invalid": {http.MethodGet, "/api/v1/stations/a/sensors", http.StatusBadRequest, nil},
+		"POST":    {http.MethodPost, "/api/v1/stations/2/sensors", http.StatusMethodNotAllowed, nil},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var got []*browser.Sensor
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleStationList(t *testing.T) {
+	var got *browser.StationFilter
+	h := NewHandler(WithStationService(&mock.StationService{
+		StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+			got = filter
+			return browser.Stations{}, nil
+		},
+	}))
+
+	testCases := map[string]struct {
+		query      string
+		statusCode int
+		want       *browser.StationFilter
+	}{
+		"empty":     {"", http.StatusOK, &browser.StationFilter{}},
+		"landuse":   {"?landuse=me&landuse=pa", http.StatusOK, &browser.StationFilter{Landuse: []string{"me", "pa"}}},
+		"name":      {"?name=p1", http.StatusOK, &browser.StationFilter{Name: "p1"}},
+		"elevation": {"?minElevation=1000&maxElevation=2000", http.StatusOK, &browser.StationFilter{MinElevation: 1000, MaxElevation: 2000}},
+		"invalid":   {"?minElevation=high", http.StatusBadRequest, nil},
+		"range":     {"?minElevation=2000&maxElevation=1000", http.StatusBadRequest, nil},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			got = nil
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/stations/"+tc.query, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got, want := w.Result().StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleStationListCoordinates(t *testing.T) {
+	h := NewHandler(WithStationService(&mock.StationService{
+		StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+			return browser.Stations{
+				{ID: 1, Name: "valid", Latitude: 46.68, Longitude: 10.58},
+				{ID: 2, Name: "unparsed", Latitude: -1, Longitude: -1},
+				{ID: 3, Name: "latitude", Latitude: 91, Longitude: 10.58},
+				{ID: 4, Name: "longitude", Latitude: 46.68, Longitude: -180.5},
+				{ID: 5, Name: "bounds", Latitude: -90, Longitude: 180},
+			}, nil
+		},
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stations/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+
+	var stations []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&stations); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string][]interface{})
+	for _, s := range stations {
+		got[s["Name"].(string)] = []interface{}{s["Latitude"], s["Longitude"]}
+	}
+	want := map[string][]interface{}{
+		"valid":     {46.68, 10.58},
+		"unparsed":  {nil, nil},
+		"latitude":  {nil, nil},
+		"longitude": {nil, nil},
+		"bounds":    {-90.0, 180.0},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("coordinates mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleStationListLanduse(t *testing.T) {
+	h := NewHandler(WithStationService(&mock.StationService{
+		StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+			return browser.Stations{
+				{ID: 1, Name: "meadow", Landuse: "me"},
+				{ID: 2, Name: "unknown", Landuse: "xx"},
+			}, nil
+		},
+	}))
+
+	testCases := map[string]struct {
+		lang string
+		want map[string]interface{}
+	}{
+		"Default": {"", map[string]interface{}{"meadow": "Meadows", "unknown": "xx"}},
+		"German":  {"de", map[string]interface{}{"meadow": "Wiese", "unknown": "xx"}},
+		"Italian": {"it", map[string]interface{}{"meadow": "Prati", "unknown": "xx"}},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/stations/", nil)
+			if tc.lang != "" {
+				req.Header.Set("Accept-Language", tc.lang)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			var stations []map[string]interface{}
+			if err := json.NewDecoder(w.Result().Body).Decode(&stations); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]interface{})
+			for _, s := range stations {
+				got[s["Name"].(string)] = s["LanduseLabel"]
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("landuse label mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleStationNearest(t *testing.T) {
+	stations := browser.Stations{
+		{ID: 2, Name: "P1", Latitude: 46.685863, Longitude: 10.58294569},
+		{ID: 4, Name: "S3", Latitude: 46.76671, Longitude: 10.71079},
+	}
+	h := NewHandler(WithStationService(&mock.StationService{
+		NearestFn: func(ctx context.Context, lat, lon float64) (*browser.Station, float64, error) {
+			if !browser.ValidCoordinates(lat, lon) {
+				return nil, 0, browser.ErrInvalidCoordinates
+			}
+			if lat < 0 {
+				return nil, 0, browser.ErrStationNotFound
+			}
+			if lat > 46.72 {
+				return stations[1], stations[1].Distance(lat, lon), nil
+			}
+			return stations[0], stations[0].Distance(lat, lon), nil
+		},
+	}))
+
+	testCases := map[string]struct {
+		method     string
+		query      string
+		statusCode int
+		want       string
+	}{
+		"P1":         {http.MethodGet, "?lat=46.7&lon=10.6", http.StatusOK, "P1"},
+		"S3":         {http.MethodGet, "?lat=46.76&lon=10.7", http.StatusOK, "S3"},
+		"MissingLat": {http.MethodGet, "?lon=10.6", http.StatusBadRequest, ""},
+		"MissingLon": {http.MethodGet, "?lat=46.7", http.StatusBadRequest, ""},
+		"InvalidLat": {http.MethodGet, "?lat=north&lon=10.6", http.StatusBadRequest, ""},
+		"OutOfRange": {http.MethodGet, "?lat=46.7&lon=200", http.StatusBadRequest, ""},
+		"NoStation":  {http.MethodGet, "?lat=-46.7&lon=10.6", http.StatusNotFound, ""},
+		"POST":       {http.MethodPost, "?lat=46.7&lon=10.6", http.StatusMethodNotAllowed, ""},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/v1/stations/nearest"+tc.query, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var got struct {
+				Station struct {
+					Name string
+				} `json:"station"`
+				Distance float64 `json:"distance"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if got.Station.Name != tc.want {
+				t.Errorf("got station %q, want %q", got.Station.Name, tc.want)
+			}
+			if got.Distance <= 0 {
+				t.Errorf("got distance %f, want > 0", got.Distance)
+			}
+		})
+	}
+}
+
+func TestHandleLanduse(t *testing.T) {
+	h := NewHandler(WithStationService(&mock.StationService{
+		LandusesFn: func(ctx context.Context) ([]string, error) {
+			return []string{"fo", "me", "xx"}, nil
+		},
+	}))
+
+	testCases := map[string]struct {
+		method     string
+		lang       string
+		statusCode int
+		want       string
+	}{
+		"Default": {http.MethodGet, "", http.StatusOK, `[{"code":"fo","label":"Forest"},{"code":"me","label":"Meadows"},{"code":"xx","label":"xx"}]` + "\n"},
+		"German":  {http.MethodGet, "de", http.StatusOK, `[{"code":"fo","label":"Wald"},{"code":"me","label":"Wiese"},{"code":"xx","label":"xx"}]` + "\n"},
+		"Italian": {http.MethodGet, "it", http.StatusOK, `[{"code":"fo","label":"Boschi"},{"code":"me","label":"Prati"},{"code":"xx","label":"xx"}]` + "\n"},
+		"POST":    {http.MethodPost, "", http.StatusMethodNotAllowed, "Expected GET request\n"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/v1/landuse", nil)
+			if tc.lang != "" {
+				req.Header.Set("Accept-Language", tc.lang)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if got := w.Body.String(); got != tc.want {
+				t.Fatalf("got unexpected body: %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
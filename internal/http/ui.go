@@ -5,10 +5,10 @@
 package http
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"net/url"
@@ -18,12 +18,23 @@ import (
 
 	"github.com/euracresearch/browser"
 	"github.com/euracresearch/browser/internal/middleware"
+	"golang.org/x/text/language"
 )
 
 func (h *Handler) handleIndex() http.HandlerFunc {
 	funcMap := template.FuncMap{
-		"T":  translate,
-		"Is": isRole,
+		"T":            translate,
+		"Is":           isRole,
+		"Languages":    func() []string { return h.languages },
+		"LanguageName": languageName,
+		"CanUseTemplates": func(r browser.Role) bool {
+			for _, role := range h.templateRoles {
+				if r == role {
+					return true
+				}
+			}
+			return false
+		},
 	}
 
 	tmpl, err := template.New("base.tmpl").Funcs(funcMap).ParseFS(templateFS, "templates/base.tmpl", "templates/index.tmpl")
@@ -34,7 +45,7 @@ func (h *Handler) handleIndex() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		user := browser.UserFromContext(ctx)
-		lang := languageFromCookie(r)
+		lang := h.languageFromRequest(r)
 
 		// If the user is not public and has not signed the data usage
 		// agreement, redirect it to sign it.
@@ -43,7 +54,7 @@ func (h *Handler) handleIndex() http.HandlerFunc {
 			return
 		}
 
-		data, err := h.stationService.Stations(ctx)
+		data, err := h.stationService.Stations(ctx, nil)
 		if err != nil {
 			Error(w, err, http.StatusInternalServerError)
 			return
@@ -55,28 +66,36 @@ func (h *Handler) handleIndex() http.HandlerFunc {
 			return
 		}
 
+		inMaintenance, maintenanceMessage := h.maintenance.get()
+		if !inMaintenance {
+			maintenanceMessage = ""
+		}
+
+		start, end := h.defaultDateRange()
 		err = tmpl.Execute(w, struct {
-			Data          browser.Stations
-			Groups        []browser.Group
-			Maintenance   []string
-			User          *browser.User
-			Language      string
-			Path          string
-			AnalyticsCode string
-			Token         string
-			StartDate     string
-			EndDate       string
+			Data               browser.Stations
+			Groups             []browser.Group
+			Maintenance        []string
+			MaintenanceMessage string
+			User               *browser.User
+			Language           string
+			Path               string
+			AnalyticsCode      string
+			Token              string
+			StartDate          string
+			EndDate            string
 		}{
 			data,
-			browser.GroupsByRole(user.Role),
+			browser.GroupsByRole(user.Role, h.publicGroups),
 			maint,
+			maintenanceMessage,
 			user,
 			lang,
 			r.URL.Path,
 			h.analytics,
 			middleware.XSRFTokenPlaceholder,
-			time.Now().AddDate(0, -6, 0).Format("2006-01-02"),
-			time.Now().Format("2006-01-02"),
+			start.Format("2006-01-02"),
+			end.Format("2006-01-02"),
 		})
 		if err != nil {
 			Error(w, err, http.StatusInternalServerError)
@@ -86,8 +105,10 @@ func (h *Handler) handleIndex() http.HandlerFunc {
 
 func (h *Handler) handleHello() http.HandlerFunc {
 	funcMap := template.FuncMap{
-		"T":  translate,
-		"Is": isRole,
+		"T":            translate,
+		"Is":           isRole,
+		"Languages":    func() []string { return h.languages },
+		"LanguageName": languageName,
 	}
 
 	tmpl, err := template.New("base.tmpl").Funcs(funcMap).ParseFS(templateFS, "templates/base.tmpl", "templates/hello.tmpl")
@@ -96,18 +117,18 @@ func (h *Handler) handleHello() http.HandlerFunc {
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		lang := languageFromCookie(r)
+		lang := h.languageFromRequest(r)
 		ctx := r.Context()
 		user := browser.UserFromContext(ctx)
 
 		const name = "license"
-		license, err := templateFS.ReadFile(filepath.Join("templates", name, fmt.Sprintf("%s.%s.html", name, lang)))
+		license, err := h.readPage(name, name, lang)
 		if err != nil {
 			Error(w, err, http.StatusNotFound)
 			return
 		}
 
-		data, err := h.stationService.Stations(ctx)
+		data, err := h.stationService.Stations(ctx, nil)
 		if err != nil {
 			Error(w, err, http.StatusInternalServerError)
 			return
@@ -138,8 +159,10 @@ func (h *Handler) handleHello() http.HandlerFunc {
 
 func (h *Handler) handleStaticPage() http.HandlerFunc {
 	funcMap := template.FuncMap{
-		"T":  translate,
-		"Is": isRole,
+		"T":            translate,
+		"Is":           isRole,
+		"Languages":    func() []string { return h.languages },
+		"LanguageName": languageName,
 	}
 
 	tmpl, err := template.New("base.tmpl").Funcs(funcMap).ParseFS(templateFS, "templates/base.tmpl", "templates/page.tmpl")
@@ -147,10 +170,16 @@ func (h *Handler) handleStaticPage() http.HandlerFunc {
 		log.Fatal(err)
 	}
 
+	for _, p := range h.pages {
+		if fi, err := fs.Stat(templateFS, filepath.Join("templates", p)); err != nil || !fi.IsDir() {
+			log.Fatalf("static page %q not found", p)
+		}
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		user := browser.UserFromContext(ctx)
-		lang := languageFromCookie(r)
+		lang := h.languageFromRequest(r)
 
 		name, err := pageNameFromPath(r.URL.Path)
 		if err != nil {
@@ -159,20 +188,24 @@ func (h *Handler) handleStaticPage() http.HandlerFunc {
 			http.Redirect(w, r, p, http.StatusTemporaryRedirect)
 			return
 		}
-		filename := fmt.Sprintf("%s.%s.html", strings.ReplaceAll(name, "/", "."), lang)
+		if !h.isPage(name) {
+			http.NotFound(w, r)
+			return
+		}
+		prefix := strings.ReplaceAll(name, "/", ".")
 
 		// TODO: this is a special case for the info page only.
 		if name == "info" && user.Role != browser.Public {
-			filename = fmt.Sprintf("internal.info.%s.html", lang)
+			prefix = "internal.info"
 		}
 
-		p, err := templateFS.ReadFile(filepath.Join("templates", name, filename))
+		p, err := h.readPage(name, prefix, lang)
 		if err != nil {
 			Error(w, err, http.StatusNotFound)
 			return
 		}
 
-		data, err := h.stationService.Stations(ctx)
+		data, err := h.stationService.Stations(ctx, nil)
 		if err != nil {
 			Error(w, err, http.StatusInternalServerError)
 			return
@@ -184,6 +217,7 @@ func (h *Handler) handleStaticPage() http.HandlerFunc {
 			Language      string
 			Path          string
 			AnalyticsCode string
+			Token         string
 			Content       template.HTML
 		}{
 			data,
@@ -191,6 +225,7 @@ func (h *Handler) handleStaticPage() http.HandlerFunc {
 			lang,
 			name,
 			h.analytics,
+			middleware.XSRFTokenPlaceholder,
 			template.HTML(p),
 		})
 		if err != nil {
@@ -213,21 +248,28 @@ func pageNameFromPath(p string) (string, error) {
 	return names[len(names)-1], nil
 }
 
+// readPage reads the page of the given language from the given directory
+// below templates, falling back to the page of the default language.
+func (h *Handler) readPage(dir, prefix, lang string) ([]byte, error) {
+	p, err := templateFS.ReadFile(filepath.Join("templates", dir, fmt.Sprintf("%s.%s.html", prefix, lang)))
+	if err != nil && lang != h.languages[0] {
+		return h.readPage(dir, prefix, h.languages[0])
+	}
+	return p, err
+}
+
 // TODO: extract to middleware?
-func handleLanguage() http.HandlerFunc {
+func (h *Handler) handleLanguage() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		l := "en"
+		l := h.languages[0]
 
 		p := strings.TrimSuffix(r.URL.Path, "/")
-		switch p[len("/l/"):] {
-		case "de":
-			l = "de"
-		case "it":
-			l = "it"
+		if want := p[len("/l/"):]; h.isLanguage(want) {
+			l = want
 		}
 
 		http.SetCookie(w, &http.Cookie{
-			Name:  languageCookieName,
+			Name:  h.languageCookie,
 			Value: l,
 			Path:  "/",
 		})
@@ -254,39 +296,72 @@ func handleLanguage() http.HandlerFunc {
 	}
 }
 
-// languageFromCookie reads the language settings from a cookie.
-func languageFromCookie(r *http.Request) string {
-	c, err := r.Cookie(languageCookieName)
-	if err != nil {
-		return "en"
+// languageFromRequest returns the language of the user interface for the
+// given request. The language chosen by the user, read from a cookie, takes
+// precedence over the best match of the Accept-Language header among the valid
+// languages. If neither is usable, the default language is returned.
+func (h *Handler) languageFromRequest(r *http.Request) string {
+	c, err := r.Cookie(h.languageCookie)
+	if err == nil && h.isLanguage(c.Value) {
+		return c.Value
 	}
-	return c.Value
-}
 
-// isRole is a template helper function for verifying a users role.
-func isRole(r browser.Role, s string) bool {
-	return r == browser.NewRole(s)
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil || len(tags) == 0 {
+		return h.languages[0]
+	}
+	_, i, confidence := h.matcher.Match(tags...)
+	if confidence == language.No {
+		return h.languages[0]
+	}
+	return h.languages[i]
 }
 
-// translate is a template helper function for translating text to other
-// languages.
-func translate(key, lang string) template.HTML {
-	j, err := templateFS.ReadFile(filepath.Join("locale", fmt.Sprintf("%s.json", lang)))
-	if err != nil {
-		log.Println(err)
-		return template.HTML(key)
+// isLanguage reports whether l is a valid language of the user interface.
+// isPage reports whether the given name is one of the static pages.
+func (h *Handler) isPage(name string) bool {
+	for _, p := range h.pages {
+		if p == name {
+			return true
+		}
 	}
+	return false
+}
 
-	var m map[string]string
-	if err := json.Unmarshal(j, &m); err != nil {
-		log.Printf("translation: %v\n", err)
-		return template.HTML(key)
+func (h *Handler) isLanguage(l string) bool {
+	for _, v := range h.languages {
+		if v == l {
+			return true
+		}
 	}
+	return false
+}
 
-	v, ok := m[key]
-	if !ok {
-		return template.HTML(key)
+// languageNames are the names of languages in their own language, shown in
+// the language menu.
+var languageNames = map[string]string{
+	"de": "Deutsch",
+	"en": "English",
+	"fr": "Français",
+	"it": "Italiano",
+}
+
+// languageName is a template helper function returning the name of the given
+// language in its own language or the language code if it is unknown.
+func languageName(l string) string {
+	if n, ok := languageNames[l]; ok {
+		return n
 	}
+	return l
+}
+
+// isRole is a template helper function for verifying a users role.
+func isRole(r browser.Role, s string) bool {
+	return r == browser.NewRole(s)
+}
 
-	return template.HTML(v)
+// translate is a template helper function for translating text to other
+// languages, see browser.Translate.
+func translate(key, lang string) template.HTML {
+	return template.HTML(browser.Translate(key, lang))
 }
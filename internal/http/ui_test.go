@@ -0,0 +1,262 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/mock"
+)
+
+func TestHandleIndexDateRange(t *testing.T) {
+	now := time.Date(2021, time.March, 31, 12, 0, 0, 0, browser.Location)
+
+	testCases := map[string]struct {
+		options   []Option
+		startDate string
+	}{
+		"Default":    {nil, "2020-10-01"},
+		"ThirtyDays": {[]Option{WithDefaultDateRange(30 * 24 * time.Hour)}, "2021-03-01"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			options := append([]Option{
+				WithDatabase(&mock.Database{
+					MaintenanceFn: func(ctx context.Context) ([]string, error) { return []string{}, nil },
+				}),
+				WithStationService(&mock.StationService{
+					StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+						return browser.Stations{}, nil
+					},
+				}),
+			}, tc.options...)
+			h := NewHandler(options...)
+			h.now = func() time.Time { return now }
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req = req.WithContext(withCTX(browser.Public))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, http.StatusOK; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+			}
+
+			for _, want := range []string{
+				`id="startDate" value="` + tc.startDate + `"`,
+				`id="endDate" value="2021-03-31"`,
+			} {
+				if !strings.Contains(string(b), want) {
+					t.Errorf("rendered form does not contain %s", want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleLanguage(t *testing.T) {
+	testCases := map[string]struct {
+		options []Option
+		path    string
+		want    string
+	}{
+		"Default":       {nil, "/l/de", "de"},
+		"DefaultFrench": {nil, "/l/fr", "en"},
+		"Added":         {[]Option{WithLanguages([]string{"en", "de", "it", "fr"})}, "/l/fr", "fr"},
+		"Unknown":       {[]Option{WithLanguages([]string{"en", "de", "it", "fr"})}, "/l/xx", "en"},
+		"Removed":       {[]Option{WithLanguages([]string{"en", "fr"})}, "/l/de", "en"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := NewHandler(tc.options...)
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Referer", "http://example.com/en/impressum/")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, http.StatusSeeOther; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+
+			var got string
+			for _, c := range resp.Cookies() {
+				if c.Name == DefaultLanguageCookieName {
+					got = c.Value
+				}
+			}
+			if got != tc.want {
+				t.Errorf("got language cookie %q, want %q", got, tc.want)
+			}
+			if got, want := resp.Header.Get("Location"), "/"+tc.want+"/impressum"; got != want {
+				t.Errorf("got redirect to %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLanguageFromRequest(t *testing.T) {
+	h := NewHandler(WithLanguages([]string{"en", "de", "it", "fr"}))
+
+	testCases := map[string]struct {
+		cookie         string
+		acceptLanguage string
+		want           string
+	}{
+		"Neither":             {"", "", "en"},
+		"Cookie":              {"fr", "", "fr"},
+		"CookieDefault":       {"it", "", "it"},
+		"CookieUnknown":       {"xx", "", "en"},
+		"CookieOverHeader":    {"it", "de-DE,de;q=0.9", "it"},
+		"CookieUnknownHeader": {"xx", "de", "de"},
+		"Header":              {"", "de", "de"},
+		"HeaderRegion":        {"", "fr-CH", "fr"},
+		"HeaderQuality":       {"", "es;q=1.0,it;q=0.8,de;q=0.5", "it"},
+		"HeaderUnknown":       {"", "ja", "en"},
+		"HeaderInvalid":       {"", "!!", "en"},
+		"HeaderNotConfigured": {"", "es", "en"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: DefaultLanguageCookieName, Value: tc.cookie})
+			}
+			if tc.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tc.acceptLanguage)
+			}
+
+			if got := h.languageFromRequest(req); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLanguageCookieName(t *testing.T) {
+	h := NewHandler(WithLanguages([]string{"en", "de"}), WithLanguageCookieName("other_lang"))
+
+	req := httptest.NewRequest(http.MethodGet, "/l/de", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "other_lang" || cookies[0].Value != "de" {
+		t.Fatalf("expected a single cookie other_lang=de, got %v", cookies)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	if got, want := h.languageFromRequest(req), "de"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A cookie of another instance using the default name is ignored.
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultLanguageCookieName, Value: "de"})
+	if got, want := h.languageFromRequest(req), "en"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHandleStaticPageLanguages(t *testing.T) {
+	h := NewHandler(
+		WithLanguages([]string{"en", "de", "it", "fr"}),
+		WithStationService(&mock.StationService{
+			StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+				return browser.Stations{}, nil
+			},
+		}),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/fr/impressum/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultLanguageCookieName, Value: "fr"})
+	req = req.WithContext(withCTX(browser.Public))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := w.Result()
+
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll(resp.Body): %v", err)
+	}
+
+	for _, want := range []string{
+		`<html lang="fr">`,
+		`<a href="/l/en">English</a>`,
+		`href="/en/privacy/"`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("rendered page does not contain %s", want)
+		}
+	}
+	if strings.Contains(string(b), `<a href="/l/fr">`) {
+		t.Error("rendered page links to its own language")
+	}
+}
+
+func TestHandleStaticPage(t *testing.T) {
+	h := NewHandler(
+		WithStationService(&mock.StationService{
+			StationsFn: func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+				return browser.Stations{}, nil
+			},
+		}),
+	)
+
+	testCases := map[string]struct {
+		path       string
+		role       browser.Role
+		statusCode int
+		want       string
+	}{
+		"Known":        {"/en/privacy/", browser.Public, http.StatusOK, `<html lang="en">`},
+		"InfoPublic":   {"/en/info/", browser.Public, http.StatusOK, "Legend of the downloaded table"},
+		"InfoInternal": {"/en/info/", browser.FullAccess, http.StatusOK, "Glossary of the downloaded table"},
+		"Unknown":      {"/en/unknown/", browser.Public, http.StatusNotFound, "404 page not found"},
+		"Template":     {"/en/page.tmpl", browser.Public, http.StatusNotFound, "404 page not found"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req = req.WithContext(withCTX(tc.role))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("body does not contain %q", tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	stdcsv "encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/euracresearch/browser"
+)
+
+// importColumns are the columns expected in the header of a CSV file for bulk
+// importing users.
+var importColumns = []string{"name", "email", "provider", "role", "license"}
+
+// importResult is the outcome of importing a single row of a CSV file.
+type importResult struct {
+	Row    int    `json:"row"`
+	Email  string `json:"email,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleUserImport creates users from a CSV file with the columns name, email,
+// provider, role and license. The file is either uploaded as multipart form
+// field "users" or sent as request body. Each row is validated and created on
+// its own; users which already exist are skipped. The response reports the
+// result of each row.
+func (h *Handler) handleUserImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apiError(w, r, errors.New("Expected POST request"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			f, _, err := r.FormFile("users")
+			if err != nil {
+				apiError(w, r, err, http.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			body = f
+		}
+
+		cr := stdcsv.NewReader(body)
+		cr.FieldsPerRecord = len(importColumns)
+		cr.TrimLeadingSpace = true
+
+		header, err := cr.Read()
+		if err != nil {
+			apiError(w, r, fmt.Errorf("could not read header: %v", err), http.StatusBadRequest)
+			return
+		}
+		for i, c := range importColumns {
+			if strings.ToLower(strings.TrimSpace(header[i])) != c {
+				apiError(w, r, fmt.Errorf("invalid header, expected %q", strings.Join(importColumns, ",")), http.StatusBadRequest)
+				return
+			}
+		}
+
+		resp := struct {
+			Created int            `json:"created"`
+			Skipped int            `json:"skipped"`
+			Failed  int            `json:"failed"`
+			Rows    []importResult `json:"rows"`
+		}{
+			Rows: []importResult{},
+		}
+
+		seen := make(map[string]bool)
+		for row := 2; ; row++ {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+
+			res := importResult{Row: row}
+			if err != nil {
+				// Malformed lines are reported as failed, any other error
+				// means the input cannot be read any further.
+				var perr *stdcsv.ParseError
+				if !errors.As(err, &perr) {
+					apiError(w, r, err, http.StatusBadRequest)
+					return
+				}
+				res.Status, res.Error = "failed", err.Error()
+				resp.Failed++
+				resp.Rows = append(resp.Rows, res)
+				continue
+			}
+
+			u, err := parseUserRecord(rec)
+			res.Email = u.Email
+
+			// Duplicates inside the file are skipped the same way as users
+			// already stored.
+			key := u.Provider + ":" + u.Email
+			if err == nil {
+				if seen[key] {
+					err = browser.ErrUserAlreadyExists
+				} else {
+					err = h.users.Create(r.Context(), u)
+				}
+			}
+			if err == nil {
+				seen[key] = true
+			}
+
+			switch {
+			case err == nil:
+				res.Status = "created"
+				resp.Created++
+			case errors.Is(err, browser.ErrUserAlreadyExists):
+				res.Status = "skipped"
+				res.Error = err.Error()
+				resp.Skipped++
+			default:
+				res.Status = "failed"
+				res.Error = err.Error()
+				resp.Failed++
+			}
+			resp.Rows = append(resp.Rows, res)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			apiError(w, r, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// parseUserRecord parses and validates a single CSV record into a user. The
+// record must be in the order of importColumns. An empty license is treated
+// as not signed. The returned user is never nil, so that it can be reported
+// even if it is invalid.
+func parseUserRecord(rec []string) (*browser.User, error) {
+	for i := range rec {
+		rec[i] = strings.TrimSpace(rec[i])
+	}
+
+	u := &browser.User{
+		Name:     rec[0],
+		Email:    rec[1],
+		Provider: rec[2],
+		Role:     browser.Role(rec[3]),
+	}
+
+	if !u.Valid() || !strings.Contains(u.Email, "@") {
+		return u, browser.ErrUserNotValid
+	}
+
+	if !isValidRole(u.Role) {
+		return u, fmt.Errorf("unknown role %q", rec[3])
+	}
+
+	if rec[4] != "" {
+		lic, err := strconv.ParseBool(rec[4])
+		if err != nil {
+			return u, fmt.Errorf("invalid license %q", rec[4])
+		}
+		u.License = lic
+	}
+
+	return u, nil
+}
+
+// isValidRole reports whether r is one of browser.Roles.
+func isValidRole(r browser.Role) bool {
+	for _, v := range browser.Roles {
+		if r == v {
+			return true
+		}
+	}
+	return false
+}
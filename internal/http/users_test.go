@@ -0,0 +1,121 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleUserImport(t *testing.T) {
+	const input = `name,email,provider,role,license
+Jane Doe,jane@example.com,github,FullAccess,true
+John Doe,john@example.com,google,External,
+Existing User,existing@example.com,microsoft,Public,false
+Jane Doe,jane@example.com,github,FullAccess,true
+No Role,norole@example.com,github,Admin,false
+No Email,,github,Public,false
+`
+
+	store := map[string]*browser.User{
+		"microsoft:existing@example.com": {Name: "Existing User", Email: "existing@example.com", Provider: "microsoft"},
+	}
+	users := &mock.UserService{
+		CreateFn: func(ctx context.Context, u *browser.User) error {
+			key := u.Provider + ":" + u.Email
+			if _, ok := store[key]; ok {
+				return browser.ErrUserAlreadyExists
+			}
+			store[key] = u
+			return nil
+		},
+	}
+
+	h := NewHandler(WithUserService(users))
+
+	testCases := map[string]struct {
+		ctx        context.Context
+		method     string
+		statusCode int
+	}{
+		"Public":     {withCTX(browser.Public), http.MethodPost, http.StatusNotFound},
+		"External":   {withCTX(browser.External), http.MethodPost, http.StatusNotFound},
+		"GET":        {withCTX(browser.FullAccess), http.MethodGet, http.StatusMethodNotAllowed},
+		"FullAccess": {withCTX(browser.FullAccess), http.MethodPost, http.StatusOK},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/v1/users/import", strings.NewReader(input))
+			req.Header.Add("Content-Type", "text/csv")
+			req = req.WithContext(tc.ctx)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var got struct {
+				Created int
+				Skipped int
+				Failed  int
+				Rows    []importResult
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			if got.Created != 2 || got.Skipped != 2 || got.Failed != 2 {
+				t.Errorf("got created=%d skipped=%d failed=%d, want created=2 skipped=2 failed=2", got.Created, got.Skipped, got.Failed)
+			}
+
+			var status []string
+			for _, r := range got.Rows {
+				status = append(status, r.Status)
+			}
+			want := []string{"created", "created", "skipped", "skipped", "failed", "failed"}
+			if diff := cmp.Diff(want, status); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+
+			if u := store["google:john@example.com"]; u == nil || u.Role != browser.External || u.License {
+				t.Errorf("user john@example.com not created as expected: %+v", u)
+			}
+		})
+	}
+}
+
+func TestHandleUserImportHeader(t *testing.T) {
+	h := NewHandler(WithUserService(&mock.UserService{
+		CreateFn: func(ctx context.Context, u *browser.User) error {
+			t.Fatal("Create must not be called on an invalid header")
+			return nil
+		},
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/import", strings.NewReader("email,name,provider,role,license\n"))
+	req = req.WithContext(withCTX(browser.FullAccess))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got, want := w.Result().StatusCode, http.StatusBadRequest; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/ql"
+)
+
+// Coverage implements browser.Database. It returns the timestamps of the first
+// and last points and the number of points of each measurement and station
+// selected by the given filter. The time range of the filter is only applied
+// if it is set, therefore at least one station must be given. Legacy labels
+// are merged into the coverage of their canonical label.
+func (db *DB) Coverage(ctx context.Context, filter *browser.SeriesFilter) ([]browser.Coverage, error) {
+	if filter == nil || len(filter.Stations) == 0 {
+		return nil, browser.ErrDataNotFound
+	}
+
+	if db.cacheEmpty() {
+		return nil, browser.ErrCatalogNotPopulated
+	}
+
+	statements := db.coverageQuery(ctx, filter)
+	if len(statements) == 0 {
+		return nil, browser.ErrDataNotFound
+	}
+
+	type key struct {
+		station int64
+		label   string
+	}
+	var (
+		coverage []*browser.Coverage
+		byKey    = make(map[key]*browser.Coverage)
+		loc      = filter.Location()
+	)
+	for _, q := range splitStatements(statements) {
+		resp, err := db.exec(q)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range resp.Results {
+			for _, series := range result.Series {
+				if len(series.Values) == 0 || len(series.Columns) < 2 || len(series.Values[0]) < 2 {
+					continue
+				}
+
+				id, err := strconv.ParseInt(series.Tags["snipeit_location_ref"], 10, 64)
+				if err != nil {
+					log.Printf("cannot convert station id: %v. skipping.", err)
+					continue
+				}
+
+				k := key{id, db.canonical(series.Name)}
+				c, ok := byKey[k]
+				if !ok {
+					c = &browser.Coverage{
+						Label: k.label,
+						Station: &browser.Station{
+							ID:   id,
+							Name: series.Tags["station"],
+						},
+					}
+					byKey[k] = c
+					coverage = append(coverage, c)
+				}
+
+				value := series.Values[0]
+				switch series.Columns[1] {
+				case "count":
+					n, err := value[1].(json.Number).Int64()
+					if err != nil {
+						log.Printf("cannot convert count: %v. skipping.", err)
+						continue
+					}
+					c.Points += n
+
+				case "first", "last":
+					s, _ := value[0].(string)
+					t, err := time.Parse(time.RFC3339, s)
+					if err != nil {
+						log.Printf("cannot convert timestamp: %v. skipping.", err)
+						continue
+					}
+					t = t.In(loc)
+
+					if series.Columns[1] == "first" && (c.First.IsZero() || t.Before(c.First)) {
+						c.First = t
+					}
+					if series.Columns[1] == "last" && t.After(c.Last) {
+						c.Last = t
+					}
+				}
+			}
+		}
+	}
+
+	if len(coverage) == 0 {
+		return nil, browser.ErrDataNotFound
+	}
+
+	sort.Slice(coverage, func(i, j int) bool {
+		a, b := coverage[i], coverage[j]
+		if a.Station.Name != b.Station.Name {
+			return a.Station.Name < b.Station.Name
+		}
+		if a.Station.ID != b.Station.ID {
+			return a.Station.ID < b.Station.ID
+		}
+		return a.Label < b.Label
+	})
+
+	res := make([]browser.Coverage, len(coverage))
+	for i, c := range coverage {
+		res[i] = *c
+	}
+	return res, nil
+}
+
+// coverageQuery returns the statements for retrieving the coverage of the
+// given filter. Each measurement results in a statement counting its points
+// and statements selecting its first and last points, since InfluxQL returns
+// no timestamps for aggregations.
+func (db *DB) coverageQuery(ctx context.Context, filter *browser.SeriesFilter) []ql.Querier {
+	var statements []ql.Querier
+	for _, measure := range db.selectedMeasurements(ctx, filter) {
+		for _, fn := range []string{"count", "first", "last"} {
+			sb := ql.Select(fn + "(" + measure + ")")
+			sb.From(measure).RetentionPolicy(filter.RetentionPolicy)
+
+			where := []ql.Querier{
+				ql.Paren(ql.Eq(ql.Or(), "snipeit_location_ref", filter.Stations...)),
+				ql.And(),
+				ql.Paren(ql.Eq(ql.Or(), "landuse", filter.Landuse...)),
+			}
+			if !filter.Start.IsZero() && !filter.End.IsZero() {
+				start, end := startEndTime(filter.Start, filter.End, filter.Location())
+				where = append(where, ql.And(), ql.TimeRange(start, end))
+			}
+			sb.Where(where...)
+			sb.GroupBy("station,snipeit_location_ref").TZ(timeZone(filter.Location()))
+
+			statements = append(statements, sb)
+		}
+	}
+	return statements
+}
@@ -0,0 +1,213 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DenyListReloadInterval is the interval in which the deny list file is checked
+// for changes.
+var DenyListReloadInterval = 1 * time.Minute
+
+// denyList is a list of measurements hidden from all users. It is read from a
+// file containing one measurement name per line. Empty lines and lines
+// starting with '#' are ignored.
+type denyList struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	names   []string
+}
+
+// newDenyList returns a denyList read from the given file.
+func newDenyList(path string) (*denyList, error) {
+	d := &denyList{path: path}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// load reads the deny list file if it has been modified since the last load.
+func (d *denyList) load() error {
+	fi, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+
+	d.mu.RLock()
+	unchanged := fi.ModTime().Equal(d.modTime)
+	d.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	f, err := os.Open(d.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := parseDenyList(f)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.name
+	}
+
+	d.mu.Lock()
+	d.modTime = fi.ModTime()
+	d.names = names
+	d.mu.Unlock()
+
+	log.Printf("influx: deny list loaded with %d measurements", len(names))
+	return nil
+}
+
+// denyEntry is a measurement name of a deny list file and its line number.
+type denyEntry struct {
+	line int
+	name string
+}
+
+// parseDenyList reads the measurement names of a deny list file from r.
+func parseDenyList(r io.Reader) ([]denyEntry, error) {
+	var (
+		entries []denyEntry
+		n       int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, denyEntry{line: n, name: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// validDenyName matches the characters allowed in measurement labels.
+var validDenyName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ValidateDenyList reads a candidate deny list file from r as WithDenyList
+// would, without applying it. It returns the measurement names of the file and
+// the problems found, one per offending line: names which are not valid
+// measurement labels, duplicates and, once the cache is populated, names of
+// measurements unknown to the database, which are most likely typos. An error
+// is returned only if the file could not be read.
+func (db *DB) ValidateDenyList(r io.Reader) ([]string, []string, error) {
+	entries, err := parseDenyList(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	known := db.knownMeasurements()
+
+	var (
+		names    = []string{}
+		problems = []string{}
+		seen     = make(map[string]int)
+	)
+	for _, e := range entries {
+		names = append(names, e.name)
+
+		key := strings.ToLower(e.name)
+		switch first, dup := seen[key]; {
+		case !validDenyName.MatchString(e.name):
+			problems = append(problems, fmt.Sprintf("line %d: invalid measurement name %q", e.line, e.name))
+		case dup:
+			problems = append(problems, fmt.Sprintf("line %d: duplicate measurement %q, first listed on line %d", e.line, e.name, first))
+		case known != nil && !known[key]:
+			problems = append(problems, fmt.Sprintf("line %d: unknown measurement %q", e.line, e.name))
+		}
+		if _, ok := seen[key]; !ok {
+			seen[key] = e.line
+		}
+	}
+
+	return names, problems, nil
+}
+
+// knownMeasurements returns the lower case labels of all cached measurements
+// and their aliases. It returns nil if the cache is empty.
+func (db *DB) knownMeasurements() map[string]bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if len(db.groupMeasurementsCache) == 0 {
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for _, labels := range db.groupMeasurementsCache {
+		for _, l := range labels {
+			known[strings.ToLower(l)] = true
+		}
+	}
+	for legacy, canonical := range db.aliases {
+		known[strings.ToLower(legacy)] = true
+		known[strings.ToLower(canonical)] = true
+	}
+	return known
+}
+
+// watch reloads the deny list every DenyListReloadInterval.
+func (d *denyList) watch() {
+	for {
+		time.Sleep(DenyListReloadInterval)
+
+		if err := d.load(); err != nil {
+			log.Printf("influx: error reloading deny list: %v", err)
+		}
+	}
+}
+
+// list returns a copy of the currently loaded measurement names. A nil
+// denyList returns nil.
+func (d *denyList) list() []string {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]string(nil), d.names...)
+}
+
+// denied reports whether the given measurement is denied. A nil denyList
+// denies nothing.
+func (d *denyList) denied(label string) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, n := range d.names {
+		if strings.EqualFold(n, label) {
+			return true
+		}
+	}
+	return false
+}
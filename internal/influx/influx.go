@@ -14,6 +14,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"regexp"
@@ -24,8 +25,10 @@ import (
 	"time"
 
 	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/metrics"
 	"github.com/euracresearch/browser/internal/ql"
 
+	"github.com/influxdata/influxdb1-client/models"
 	client "github.com/influxdata/influxdb1-client/v2"
 )
 
@@ -36,107 +39,224 @@ var (
 	// CacheRefreshInterval is the interval in which the cache will be refreshed.
 	CacheRefreshInterval = 8 * time.Hour
 
+	// CacheRetryInterval is the interval in which the cache will be refreshed
+	// as long as it is empty.
+	CacheRetryInterval = 1 * time.Minute
+
+	// CacheLoadTimeout is the maximum duration NewDB waits for the initial
+	// load of the cache. If loading takes longer it continues in the
+	// background and the DB is not ready until it completes.
+	CacheLoadTimeout = 1 * time.Minute
+
+	// MaxStatementsPerQuery is the maximum number of statements sent to
+	// InfluxDB in a single query. Larger selections will be split into
+	// multiple queries. A value <= 0 disables splitting.
+	MaxStatementsPerQuery = 100
+
+	// PingTimeout is the maximum duration to wait for a response when pinging
+	// InfluxDB.
+	PingTimeout = 5 * time.Second
+
 	// groupRegexpMap maps a Group to a regular expression for matching
-	// measurements.
-	groupRegexpMap = map[browser.Group]*regexp.Regexp{
-		browser.AirTemperature:                               regexp.MustCompile(`air_t`),
-		browser.RelativeHumidity:                             regexp.MustCompile(`air_rh`),
-		browser.SoilTemperature:                              regexp.MustCompile(`^st_.*|_st_.*$`),
-		browser.SoilTemperatureDepth00:                       regexp.MustCompile(`st_.*00_.*$`),
-		browser.SoilTemperatureDepth02:                       regexp.MustCompile(`st_.*02_.*$`),
-		browser.SoilTemperatureDepth05:                       regexp.MustCompile(`st_.*05_.*$`),
-		browser.SoilTemperatureDepth10:                       regexp.MustCompile(`st_.*10_.*$`),
-		browser.SoilTemperatureDepth20:                       regexp.MustCompile(`st_.*20_.*$`),
-		browser.SoilTemperatureDepth40:                       regexp.MustCompile(`st_.*40_.*$`),
-		browser.SoilTemperatureDepth50:                       regexp.MustCompile(`st_.*50_.*$`),
-		browser.SoilWaterContent:                             regexp.MustCompile(`^swc_[^dp_|ec_|st_]`),
-		browser.SoilWaterContentDepth02:                      regexp.MustCompile(`^swc_[^dp_|ec_|st_].*_02_.*$`),
-		browser.SoilWaterContentDepth05:                      regexp.MustCompile(`^swc_[^dp_|ec_|st_].*_05_.*$`),
-		browser.SoilWaterContentDepth20:                      regexp.MustCompile(`^swc_[^dp_|ec_|st_].*_20_.*$`),
-		browser.SoilWaterContentDepth40:                      regexp.MustCompile(`^swc_[^dp_|ec_|st_].*_40_.*$`),
-		browser.SoilWaterContentDepth50:                      regexp.MustCompile(`^swc_[^dp_|ec_|st_].*_50_.*$`),
-		browser.SoilElectricalConductivity:                   regexp.MustCompile(`^swc_ec_.*$`),
-		browser.SoilElectricalConductivityDepth02:            regexp.MustCompile(`^swc_ec_.*02_.*$`),
-		browser.SoilElectricalConductivityDepth05:            regexp.MustCompile(`^swc_ec_.*05_.*$`),
-		browser.SoilElectricalConductivityDepth20:            regexp.MustCompile(`^swc_ec_.*20_.*$`),
-		browser.SoilElectricalConductivityDepth40:            regexp.MustCompile(`^swc_ec_.*40_.*$`),
-		browser.SoilElectricalConductivityDepth50:            regexp.MustCompile(`^swc_ec_.*50_.*$`),
-		browser.SoilDielectricPermittivity:                   regexp.MustCompile(`^swc_dp_.*$`),
-		browser.SoilDielectricPermittivityDepth02:            regexp.MustCompile(`^swc_dp_.*02_.*$`),
-		browser.SoilDielectricPermittivityDepth05:            regexp.MustCompile(`^swc_dp_.*05_.*$`),
-		browser.SoilDielectricPermittivityDepth20:            regexp.MustCompile(`^swc_dp_.*20_.*$`),
-		browser.SoilDielectricPermittivityDepth40:            regexp.MustCompile(`^swc_dp_.*40_.*$`),
-		browser.SoilDielectricPermittivityDepth50:            regexp.MustCompile(`^swc_dp_.*50_.*$`),
-		browser.SoilWaterPotential:                           regexp.MustCompile(`^swp.[^_st_].*$`),
-		browser.SoilWaterPotentialDepth05:                    regexp.MustCompile(`^swp.[^_st_].*_05_.*$`),
-		browser.SoilWaterPotentialDepth20:                    regexp.MustCompile(`^swp.[^_st_].*_20_.*$`),
-		browser.SoilWaterPotentialDepth40:                    regexp.MustCompile(`^swp.[^_st_].*_40_.*$`),
-		browser.SoilWaterPotentialDepth50:                    regexp.MustCompile(`^swp.[^_st_].*_50_.*$`),
-		browser.SoilHeatFlux:                                 regexp.MustCompile(`^shf.*$`),
-		browser.SoilSurfaceTemperature:                       regexp.MustCompile(`.*surf_t.*$`), // TODO: "surf_t_" and not("mv")
-		browser.Wind:                                         regexp.MustCompile(`^wind.*$`),
-		browser.WindSpeed:                                    regexp.MustCompile(`^wind_speed$|wind_speed.*_(avg|std)$`),
-		browser.WindSpeedMax:                                 regexp.MustCompile(`^wind_speed.*_max$`),
-		browser.WindDirection:                                regexp.MustCompile(`^wind_dir.*`),
-		browser.Precipitation:                                regexp.MustCompile(`^precip.*(_tot|_int).*$`),
-		browser.PrecipitationTotal:                           regexp.MustCompile(`^precip.*(_tot).*$`),
-		browser.PrecipitationIntensity:                       regexp.MustCompile(`^precip.*(_int).*$`),
-		browser.SnowHeight:                                   regexp.MustCompile(`snow_height`),
-		browser.LeafWetnessDuration:                          regexp.MustCompile(`^lwm`),
-		browser.SunshineDuration:                             regexp.MustCompile(`^sun`),
-		browser.PhotosyntheticallyActiveRadiation:            regexp.MustCompile(`^par_.*$`),
-		browser.PhotosyntheticallyActiveRadiationTotal:       regexp.MustCompile(`^par_[^dif|soil].*$|par_std`),
-		browser.PhotosyntheticallyActiveRadiationDiffuse:     regexp.MustCompile(`^par_.*dif_.*$`),
-		browser.PhotosyntheticallyActiveRadiationAtSoilLevel: regexp.MustCompile(`^par_.*soil_.*$`),
-		browser.NDVIRadiations:                               regexp.MustCompile(`^ndvi_.*`),
-		browser.PRIRadiations:                                regexp.MustCompile(`^pri_.*$`),
-		browser.ShortWaveRadiation:                           regexp.MustCompile(`^sr_|.*_sw_.*$`),
-		browser.ShortWaveRadiationIncoming:                   regexp.MustCompile(`^.*_dn.*_sw_.*$`),
-		browser.ShortWaveRadiationOutgoing:                   regexp.MustCompile(`^.*_up.*_sw_.*$`),
-		browser.LongWaveRadiation:                            regexp.MustCompile(`.*_lw_.*$`),
-		browser.LongWaveRadiationIncoming:                    regexp.MustCompile(`.*_dn.*_lw_.*$`),
-		browser.LongWaveRadiationOutgoing:                    regexp.MustCompile(`.*_up.*_lw_.*$`),
-	}
+	// measurements. Public users only receive wind_speed_avg of WindSpeed, see
+	// publicMeasurements.
+	groupRegexpMap = compileGroupRegexps()
 )
 
 // DB holds information for communicating with InfluxDB.
 type DB struct {
 	client   client.Client
 	database string
-
-	mu                     sync.RWMutex // guards the fields below
-	stationGroupsCache     map[int64][]browser.Group
-	groupMeasurementsCache map[browser.Group][]string // will contain only measurements which are not maintenance
+	metrics  *dbMetrics
+	stats    *metrics.Stats
+
+	// aliases maps legacy measurement labels to their canonical label.
+	aliases map[string]string
+
+	// intervals maps station IDs to their collection interval if it differs
+	// from browser.DefaultCollectionInterval.
+	intervals map[int64]time.Duration
+
+	// publicGroups are the groups the public role is allowed to access.
+	publicGroups []browser.Group
+
+	// denyPath is the path of the deny list file and deny the list read from
+	// it.
+	denyPath string
+	deny     *denyList
+
+	mu                       sync.RWMutex // guards the fields below
+	stationGroupsCache       map[int64][]browser.Group
+	stationMeasurementsCache map[int64][]string
+	groupMeasurementsCache   map[browser.Group][]string // will contain only measurements which are not maintenance
+	aggregationCache         map[string]string          // maps a measurement to its aggregation
+	unitCache                map[string]string          // maps a measurement to its unit
+	refreshed                time.Time                  // time the caches were last loaded
+	loaded                   bool                       // whether the caches have been loaded at least once
 }
 
 // NewDB returns a new instance of DB and initializes the internal caches and
 // starts a new go routine for refreshing the cache on the defined
 // CacheRefreshInterval.
-func NewDB(client client.Client, database string) (*DB, error) {
+func NewDB(client client.Client, database string, options ...Option) (*DB, error) {
 	db := &DB{
-		client:             client,
-		database:           database,
-		stationGroupsCache: make(map[int64][]browser.Group),
+		client:                   client,
+		database:                 database,
+		metrics:                  newDBMetrics(metrics.DefaultRegistry),
+		stats:                    metrics.DefaultStats,
+		stationGroupsCache:       make(map[int64][]browser.Group),
+		stationMeasurementsCache: make(map[int64][]string),
+		aggregationCache:         make(map[string]string),
+		unitCache:                make(map[string]string),
 	}
 
-	if err := db.loadCache(); err != nil {
-		return nil, err
+	for _, option := range options {
+		option(db)
+	}
+
+	if len(db.publicGroups) == 0 {
+		db.publicGroups = browser.DefaultPublicGroups
+	}
+
+	if db.denyPath != "" {
+		d, err := newDenyList(db.denyPath)
+		if err != nil {
+			return nil, err
+		}
+		db.deny = d
+	}
+
+	// The initial load is bounded by CacheLoadTimeout, so that a slow
+	// InfluxDB does not block the startup. Errors within the timeout are
+	// returned, later ones are logged and the load is retried by
+	// refreshCache.
+	loaded := make(chan error, 1)
+	go func() { loaded <- db.loadCache() }()
+	select {
+	case err := <-loaded:
+		if err != nil {
+			return nil, err
+		}
+	case <-time.After(CacheLoadTimeout):
+		log.Printf("influx: caches not loaded within %v, loading in the background", CacheLoadTimeout)
+		go func() {
+			if err := <-loaded; err != nil {
+				log.Println(err)
+			}
+		}()
 	}
 	go db.refreshCache()
+	// The deny list is only watched once the DB is returned, so that no
+	// goroutine is left behind if creating it fails.
+	if db.deny != nil {
+		go db.deny.watch()
+	}
 
 	return db, nil
 }
 
+// Option controls some aspects of the DB.
+type Option func(db *DB)
+
+// WithRegistry returns an option function for setting the registry the DB
+// records its metrics to. By default metrics.DefaultRegistry is used.
+func WithRegistry(r *metrics.Registry) Option {
+	return func(db *DB) {
+		db.metrics = newDBMetrics(r)
+	}
+}
+
+// WithStats returns an option function for setting the summary the DB counts
+// its queries in. By default metrics.DefaultStats is used.
+func WithStats(s *metrics.Stats) Option {
+	return func(db *DB) {
+		db.stats = s
+	}
+}
+
+// WithAliases returns an option function for renaming legacy measurement
+// labels. Each key is a label used by older stations which is exported under
+// the label it maps to, so that historical data merges into a single column.
+func WithAliases(aliases map[string]string) Option {
+	return func(db *DB) {
+		db.aliases = aliases
+	}
+}
+
+// WithCollectionIntervals returns an option function for setting the
+// collection interval of stations not logging every
+// browser.DefaultCollectionInterval. The keys are station IDs. The interval is
+// used when filling missing points of a series.
+func WithCollectionIntervals(intervals map[int64]time.Duration) Option {
+	return func(db *DB) {
+		db.intervals = intervals
+	}
+}
+
+// WithPublicGroups returns an option function for setting the groups the
+// public role is allowed to access. By default browser.DefaultPublicGroups are
+// used.
+func WithPublicGroups(groups []browser.Group) Option {
+	return func(db *DB) {
+		db.publicGroups = groups
+	}
+}
+
+// WithDenyList returns an option function for setting a file listing
+// measurements, one per line, which are hidden from all users regardless of
+// their role. The file is reloaded every DenyListReloadInterval if it changed.
+func WithDenyList(path string) Option {
+	return func(db *DB) {
+		db.denyPath = path
+	}
+}
+
+// DeniedMeasurements returns the measurements of the currently loaded deny
+// list, see WithDenyList.
+func (db *DB) DeniedMeasurements() []string {
+	return db.deny.list()
+}
+
+// ParseAliases parses a comma separated list of legacy=canonical label pairs,
+// e.g. "t_air=air_t_avg,tair=air_t_avg", as used by WithAliases.
+func ParseAliases(s string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return aliases, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("influx: invalid alias %q", pair)
+		}
+		aliases[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return aliases, nil
+}
+
+// canonical returns the canonical label of the given measurement label.
+func (db *DB) canonical(label string) string {
+	if c, ok := db.aliases[label]; ok {
+		return c
+	}
+	return label
+}
+
 // loadCache initializes a in memory cache due to the slowness of metadata
 // queries like "SHOW TAG VALUES" on large datasets inside InfluxDB.
 func (db *DB) loadCache() error {
-	resp, err := db.exec(ql.ShowTagValues().From().WithKeyIn("snipeit_location_ref"))
+	resp, err := db.exec(ql.ShowTagValues().From().WithKeyIn("aggr", "snipeit_location_ref", "unit"))
 	if err != nil {
 		return err
 	}
 
 	gCache := make(map[int64][]browser.Group)
+	sCache := make(map[int64][]string)
 	mCache := make(map[browser.Group][]string)
+	aCache := make(map[string]string)
+	uCache := make(map[string]string)
 	for _, result := range resp.Results {
 		for _, series := range result.Series {
 			// add series name to list of measurements if it doesn't belong to
@@ -145,17 +265,31 @@ func (db *DB) loadCache() error {
 				continue
 			}
 
-			// Match series.Name parent groups
-			g := matchGroupByType(series.Name, browser.ParentGroup)
+			// Match series.Name parent groups. Legacy labels are matched by
+			// their canonical label.
+			g := matchGroupByType(db.canonical(series.Name), browser.ParentGroup)
 
 			// Match series.Name to sub groups too.
-			sg := matchGroupByType(series.Name, browser.SubGroup)
+			sg := matchGroupByType(db.canonical(series.Name), browser.SubGroup)
 
 			for _, value := range series.Values {
-				id, err := strconv.ParseInt(value[1].(string), 10, 64)
-				if err == nil {
-					gCache[id] = browser.AppendGroupIfMissing(gCache[id], g)
-					gCache[id] = browser.AppendGroupIfMissing(gCache[id], sg)
+				key, _ := value[0].(string)
+				v, _ := value[1].(string)
+
+				switch key {
+				case "aggr":
+					aCache[series.Name] = v
+
+				case "unit":
+					uCache[series.Name] = v
+
+				case "snipeit_location_ref":
+					id, err := strconv.ParseInt(v, 10, 64)
+					if err == nil {
+						gCache[id] = browser.AppendGroupIfMissing(gCache[id], g)
+						gCache[id] = browser.AppendGroupIfMissing(gCache[id], sg)
+						sCache[id] = browser.AppendStringIfMissing(sCache[id], series.Name)
+					}
 				}
 			}
 
@@ -166,13 +300,57 @@ func (db *DB) loadCache() error {
 
 	db.mu.Lock()
 	db.stationGroupsCache = gCache
+	db.stationMeasurementsCache = sCache
 	db.groupMeasurementsCache = mCache
+	db.aggregationCache = aCache
+	db.unitCache = uCache
+	db.refreshed = time.Now()
+	db.loaded = true
 	db.mu.Unlock()
 
+	db.metrics.cacheRefreshes.Inc()
+	db.metrics.cachedStations.Set(float64(len(gCache)))
+	db.metrics.cachedGroups.Set(float64(len(mCache)))
+
+	if len(mCache) == 0 {
+		log.Println("influx: caches initialized but empty")
+		return nil
+	}
+
 	log.Println("influx: caches initialized")
 	return nil
 }
 
+// Ready reports whether the cache has been loaded and the DB is ready to serve
+// series. A DB without any data is ready once its empty cache is loaded.
+func (db *DB) Ready() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.loaded
+}
+
+// cacheEmpty reports whether the cache holds no measurements at all, which is
+// the case if no data has been written yet to InfluxDB.
+func (db *DB) cacheEmpty() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return len(db.groupMeasurementsCache) == 0
+}
+
+// compileGroupRegexps compiles the measurement regular expressions of all
+// groups.
+func compileGroupRegexps() map[browser.Group]*regexp.Regexp {
+	m := make(map[browser.Group]*regexp.Regexp)
+	for g := browser.AirTemperature; g < browser.NoGroup; g++ {
+		if re := g.MeasurementRegex(); re != "" {
+			m[g] = regexp.MustCompile(re)
+		}
+	}
+	return m
+}
+
 // matchGroupByType returns a group for the given label. A return of NoGroup indicates
 // no match.
 func matchGroupByType(label string, t browser.GroupType) browser.Group {
@@ -190,17 +368,56 @@ func matchGroupByType(label string, t browser.GroupType) browser.Group {
 	return browser.NoGroup
 }
 
+// refreshCache reloads the cache every CacheRefreshInterval. As long as the
+// cache is empty or not loaded it will retry sooner, using CacheRetryInterval.
 func (db *DB) refreshCache() {
-	ticker := time.NewTicker(CacheRefreshInterval)
+	for {
+		interval := CacheRefreshInterval
+		if !db.Ready() || db.cacheEmpty() {
+			interval = CacheRetryInterval
+		}
+		time.Sleep(interval)
 
-	for range ticker.C {
 		if err := db.loadCache(); err != nil {
 			log.Println(err)
+			continue
 		}
 		log.Println("influx: caches updated")
 	}
 }
 
+// RefreshCache reloads the cache immediately instead of waiting for the next
+// CacheRefreshInterval, e.g. after a station has been added to InfluxDB, and
+// returns the status of the reloaded cache.
+func (db *DB) RefreshCache(ctx context.Context) (browser.CacheStatus, error) {
+	if err := db.loadCache(); err != nil {
+		return browser.CacheStatus{}, err
+	}
+	log.Println("influx: caches updated on demand")
+
+	return db.CacheStatus(), nil
+}
+
+// CacheStatus returns the status of the cache.
+func (db *DB) CacheStatus() browser.CacheStatus {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	measurements := make(map[string]bool)
+	for _, labels := range db.stationMeasurementsCache {
+		for _, l := range labels {
+			measurements[l] = true
+		}
+	}
+
+	return browser.CacheStatus{
+		Ready:        len(db.groupMeasurementsCache) > 0,
+		Stations:     len(db.stationMeasurementsCache),
+		Measurements: len(measurements),
+		Refreshed:    db.refreshed,
+	}
+}
+
 func (db *DB) GroupsByStation(ctx context.Context, id int64) ([]browser.Group, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
@@ -208,12 +425,122 @@ func (db *DB) GroupsByStation(ctx context.Context, id int64) ([]browser.Group, e
 	user := browser.UserFromContext(ctx)
 	groups, ok := db.stationGroupsCache[id]
 	if ok {
-		return browser.FilterGroupsByRole(groups, user.Role), nil
+		return browser.FilterGroupsByRole(groups, user.Role, db.publicGroups), nil
 	}
 
 	return []browser.Group{}, browser.ErrGroupsNotFound
 }
 
+func (db *DB) AggregationsByStation(ctx context.Context, id int64) (map[browser.Group][]string, error) {
+	values, err := db.valuesByStation(ctx, id, &db.aggregationCache)
+	if err != nil {
+		return nil, err
+	}
+
+	user := browser.UserFromContext(ctx)
+	aggregations := make(map[browser.Group][]string)
+	for _, g := range browser.GroupsByRole(user.Role, db.publicGroups) {
+		if v, ok := values[g]; ok {
+			aggregations[g] = v
+		}
+	}
+
+	return aggregations, nil
+}
+
+// UnitsByStation returns for each group and sub group of the given station the
+// sorted units of its measurements, omitting measurements the user has no
+// access to.
+func (db *DB) UnitsByStation(ctx context.Context, id int64) (map[browser.Group][]string, error) {
+	return db.valuesByStation(ctx, id, &db.unitCache)
+}
+
+// valuesByStation returns for each group and sub group of the measurements
+// stored for the given station the sorted values of the given cache, which maps
+// a measurement to a tag value. The cache is read while holding the lock.
+// Measurements the user has no access to are omitted.
+func (db *DB) valuesByStation(ctx context.Context, id int64, cache *map[string]string) (map[browser.Group][]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	measurements, ok := db.stationMeasurementsCache[id]
+	if !ok {
+		return nil, browser.ErrGroupsNotFound
+	}
+
+	user := browser.UserFromContext(ctx)
+	values := make(map[browser.Group][]string)
+	for _, m := range measurements {
+		if user.Role == browser.Public && !db.isPublic(m) {
+			continue
+		}
+
+		v, ok := (*cache)[m]
+		if !ok {
+			continue
+		}
+
+		for _, g := range []browser.Group{
+			matchGroupByType(m, browser.ParentGroup),
+			matchGroupByType(m, browser.SubGroup),
+		} {
+			if g == browser.NoGroup {
+				continue
+			}
+			values[g] = browser.AppendStringIfMissing(values[g], v)
+		}
+	}
+
+	for _, v := range values {
+		sort.Strings(v)
+	}
+
+	return values, nil
+}
+
+// Ping checks if InfluxDB is reachable. It will wait at most PingTimeout or
+// until the deadline of the given context.
+func (db *DB) Ping(ctx context.Context) error {
+	timeout := PingTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	if _, _, err := db.client.Ping(timeout); err != nil {
+		return fmt.Errorf("db.ping: %v", err)
+	}
+	return nil
+}
+
+// Cardinality returns the number of series stored in the database. It sums
+// the values of all returned rows, since depending on the InfluxDB version
+// the cardinality is returned per measurement or as a single estimation.
+func (db *DB) Cardinality(ctx context.Context) (int64, error) {
+	resp, err := db.exec(ql.ShowSeriesCardinality())
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, result := range resp.Results {
+		for _, series := range result.Series {
+			for _, value := range series.Values {
+				if len(value) == 0 {
+					continue
+				}
+
+				c, err := value[0].(json.Number).Int64()
+				if err != nil {
+					return 0, fmt.Errorf("db.cardinality: %v", err)
+				}
+				n += c
+			}
+		}
+	}
+
+	return n, nil
+}
+
 func (db *DB) Maintenance(ctx context.Context) ([]string, error) {
 	user := browser.UserFromContext(ctx)
 	if user.Role != browser.FullAccess && !user.License {
@@ -223,124 +550,492 @@ func (db *DB) Maintenance(ctx context.Context) ([]string, error) {
 }
 
 func (db *DB) Series(ctx context.Context, filter *browser.SeriesFilter) (browser.TimeSeries, error) {
+	defer observeSince(db.metrics.seriesDuration, time.Now())
+
+	it, err := db.seriesStream(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ts      browser.TimeSeries
+		renamed = make(map[*browser.Measurement]bool)
+	)
+	for {
+		m, name, err := it.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if m.Label != name {
+			renamed[m] = true
+		}
+
+		ts = append(ts, m)
+	}
+
+	if len(renamed) > 0 {
+		ts = mergeRenamed(ts, renamed, filter.Descending)
+	}
+
+	return ts, nil
+}
+
+// SeriesStream returns an iterator over the measurements of Series. The
+// queries are executed one after another while iterating and each series of a
+// response is decoded only when requested. If aliases are configured all
+// measurements must be known for merging renamed ones, so the result of Series
+// is iterated instead.
+func (db *DB) SeriesStream(ctx context.Context, filter *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+	if len(db.aliases) > 0 {
+		ts, err := db.Series(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		return browser.NewMeasurementIterator(ts), nil
+	}
+
+	return db.seriesStream(ctx, filter)
+}
+
+func (db *DB) seriesStream(ctx context.Context, filter *browser.SeriesFilter) (*seriesIterator, error) {
 	if filter == nil {
 		return nil, browser.ErrDataNotFound
 	}
 
-	resp, err := db.exec(db.seriesQuery(ctx, filter))
-	if err != nil {
-		return nil, err
+	if db.cacheEmpty() {
+		return nil, browser.ErrCatalogNotPopulated
 	}
 
-	var ts browser.TimeSeries
-	for _, result := range resp.Results {
-		for _, series := range result.Series {
-			nTime := filter.Start
-
-			m := &browser.Measurement{
-				Label:       series.Name,
-				Aggregation: series.Tags["aggr"],
-				Unit:        series.Tags["unit"],
-				Station: &browser.Station{
-					Name:    series.Tags["station"],
-					Landuse: series.Tags["landuse"],
-				},
+	// Each query is executed on its own, since InfluxDB limits the number of
+	// statements in a single request.
+	queries := db.seriesQuery(ctx, filter)
+	if len(queries) == 0 {
+		return nil, browser.ErrDataNotFound
+	}
+
+	return &seriesIterator{
+		db:      db,
+		filter:  filter,
+		queries: queries,
+	}, nil
+}
+
+// seriesIterator implements browser.MeasurementIterator. It executes the next
+// query only after all series of the previous response have been consumed.
+type seriesIterator struct {
+	db      *DB
+	filter  *browser.SeriesFilter
+	queries []ql.Querier
+	results []client.Result
+	series  []models.Row
+}
+
+func (it *seriesIterator) Next() (*browser.Measurement, error) {
+	m, _, err := it.next()
+	return m, err
+}
+
+// next returns the next measurement together with the name of the series it
+// was decoded from.
+func (it *seriesIterator) next() (*browser.Measurement, string, error) {
+	for len(it.series) == 0 {
+		if len(it.results) > 0 {
+			it.series = it.results[0].Series
+			it.results = it.results[1:]
+			continue
+		}
+
+		if len(it.queries) == 0 {
+			return nil, "", io.EOF
+		}
+
+		resp, err := it.db.exec(it.queries[0])
+		if err != nil {
+			return nil, "", err
+		}
+		it.queries = it.queries[1:]
+		it.results = resp.Results
+	}
+
+	series := it.series[0]
+	it.series = it.series[1:]
+
+	from := it.filter.Start
+	if it.filter.Descending {
+		loc := it.filter.Location()
+		_, end := startEndTime(it.filter.Start, it.filter.End, loc)
+		from = end.Add(time.Second).In(loc)
+	}
+	m := it.db.measurement(series, from, it.filter.Descending)
+	m.Points = selectPoints(m.Points, it.filter.TimeOfDay, it.filter.DayOfWeek)
+	if err := it.filter.ConvertUnits(m); err != nil {
+		return nil, "", err
+	}
+
+	return m, series.Name, nil
+}
+
+// selectPoints returns the points measured at the given time of day and day of
+// week. InfluxQL cannot express these conditions, so they are applied after
+// retrieving and gap filling the full time range.
+func selectPoints(points []*browser.Point, tod browser.TimeOfDay, dow browser.DayOfWeek) []*browser.Point {
+	if tod == browser.AnyTime && dow == browser.AnyDay {
+		return points
+	}
+
+	selected := points[:0]
+	for _, p := range points {
+		if tod.Includes(p.Timestamp) && dow.Includes(p.Timestamp) {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// measurement decodes the given series into a measurement. Missing points
+// after the given start time are filled with NaN values according to the
+// collection interval of the station. If descending is true the values of the
+// series are expected newest first and missing points before the given time,
+// which is then the exclusive end, are filled instead.
+func (db *DB) measurement(series models.Row, from time.Time, descending bool) *browser.Measurement {
+
+	m := &browser.Measurement{
+		Label:       db.canonical(series.Name),
+		Aggregation: series.Tags["aggr"],
+		Unit:        series.Tags["unit"],
+		Station: &browser.Station{
+			Name:    series.Tags["station"],
+			Landuse: series.Tags["landuse"],
+		},
+	}
+	if id, err := strconv.ParseInt(series.Tags["snipeit_location_ref"], 10, 64); err == nil {
+		m.Station.ID = id
+		m.Station.CollectionInterval = db.intervals[id]
+	}
+	interval := m.Station.Interval()
+
+	nTime, step := from, interval
+	if descending {
+		step = -interval
+		nTime = from.Add(step)
+	}
+	missing := func(t time.Time) bool {
+		if descending {
+			return nTime.After(t)
+		}
+		return nTime.Before(t)
+	}
+
+	for _, value := range series.Values {
+		t, err := time.ParseInLocation(time.RFC3339, value[0].(string), time.UTC)
+		if err != nil {
+			log.Printf("cannot convert timestamp: %v. skipping.", err)
+			continue
+		}
+
+		// Fill missing timestamps with NaN values, to return a time
+		// series with a continuous time range. The interval of raw data
+		// in LTER is 15 minutes unless configured otherwise for the
+		// station. Timestamps which are not aligned to the interval are
+		// kept as they are. See:
+		// https://gitlab.inf.unibz.it/lter/browser/issues/10
+		for missing(t) {
+			m.Points = append(m.Points, &browser.Point{
+				Timestamp: nTime,
+				Value:     math.NaN(),
+			})
+			nTime = nTime.Add(step)
+		}
+		nTime = t.Add(step)
+
+		f, err := value[1].(json.Number).Float64()
+		if err != nil {
+			log.Printf("cannot convert value to float: %v. skipping.", err)
+			continue
+		}
+
+		// Add additional metadata only on the first run.
+		m.Station.Elevation, err = value[2].(json.Number).Int64()
+		if err != nil {
+			m.Station.Elevation = -1
+		}
+
+		m.Station.Latitude, err = value[3].(json.Number).Float64()
+		if err != nil {
+			m.Station.Latitude = -1.0
+		}
+
+		m.Station.Longitude, err = value[4].(json.Number).Float64()
+		if err != nil {
+			m.Station.Longitude = -1.0
+		}
+
+		if value[5] == nil {
+			m.Depth = 0
+		} else {
+			m.Depth, err = value[5].(json.Number).Int64()
+			if err != nil {
+				m.Depth = -1
 			}
+		}
+		p := &browser.Point{
+			Timestamp: t,
+			Value:     f,
+		}
+		m.Points = append(m.Points, p)
+	}
 
-			for _, value := range series.Values {
-				t, err := time.ParseInLocation(time.RFC3339, value[0].(string), time.UTC)
-				if err != nil {
-					log.Printf("cannot convert timestamp: %v. skipping.", err)
-					continue
-				}
+	return m
+}
 
-				// Fill missing timestamps with NaN values, to return a time
-				// series with a continuous time range. The interval of raw data
-				// in LTER is 15 minutes. See:
-				// https://gitlab.inf.unibz.it/lter/browser/issues/10
-				for !t.Equal(nTime) {
-					m.Points = append(m.Points, &browser.Point{
-						Timestamp: nTime,
-						Value:     math.NaN(),
-					})
-					nTime = nTime.Add(browser.DefaultCollectionInterval)
-				}
-				nTime = t.Add(browser.DefaultCollectionInterval)
+// mergeRenamed merges measurements of the same station which share the same
+// label after renaming legacy labels into a single measurement. Measurements
+// which have not been renamed are preferred for metadata and points. The
+// points of merged measurements are sorted newest first if descending is true.
+func mergeRenamed(ts browser.TimeSeries, renamed map[*browser.Measurement]bool, descending bool) browser.TimeSeries {
+	type key struct {
+		station, label string
+	}
 
-				f, err := value[1].(json.Number).Float64()
-				if err != nil {
-					log.Printf("cannot convert value to float: %v. skipping.", err)
-					continue
-				}
+	var (
+		keys   []key
+		groups = make(map[key][]*browser.Measurement)
+	)
+	for _, m := range ts {
+		k := key{m.Station.Name, m.Label}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
 
-				// Add additional metadata only on the first run.
-				m.Station.Elevation, err = value[2].(json.Number).Int64()
-				if err != nil {
-					m.Station.Elevation = -1
+		// Keep canonical measurements in front.
+		if renamed[m] {
+			groups[k] = append(groups[k], m)
+		} else {
+			groups[k] = append([]*browser.Measurement{m}, groups[k]...)
+		}
+	}
+
+	var merged browser.TimeSeries
+	for _, k := range keys {
+		ms := groups[k]
+		if len(ms) == 1 {
+			merged = append(merged, ms[0])
+			continue
+		}
+
+		m := &browser.Measurement{
+			Label:       ms[0].Label,
+			Aggregation: ms[0].Aggregation,
+			Unit:        ms[0].Unit,
+			Depth:       ms[0].Depth,
+			Station:     ms[0].Station,
+		}
+
+		// Prefer the first non NaN value on duplicate timestamps.
+		points := make(map[int64]*browser.Point)
+		for _, o := range ms {
+			for _, p := range o.Points {
+				n := p.Timestamp.UnixNano()
+				if e, ok := points[n]; !ok || (math.IsNaN(e.Value) && !math.IsNaN(p.Value)) {
+					points[n] = p
 				}
+			}
+		}
+		for _, p := range points {
+			m.Points = append(m.Points, p)
+		}
+		sort.Slice(m.Points, func(i, j int) bool {
+			if descending {
+				return m.Points[i].Timestamp.After(m.Points[j].Timestamp)
+			}
+			return m.Points[i].Timestamp.Before(m.Points[j].Timestamp)
+		})
 
-				m.Station.Latitude, err = value[3].(json.Number).Float64()
-				if err != nil {
-					m.Station.Latitude = -1.0
+		merged = append(merged, m)
+	}
+
+	return merged
+}
+
+// seriesQuery returns the queries for retrieving the series of the given
+// filter. Each measurement results in a single statement and each query will
+// contain at most MaxStatementsPerQuery statements.
+func (db *DB) seriesQuery(ctx context.Context, filter *browser.SeriesFilter) []ql.Querier {
+	return splitStatements(db.seriesStatements(ctx, filter))
+}
+
+// seriesStatements returns a statement for each measurement of the given
+// filter the user is allowed to access.
+func (db *DB) seriesStatements(ctx context.Context, filter *browser.SeriesFilter) []ql.Querier {
+	start, end := startEndTime(filter.Start, filter.End, filter.Location())
+
+	var statements []ql.Querier
+	for _, measure := range db.selectedMeasurements(ctx, filter) {
+		columns := []string{measure, "altitude as elevation", "latitude", "longitude", "depth"}
+
+		sb := ql.Select(columns...)
+		sb.From(measure).RetentionPolicy(filter.RetentionPolicy)
+		sb.Where(
+			ql.Paren(ql.Eq(ql.Or(), "snipeit_location_ref", filter.Stations...)),
+			ql.And(),
+			ql.Paren(ql.Eq(ql.Or(), "landuse", filter.Landuse...)),
+			ql.And(),
+			ql.TimeRange(start, end),
+		)
+		sb.GroupBy("station,snipeit_location_ref,landuse,unit,aggr")
+		orderByTime(sb, filter).Limit(limit(filter)).TZ(timeZone(filter.Location()))
+
+		statements = append(statements, sb)
+	}
+
+	return statements
+}
+
+// selectedMeasurements returns the measurements selected by the given filter
+// which the user is allowed to access.
+func (db *DB) selectedMeasurements(ctx context.Context, filter *browser.SeriesFilter) []string {
+	var (
+		user         = browser.UserFromContext(ctx)
+		measurements = db.parseMeasurements(ctx, filter)
+	)
+
+	// If the users has full access and the filter contains maintenance
+	// measurements add them to the slice.
+	if user.Role == browser.FullAccess && user.License {
+		measurements = appendMaintenance(measurements, filter.Maintenance...)
+	}
+
+	return measurements
+}
+
+// splitStatements joins the given statements into queries of at most
+// MaxStatementsPerQuery statements.
+func splitStatements(statements []ql.Querier) []ql.Querier {
+	var queries []ql.Querier
+	for len(statements) > 0 {
+		n := MaxStatementsPerQuery
+		if n <= 0 || n > len(statements) {
+			n = len(statements)
+		}
+
+		queries = append(queries, joinStatements(statements[:n]))
+		statements = statements[n:]
+	}
+
+	return queries
+}
+
+// Latest implements browser.Database. It returns the most recent point of
+// each measurement and station selected by the given filter. The time range
+// of the filter is ignored, therefore at least one station must be given.
+func (db *DB) Latest(ctx context.Context, filter *browser.SeriesFilter) (browser.TimeSeries, error) {
+	if filter == nil || len(filter.Stations) == 0 {
+		return nil, browser.ErrDataNotFound
+	}
+
+	if db.cacheEmpty() {
+		return nil, browser.ErrCatalogNotPopulated
+	}
+
+	var statements []ql.Querier
+	for _, measure := range db.selectedMeasurements(ctx, filter) {
+		columns := []string{measure, "altitude as elevation", "latitude", "longitude", "depth"}
+
+		sb := ql.Select(columns...)
+		sb.From(measure).RetentionPolicy(filter.RetentionPolicy)
+		sb.Where(
+			ql.Paren(ql.Eq(ql.Or(), "snipeit_location_ref", filter.Stations...)),
+			ql.And(),
+			ql.Paren(ql.Eq(ql.Or(), "landuse", filter.Landuse...)),
+		)
+		sb.GroupBy("station,snipeit_location_ref,landuse,unit,aggr")
+		sb.OrderBy("time").DESC().Limit(1).TZ(timeZone(filter.Location()))
+
+		statements = append(statements, sb)
+	}
+	if len(statements) == 0 {
+		return nil, browser.ErrDataNotFound
+	}
+
+	var (
+		ts      browser.TimeSeries
+		renamed = make(map[*browser.Measurement]bool)
+	)
+	for _, q := range splitStatements(statements) {
+		resp, err := db.exec(q)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range resp.Results {
+			for _, series := range result.Series {
+				if len(series.Values) == 0 {
+					continue
 				}
 
-				m.Station.Longitude, err = value[4].(json.Number).Float64()
+				// A single point has no gaps to fill, therefore its own
+				// timestamp is used as start.
+				s, _ := series.Values[0][0].(string)
+				start, err := time.Parse(time.RFC3339, s)
 				if err != nil {
-					m.Station.Longitude = -1.0
+					log.Printf("cannot convert timestamp: %v. skipping.", err)
+					continue
 				}
 
-				if value[5] == nil {
-					m.Depth = 0
-				} else {
-					m.Depth, err = value[5].(json.Number).Int64()
-					if err != nil {
-						m.Depth = -1
-					}
+				m := db.measurement(series, start, false)
+				if m.Label != series.Name {
+					renamed[m] = true
 				}
-				p := &browser.Point{
-					Timestamp: t,
-					Value:     f,
-				}
-				m.Points = append(m.Points, p)
+				ts = append(ts, m)
 			}
-
-			ts = append(ts, m)
 		}
 	}
 
+	if len(renamed) > 0 {
+		ts = mergeRenamed(ts, renamed, false)
+	}
+
+	if len(ts) == 0 {
+		return nil, browser.ErrDataNotFound
+	}
+
 	return ts, nil
 }
 
-func (db *DB) seriesQuery(ctx context.Context, filter *browser.SeriesFilter) ql.Querier {
+// orderByTime orders the points selected by the given builder by time in the
+// direction of the given filter.
+func orderByTime(sb *ql.SelectBuilder, filter *browser.SeriesFilter) *ql.SelectBuilder {
+	sb.OrderBy("time")
+	if filter.Descending {
+		return sb.DESC()
+	}
+	return sb.ASC()
+}
+
+// limit returns the limit of the given filter bounded by browser.MaxLimit.
+// Filters without a limit are not limited.
+func limit(filter *browser.SeriesFilter) int64 {
+	if browser.MaxLimit > 0 && filter.Limit > browser.MaxLimit {
+		return browser.MaxLimit
+	}
+	return filter.Limit
+}
+
+// joinStatements joins the given statements into a single multi-statement
+// query.
+func joinStatements(statements []ql.Querier) ql.Querier {
 	return ql.QueryFunc(func() (string, []interface{}) {
 		var (
-			buf          bytes.Buffer
-			args         []interface{}
-			start, end   = startEndTime(filter.Start, filter.End)
-			user         = browser.UserFromContext(ctx)
-			measurements = db.parseMeasurements(ctx, filter)
+			buf  bytes.Buffer
+			args []interface{}
 		)
 
-		// If the users has full access and the filter contains maintenance
-		// measurements add them to the slice.
-		if user.Role == browser.FullAccess && user.License {
-			measurements = appendMaintenance(measurements, filter.Maintenance...)
-		}
-
-		for _, measure := range measurements {
-			columns := []string{measure, "altitude as elevation", "latitude", "longitude", "depth"}
-
-			sb := ql.Select(columns...)
-			sb.From(measure)
-			sb.Where(
-				ql.Eq(ql.Or(), "snipeit_location_ref", filter.Stations...),
-				ql.And(),
-				ql.TimeRange(start, end),
-			)
-			sb.GroupBy("station,snipeit_location_ref,landuse,unit,aggr")
-			sb.OrderBy("time").ASC().TZ("Etc/GMT-1")
-
-			q, arg := sb.Query()
+		for _, stmt := range statements {
+			q, arg := stmt.Query()
 			buf.WriteString(q)
 			buf.WriteString(";")
 
@@ -352,12 +1047,12 @@ func (db *DB) seriesQuery(ctx context.Context, filter *browser.SeriesFilter) ql.
 }
 
 // appendMaintenance appends the given labels to s if the label is present in
-// the maintenance slice.
+// the maintenance slice and not already in s.
 func appendMaintenance(s []string, label ...string) []string {
 	for _, l := range label {
 		for _, m := range maintenace {
 			if strings.EqualFold(l, m) {
-				s = append(s, strings.ToLower(l))
+				s = browser.AppendStringIfMissing(s, strings.ToLower(l))
 			}
 		}
 	}
@@ -365,18 +1060,45 @@ func appendMaintenance(s []string, label ...string) []string {
 	return s
 }
 
-// Data in InfluxDB is UTC but LTER data is UTC+1 therefor we need to adapt
-// start and end times. It will shift the start time to -1 hour and will set
-// the end time to 22:59:59 in order to capture a full day.
-func startEndTime(s time.Time, e time.Time) (time.Time, time.Time) {
-	start := s.Add(-1 * time.Hour)
-	end := time.Date(e.Year(), e.Month(), e.Day(), 22, 59, 59, 59, time.UTC)
-	return start, end
+// startEndTime returns the time range in UTC, as stored in InfluxDB, covering
+// the full days of the given start and end dates in the given location. The
+// day boundaries are computed in the location, so that a full day is captured
+// even if its offset to UTC changes, e.g. on daylight saving time transitions.
+func startEndTime(s time.Time, e time.Time, loc *time.Location) (time.Time, time.Time) {
+	y, m, d := s.In(loc).Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+
+	y, m, d = e.In(loc).Date()
+	end := time.Date(y, m, d+1, 0, 0, 0, 0, loc).Add(-time.Second)
+
+	return start.UTC(), end.UTC()
+}
+
+// effectiveRange returns the time range selected by a query for the given
+// start and end times, as returned by startEndTime, in the given location.
+// ql.TimeRange writes the wall clock of the times as UTC.
+func effectiveRange(start, end time.Time, loc *time.Location) (time.Time, time.Time) {
+	utc := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	}
+	return utc(start).In(loc), utc(end).In(loc)
+}
+
+// timeZone returns the name of the given location as used by the TZ clause of
+// InfluxQL. LTER local time (browser.Location) is a fixed zone without a name
+// in the time zone database and maps to Etc/GMT-1.
+func timeZone(loc *time.Location) string {
+	if loc == browser.Location {
+		return "Etc/GMT-1"
+	}
+	return loc.String()
 }
 
 func (db *DB) Query(ctx context.Context, filter *browser.SeriesFilter) *browser.Stmt {
+	defer observeSince(db.metrics.queryDuration, time.Now())
+
 	var measures []string
-	if len(filter.Groups) > 0 {
+	if len(filter.Groups) > 0 || len(filter.Measurements) > 0 {
 		measures = db.parseMeasurements(ctx, filter)
 	}
 
@@ -385,18 +1107,44 @@ func (db *DB) Query(ctx context.Context, filter *browser.SeriesFilter) *browser.
 	c := []string{"station", "landuse", "altitude as elevation", "latitude", "longitude"}
 	c = append(c, measures...)
 
-	start, end := startEndTime(filter.Start, filter.End)
+	start, end := startEndTime(filter.Start, filter.End, filter.Location())
 
-	q, _ := ql.Select(c...).From(measures...).Where(
-		ql.Eq(ql.Or(), "snipeit_location_ref", filter.Stations...),
+	sb := ql.Select(c...).From(measures...).RetentionPolicy(filter.RetentionPolicy).Where(
+		ql.Paren(ql.Eq(ql.Or(), "snipeit_location_ref", filter.Stations...)),
+		ql.And(),
+		ql.Paren(ql.Eq(ql.Or(), "landuse", filter.Landuse...)),
 		ql.And(),
 		ql.TimeRange(start, end),
-	).OrderBy("time").ASC().TZ("Etc/GMT-1").Query()
+	)
+	q, _ := orderByTime(sb, filter).Limit(limit(filter)).TZ(timeZone(filter.Location())).Query()
+
+	var statements []string
+	for _, s := range db.seriesStatements(ctx, filter) {
+		q, _ := s.Query()
+		statements = append(statements, q)
+	}
 
-	return &browser.Stmt{
-		Query:    q,
-		Database: db.database,
+	stmt := &browser.Stmt{
+		Query:        q,
+		Database:     db.database,
+		Statements:   statements,
+		Measurements: measures,
 	}
+	stmt.Start, stmt.End = effectiveRange(start, end, filter.Location())
+
+	return stmt
+}
+
+// containsLabel reports whether the given labels contain the label of the
+// measurement or of the measurement a flag belongs to.
+func containsLabel(labels []string, label string) bool {
+	label = strings.TrimSuffix(label, browser.FlagSuffix)
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
 }
 
 // parseMeasurements will return a list of InfluxDB measurements, read from
@@ -418,11 +1166,21 @@ func (db *DB) parseMeasurements(ctx context.Context, filter *browser.SeriesFilte
 		}
 
 		for _, m := range measurements {
+			// Denied measurements are hidden from all users.
+			if db.deny.denied(m) {
+				continue
+			}
+
+			// Only include measurements of the given labels if any.
+			if len(filter.Labels) > 0 && !containsLabel(filter.Labels, m) {
+				continue
+			}
+
 			// check if the user is allowed to retrieve the measurement. If not
 			// continue. This is the minimum on access control which is present.
 			// Only registered and signed users have access to the full data
 			// set.
-			if user.Role == browser.Public && !isAllowed(m, publicAllowed) {
+			if user.Role == browser.Public && !db.isPublic(m) {
 				continue
 			}
 
@@ -431,7 +1189,33 @@ func (db *DB) parseMeasurements(ctx context.Context, filter *browser.SeriesFilte
 				continue
 			}
 
-			labels = browser.AppendStringIfMissing(labels, m)
+			// Only include flags if explicitly declared in the filter.
+			if strings.HasSuffix(m, browser.FlagSuffix) && !filter.WithFlags {
+				continue
+			}
+
+			labels = db.appendMeasurement(labels, m, filter.WithFlags)
+		}
+	}
+
+	// Single measurements are only selected if they are part of a group,
+	// therefore arbitrary measurements of the database cannot be retrieved.
+	if len(filter.Measurements) > 0 {
+		known := make(map[string]bool)
+		for _, measurements := range cache {
+			for _, m := range measurements {
+				known[m] = true
+			}
+		}
+
+		for _, m := range filter.Measurements {
+			if !known[m] || db.deny.denied(m) {
+				continue
+			}
+			if user.Role == browser.Public && !db.isPublic(m) {
+				continue
+			}
+			labels = db.appendMeasurement(labels, m, filter.WithFlags)
 		}
 	}
 
@@ -440,6 +1224,19 @@ func (db *DB) parseMeasurements(ctx context.Context, filter *browser.SeriesFilte
 	return labels
 }
 
+// appendMeasurement appends the given measurement to labels if it is missing,
+// together with the measurement of its quality flags if withFlags is set.
+func (db *DB) appendMeasurement(labels []string, m string, withFlags bool) []string {
+	labels = browser.AppendStringIfMissing(labels, m)
+
+	// The quality flags of a measurement are stored in a companion
+	// measurement which is not part of any group.
+	if withFlags && !strings.HasSuffix(m, "_std") && !strings.HasSuffix(m, browser.FlagSuffix) && !db.deny.denied(m+browser.FlagSuffix) {
+		labels = browser.AppendStringIfMissing(labels, m+browser.FlagSuffix)
+	}
+	return labels
+}
+
 // exec executes the given ql query and returns a response.
 func (db *DB) exec(q ql.Querier) (*client.Response, error) {
 	query, _ := q.Query()
@@ -448,17 +1245,37 @@ func (db *DB) exec(q ql.Querier) (*client.Response, error) {
 		return nil, errors.New("db.exec: given query is empty")
 	}
 
+	db.stats.IncQueries()
 	resp, err := db.client.Query(client.NewQuery(query, db.database, ""))
 	if err != nil {
+		db.metrics.queryErrors.Inc()
 		return nil, fmt.Errorf("db.exec: %v", err)
 	}
 	if resp.Error() != nil {
+		db.metrics.queryErrors.Inc()
 		return nil, fmt.Errorf("db.exec: %v", resp.Error())
 	}
 
 	return resp, nil
 }
 
+// isPublic reports whether the public role is allowed to access the given
+// measurement. It must be part of one of the public groups and, if the group
+// has any, one of its publicMeasurements.
+func (db *DB) isPublic(label string) bool {
+	for _, g := range db.publicGroups {
+		re, ok := groupRegexpMap[g]
+		if !ok || !re.MatchString(label) {
+			continue
+		}
+		allowed, ok := publicMeasurements[g]
+		if !ok || isAllowed(label, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
 func isAllowed(label string, allowed []string) bool {
 	for _, f := range allowed {
 		if strings.EqualFold(label, f) {
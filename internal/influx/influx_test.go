@@ -5,19 +5,31 @@
 package influx
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"math"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/encoding/csv"
+	"github.com/euracresearch/browser/internal/metrics"
 	"github.com/euracresearch/browser/internal/mock"
+	"github.com/euracresearch/browser/internal/ql"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	client "github.com/influxdata/influxdb1-client/v2"
 )
 
@@ -41,47 +53,129 @@ func TestQuery(t *testing.T) {
 			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.Wind}},
 			ctx: context.Background(),
 			want: &browser.Stmt{
-				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_dir, wind_speed_avg, wind_speed_max FROM wind_dir, wind_speed_avg, wind_speed_max WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
-				Database: dbName,
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_dir, wind_speed_avg, wind_speed_max FROM wind_dir, wind_speed_avg, wind_speed_max WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"wind_dir", "wind_speed_avg", "wind_speed_max"},
 			},
 		},
 		"subgroup": {
 			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.WindSpeed}},
 			ctx: context.Background(),
 			want: &browser.Stmt{
-				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_speed_avg FROM wind_speed_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
-				Database: dbName,
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_speed_avg FROM wind_speed_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"wind_speed_avg"},
+			},
+		},
+		"labels": {
+			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.Wind}, Labels: []string{"wind_dir", "air_t_avg"}},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_dir FROM wind_dir WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"wind_dir"},
+			},
+		},
+		"descending": {
+			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.WindSpeed}, Descending: true},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_speed_avg FROM wind_speed_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time DESC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"wind_speed_avg"},
+			},
+		},
+		"utc": {
+			in: &browser.SeriesFilter{
+				Groups: []browser.Group{browser.WindSpeed},
+				Start:  time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+				End:    time.Date(2020, 1, 16, 0, 0, 0, 0, time.UTC),
+				TZ:     time.UTC,
+			},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_speed_avg FROM wind_speed_avg WHERE time >= '2020-01-15T00:00:00Z' AND time <= '2020-01-16T23:59:59Z' ORDER BY time ASC TZ('UTC')",
+				Database:     dbName,
+				Measurements: []string{"wind_speed_avg"},
+			},
+		},
+		"parent_and_subgroup": {
+			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.Wind, browser.WindSpeed, browser.WindSpeedMax}},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_dir, wind_speed_avg, wind_speed_max FROM wind_dir, wind_speed_avg, wind_speed_max WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"wind_dir", "wind_speed_avg", "wind_speed_max"},
+			},
+		},
+		"maintenance_duplicate": {
+			in:  &browser.SeriesFilter{Maintenance: []string{"Batt_V_Avg", "batt_v_avg"}},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, batt_v_avg FROM batt_v_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"batt_v_avg"},
+			},
+		},
+		"flags": {
+			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.Wind}, WithFlags: true},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_dir, wind_dir_flag, wind_speed_avg, wind_speed_avg_flag, wind_speed_max, wind_speed_max_flag FROM wind_dir, wind_dir_flag, wind_speed_avg, wind_speed_avg_flag, wind_speed_max, wind_speed_max_flag WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"wind_dir", "wind_dir_flag", "wind_speed_avg", "wind_speed_avg_flag", "wind_speed_max", "wind_speed_max_flag"},
+			},
+		},
+		"flags_with_std": {
+			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.WindSpeed}, WithSTD: true, WithFlags: true},
+			ctx: createContext(t, browser.FullAccess, true),
+			want: &browser.Stmt{
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_speed, wind_speed_avg, wind_speed_avg_flag, wind_speed_flag, wind_speed_std FROM wind_speed, wind_speed_avg, wind_speed_avg_flag, wind_speed_flag, wind_speed_std WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"wind_speed", "wind_speed_avg", "wind_speed_avg_flag", "wind_speed_flag", "wind_speed_std"},
+			},
+		},
+		"retention_policy": {
+			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.WindSpeed}, RetentionPolicy: "raw"},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, wind_speed_avg FROM raw.wind_speed_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"wind_speed_avg"},
 			},
 		},
 		"measurements_public_false": {
 			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.AirTemperature, browser.SoilTemperature}},
 			ctx: createContext(t, browser.Public, false),
 			want: &browser.Stmt{
-				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude, air_t_avg FROM air_t_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
-				Database: dbName,
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, air_t_avg FROM air_t_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"air_t_avg"},
 			},
 		},
 		"measurements_public_true": {
 			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.AirTemperature, browser.SoilTemperature}},
 			ctx: createContext(t, browser.Public, true),
 			want: &browser.Stmt{
-				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude, air_t_avg FROM air_t_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
-				Database: dbName,
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, air_t_avg FROM air_t_avg WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"air_t_avg"},
 			},
 		},
 		"measurements_fullaccess": {
 			in:  &browser.SeriesFilter{Groups: []browser.Group{browser.Wind, browser.SunshineDuration}, WithSTD: true},
 			ctx: createContext(t, browser.FullAccess, true),
 			want: &browser.Stmt{
-				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude, sun_count_tot, wind_dir, wind_dir_std, wind_speed, wind_speed_avg, wind_speed_max, wind_speed_std FROM sun_count_tot, wind_dir, wind_dir_std, wind_speed, wind_speed_avg, wind_speed_max, wind_speed_std WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
-				Database: dbName,
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, sun_count_tot, wind_dir, wind_dir_std, wind_speed, wind_speed_avg, wind_speed_max, wind_speed_std FROM sun_count_tot, wind_dir, wind_dir_std, wind_speed, wind_speed_avg, wind_speed_max, wind_speed_std WHERE time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"sun_count_tot", "wind_dir", "wind_dir_std", "wind_speed", "wind_speed_avg", "wind_speed_max", "wind_speed_std"},
 			},
 		},
 		"station": {
 			in:  &browser.SeriesFilter{Stations: []string{"1"}},
 			ctx: context.Background(),
 			want: &browser.Stmt{
-				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude FROM /.*/ WHERE snipeit_location_ref='1' AND time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude FROM /.*/ WHERE (snipeit_location_ref='1') AND time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
 				Database: dbName,
 			},
 		},
@@ -89,7 +183,23 @@ func TestQuery(t *testing.T) {
 			in:  &browser.SeriesFilter{Stations: []string{"s1", "s2"}},
 			ctx: context.Background(),
 			want: &browser.Stmt{
-				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude FROM /.*/ WHERE snipeit_location_ref='s1' OR snipeit_location_ref='s2' AND time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude FROM /.*/ WHERE (snipeit_location_ref='s1' OR snipeit_location_ref='s2') AND time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database: dbName,
+			},
+		},
+		"landuse": {
+			in:  &browser.SeriesFilter{Stations: []string{"s1", "s2"}, Landuse: []string{"me", "fo"}},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude FROM /.*/ WHERE (snipeit_location_ref='s1' OR snipeit_location_ref='s2') AND (landuse='me' OR landuse='fo') AND time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database: dbName,
+			},
+		},
+		"landuse_empty": {
+			in:  &browser.SeriesFilter{Stations: []string{"1"}, Landuse: []string{""}},
+			ctx: context.Background(),
+			want: &browser.Stmt{
+				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude FROM /.*/ WHERE (snipeit_location_ref='1') AND time >= '0000-12-31T23:00:00Z' AND time <= '0001-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
 				Database: dbName,
 			},
 		},
@@ -102,8 +212,9 @@ func TestQuery(t *testing.T) {
 			},
 			ctx: createContext(t, browser.FullAccess, true),
 			want: &browser.Stmt{
-				Query:    "SELECT station, landuse, altitude as elevation, latitude, longitude, air_t_avg, snow_air_t, snow_height, wind_dir, wind_speed, wind_speed_avg, wind_speed_max FROM air_t_avg, snow_air_t, snow_height, wind_dir, wind_speed, wind_speed_avg, wind_speed_max WHERE snipeit_location_ref='s1' OR snipeit_location_ref='s2' AND time >= '2019-12-31T23:00:00Z' AND time <= '2020-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
-				Database: dbName,
+				Query:        "SELECT station, landuse, altitude as elevation, latitude, longitude, air_t_avg, snow_air_t, snow_height, wind_dir, wind_speed, wind_speed_avg, wind_speed_max FROM air_t_avg, snow_air_t, snow_height, wind_dir, wind_speed, wind_speed_avg, wind_speed_max WHERE (snipeit_location_ref='s1' OR snipeit_location_ref='s2') AND time >= '2019-12-31T23:00:00Z' AND time <= '2020-01-01T22:59:59Z' ORDER BY time ASC TZ('Etc/GMT-1')",
+				Database:     dbName,
+				Measurements: []string{"air_t_avg", "snow_air_t", "snow_height", "wind_dir", "wind_speed", "wind_speed_avg", "wind_speed_max"},
 			},
 		},
 	}
@@ -119,7 +230,9 @@ func TestQuery(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			got := db.Query(tc.ctx, tc.in)
 
-			diff := cmp.Diff(tc.want, got)
+			// The effective time range is covered by TestQueryEffectiveRange
+			// and the statements by TestQueryStatements.
+			diff := cmp.Diff(tc.want, got, cmpopts.IgnoreFields(browser.Stmt{}, "Start", "End", "Statements"))
 			if diff != "" {
 				t.Fatalf("mismatch (-want +got):\n%s", diff)
 			}
@@ -127,6 +240,147 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+// TestQueryStatements checks that the statements of Query are those executed
+// by Series.
+func TestQueryStatements(t *testing.T) {
+	var command string
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	multiple := queryFnTestHelper(t, "multiple.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		command = q.Command
+		return multiple(q)
+	}
+
+	ctx := createContext(t, browser.FullAccess, true)
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature},
+		Stations: []string{"39"},
+		Start:    time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+	}
+	if _, err := db.Series(ctx, filter); err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
+
+	stmt := db.Query(ctx, filter)
+	if len(stmt.Statements) != len(stmt.Measurements) {
+		t.Fatalf("got %d statements for %d measurements", len(stmt.Statements), len(stmt.Measurements))
+	}
+	if got, want := strings.Join(stmt.Statements, ";")+";", command; got != want {
+		t.Fatalf("statements %q differ from the executed query %q", got, want)
+	}
+}
+
+func TestQueryEffectiveRange(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		start, end time.Time
+		tz         *time.Location
+		wantStart  time.Time
+		wantEnd    time.Time
+	}{
+		"day": {
+			start:     time.Date(2020, 1, 1, 0, 0, 0, 0, browser.Location),
+			end:       time.Date(2020, 1, 1, 0, 0, 0, 0, browser.Location),
+			wantStart: time.Date(2020, 1, 1, 0, 0, 0, 0, browser.Location),
+			wantEnd:   time.Date(2020, 1, 1, 23, 59, 59, 0, browser.Location),
+		},
+		"range": {
+			start:     time.Date(2019, 7, 23, 0, 0, 0, 0, browser.Location),
+			end:       time.Date(2020, 1, 23, 0, 0, 0, 0, browser.Location),
+			wantStart: time.Date(2019, 7, 23, 0, 0, 0, 0, browser.Location),
+			wantEnd:   time.Date(2020, 1, 23, 23, 59, 59, 0, browser.Location),
+		},
+		"utc": {
+			start:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			end:       time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			tz:        time.UTC,
+			wantStart: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2020, 1, 1, 23, 59, 59, 0, time.UTC),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := &browser.SeriesFilter{
+				Stations: []string{"s1"},
+				Start:    tc.start,
+				End:      tc.end,
+				TZ:       tc.tz,
+			}
+			got := db.Query(context.Background(), f)
+
+			if !got.Start.Equal(tc.wantStart) || !got.End.Equal(tc.wantEnd) {
+				t.Fatalf("got effective range %v - %v, want %v - %v", got.Start, got.End, tc.wantStart, tc.wantEnd)
+			}
+			if got.Start.Location() != f.Location() || got.End.Location() != f.Location() {
+				t.Fatalf("effective range is not in the time zone of the filter: %v - %v", got.Start, got.End)
+			}
+		})
+	}
+}
+
+func TestStartEndTime(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(loc *time.Location) { browser.Location = loc }(browser.Location)
+
+	testCases := map[string]struct {
+		loc       *time.Location
+		day       string
+		wantStart string
+		wantEnd   string
+	}{
+		"fixed_winter":   {browser.Location, "2020-01-15", "2020-01-14T23:00:00Z", "2020-01-15T22:59:59Z"},
+		"fixed_summer":   {browser.Location, "2020-07-15", "2020-07-14T23:00:00Z", "2020-07-15T22:59:59Z"},
+		"winter":         {rome, "2020-01-15", "2020-01-14T23:00:00Z", "2020-01-15T22:59:59Z"},
+		"summer":         {rome, "2020-07-15", "2020-07-14T22:00:00Z", "2020-07-15T21:59:59Z"},
+		"spring_forward": {rome, "2020-03-29", "2020-03-28T23:00:00Z", "2020-03-29T21:59:59Z"},
+		"fall_back":      {rome, "2020-10-25", "2020-10-24T22:00:00Z", "2020-10-25T22:59:59Z"},
+		"utc":            {time.UTC, "2020-01-15", "2020-01-15T00:00:00Z", "2020-01-15T23:59:59Z"},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			browser.Location = tc.loc
+
+			day, err := time.ParseInLocation("2006-01-02", tc.day, tc.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start, end := startEndTime(day, day, tc.loc)
+			if got := start.Format(time.RFC3339); got != tc.wantStart {
+				t.Errorf("start: got %s, want %s", got, tc.wantStart)
+			}
+			if got := end.Format(time.RFC3339); got != tc.wantEnd {
+				t.Errorf("end: got %s, want %s", got, tc.wantEnd)
+			}
+
+			// The range must cover exactly the local day.
+			if got, want := end.Add(time.Second).Sub(start), day.AddDate(0, 0, 1).Sub(day); got != want {
+				t.Errorf("range covers %v, want %v", got, want)
+			}
+		})
+	}
+}
+
 func TestSeries(t *testing.T) {
 
 	// In tests we use always the same message since we use a mock implementation
@@ -156,6 +410,7 @@ func TestSeries(t *testing.T) {
 				&browser.Measurement{
 					Label: "air_rh_avg",
 					Station: &browser.Station{
+						ID:        39,
 						Name:      "b1",
 						Landuse:   "me",
 						Elevation: 990,
@@ -192,6 +447,7 @@ func TestSeries(t *testing.T) {
 					Aggregation: "avg",
 					Unit:        "%",
 					Station: &browser.Station{
+						ID:        39,
 						Name:      "b1",
 						Landuse:   "me",
 						Elevation: 990,
@@ -209,6 +465,7 @@ func TestSeries(t *testing.T) {
 				&browser.Measurement{
 					Label: "air_rh_avg",
 					Station: &browser.Station{
+						ID:        4,
 						Name:      "b2",
 						Landuse:   "me",
 						Elevation: 1490,
@@ -230,6 +487,7 @@ func TestSeries(t *testing.T) {
 					Aggregation: "avg",
 					Unit:        "deg c",
 					Station: &browser.Station{
+						ID:        39,
 						Name:      "b1",
 						Landuse:   "me",
 						Elevation: 990,
@@ -247,6 +505,7 @@ func TestSeries(t *testing.T) {
 				&browser.Measurement{
 					Label: "air_t_avg",
 					Station: &browser.Station{
+						ID:        4,
 						Name:      "b2",
 						Landuse:   "me",
 						Elevation: 1490,
@@ -267,6 +526,7 @@ func TestSeries(t *testing.T) {
 					Aggregation: "smp",
 					Unit:        "",
 					Station: &browser.Station{
+						ID:        39,
 						Name:      "b1",
 						Landuse:   "me",
 						Elevation: 990,
@@ -309,138 +569,1619 @@ func TestSeries(t *testing.T) {
 	}
 }
 
-func TestGroupsByStation(t *testing.T) {
-	db, err := NewDB(&mock.InfluxClient{
+func TestSeriesSplitQuery(t *testing.T) {
+	defer func(n int) { MaxStatementsPerQuery = n }(MaxStatementsPerQuery)
+	MaxStatementsPerQuery = 2
+
+	var selects int
+	c := &mock.InfluxClient{
 		QueryFn: queryFnTestHelper(t, ""),
-	}, "test")
+	}
+	db, err := NewDB(c, "testdb")
 	if err != nil {
-		t.Fatalf("TestQuery: error in NewDB: %v", err)
+		t.Fatalf("NewDB returned an error: %v", err)
 	}
 
-	t.Run("notfound", func(t *testing.T) {
-		ctx := context.Background()
-		_, err := db.GroupsByStation(ctx, 8888)
-		if err == nil {
-			t.Fatal("expected an error")
-		}
-	})
-
-	t.Run("public", func(t *testing.T) {
-		want := []browser.Group{
-			browser.RelativeHumidity,
-			browser.AirTemperature,
-			browser.ShortWaveRadiationOutgoing,
-			browser.PrecipitationTotal,
-			browser.SnowHeight,
-			browser.WindDirection,
-			browser.WindSpeed,
-			browser.WindSpeedMax,
-		}
+	ctx := createContext(t, browser.FullAccess, true)
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature, browser.Wind},
+		Stations: []string{"39"},
+		Start:    time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+	}
 
-		// Test with user public user embedded in the ctx.
-		ctx := createContext(t, browser.Public, false)
-		got, err := db.GroupsByStation(ctx, 6)
-		if err != nil {
-			t.Fatal("got error")
-		}
+	statements := len(db.parseMeasurements(ctx, filter))
+	if statements <= MaxStatementsPerQuery {
+		t.Fatalf("selection has %d statements, want more than %d", statements, MaxStatementsPerQuery)
+	}
 
-		diff := cmp.Diff(want, got)
-		if diff != "" {
-			t.Fatalf("mismatch (-want +got):\n%s", diff)
-		}
+	multiple := queryFnTestHelper(t, "multiple.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		selects++
 
-		// Test with general context.
-		ctx = context.Background()
-		got, err = db.GroupsByStation(ctx, 6)
-		if err != nil {
-			t.Fatal("got error")
+		if n := strings.Count(q.Command, ";"); n > MaxStatementsPerQuery {
+			t.Errorf("query contains %d statements, want at most %d", n, MaxStatementsPerQuery)
 		}
 
-		diff = cmp.Diff(want, got)
-		if diff != "" {
-			t.Fatalf("mismatch (-want +got):\n%s", diff)
-		}
-	})
+		return multiple(q)
+	}
 
-	t.Run("fullaccess", func(t *testing.T) {
-		want := []browser.Group{
-			browser.RelativeHumidity,
-			browser.AirTemperature,
-			browser.NDVIRadiations,
-			browser.LongWaveRadiation,
-			browser.ShortWaveRadiation,
-			browser.PhotosyntheticallyActiveRadiation,
-			browser.PRIRadiations,
-			browser.SoilHeatFlux,
-			browser.SnowHeight,
-			browser.SunshineDuration,
-			browser.SoilDielectricPermittivity,
-			browser.SoilElectricalConductivity,
-			browser.SoilTemperature,
-			browser.SoilWaterContent,
-			browser.SoilWaterPotential,
-			browser.Wind,
-		}
+	ts, err := db.Series(ctx, filter)
+	if err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
 
-		ctx := createContext(t, browser.FullAccess, true)
-		got, err := db.GroupsByStation(ctx, 3)
-		if err != nil {
-			t.Fatal("got error")
-		}
+	want := (statements + MaxStatementsPerQuery - 1) / MaxStatementsPerQuery
+	if selects != want {
+		t.Fatalf("got %d queries, want %d", selects, want)
+	}
 
-		diff := cmp.Diff(want, got)
-		if diff != "" {
-			t.Fatalf("mismatch (-want +got):\n%s", diff)
-		}
-	})
+	// Each query returns the same fixture, so the results of all queries must
+	// be merged.
+	if got, want := len(ts), 5*selects; got != want {
+		t.Fatalf("got %d measurements, want %d", got, want)
+	}
 }
 
-func testPoint(t *testing.T, s string, value float64) *browser.Point {
-	t.Helper()
+func TestSeriesStream(t *testing.T) {
+	defer func(n int) { MaxStatementsPerQuery = n }(MaxStatementsPerQuery)
+	MaxStatementsPerQuery = 2
 
-	ts, err := time.ParseInLocation(time.RFC3339, s, browser.Location)
+	var selects int
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("NewDB returned an error: %v", err)
 	}
-	return &browser.Point{
-		Timestamp: ts,
-		Value:     value,
+
+	multiple := queryFnTestHelper(t, "multiple.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		selects++
+		return multiple(q)
 	}
-}
 
-func queryFnTestHelper(t *testing.T, filename string) func(q client.Query) (*client.Response, error) {
-	t.Helper()
+	ctx := createContext(t, browser.FullAccess, true)
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature, browser.Wind},
+		Stations: []string{"39"},
+		Start:    time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+	}
 
-	return func(q client.Query) (*client.Response, error) {
-		inQuery := strings.ToLower(q.Command)
+	want, err := db.Series(ctx, filter)
+	if err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
 
-		switch {
-		case strings.HasPrefix(inQuery, "show measurements"):
-			filename = "measurements.json"
-		case strings.HasPrefix(inQuery, "show tag"):
-			filename = "tags.json"
-		}
+	selects = 0
+	it, err := db.SeriesStream(ctx, filter)
+	if err != nil {
+		t.Fatalf("SeriesStream returned an error: %v", err)
+	}
+	if selects != 0 {
+		t.Fatalf("got %d queries before iterating, want 0", selects)
+	}
 
-		f, err := os.Open(filepath.Join("testdata", filename))
-		if err != nil {
-			return nil, err
+	// The first response contains 5 measurements, so the second query must
+	// not be executed before they are consumed.
+	for i := 0; i < 5; i++ {
+		if _, err := it.Next(); err != nil {
+			t.Fatalf("Next returned an error: %v", err)
 		}
-		defer f.Close()
+	}
+	if selects != 1 {
+		t.Fatalf("got %d queries after the first response, want 1", selects)
+	}
 
-		dec := json.NewDecoder(f)
-		dec.UseNumber()
+	it, err = db.SeriesStream(ctx, filter)
+	if err != nil {
+		t.Fatalf("SeriesStream returned an error: %v", err)
+	}
+	got, err := browser.ReadTimeSeries(it)
+	if err != nil {
+		t.Fatalf("ReadTimeSeries returned an error: %v", err)
+	}
 
-		var resp *client.Response
-		if err := dec.Decode(&resp); err != nil {
-			return nil, err
-		}
+	diff := cmp.Diff(want, got, cmp.Comparer(func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+	}))
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
 
-		return resp, nil
+	if _, err := it.Next(); err != io.EOF {
+		t.Fatalf("Next after the last measurement returned %v, want io.EOF", err)
+	}
+
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		return nil, errors.New("unreachable")
+	}
+	it, err = db.SeriesStream(ctx, filter)
+	if err != nil {
+		t.Fatalf("SeriesStream returned an error: %v", err)
+	}
+	if _, err := it.Next(); err == nil {
+		t.Fatal("expected an error from Next on a failing query")
 	}
 }
 
-// createContext returns a new context with an browser.User embedded with the
-// given role and license.
+func TestSeriesOverlappingGroups(t *testing.T) {
+	var command string
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	multiple := queryFnTestHelper(t, "multiple.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		command += q.Command
+		return multiple(q)
+	}
+
+	ctx := createContext(t, browser.FullAccess, true)
+	filter := &browser.SeriesFilter{
+		Groups:      []browser.Group{browser.Wind, browser.WindSpeed, browser.WindSpeedMax},
+		Stations:    []string{"39"},
+		Start:       time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:         time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		Maintenance: []string{"Batt_V_Avg", "batt_v_avg"},
+	}
+	if _, err := db.Series(ctx, filter); err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
+
+	for _, m := range []string{"wind_dir", "wind_speed", "wind_speed_avg", "wind_speed_max", "batt_v_avg"} {
+		if n := strings.Count(command, "FROM "+m+" "); n != 1 {
+			t.Errorf("measurement %q is queried %d times, want 1", m, n)
+		}
+	}
+}
+
+func TestSeriesCollectionInterval(t *testing.T) {
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature},
+		Stations: []string{"39"},
+		Start:    time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+	}
+
+	testCases := map[string]struct {
+		options  []Option
+		interval time.Duration
+		want     []*browser.Point
+	}{
+		"10m": {
+			[]Option{WithCollectionIntervals(map[int64]time.Duration{39: 10 * time.Minute})},
+			10 * time.Minute,
+			[]*browser.Point{
+				testPoint(t, "2020-05-04T00:00:00+01:00", 1.5),
+				testPoint(t, "2020-05-04T00:10:00+01:00", 1.6),
+				testPoint(t, "2020-05-04T00:20:00+01:00", 1.7),
+				testPoint(t, "2020-05-04T00:30:00+01:00", math.NaN()),
+				testPoint(t, "2020-05-04T00:40:00+01:00", math.NaN()),
+				testPoint(t, "2020-05-04T00:50:00+01:00", 2.0),
+				testPoint(t, "2020-05-04T01:00:00+01:00", 2.1),
+			},
+		},
+		"other station": {
+			[]Option{WithCollectionIntervals(map[int64]time.Duration{4: 10 * time.Minute})},
+			0,
+			// With the default interval the points are not aligned, which
+			// must neither hang nor drop values.
+			[]*browser.Point{
+				testPoint(t, "2020-05-04T00:00:00+01:00", 1.5),
+				testPoint(t, "2020-05-04T00:10:00+01:00", 1.6),
+				testPoint(t, "2020-05-04T00:20:00+01:00", 1.7),
+				testPoint(t, "2020-05-04T00:35:00+01:00", math.NaN()),
+				testPoint(t, "2020-05-04T00:50:00+01:00", 2.0),
+				testPoint(t, "2020-05-04T01:00:00+01:00", 2.1),
+			},
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			c := &mock.InfluxClient{
+				QueryFn: queryFnTestHelper(t, ""),
+			}
+			db, err := NewDB(c, "testdb", tc.options...)
+			if err != nil {
+				t.Fatalf("NewDB returned an error: %v", err)
+			}
+			c.QueryFn = queryFnTestHelper(t, "interval.json")
+
+			ts, err := db.Series(context.Background(), filter)
+			if err != nil {
+				t.Fatalf("Series returned an error: %v", err)
+			}
+			if len(ts) != 1 {
+				t.Fatalf("got %d measurements, want 1", len(ts))
+			}
+
+			if got := ts[0].Station.CollectionInterval; got != tc.interval {
+				t.Errorf("got collection interval %v, want %v", got, tc.interval)
+			}
+
+			diff := cmp.Diff(tc.want, ts[0].Points, cmp.Comparer(func(x, y float64) bool {
+				return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+			}))
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSeriesDescending(t *testing.T) {
+	var command string
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	descending := queryFnTestHelper(t, "descending.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		command = q.Command
+		return descending(q)
+	}
+
+	filter := &browser.SeriesFilter{
+		Groups:     []browser.Group{browser.AirTemperature},
+		Stations:   []string{"39"},
+		Start:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:        time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		Descending: true,
+	}
+
+	ts, err := db.Series(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
+	if !strings.Contains(command, " ORDER BY time DESC ") {
+		t.Fatalf("query %q is not ordered descending", command)
+	}
+	if len(ts) != 1 {
+		t.Fatalf("got %d measurements, want 1", len(ts))
+	}
+
+	// Gaps are filled backwards from the end of the range.
+	want := []*browser.Point{
+		testPoint(t, "2020-05-04T23:45:00+01:00", math.NaN()),
+		testPoint(t, "2020-05-04T23:30:00+01:00", 2.3),
+		testPoint(t, "2020-05-04T23:15:00+01:00", 2.2),
+		testPoint(t, "2020-05-04T23:00:00+01:00", math.NaN()),
+		testPoint(t, "2020-05-04T22:45:00+01:00", 2.0),
+	}
+	diff := cmp.Diff(want, ts[0].Points, cmp.Comparer(func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+	}), cmp.Comparer(func(x, y time.Time) bool {
+		return x.Equal(y)
+	}))
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSeriesFlags(t *testing.T) {
+	var command string
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	flags := queryFnTestHelper(t, "flags.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		command = q.Command
+		return flags(q)
+	}
+
+	filter := &browser.SeriesFilter{
+		Groups:    []browser.Group{browser.AirTemperature},
+		Stations:  []string{"39"},
+		Start:     time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:       time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		WithFlags: true,
+	}
+
+	ts, err := db.Series(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
+	if !strings.Contains(command, "FROM air_t_avg_flag ") {
+		t.Fatalf("query %q does not select the flags", command)
+	}
+
+	got := make(map[string][]float64)
+	for _, m := range ts {
+		for _, p := range m.Points[:2] {
+			got[m.Label] = append(got[m.Label], p.Value)
+		}
+	}
+	want := map[string][]float64{
+		"air_t_avg":      {1.5, 1.6},
+		"air_t_avg_flag": {0, 2},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+
+	filter.WithFlags = false
+	if _, err := db.Series(context.Background(), filter); err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
+	if strings.Contains(command, browser.FlagSuffix) {
+		t.Fatalf("query %q selects flags without being requested", command)
+	}
+}
+
+func TestSeriesUTC(t *testing.T) {
+	var command string
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	utc := queryFnTestHelper(t, "utc.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		command = q.Command
+		return utc(q)
+	}
+
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature},
+		Stations: []string{"39"},
+		Start:    time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+		TZ:       time.UTC,
+	}
+
+	ts, err := db.Series(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
+	if want := "time >= '2020-01-15T00:00:00Z' AND time <= '2020-01-15T23:59:59Z'"; !strings.Contains(command, want) {
+		t.Fatalf("query %q does not contain the UTC day %q", command, want)
+	}
+	if !strings.Contains(command, "TZ('UTC')") {
+		t.Fatalf("query %q does not return UTC timestamps", command)
+	}
+	if len(ts) != 1 {
+		t.Fatalf("got %d measurements, want 1", len(ts))
+	}
+
+	var got []string
+	for _, p := range ts[0].Points {
+		got = append(got, p.Timestamp.Format(time.RFC3339))
+	}
+	want := []string{"2020-01-15T00:00:00Z", "2020-01-15T00:15:00Z", "2020-01-15T00:30:00Z"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSeriesTimeFilter(t *testing.T) {
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+	c.QueryFn = queryFnTestHelper(t, "daynight.json")
+
+	// The fixture contains points of Saturday 2020-05-02 from 05:30 until
+	// 06:15, crossing the end of the night.
+	testCases := map[string]struct {
+		tod  browser.TimeOfDay
+		dow  browser.DayOfWeek
+		want []*browser.Point
+	}{
+		"all": {browser.AnyTime, browser.AnyDay, []*browser.Point{
+			testPoint(t, "2020-05-02T05:30:00+01:00", 1),
+			testPoint(t, "2020-05-02T05:45:00+01:00", 2),
+			testPoint(t, "2020-05-02T06:00:00+01:00", 3),
+			testPoint(t, "2020-05-02T06:15:00+01:00", 4),
+		}},
+		"night": {browser.Nighttime, browser.AnyDay, []*browser.Point{
+			testPoint(t, "2020-05-02T05:30:00+01:00", 1),
+			testPoint(t, "2020-05-02T05:45:00+01:00", 2),
+		}},
+		"day_weekend": {browser.Daytime, browser.Weekends, []*browser.Point{
+			testPoint(t, "2020-05-02T06:00:00+01:00", 3),
+			testPoint(t, "2020-05-02T06:15:00+01:00", 4),
+		}},
+		"weekday": {browser.AnyTime, browser.Weekdays, nil},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			filter := &browser.SeriesFilter{
+				Groups:    []browser.Group{browser.AirTemperature},
+				Stations:  []string{"39"},
+				Start:     time.Date(2020, 5, 2, 5, 30, 0, 0, browser.Location),
+				End:       time.Date(2020, 5, 2, 0, 0, 0, 0, browser.Location),
+				TimeOfDay: tc.tod,
+				DayOfWeek: tc.dow,
+			}
+
+			ts, err := db.Series(context.Background(), filter)
+			if err != nil {
+				t.Fatalf("Series returned an error: %v", err)
+			}
+			if len(ts) != 1 {
+				t.Fatalf("got %d measurements, want 1", len(ts))
+			}
+
+			// Compare an empty selection as nil.
+			var got []*browser.Point
+			got = append(got, ts[0].Points...)
+			diff := cmp.Diff(tc.want, got)
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSeriesUnits(t *testing.T) {
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+	c.QueryFn = queryFnTestHelper(t, "units.json")
+
+	type result struct {
+		Unit   string
+		Values []float64
+	}
+
+	testCases := map[string]struct {
+		units   map[browser.Group]string
+		want    map[string]result
+		wantErr error
+	}{
+		"none": {nil, map[string]result{
+			"air_t_avg":      {"deg c", []float64{1, 2}},
+			"wind_speed_avg": {"km/h", []float64{36, 7.2}},
+		}, nil},
+		"convert": {map[browser.Group]string{browser.AirTemperature: "K", browser.WindSpeed: "m/s"}, map[string]result{
+			"air_t_avg":      {"K", []float64{274.15, 275.15}},
+			"wind_speed_avg": {"m/s", []float64{10, 2}},
+		}, nil},
+		"same_unit": {map[browser.Group]string{browser.AirTemperature: "°C"}, map[string]result{
+			"air_t_avg":      {"°C", []float64{1, 2}},
+			"wind_speed_avg": {"km/h", []float64{36, 7.2}},
+		}, nil},
+		"unsupported": {map[browser.Group]string{browser.AirTemperature: "m/s"}, nil, browser.ErrUnsupportedConversion},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			filter := &browser.SeriesFilter{
+				Groups:   []browser.Group{browser.AirTemperature},
+				Stations: []string{"39"},
+				Start:    time.Date(2020, 5, 2, 5, 30, 0, 0, browser.Location),
+				End:      time.Date(2020, 5, 2, 0, 0, 0, 0, browser.Location),
+				Units:    tc.units,
+			}
+
+			ts, err := db.Series(context.Background(), filter)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+
+			got := make(map[string]result)
+			for _, m := range ts {
+				r := result{Unit: m.Unit}
+				for _, p := range m.Points {
+					r.Values = append(r.Values, p.Value)
+				}
+				got[m.Label] = r
+			}
+
+			diff := cmp.Diff(tc.want, got, cmp.Comparer(func(x, y float64) bool {
+				return math.Abs(x-y) < 1e-9
+			}))
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSeriesAliases(t *testing.T) {
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb", WithAliases(map[string]string{
+		"t_air": "air_t_avg",
+		"tair":  "air_t_avg",
+	}))
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+	c.QueryFn = queryFnTestHelper(t, "aliases.json")
+
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature},
+		Stations: []string{"39"},
+		Start:    time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+	}
+	got, err := db.Series(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
+
+	want := browser.TimeSeries{
+		&browser.Measurement{
+			Label:       "air_t_avg",
+			Aggregation: "avg",
+			Unit:        "deg_C",
+			Station: &browser.Station{
+				ID:        39,
+				Name:      "b1",
+				Landuse:   "me",
+				Elevation: 990,
+				Latitude:  46.6612188656,
+				Longitude: 10.5902491243,
+			},
+			Points: []*browser.Point{
+				{Timestamp: time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location), Value: 1.5},
+				{Timestamp: time.Date(2020, 5, 4, 0, 15, 0, 0, browser.Location), Value: 2.5},
+				{Timestamp: time.Date(2020, 5, 4, 0, 30, 0, 0, browser.Location), Value: 3.5},
+				{Timestamp: time.Date(2020, 5, 4, 0, 45, 0, 0, browser.Location), Value: 4.5},
+			},
+		},
+	}
+
+	diff := cmp.Diff(want, got)
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	testCases := map[string]struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		"empty":   {"", map[string]string{}, false},
+		"single":  {"t_air=air_t_avg", map[string]string{"t_air": "air_t_avg"}, false},
+		"multi":   {"t_air=air_t_avg, tair = air_t_avg", map[string]string{"t_air": "air_t_avg", "tair": "air_t_avg"}, false},
+		"missing": {"t_air", nil, true},
+		"empty_v": {"t_air=", nil, true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseAliases(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+
+			diff := cmp.Diff(tc.want, got)
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSeriesLimit(t *testing.T) {
+	defer func(n int64) { browser.MaxLimit = n }(browser.MaxLimit)
+	browser.MaxLimit = 100
+
+	var command string
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	multiple := queryFnTestHelper(t, "multiple.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		command = q.Command
+		return multiple(q)
+	}
+
+	testCases := map[string]struct {
+		limit int64
+		want  string
+	}{
+		"default":  {0, ""},
+		"limit":    {10, " LIMIT 10 "},
+		"exceeded": {1000, " LIMIT 100 "},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			command = ""
+			filter := &browser.SeriesFilter{
+				Groups:   []browser.Group{browser.AirTemperature},
+				Stations: []string{"39"},
+				Start:    time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+				End:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+				Limit:    tc.limit,
+			}
+			if _, err := db.Series(context.Background(), filter); err != nil {
+				t.Fatalf("Series returned an error: %v", err)
+			}
+
+			if tc.want == "" {
+				if strings.Contains(command, "LIMIT") {
+					t.Fatalf("query contains a LIMIT clause: %s", command)
+				}
+				return
+			}
+			if !strings.Contains(command, tc.want) {
+				t.Fatalf("query %q does not contain %q", command, tc.want)
+			}
+		})
+	}
+}
+
+func TestSeriesRetentionPolicy(t *testing.T) {
+	var command string
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	multiple := queryFnTestHelper(t, "multiple.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		command = q.Command
+		return multiple(q)
+	}
+
+	testCases := map[string]struct {
+		rp   string
+		want string
+	}{
+		"default":     {"", "FROM air_t_avg WHERE"},
+		"downsampled": {"downsampled", `FROM downsampled.air_t_avg WHERE`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			filter := &browser.SeriesFilter{
+				Groups:          []browser.Group{browser.AirTemperature},
+				Stations:        []string{"39"},
+				Start:           time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+				End:             time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+				RetentionPolicy: tc.rp,
+			}
+			if _, err := db.Series(context.Background(), filter); err != nil {
+				t.Fatalf("Series returned an error: %v", err)
+			}
+
+			if !strings.Contains(command, tc.want) {
+				t.Fatalf("query %q does not contain %q", command, tc.want)
+			}
+		})
+	}
+}
+
+func TestDenyList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny")
+	if err := ioutil.WriteFile(path, []byte("# broken sensor\nwind_speed_avg\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb", WithDenyList(path))
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	ctx := createContext(t, browser.FullAccess, true)
+	filter := &browser.SeriesFilter{
+		Groups:    []browser.Group{browser.Wind, browser.WindSpeed},
+		WithFlags: true,
+	}
+
+	want := []string{"wind_dir", "wind_dir_flag", "wind_speed", "wind_speed_flag", "wind_speed_max", "wind_speed_max_flag"}
+	if diff := cmp.Diff(want, db.Query(ctx, filter).Measurements); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"wind_speed_avg"}, db.DeniedMeasurements()); diff != "" {
+		t.Fatalf("denied measurements mismatch (-want +got):\n%s", diff)
+	}
+
+	// Removing the measurement from the file must show it again after a
+	// reload.
+	if err := ioutil.WriteFile(path, []byte("wind_dir\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.deny.load(); err != nil {
+		t.Fatalf("load returned an error: %v", err)
+	}
+
+	want = []string{"wind_speed", "wind_speed_avg", "wind_speed_avg_flag", "wind_speed_flag", "wind_speed_max", "wind_speed_max_flag"}
+	if diff := cmp.Diff(want, db.Query(ctx, filter).Measurements); diff != "" {
+		t.Fatalf("mismatch after reload (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"wind_dir"}, db.DeniedMeasurements()); diff != "" {
+		t.Fatalf("denied measurements mismatch after reload (-want +got):\n%s", diff)
+	}
+}
+
+func TestDenyListNewDBError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny")
+	if err := ioutil.WriteFile(path, []byte("wind_speed_avg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := runtime.NumGoroutine()
+	_, err := NewDB(&mock.InfluxClient{
+		QueryFn: func(q client.Query) (*client.Response, error) {
+			return nil, errors.New("unreachable")
+		},
+	}, "testdb", WithDenyList(path))
+	if err == nil {
+		t.Fatal("NewDB returned no error for an unreachable InfluxDB")
+	}
+
+	// The goroutine loading the cache exits right after returning the error.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d goroutines after NewDB failed, want at most %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestValidateDenyList(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		in       string
+		names    []string
+		problems []string
+	}{
+		"Empty": {"", []string{}, []string{}},
+		"Valid": {
+			"# broken sensors\nwind_speed_avg\n\nWIND_DIR\n",
+			[]string{"wind_speed_avg", "WIND_DIR"},
+			[]string{},
+		},
+		"Invalid": {
+			"wind_speed_avg\nwind speed\nwind_sped_avg\nwind_speed_avg\nair_t/avg\n",
+			[]string{"wind_speed_avg", "wind speed", "wind_sped_avg", "wind_speed_avg", "air_t/avg"},
+			[]string{
+				`line 2: invalid measurement name "wind speed"`,
+				`line 3: unknown measurement "wind_sped_avg"`,
+				`line 4: duplicate measurement "wind_speed_avg", first listed on line 1`,
+				`line 5: invalid measurement name "air_t/avg"`,
+			},
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			names, problems, err := db.ValidateDenyList(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatalf("ValidateDenyList returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tc.names, names); diff != "" {
+				t.Errorf("names mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.problems, problems); diff != "" {
+				t.Errorf("problems mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if got := db.DeniedMeasurements(); got != nil {
+		t.Errorf("validating applied the deny list: %v", got)
+	}
+}
+
+func TestStatsQueries(t *testing.T) {
+	stats := metrics.NewStats()
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb", WithStats(stats))
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	before := stats.Summary().InfluxQueries
+	if before == 0 {
+		t.Fatal("loading the cache was not counted")
+	}
+
+	if _, err := db.Cardinality(context.Background()); err != nil {
+		t.Fatalf("Cardinality returned an error: %v", err)
+	}
+	if got, want := stats.Summary().InfluxQueries, before+1; got != want {
+		t.Fatalf("got %d queries, want %d", got, want)
+	}
+}
+
+func TestCardinality(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	got, err := db.Cardinality(context.Background())
+	if err != nil {
+		t.Fatalf("Cardinality returned an error: %v", err)
+	}
+	if want := int64(42); got != want {
+		t.Fatalf("got cardinality %d, want %d", got, want)
+	}
+}
+
+func TestRefreshCache(t *testing.T) {
+	var queries int
+	queryFn := queryFnTestHelper(t, "")
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: func(q client.Query) (*client.Response, error) {
+			queries++
+			return queryFn(q)
+		},
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	before := queries
+	status, err := db.RefreshCache(context.Background())
+	if err != nil {
+		t.Fatalf("RefreshCache returned an error: %v", err)
+	}
+	if got, want := queries-before, 1; got != want {
+		t.Fatalf("got %d queries, want %d", got, want)
+	}
+	if !status.Ready || status.Stations == 0 || status.Measurements == 0 || status.Refreshed.IsZero() {
+		t.Fatalf("got unexpected cache status: %+v", status)
+	}
+	if diff := cmp.Diff(db.CacheStatus(), status); diff != "" {
+		t.Fatalf("status mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	testCases := map[string]struct {
+		tagKeys string
+		want    []string
+	}{
+		"complete":   {"tagkeys.json", nil},
+		"missingTag": {"tagkeys_missing.json", []string{"station", "landuse"}},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			queryFn := queryFnTestHelper(t, "")
+			db, err := NewDB(&mock.InfluxClient{
+				QueryFn: func(q client.Query) (*client.Response, error) {
+					if strings.HasPrefix(strings.ToLower(q.Command), "show tag keys") {
+						return queryFnTestHelper(t, tc.tagKeys)(client.Query{})
+					}
+					return queryFn(q)
+				},
+			}, "testdb")
+			if err != nil {
+				t.Fatalf("NewDB returned an error: %v", err)
+			}
+
+			got, err := db.CheckSchema(context.Background())
+			if err != nil {
+				t.Fatalf("CheckSchema returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("missing keys mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWindSpeedGroup(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		ctx     context.Context
+		groups  []browser.Group
+		withSTD bool
+		want    []string
+	}{
+		"public":               {createContext(t, browser.Public, true), []browser.Group{browser.WindSpeed}, false, []string{"wind_speed_avg"}},
+		"public_std":           {createContext(t, browser.Public, true), []browser.Group{browser.WindSpeed}, true, []string{"wind_speed_avg"}},
+		"public_with_max":      {createContext(t, browser.Public, true), []browser.Group{browser.WindSpeed, browser.WindSpeedMax}, false, []string{"wind_speed_avg", "wind_speed_max"}},
+		"fullaccess":           {createContext(t, browser.FullAccess, true), []browser.Group{browser.WindSpeed}, false, []string{"wind_speed", "wind_speed_avg"}},
+		"fullaccess_std":       {createContext(t, browser.FullAccess, true), []browser.Group{browser.WindSpeed}, true, []string{"wind_speed", "wind_speed_avg", "wind_speed_std"}},
+		"fullaccess_with_wind": {createContext(t, browser.FullAccess, true), []browser.Group{browser.Wind, browser.WindSpeed}, false, []string{"wind_dir", "wind_speed", "wind_speed_avg", "wind_speed_max"}},
+		"fullaccess_with_max":  {createContext(t, browser.FullAccess, true), []browser.Group{browser.WindSpeed, browser.WindSpeedMax}, false, []string{"wind_speed", "wind_speed_avg", "wind_speed_max"}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := db.parseMeasurements(tc.ctx, &browser.SeriesFilter{Groups: tc.groups, WithSTD: tc.withSTD})
+
+			diff := cmp.Diff(tc.want, got)
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestQuerySTD(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		ctx     context.Context
+		withSTD bool
+		want    []string
+	}{
+		"fullaccess":     {createContext(t, browser.FullAccess, true), false, []string{"air_t_avg", "snow_air_t"}},
+		"fullaccess_std": {createContext(t, browser.FullAccess, true), true, []string{"air_t_avg", "air_t_std", "snow_air_t", "snow_air_t_std"}},
+		"public_std":     {createContext(t, browser.Public, false), true, []string{"air_t_avg"}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			stmt := db.Query(tc.ctx, &browser.SeriesFilter{
+				Groups:   []browser.Group{browser.AirTemperature},
+				Stations: []string{"1"},
+				WithSTD:  tc.withSTD,
+			})
+
+			if diff := cmp.Diff(tc.want, stmt.Measurements); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+			for _, m := range tc.want {
+				if !strings.Contains(stmt.Query, m) {
+					t.Errorf("query %q does not select %s", stmt.Query, m)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSingleMeasurements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny")
+	if err := ioutil.WriteFile(path, []byte("air_rh_avg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb", WithDenyList(path))
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		ctx    context.Context
+		filter *browser.SeriesFilter
+		want   []string
+	}{
+		"only_measurements": {
+			createContext(t, browser.FullAccess, true),
+			&browser.SeriesFilter{Measurements: []string{"air_t_avg", "wind_speed_std"}},
+			[]string{"air_t_avg", "wind_speed_std"},
+		},
+		"groups_and_measurements": {
+			createContext(t, browser.FullAccess, true),
+			&browser.SeriesFilter{Groups: []browser.Group{browser.WindSpeed}, Measurements: []string{"air_t_avg", "wind_speed_avg", "air_t_avg"}},
+			[]string{"air_t_avg", "wind_speed", "wind_speed_avg"},
+		},
+		"with_flags": {
+			createContext(t, browser.FullAccess, true),
+			&browser.SeriesFilter{Measurements: []string{"air_t_avg"}, WithFlags: true},
+			[]string{"air_t_avg", "air_t_avg" + browser.FlagSuffix},
+		},
+		"unknown": {
+			createContext(t, browser.FullAccess, true),
+			&browser.SeriesFilter{Measurements: []string{"RECORD", "snipeit_location_ref"}},
+			nil,
+		},
+		"denied": {
+			createContext(t, browser.FullAccess, true),
+			&browser.SeriesFilter{Measurements: []string{"air_rh_avg"}},
+			nil,
+		},
+		"public": {
+			createContext(t, browser.Public, false),
+			&browser.SeriesFilter{Groups: []browser.Group{browser.WindSpeed}, Measurements: []string{"air_t_avg", "wind_speed", "wind_speed_std"}},
+			[]string{"air_t_avg", "wind_speed_avg"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := db.parseMeasurements(tc.ctx, tc.filter)
+
+			diff := cmp.Diff(tc.want, got)
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSoilSurfaceTemperatureGroup(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		ctx     context.Context
+		station int64
+		present bool
+	}{
+		"public":     {createContext(t, browser.Public, false), 11, false},
+		"external":   {createContext(t, browser.External, true), 11, true},
+		"fullaccess": {createContext(t, browser.FullAccess, true), 39, true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			groups, err := db.GroupsByStation(tc.ctx, tc.station)
+			if err != nil {
+				t.Fatalf("GroupsByStation returned an error: %v", err)
+			}
+
+			var got bool
+			for _, g := range groups {
+				got = got || g == browser.SoilSurfaceTemperature
+			}
+			if got != tc.present {
+				t.Fatalf("soil surface temperature in groups of station %d: got %v, want %v", tc.station, got, tc.present)
+			}
+		})
+	}
+
+	t.Run("measurements", func(t *testing.T) {
+		ctx := createContext(t, browser.FullAccess, true)
+		got := db.parseMeasurements(ctx, &browser.SeriesFilter{Groups: []browser.Group{browser.SoilSurfaceTemperature}, WithSTD: true})
+
+		want := []string{"soil_surf_t_avg", "soil_surf_t_std"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestQueryOverlappingGroups(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	filter := &browser.SeriesFilter{
+		Groups:      []browser.Group{browser.Wind, browser.WindSpeed, browser.WindSpeedMax},
+		Stations:    []string{"39"},
+		Maintenance: []string{"Batt_V_Avg", "batt_v_avg", "BATT_V_AVG"},
+	}
+	got := db.Query(createContext(t, browser.FullAccess, true), filter).Measurements
+	if len(got) == 0 {
+		t.Fatal("Query returned no measurements")
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range got {
+		if seen[m] {
+			t.Errorf("measurement %q is selected multiple times: %v", m, got)
+		}
+		seen[m] = true
+	}
+	if !seen["batt_v_avg"] {
+		t.Errorf("maintenance measurement batt_v_avg is not selected: %v", got)
+	}
+}
+
+func TestSeriesSameStationName(t *testing.T) {
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+	c.QueryFn = queryFnTestHelper(t, "samename.json")
+
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature},
+		Stations: []string{"1", "2"},
+		Start:    time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+	}
+	ts, err := db.Series(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("Series returned an error: %v", err)
+	}
+
+	var ids []int64
+	for _, m := range ts {
+		ids = append(ids, m.Station.ID)
+	}
+	if diff := cmp.Diff([]int64{1, 2}, ids); diff != "" {
+		t.Fatalf("station ID mismatch (-want +got):\n%s", diff)
+	}
+
+	// Stations sharing a name are written as separate rows after the header
+	// and the units.
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).Write(ts); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if got, want := len(lines), 2+4; got != want {
+		t.Errorf("got %d lines, want %d:\n%s", got, want, buf.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, "multiple.json"),
+	}, "testdb", WithRegistry(reg))
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	ctx := context.Background()
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature},
+		Stations: []string{"39"},
+		Start:    time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+		End:      time.Date(2020, 5, 4, 0, 0, 0, 0, browser.Location),
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := db.Series(ctx, filter); err != nil {
+			t.Fatalf("Series returned an error: %v", err)
+		}
+	}
+	db.Query(ctx, filter)
+
+	ts := httptest.NewServer(reg.Handler())
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatalf("GET returned error %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`browser_influx_duration_seconds_count{method="series"} 3`,
+		`browser_influx_duration_seconds_count{method="query"} 1`,
+		`browser_influx_cache_refreshes_total 1`,
+		`browser_influx_query_errors_total 0`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+}
+
+func TestSeriesEmptyCache(t *testing.T) {
+	// Every query, including the one loading the cache, returns an empty
+	// result as on a fresh deployment.
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: func(q client.Query) (*client.Response, error) {
+			f, err := os.Open(filepath.Join("testdata", "empty.json"))
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+
+			var resp *client.Response
+			if err := json.NewDecoder(f).Decode(&resp); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		},
+	}, "testdb")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	filter := &browser.SeriesFilter{
+		Groups:   []browser.Group{browser.AirTemperature},
+		Stations: []string{"39"},
+	}
+
+	_, err = db.Series(context.Background(), filter)
+	if !errors.Is(err, browser.ErrCatalogNotPopulated) {
+		t.Fatalf("got error %v, want %v", err, browser.ErrCatalogNotPopulated)
+	}
+}
+
+func TestReady(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		db, err := NewDB(&mock.InfluxClient{
+			QueryFn: func(q client.Query) (*client.Response, error) {
+				f, err := os.Open(filepath.Join("testdata", "empty.json"))
+				if err != nil {
+					return nil, err
+				}
+				defer f.Close()
+
+				var resp *client.Response
+				if err := json.NewDecoder(f).Decode(&resp); err != nil {
+					return nil, err
+				}
+				return resp, nil
+			},
+		}, "testdb")
+		if err != nil {
+			t.Fatalf("NewDB returned an error: %v", err)
+		}
+
+		if !db.Ready() {
+			t.Fatal("Ready returned false after the empty cache has been loaded")
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		defer func(d time.Duration) { CacheLoadTimeout = d }(CacheLoadTimeout)
+		CacheLoadTimeout = 10 * time.Millisecond
+
+		unblock := make(chan struct{})
+		populated := queryFnTestHelper(t, "")
+		db, err := NewDB(&mock.InfluxClient{
+			QueryFn: func(q client.Query) (*client.Response, error) {
+				<-unblock
+				return populated(q)
+			},
+		}, "testdb")
+		if err != nil {
+			t.Fatalf("NewDB returned an error: %v", err)
+		}
+
+		if db.Ready() {
+			t.Fatal("Ready returned true before the cache has been loaded")
+		}
+
+		close(unblock)
+		deadline := time.Now().Add(time.Second)
+		for !db.Ready() {
+			if time.Now().After(deadline) {
+				t.Fatal("Ready returned false after the cache has been loaded")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if db.cacheEmpty() {
+			t.Fatal("cache is empty after loading")
+		}
+	})
+}
+
+func TestGroupsByStation(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "test")
+	if err != nil {
+		t.Fatalf("TestQuery: error in NewDB: %v", err)
+	}
+
+	t.Run("notfound", func(t *testing.T) {
+		ctx := context.Background()
+		_, err := db.GroupsByStation(ctx, 8888)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("public", func(t *testing.T) {
+		want := []browser.Group{
+			browser.RelativeHumidity,
+			browser.AirTemperature,
+			browser.ShortWaveRadiationOutgoing,
+			browser.PrecipitationTotal,
+			browser.SnowHeight,
+			browser.WindDirection,
+			browser.WindSpeed,
+			browser.WindSpeedMax,
+		}
+
+		// Test with user public user embedded in the ctx.
+		ctx := createContext(t, browser.Public, false)
+		got, err := db.GroupsByStation(ctx, 6)
+		if err != nil {
+			t.Fatal("got error")
+		}
+
+		diff := cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+
+		// Test with general context.
+		ctx = context.Background()
+		got, err = db.GroupsByStation(ctx, 6)
+		if err != nil {
+			t.Fatal("got error")
+		}
+
+		diff = cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("fullaccess", func(t *testing.T) {
+		want := []browser.Group{
+			browser.RelativeHumidity,
+			browser.AirTemperature,
+			browser.NDVIRadiations,
+			browser.LongWaveRadiation,
+			browser.ShortWaveRadiation,
+			browser.PhotosyntheticallyActiveRadiation,
+			browser.PRIRadiations,
+			browser.SoilHeatFlux,
+			browser.SnowHeight,
+			browser.SunshineDuration,
+			browser.SoilDielectricPermittivity,
+			browser.SoilElectricalConductivity,
+			browser.SoilTemperature,
+			browser.SoilWaterContent,
+			browser.SoilWaterPotential,
+			browser.Wind,
+		}
+
+		ctx := createContext(t, browser.FullAccess, true)
+		got, err := db.GroupsByStation(ctx, 3)
+		if err != nil {
+			t.Fatal("got error")
+		}
+
+		diff := cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("custompublic", func(t *testing.T) {
+		db, err := NewDB(&mock.InfluxClient{
+			QueryFn: queryFnTestHelper(t, ""),
+		}, "test", WithPublicGroups([]browser.Group{
+			browser.AirTemperature,
+			browser.LeafWetnessDuration,
+			browser.SunshineDuration,
+		}))
+		if err != nil {
+			t.Fatalf("NewDB returned an error: %v", err)
+		}
+
+		want := []browser.Group{
+			browser.AirTemperature,
+			browser.SunshineDuration,
+		}
+
+		ctx := createContext(t, browser.Public, false)
+		got, err := db.GroupsByStation(ctx, 3)
+		if err != nil {
+			t.Fatal("got error")
+		}
+
+		diff := cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestPublicGroups(t *testing.T) {
+	groups := []browser.Group{
+		browser.AirTemperature,
+		browser.RelativeHumidity,
+		browser.LeafWetnessDuration,
+		browser.SunshineDuration,
+	}
+
+	testCases := map[string]struct {
+		options []Option
+		role    browser.Role
+		want    []string
+	}{
+		"default": {nil, browser.Public, []string{"air_rh_avg", "air_t_avg"}},
+		"custom": {
+			[]Option{WithPublicGroups([]browser.Group{browser.AirTemperature, browser.LeafWetnessDuration, browser.SunshineDuration})},
+			browser.Public,
+			[]string{"air_t_avg", "lwm_con_tot", "lwm_dry_tot", "lwm_wet_tot", "sun_count_tot"},
+		},
+		"fullaccess": {
+			[]Option{WithPublicGroups([]browser.Group{browser.SunshineDuration})},
+			browser.FullAccess,
+			[]string{"air_rh", "air_rh_avg", "air_t_avg", "lwm_con_tot", "lwm_dry_tot", "lwm_wet_tot", "snow_air_t", "sun_count_tot"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db, err := NewDB(&mock.InfluxClient{
+				QueryFn: queryFnTestHelper(t, ""),
+			}, "testdb", tc.options...)
+			if err != nil {
+				t.Fatalf("NewDB returned an error: %v", err)
+			}
+
+			got := db.parseMeasurements(createContext(t, tc.role, true), &browser.SeriesFilter{Groups: groups})
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestPublicMeasurements checks that the measurements public users may access
+// are part of their group.
+func TestPublicMeasurements(t *testing.T) {
+	for g, labels := range publicMeasurements {
+		for _, l := range labels {
+			if !groupRegexpMap[g].MatchString(l) {
+				t.Errorf("%s is not a measurement of group %s", l, g)
+			}
+		}
+	}
+}
+
+func TestAggregationsByStation(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "test")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	t.Run("notfound", func(t *testing.T) {
+		_, err := db.AggregationsByStation(context.Background(), 8888)
+		if !errors.Is(err, browser.ErrGroupsNotFound) {
+			t.Fatalf("got error %v, want %v", err, browser.ErrGroupsNotFound)
+		}
+	})
+
+	t.Run("public", func(t *testing.T) {
+		want := map[browser.Group][]string{
+			browser.WindSpeed:    {"avg"},
+			browser.WindSpeedMax: {"max"},
+		}
+
+		got, err := db.AggregationsByStation(createContext(t, browser.Public, false), 6)
+		if err != nil {
+			t.Fatalf("AggregationsByStation returned an error: %v", err)
+		}
+
+		diff := cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("fullaccess", func(t *testing.T) {
+		want := map[browser.Group][]string{
+			browser.Wind: {"avg", "max", "std"},
+		}
+
+		got, err := db.AggregationsByStation(createContext(t, browser.FullAccess, true), 6)
+		if err != nil {
+			t.Fatalf("AggregationsByStation returned an error: %v", err)
+		}
+
+		diff := cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func testPoint(t *testing.T, s string, value float64) *browser.Point {
+	t.Helper()
+
+	ts, err := time.ParseInLocation(time.RFC3339, s, browser.Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &browser.Point{
+		Timestamp: ts,
+		Value:     value,
+	}
+}
+
+func queryFnTestHelper(t *testing.T, filename string) func(q client.Query) (*client.Response, error) {
+	t.Helper()
+
+	return func(q client.Query) (*client.Response, error) {
+		inQuery := strings.ToLower(q.Command)
+
+		switch {
+		case strings.HasPrefix(inQuery, "show measurements"):
+			filename = "measurements.json"
+		case strings.HasPrefix(inQuery, "show tag keys"):
+			filename = "tagkeys.json"
+		case strings.HasPrefix(inQuery, "show field keys"):
+			filename = "fieldkeys.json"
+		case strings.HasPrefix(inQuery, "show tag"):
+			filename = "tags.json"
+		case strings.HasPrefix(inQuery, "show series cardinality"):
+			filename = "cardinality.json"
+		}
+
+		f, err := os.Open(filepath.Join("testdata", filename))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		dec := json.NewDecoder(f)
+		dec.UseNumber()
+
+		var resp *client.Response
+		if err := dec.Decode(&resp); err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	}
+}
+
+// createContext returns a new context with an browser.User embedded with the
+// given role and license.
 func createContext(t *testing.T, role browser.Role, lic bool) context.Context {
 	t.Helper()
 
@@ -450,3 +2191,315 @@ func createContext(t *testing.T, role browser.Role, lic bool) context.Context {
 	}
 	return context.WithValue(context.Background(), browser.UserContextKey, u)
 }
+
+func TestUnitsByStation(t *testing.T) {
+	db, err := NewDB(&mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}, "test")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	t.Run("notfound", func(t *testing.T) {
+		_, err := db.UnitsByStation(context.Background(), 8888)
+		if !errors.Is(err, browser.ErrGroupsNotFound) {
+			t.Fatalf("got error %v, want %v", err, browser.ErrGroupsNotFound)
+		}
+	})
+
+	t.Run("public", func(t *testing.T) {
+		want := map[browser.Group][]string{
+			browser.Wind:          {"deg", "m/s"},
+			browser.WindSpeed:     {"m/s"},
+			browser.WindSpeedMax:  {"m/s"},
+			browser.WindDirection: {"deg"},
+		}
+
+		got, err := db.UnitsByStation(createContext(t, browser.Public, false), 6)
+		if err != nil {
+			t.Fatalf("UnitsByStation returned an error: %v", err)
+		}
+
+		diff := cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("fullaccess", func(t *testing.T) {
+		want := map[browser.Group][]string{
+			browser.Wind:          {"deg", "m/s"},
+			browser.WindSpeed:     {"m/s"},
+			browser.WindSpeedMax:  {"m/s"},
+			browser.WindDirection: {"deg"},
+		}
+
+		got, err := db.UnitsByStation(createContext(t, browser.FullAccess, true), 6)
+		if err != nil {
+			t.Fatalf("UnitsByStation returned an error: %v", err)
+		}
+
+		diff := cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestLatest(t *testing.T) {
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "test")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	var queries []string
+	helper := queryFnTestHelper(t, "latest.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		queries = append(queries, q.Command)
+		return helper(q)
+	}
+
+	t.Run("nostation", func(t *testing.T) {
+		_, err := db.Latest(context.Background(), &browser.SeriesFilter{
+			Groups: []browser.Group{browser.AirTemperature},
+		})
+		if !errors.Is(err, browser.ErrDataNotFound) {
+			t.Fatalf("got error %v, want %v", err, browser.ErrDataNotFound)
+		}
+	})
+
+	t.Run("latest", func(t *testing.T) {
+		queries = nil
+
+		got, err := db.Latest(createContext(t, browser.FullAccess, true), &browser.SeriesFilter{
+			Groups:   []browser.Group{browser.AirTemperature},
+			Stations: []string{"39", "6"},
+			Start:    time.Date(2020, 1, 1, 0, 0, 0, 0, browser.Location),
+			End:      time.Date(2020, 1, 1, 0, 0, 0, 0, browser.Location),
+		})
+		if err != nil {
+			t.Fatalf("Latest returned an error: %v", err)
+		}
+
+		wantQuery := "SELECT air_t_avg, altitude as elevation, latitude, longitude, depth FROM air_t_avg WHERE (snipeit_location_ref='39' OR snipeit_location_ref='6') GROUP BY station,snipeit_location_ref,landuse,unit,aggr ORDER BY time DESC LIMIT 1 TZ('Etc/GMT-1');" +
+			"SELECT snow_air_t, altitude as elevation, latitude, longitude, depth FROM snow_air_t WHERE (snipeit_location_ref='39' OR snipeit_location_ref='6') GROUP BY station,snipeit_location_ref,landuse,unit,aggr ORDER BY time DESC LIMIT 1 TZ('Etc/GMT-1');"
+		if diff := cmp.Diff([]string{wantQuery}, queries); diff != "" {
+			t.Fatalf("query mismatch (-want +got):\n%s", diff)
+		}
+
+		want := browser.TimeSeries{
+			{
+				Label:       "air_t_avg",
+				Aggregation: "avg",
+				Unit:        "deg c",
+				Station: &browser.Station{
+					ID:        39,
+					Name:      "b1",
+					Landuse:   "me",
+					Elevation: 990,
+					Latitude:  46.6612188656,
+					Longitude: 10.5902491243,
+				},
+				Points: []*browser.Point{testPoint(t, "2020-05-04T12:45:00+01:00", 18.5)},
+			},
+			{
+				Label:       "air_t_avg",
+				Aggregation: "avg",
+				Unit:        "deg c",
+				Station: &browser.Station{
+					ID:        6,
+					Name:      "p2",
+					Landuse:   "pa",
+					Elevation: 1540,
+					Latitude:  46.6863,
+					Longitude: 10.5799,
+				},
+				Points: []*browser.Point{testPoint(t, "2020-05-04T12:30:00+01:00", 12.1)},
+			},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestCoverage(t *testing.T) {
+	c := &mock.InfluxClient{
+		QueryFn: queryFnTestHelper(t, ""),
+	}
+	db, err := NewDB(c, "test")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+
+	var queries []string
+	helper := queryFnTestHelper(t, "coverage.json")
+	c.QueryFn = func(q client.Query) (*client.Response, error) {
+		queries = append(queries, q.Command)
+		return helper(q)
+	}
+
+	t.Run("nostation", func(t *testing.T) {
+		_, err := db.Coverage(context.Background(), &browser.SeriesFilter{
+			Groups: []browser.Group{browser.AirTemperature},
+		})
+		if !errors.Is(err, browser.ErrDataNotFound) {
+			t.Fatalf("got error %v, want %v", err, browser.ErrDataNotFound)
+		}
+	})
+
+	const where = "WHERE (snipeit_location_ref='39' OR snipeit_location_ref='6')"
+	statements := func(timeRange string) string {
+		var q string
+		for _, m := range []string{"air_t_avg", "snow_air_t"} {
+			for _, fn := range []string{"count", "first", "last"} {
+				q += "SELECT " + fn + "(" + m + ") FROM " + m + " " + where + timeRange + " GROUP BY station,snipeit_location_ref TZ('Etc/GMT-1');"
+			}
+		}
+		return q
+	}
+
+	testCases := map[string]struct {
+		start, end time.Time
+		query      string
+	}{
+		"alltime": {query: statements("")},
+		"range": {
+			start: time.Date(2019, 1, 1, 0, 0, 0, 0, browser.Location),
+			end:   time.Date(2020, 12, 31, 0, 0, 0, 0, browser.Location),
+			query: statements(" AND time >= '2018-12-31T23:00:00Z' AND time <= '2020-12-31T22:59:59Z'"),
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			queries = nil
+
+			got, err := db.Coverage(createContext(t, browser.FullAccess, true), &browser.SeriesFilter{
+				Groups:   []browser.Group{browser.AirTemperature},
+				Stations: []string{"39", "6"},
+				Start:    tc.start,
+				End:      tc.end,
+			})
+			if err != nil {
+				t.Fatalf("Coverage returned an error: %v", err)
+			}
+
+			if diff := cmp.Diff([]string{tc.query}, queries); diff != "" {
+				t.Fatalf("query mismatch (-want +got):\n%s", diff)
+			}
+
+			want := []browser.Coverage{
+				{
+					Label:   "air_t_avg",
+					Station: &browser.Station{ID: 39, Name: "b1"},
+					First:   testPoint(t, "2019-01-01T00:15:00+01:00", 0).Timestamp,
+					Last:    testPoint(t, "2020-01-01T00:00:00+01:00", 0).Timestamp,
+					Points:  35040,
+				},
+				{
+					Label:   "air_t_avg",
+					Station: &browser.Station{ID: 6, Name: "p2"},
+					First:   testPoint(t, "2020-05-03T13:00:00+01:00", 0).Timestamp,
+					Last:    testPoint(t, "2020-05-04T12:30:00+01:00", 0).Timestamp,
+					Points:  96,
+				},
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGroupMeasurementRegex(t *testing.T) {
+	labels := []string{
+		"air_t_avg", "air_rh_avg", "st_05_avg", "swc_wc_05_avg", "swc_ec_05_avg",
+		"wind_speed", "wind_speed_avg", "wind_speed_max", "wind_dir",
+		"precip_rt_nrt_tot", "snow_height", "par_soil_avg",
+		"soil_surf_t_avg", "soil_surf_t0_avg", "soil_surf_t_mv_avg", "soil_surf_body_t_avg",
+	}
+
+	testCases := map[string]struct {
+		group     browser.Group
+		wantQuery string
+		want      []string
+	}{
+		"AirTemperature":             {browser.AirTemperature, "SHOW MEASUREMENTS WITH MEASUREMENT =~ /air_t/", []string{"air_t_avg"}},
+		"SoilTemperatureDepth05":     {browser.SoilTemperatureDepth05, "SHOW MEASUREMENTS WITH MEASUREMENT =~ /st_(.*_)?05_.*$/", []string{"st_05_avg"}},
+		"SoilElectricalConductivity": {browser.SoilElectricalConductivity, "SHOW MEASUREMENTS WITH MEASUREMENT =~ /^swc_ec_.*$/", []string{"swc_ec_05_avg"}},
+		"WindSpeed":                  {browser.WindSpeed, "SHOW MEASUREMENTS WITH MEASUREMENT =~ /^wind_speed$|wind_speed.*_(avg|std)$/", []string{"wind_speed", "wind_speed_avg"}},
+		"WindSpeedMax":               {browser.WindSpeedMax, "SHOW MEASUREMENTS WITH MEASUREMENT =~ /^wind_speed.*_max$/", []string{"wind_speed_max"}},
+		"Wind":                       {browser.Wind, "SHOW MEASUREMENTS WITH MEASUREMENT =~ /^wind.*$/", []string{"wind_speed", "wind_speed_avg", "wind_speed_max", "wind_dir"}},
+		"PrecipitationTotal":         {browser.PrecipitationTotal, "SHOW MEASUREMENTS WITH MEASUREMENT =~ /^precip.*(_tot).*$/", []string{"precip_rt_nrt_tot"}},
+		"SoilSurfaceTemperature":     {browser.SoilSurfaceTemperature, "SHOW MEASUREMENTS WITH MEASUREMENT =~ /surf_t\\d*(_(avg|std|min|max))?$/", []string{"soil_surf_t_avg", "soil_surf_t0_avg"}},
+		"NoGroup":                    {browser.NoGroup, "SHOW MEASUREMENTS", nil},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			regex := tc.group.MeasurementRegex()
+
+			query, _ := ql.ShowMeasurement().With(ql.MATCH, regex).Query()
+			if query != tc.wantQuery {
+				t.Errorf("got query %q, want %q", query, tc.wantQuery)
+			}
+
+			if regex == "" {
+				return
+			}
+
+			re := regexp.MustCompile(regex)
+			var got []string
+			for _, l := range labels {
+				if re.MatchString(l) {
+					got = append(got, l)
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// Every group has a regular expression.
+	for g := browser.AirTemperature; g < browser.NoGroup; g++ {
+		if _, ok := groupRegexpMap[g]; !ok {
+			t.Errorf("no regular expression for group %v", g)
+		}
+	}
+}
+
+func TestDepthGroups(t *testing.T) {
+	// Labels of measurements of each group with depth sub groups, NN is
+	// replaced by the depth.
+	labels := map[browser.Group][]string{
+		browser.SoilTemperature:            {"st_NN_avg", "st_b_NN_std", "swc_st_NN_avg"},
+		browser.SoilWaterContent:           {"swc_bk_NN_avg", "swc_a_NN_std"},
+		browser.SoilElectricalConductivity: {"swc_ec_NN_avg", "swc_ec_NN_1_avg", "swc_ec_a_NN_std"},
+		browser.SoilDielectricPermittivity: {"swc_dp_NN_avg", "swc_dp_NN_1_avg", "swc_dp_a_NN_std"},
+		browser.SoilWaterPotential:         {"swp_bk_NN_avg", "swp_ci_NN_std"},
+	}
+	depths := []string{"00", "02", "05", "10", "20", "40", "50", "100", "105"}
+
+	for parent, templates := range labels {
+		for _, g := range parent.SubGroups() {
+			depth := strings.TrimSuffix(g.String(), " cm")
+			if len(depth) == 1 {
+				depth = "0" + depth
+			}
+
+			for _, d := range depths {
+				for _, tmpl := range templates {
+					label := strings.Replace(tmpl, "NN", d, 1)
+					if got, want := groupRegexpMap[g].MatchString(label), d == depth; got != want {
+						t.Errorf("%s %s: match of %q: got %v, want %v", parent, g, label, got, want)
+					}
+				}
+			}
+		}
+	}
+}
@@ -4,16 +4,20 @@
 
 package influx
 
-// publicAllowed is the list of allowed measurements for the public role.
-var publicAllowed = []string{
-	"air_t_avg",
-	"air_rh_avg",
-	"wind_dir",
-	"wind_speed_avg",
-	"wind_speed_max",
-	"nr_up_sw_avg",
-	"precip_rt_nrt_tot",
-	"snow_height",
+import "github.com/euracresearch/browser"
+
+// publicMeasurements maps public groups to the only measurements of the group
+// the public role is allowed to access. All measurements are allowed of public
+// groups not present.
+var publicMeasurements = map[browser.Group][]string{
+	browser.AirTemperature:             {"air_t_avg"},
+	browser.RelativeHumidity:           {"air_rh_avg"},
+	browser.WindDirection:              {"wind_dir"},
+	browser.WindSpeed:                  {"wind_speed_avg"},
+	browser.WindSpeedMax:               {"wind_speed_max"},
+	browser.ShortWaveRadiationOutgoing: {"nr_up_sw_avg"},
+	browser.PrecipitationTotal:         {"precip_rt_nrt_tot"},
+	browser.SnowHeight:                 {"snow_height"},
 }
 
 // maintenace is a list of measurement names only intressting for technicians.
@@ -0,0 +1,39 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"time"
+
+	"github.com/euracresearch/browser/internal/metrics"
+)
+
+// dbMetrics holds the metrics collected by DB.
+type dbMetrics struct {
+	seriesDuration *metrics.Histogram
+	queryDuration  *metrics.Histogram
+	queryErrors    *metrics.Counter
+	cacheRefreshes *metrics.Counter
+	cachedStations *metrics.Gauge
+	cachedGroups   *metrics.Gauge
+}
+
+func newDBMetrics(r *metrics.Registry) *dbMetrics {
+	const durationHelp = "Duration of database calls in seconds."
+
+	return &dbMetrics{
+		seriesDuration: r.Histogram("browser_influx_duration_seconds", durationHelp, metrics.Labels{"method": "series"}),
+		queryDuration:  r.Histogram("browser_influx_duration_seconds", durationHelp, metrics.Labels{"method": "query"}),
+		queryErrors:    r.Counter("browser_influx_query_errors_total", "Total number of failed InfluxDB queries.", nil),
+		cacheRefreshes: r.Counter("browser_influx_cache_refreshes_total", "Total number of successful cache refreshes.", nil),
+		cachedStations: r.Gauge("browser_influx_cached_stations", "Number of stations in the cache.", nil),
+		cachedGroups:   r.Gauge("browser_influx_cached_groups", "Number of groups in the cache.", nil),
+	}
+}
+
+// observeSince records the duration since start in the given histogram.
+func observeSince(h *metrics.Histogram, start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
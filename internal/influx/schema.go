@@ -0,0 +1,60 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"context"
+
+	"github.com/euracresearch/browser/internal/ql"
+)
+
+// ExpectedKeys are the tag and field keys the queries of DB rely on besides the
+// field holding the values of a measurement.
+var ExpectedKeys = []string{
+	"snipeit_location_ref",
+	"station",
+	"landuse",
+	"unit",
+	"aggr",
+	"altitude",
+	"latitude",
+	"longitude",
+	"depth",
+}
+
+// CheckSchema returns the ExpectedKeys which exist in the database neither as
+// tag nor as field key of any measurement. A misconfigured database, e.g. one
+// written by another importer, is therefore detected before queries silently
+// return no data.
+func (db *DB) CheckSchema(ctx context.Context) ([]string, error) {
+	found := make(map[string]bool)
+	for _, q := range []ql.Querier{ql.ShowTagKeys(), ql.ShowFieldKeys()} {
+		resp, err := db.exec(q)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range resp.Results {
+			for _, series := range result.Series {
+				for _, value := range series.Values {
+					if len(value) == 0 {
+						continue
+					}
+					key, _ := value[0].(string)
+					found[key] = true
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for _, key := range ExpectedKeys {
+		if !found[key] {
+			missing = append(missing, key)
+		}
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,318 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package metrics provides counters, gauges and histograms which can be
+// exposed in the Prometheus text format.
+//
+// It implements only the small subset of the Prometheus client needed by the
+// application, so no external dependency is required. For the format see:
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default histogram buckets in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultRegistry is the registry used if no other registry is given.
+var DefaultRegistry = NewRegistry()
+
+// Labels are constant label names and values attached to a metric.
+type Labels map[string]string
+
+// String returns the labels in the Prometheus format sorted by name, e.g.
+// {a="b",c="d"}. Empty labels will return an empty string.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for n := range l {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", n, l[n])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// with returns a copy of the labels with the given label added.
+func (l Labels) with(name, value string) Labels {
+	c := make(Labels, len(l)+1)
+	for k, v := range l {
+		c[k] = v
+	}
+	c[name] = value
+	return c
+}
+
+// metric is implemented by all metric types.
+type metric interface {
+	write(w io.Writer, name string, labels Labels)
+}
+
+// family groups all metrics with the same name.
+type family struct {
+	name    string
+	help    string
+	typ     string
+	metrics map[string]metric // keyed by the labels string
+	labels  map[string]Labels
+}
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu       sync.Mutex // guards families
+	families map[string]*family
+}
+
+// NewRegistry returns a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+// register returns the metric registered with the given name and labels. If
+// it does not exist yet it will be created with fn.
+func (r *Registry) register(name, help, typ string, labels Labels, fn func() metric) metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{
+			name:    name,
+			help:    help,
+			typ:     typ,
+			metrics: make(map[string]metric),
+			labels:  make(map[string]Labels),
+		}
+		r.families[name] = f
+	}
+
+	if f.typ != typ {
+		panic(fmt.Sprintf("metrics: %q already registered as %s", name, f.typ))
+	}
+
+	key := labels.String()
+	m, ok := f.metrics[key]
+	if !ok {
+		m = fn()
+		f.metrics[key] = m
+		f.labels[key] = labels
+	}
+	return m
+}
+
+// Counter returns the counter with the given name and labels, creating it if
+// necessary.
+func (r *Registry) Counter(name, help string, labels Labels) *Counter {
+	return r.register(name, help, "counter", labels, func() metric { return new(Counter) }).(*Counter)
+}
+
+// Gauge returns the gauge with the given name and labels, creating it if
+// necessary.
+func (r *Registry) Gauge(name, help string, labels Labels) *Gauge {
+	return r.register(name, help, "gauge", labels, func() metric { return new(Gauge) }).(*Gauge)
+}
+
+// Histogram returns the histogram with the given name and labels, creating it
+// with the given buckets if necessary. If no buckets are given DefaultBuckets
+// will be used.
+func (r *Registry) Histogram(name, help string, labels Labels, buckets ...float64) *Histogram {
+	return r.register(name, help, "histogram", labels, func() metric { return newHistogram(buckets) }).(*Histogram)
+}
+
+// WriteTo writes all registered metrics in the Prometheus text format to w.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	names := make([]string, 0, len(r.families))
+	for n := range r.families {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := r.families[n]
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+
+		keys := make([]string, 0, len(f.metrics))
+		for k := range f.metrics {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			f.metrics[k].write(bw, f.name, f.labels[k])
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler returns a HTTP handler serving all registered metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := r.WriteTo(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Counter is a metric which value can only increase.
+type Counter struct {
+	mu sync.Mutex
+	v  float64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds the given value to the counter. Negative values are ignored.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.v += v
+	c.mu.Unlock()
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v
+}
+
+func (c *Counter) write(w io.Writer, name string, labels Labels) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(c.Value()))
+}
+
+// Gauge is a metric which value can go up and down.
+type Gauge struct {
+	mu sync.Mutex
+	v  float64
+}
+
+// Set sets the gauge to the given value.
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.v = v
+	g.mu.Unlock()
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.v
+}
+
+func (g *Gauge) write(w io.Writer, name string, labels Labels) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(g.Value()))
+}
+
+// Histogram counts observations in configurable buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+
+	return &Histogram{
+		buckets: b,
+		counts:  make([]uint64, len(b)),
+	}
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the total number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(w io.Writer, name string, labels Labels) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels.with("le", formatFloat(upper)), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels.with("le", "+Inf"), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
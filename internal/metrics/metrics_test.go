@@ -0,0 +1,64 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.Counter("test_total", "A test counter.", nil)
+	c.Inc()
+	c.Add(2)
+	c.Add(-1)
+
+	// Registering the same name and labels returns the same metric.
+	if got := r.Counter("test_total", "A test counter.", nil); got != c {
+		t.Fatal("expected the already registered counter")
+	}
+
+	r.Gauge("test_gauge", "A test gauge.", Labels{"kind": "b"}).Set(2)
+	r.Gauge("test_gauge", "A test gauge.", Labels{"kind": "a"}).Set(1.5)
+
+	h := r.Histogram("test_seconds", "A test histogram.", Labels{"method": "m"}, 0.1, 1)
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	want := `# HELP test_gauge A test gauge.
+# TYPE test_gauge gauge
+test_gauge{kind="a"} 1.5
+test_gauge{kind="b"} 2
+# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1",method="m"} 1
+test_seconds_bucket{le="1",method="m"} 2
+test_seconds_bucket{le="+Inf",method="m"} 3
+test_seconds_sum{method="m"} 5.55
+test_seconds_count{method="m"} 3
+# HELP test_total A test counter.
+# TYPE test_total counter
+test_total 3
+`
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo returned an error: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("WriteTo returned %d bytes, wrote %d", n, buf.Len())
+	}
+
+	diff := cmp.Diff(want, buf.String())
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
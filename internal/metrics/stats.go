@@ -0,0 +1,129 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MaxStatsEndpoints is the maximum number of endpoints tracked by Stats.
+// Requests to further endpoints are counted as OtherEndpoint, so that
+// requests to arbitrary paths cannot grow the summary without bound.
+const MaxStatsEndpoints = 100
+
+// OtherEndpoint is the endpoint of requests not tracked on their own.
+const OtherEndpoint = "other"
+
+// DefaultStats is the summary used if no other summary is given.
+var DefaultStats = NewStats()
+
+// Stats is a lightweight summary of the requests per endpoint and the number
+// of InfluxDB queries since it has been created. It is safe for concurrent
+// use.
+type Stats struct {
+	mu        sync.Mutex
+	start     time.Time
+	endpoints map[string]*endpointStats
+	queries   uint64
+}
+
+type endpointStats struct {
+	count   uint64
+	latency time.Duration
+}
+
+// NewStats returns a new empty summary.
+func NewStats() *Stats {
+	return &Stats{
+		start:     time.Now(),
+		endpoints: make(map[string]*endpointStats),
+	}
+}
+
+// ObserveRequest records a request to the given path, which took d. Numeric
+// path segments are replaced by {id}, so that e.g. all stations share the
+// endpoint /api/v1/stations/{id}.
+func (s *Stats) ObserveRequest(path string, d time.Duration) {
+	endpoint := Endpoint(path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.endpoints[endpoint]
+	if !ok {
+		if len(s.endpoints) >= MaxStatsEndpoints {
+			endpoint = OtherEndpoint
+			e = s.endpoints[endpoint]
+		}
+		if e == nil {
+			e = new(endpointStats)
+			s.endpoints[endpoint] = e
+		}
+	}
+	e.count++
+	e.latency += d
+}
+
+// IncQueries increments the number of InfluxDB queries by one.
+func (s *Stats) IncQueries() {
+	s.mu.Lock()
+	s.queries++
+	s.mu.Unlock()
+}
+
+// EndpointSummary summarizes the requests of a single endpoint.
+type EndpointSummary struct {
+	Endpoint string `json:"endpoint"`
+	Requests uint64 `json:"requests"`
+	// AvgLatency is the average duration of the requests in milliseconds.
+	AvgLatency float64 `json:"avgLatencyMs"`
+}
+
+// Summary is a point in time copy of Stats.
+type Summary struct {
+	Since         time.Time         `json:"since"`
+	Requests      uint64            `json:"requests"`
+	Endpoints     []EndpointSummary `json:"endpoints"`
+	InfluxQueries uint64            `json:"influxQueries"`
+}
+
+// Summary returns the current summary with the endpoints ordered by name.
+func (s *Stats) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sum := Summary{
+		Since:         s.start,
+		Endpoints:     make([]EndpointSummary, 0, len(s.endpoints)),
+		InfluxQueries: s.queries,
+	}
+	for name, e := range s.endpoints {
+		sum.Requests += e.count
+		sum.Endpoints = append(sum.Endpoints, EndpointSummary{
+			Endpoint:   name,
+			Requests:   e.count,
+			AvgLatency: float64(e.latency) / float64(e.count) / float64(time.Millisecond),
+		})
+	}
+	sort.Slice(sum.Endpoints, func(i, j int) bool { return sum.Endpoints[i].Endpoint < sum.Endpoints[j].Endpoint })
+
+	return sum
+}
+
+// Endpoint returns the endpoint of the given path with numeric segments
+// replaced by {id}, e.g. /api/v1/stations/{id} for /api/v1/stations/12.
+func Endpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStats(t *testing.T) {
+	s := NewStats()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.ObserveRequest("/api/v1/series", 10*time.Millisecond)
+			s.ObserveRequest("/api/v1/series", 30*time.Millisecond)
+			s.IncQueries()
+		}()
+	}
+	wg.Wait()
+
+	s.ObserveRequest("/api/v1/stations/12", time.Millisecond)
+	s.ObserveRequest("/api/v1/stations/13/groups", 3*time.Millisecond)
+
+	got := s.Summary()
+	if got.Since.IsZero() {
+		t.Fatal("got zero start time")
+	}
+
+	want := Summary{
+		Since:    got.Since,
+		Requests: 22,
+		Endpoints: []EndpointSummary{
+			{"/api/v1/series", 20, 20},
+			{"/api/v1/stations/{id}", 1, 1},
+			{"/api/v1/stations/{id}/groups", 1, 3},
+		},
+		InfluxQueries: 10,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStatsMaxEndpoints(t *testing.T) {
+	s := NewStats()
+	for i := 0; i < MaxStatsEndpoints+5; i++ {
+		s.ObserveRequest(fmt.Sprintf("/page%d", i), time.Millisecond)
+	}
+	s.ObserveRequest("/page0", time.Millisecond)
+
+	sum := s.Summary()
+	if got, want := len(sum.Endpoints), MaxStatsEndpoints+1; got != want {
+		t.Fatalf("got %d endpoints, want %d", got, want)
+	}
+	for _, e := range sum.Endpoints {
+		switch e.Endpoint {
+		case OtherEndpoint:
+			if e.Requests != 5 {
+				t.Fatalf("got %d other requests, want 5", e.Requests)
+			}
+		case "/page0":
+			if e.Requests != 2 {
+				t.Fatalf("got %d requests of a tracked endpoint, want 2", e.Requests)
+			}
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	testCases := map[string]string{
+		"/":                      "/",
+		"/api/v1/series":         "/api/v1/series",
+		"/api/v1/stations/1":     "/api/v1/stations/{id}",
+		"/api/v1/stations/1/":    "/api/v1/stations/{id}/",
+		"/api/v1/stations/1a":    "/api/v1/stations/1a",
+		"/api/v1/stations/2/ids": "/api/v1/stations/{id}/ids",
+	}
+
+	for in, want := range testCases {
+		if got := Endpoint(in); got != want {
+			t.Errorf("Endpoint(%q): got %q, want %q", in, got, want)
+		}
+	}
+}
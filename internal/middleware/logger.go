@@ -0,0 +1,112 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/metrics"
+)
+
+// Logger is a HTTP middleware writing one structured line for each request to
+// out. The line contains the method, path, status code, response size,
+// duration and the role of the authenticated user.
+func Logger(out io.Writer) Middleware {
+	return LoggerWithStats(out, nil)
+}
+
+// LoggerWithStats is a Logger which additionally records the path and duration
+// of each request in the given summary. A nil summary records nothing.
+func LoggerWithStats(out io.Writer, stats *metrics.Stats) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			lrw := &loggingResponseWriter{ResponseWriter: w}
+			h.ServeHTTP(lrw, r)
+
+			duration := time.Since(start)
+			if stats != nil {
+				stats.ObserveRequest(r.URL.Path, duration)
+			}
+
+			user := browser.UserFromContext(r.Context())
+			_, err := fmt.Fprintf(out, "time=%s method=%s path=%q status=%d size=%d duration=%s role=%s\n",
+				start.Format(time.RFC3339),
+				r.Method,
+				r.URL.Path,
+				lrw.statusCode(),
+				lrw.size,
+				duration,
+				user.Role,
+			)
+			if err != nil {
+				log.Printf("Logger, writing: %v", err)
+			}
+		})
+	}
+}
+
+// loggingResponseWriter is an http.ResponseWriter that records the status code
+// and the number of bytes written.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (l *loggingResponseWriter) WriteHeader(code int) {
+	if l.status == 0 {
+		l.status = code
+	}
+	l.ResponseWriter.WriteHeader(code)
+}
+
+func (l *loggingResponseWriter) Write(b []byte) (int, error) {
+	if l.status == 0 {
+		l.status = http.StatusOK
+	}
+	n, err := l.ResponseWriter.Write(b)
+	l.size += n
+	return n, err
+}
+
+// Hijack lets the caller take over the connection, e.g. for WebSockets. The
+// status code is recorded as http.StatusSwitchingProtocols.
+func (l *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := l.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("logger: response writer does not support hijacking")
+	}
+	if l.status == 0 {
+		l.status = http.StatusSwitchingProtocols
+	}
+	return hj.Hijack()
+}
+
+// Flush sends any buffered data to the client, if supported by the underlying
+// http.ResponseWriter.
+func (l *loggingResponseWriter) Flush() {
+	if f, ok := l.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// statusCode returns the recorded status code. If nothing has been written the
+// default status code http.StatusOK is assumed.
+func (l *loggingResponseWriter) statusCode() int {
+	if l.status == 0 {
+		return http.StatusOK
+	}
+	return l.status
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/metrics"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLogger(t *testing.T) {
+	const testBody = "You are not expected to understand this."
+
+	testCases := map[string]struct {
+		handler http.HandlerFunc
+		ctx     context.Context
+		want    []string
+	}{
+		"created": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, testBody)
+			},
+			ctx:  context.Background(),
+			want: []string{"method=GET", `path="/test"`, "status=201", fmt.Sprintf("size=%d", len(testBody)), "role=Public"},
+		},
+		"implicit ok": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, testBody)
+			},
+			ctx:  context.WithValue(context.Background(), browser.UserContextKey, &browser.User{Role: browser.FullAccess}),
+			want: []string{"status=200", fmt.Sprintf("size=%d", len(testBody)), "role=FullAccess"},
+		},
+		"not found": {
+			handler: http.NotFound,
+			ctx:     context.Background(),
+			want:    []string{"status=404", "size=19"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			Logger(&buf)(tc.handler).ServeHTTP(w, req)
+
+			line := buf.String()
+			if strings.Count(line, "\n") != 1 {
+				t.Fatalf("expected a single line, got %q", line)
+			}
+
+			for _, want := range tc.want {
+				if !strings.Contains(line, want) {
+					t.Errorf("log line %q does not contain %q", line, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerWithStats(t *testing.T) {
+	stats := metrics.NewStats()
+	h := LoggerWithStats(ioutil.Discard, stats)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, path := range []string{"/api/v1/series", "/api/v1/stations/1", "/api/v1/stations/2"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	var got []string
+	for _, e := range stats.Summary().Endpoints {
+		got = append(got, fmt.Sprintf("%s=%d", e.Endpoint, e.Requests))
+	}
+	want := []string{"/api/v1/series=1", "/api/v1/stations/{id}=2"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
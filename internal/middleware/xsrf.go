@@ -5,9 +5,13 @@
 package middleware
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/euracresearch/browser"
 	"golang.org/x/net/xsrftoken"
@@ -19,7 +23,9 @@ import (
 const XSRFTokenPlaceholder = "$$XSRFTOKEN$$"
 
 // XSRFProtect is a HTTP middlware adding XSRF/CSRF token protection for
-// non-safe HTTP Methods.
+// non-safe HTTP Methods. Only HTML responses can contain the placeholder and
+// are buffered for substituting it, other responses, e.g. downloads, are
+// written to the client directly.
 func XSRFProtect(key string) Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -32,6 +38,9 @@ func XSRFProtect(key string) Middleware {
 
 			crw := &capturingResponseWriter{ResponseWriter: w}
 			h.ServeHTTP(crw, r)
+			if crw.hijacked || crw.passThrough {
+				return
+			}
 			body := bytes.ReplaceAll(crw.bytes(), []byte(XSRFTokenPlaceholder), []byte(xsrftoken.Generate(key, "", "")))
 			if _, err := w.Write(body); err != nil {
 				log.Printf("XSRFProtect, writing: %v", err)
@@ -40,17 +49,60 @@ func XSRFProtect(key string) Middleware {
 	}
 }
 
-// capturingResponseWriter is an http.ResponseWriter that captures the body for
-// later processing.
+// capturingResponseWriter is an http.ResponseWriter that captures the body of
+// HTML responses for later processing.
 type capturingResponseWriter struct {
 	http.ResponseWriter
-	buf bytes.Buffer
+	buf      bytes.Buffer
+	hijacked bool
+
+	// decided is set once the content type of the response has been checked
+	// on the first write.
+	decided bool
+
+	// passThrough is set if the body is written to the underlying
+	// http.ResponseWriter instead of being captured.
+	passThrough bool
 }
 
 func (c *capturingResponseWriter) Write(b []byte) (int, error) {
+	if !c.decided {
+		c.decided = true
+		ct := c.Header().Get("Content-Type")
+		c.passThrough = ct != "" && !strings.HasPrefix(ct, "text/html")
+	}
+	if c.passThrough {
+		return c.ResponseWriter.Write(b)
+	}
 	return c.buf.Write(b)
 }
 
+// Flush sends any buffered data of responses written directly to the client,
+// if supported by the underlying http.ResponseWriter. Captured bodies are
+// written once the handler returns.
+func (c *capturingResponseWriter) Flush() {
+	if !c.passThrough {
+		return
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, e.g. for WebSockets.
+// Nothing captured is written afterwards.
+func (c *capturingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("xsrf: response writer does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		c.hijacked = true
+	}
+	return conn, rw, err
+}
+
 func (c *capturingResponseWriter) bytes() []byte {
 	return c.buf.Bytes()
 }
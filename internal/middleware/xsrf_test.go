@@ -70,3 +70,29 @@ func TestXSRFProtect(t *testing.T) {
 	}
 
 }
+
+func TestXSRFProtectPassThrough(t *testing.T) {
+	const body = "time,station\n"
+
+	rec := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		fmt.Fprint(w, body)
+		w.(http.Flusher).Flush()
+
+		// The body must reach the client before the handler returns.
+		if got := rec.Body.String(); got != body {
+			t.Errorf("got body %q before the handler returned, want %q", got, body)
+		}
+		if !rec.Flushed {
+			t.Error("response was not flushed")
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	XSRFProtect("key")(handler).ServeHTTP(rec, req)
+
+	if got := rec.Body.String(); got != body {
+		t.Errorf("got body %q, want %q", got, body)
+	}
+}
@@ -9,6 +9,7 @@ package mock
 import (
 	"context"
 	"errors"
+	"io"
 	"time"
 
 	"github.com/euracresearch/browser"
@@ -19,9 +20,15 @@ import (
 type InfluxClient struct {
 	QueryFn func(q client.Query) (*client.Response, error)
 	WriteFn func(bp client.BatchPoints) error
+
+	// PingFn is optional. If not set Ping will always succeed.
+	PingFn func(timeout time.Duration) (time.Duration, string, error)
 }
 
 func (c *InfluxClient) Ping(timeout time.Duration) (time.Duration, string, error) {
+	if c.PingFn != nil {
+		return c.PingFn(timeout)
+	}
 	return (1 * time.Second), "Pong", nil
 }
 
@@ -47,16 +54,203 @@ func (c *InfluxClient) Query(q client.Query) (*client.Response, error) {
 	return c.QueryFn(q)
 }
 
+// Guarantee we implement browser.Database.
+var _ browser.Database = &Database{}
+
 // Database represents a mock implementation of browser.Database.
 type Database struct {
-	QueryFn  func(ctx context.Context, m *browser.SeriesFilter) *browser.Stmt
-	SeriesFn func() (browser.TimeSeries, error)
+	SeriesFn                func() (browser.TimeSeries, error)
+	GroupsByStationFn       func(ctx context.Context, id int64) ([]browser.Group, error)
+	AggregationsByStationFn func(ctx context.Context, id int64) (map[browser.Group][]string, error)
+	UnitsByStationFn        func(ctx context.Context, id int64) (map[browser.Group][]string, error)
+	MaintenanceFn           func(ctx context.Context) ([]string, error)
+	PingFn                  func(ctx context.Context) error
+
+	// ReadyFn is optional. If not set Ready will always return true.
+	ReadyFn func() bool
+
+	// DeniedMeasurementsFn is optional. If not set DeniedMeasurements returns
+	// nil.
+	DeniedMeasurementsFn func() []string
+
+	// ValidateDenyListFn is optional. If not set ValidateDenyList returns no
+	// names and no problems.
+	ValidateDenyListFn func(r io.Reader) ([]string, []string, error)
+
+	// RefreshCacheFn is optional. If not set RefreshCache returns a ready
+	// status.
+	RefreshCacheFn func(ctx context.Context) (browser.CacheStatus, error)
+
+	// LatestFn is optional. If not set Latest returns the result of SeriesFn.
+	LatestFn func(ctx context.Context, m *browser.SeriesFilter) (browser.TimeSeries, error)
+
+	// CoverageFn is optional. If not set Coverage returns
+	// browser.ErrDataNotFound.
+	CoverageFn func(ctx context.Context, m *browser.SeriesFilter) ([]browser.Coverage, error)
+
+	// QueryFn is optional. If not set Query returns an empty statement.
+	QueryFn func(ctx context.Context, m *browser.SeriesFilter) *browser.Stmt
+
+	// SeriesStreamFn is optional. If not set SeriesStream iterates over the
+	// result of SeriesFn.
+	SeriesStreamFn func(ctx context.Context, m *browser.SeriesFilter) (browser.MeasurementIterator, error)
 }
 
 func (db *Database) Series(ctx context.Context, m *browser.SeriesFilter) (browser.TimeSeries, error) {
 	return db.SeriesFn()
 }
 
+func (db *Database) Latest(ctx context.Context, m *browser.SeriesFilter) (browser.TimeSeries, error) {
+	if db.LatestFn != nil {
+		return db.LatestFn(ctx, m)
+	}
+	return db.SeriesFn()
+}
+
+func (db *Database) Coverage(ctx context.Context, m *browser.SeriesFilter) ([]browser.Coverage, error) {
+	if db.CoverageFn != nil {
+		return db.CoverageFn(ctx, m)
+	}
+	return nil, browser.ErrDataNotFound
+}
+
+func (db *Database) SeriesStream(ctx context.Context, m *browser.SeriesFilter) (browser.MeasurementIterator, error) {
+	if db.SeriesStreamFn != nil {
+		return db.SeriesStreamFn(ctx, m)
+	}
+
+	ts, err := db.SeriesFn()
+	if err != nil {
+		return nil, err
+	}
+	return browser.NewMeasurementIterator(ts), nil
+}
+
 func (db *Database) Query(ctx context.Context, m *browser.SeriesFilter) *browser.Stmt {
+	if db.QueryFn == nil {
+		return &browser.Stmt{}
+	}
 	return db.QueryFn(ctx, m)
 }
+
+func (db *Database) GroupsByStation(ctx context.Context, id int64) ([]browser.Group, error) {
+	return db.GroupsByStationFn(ctx, id)
+}
+
+func (db *Database) AggregationsByStation(ctx context.Context, id int64) (map[browser.Group][]string, error) {
+	return db.AggregationsByStationFn(ctx, id)
+}
+
+func (db *Database) UnitsByStation(ctx context.Context, id int64) (map[browser.Group][]string, error) {
+	return db.UnitsByStationFn(ctx, id)
+}
+
+func (db *Database) Maintenance(ctx context.Context) ([]string, error) {
+	return db.MaintenanceFn(ctx)
+}
+
+func (db *Database) Ping(ctx context.Context) error {
+	return db.PingFn(ctx)
+}
+
+func (db *Database) Ready() bool {
+	if db.ReadyFn != nil {
+		return db.ReadyFn()
+	}
+	return true
+}
+
+func (db *Database) DeniedMeasurements() []string {
+	if db.DeniedMeasurementsFn != nil {
+		return db.DeniedMeasurementsFn()
+	}
+	return nil
+}
+
+func (db *Database) ValidateDenyList(r io.Reader) ([]string, []string, error) {
+	if db.ValidateDenyListFn != nil {
+		return db.ValidateDenyListFn(r)
+	}
+	return []string{}, []string{}, nil
+}
+
+func (db *Database) RefreshCache(ctx context.Context) (browser.CacheStatus, error) {
+	if db.RefreshCacheFn != nil {
+		return db.RefreshCacheFn(ctx)
+	}
+	return browser.CacheStatus{Ready: true}, nil
+}
+
+// Guarantee we implement browser.StationService.
+var _ browser.StationService = &StationService{}
+
+// StationService represents a mock implementation of browser.StationService.
+type StationService struct {
+	StationFn  func(ctx context.Context, id int64) (*browser.Station, error)
+	StationsFn func(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error)
+	SensorsFn  func(ctx context.Context, id int64) ([]*browser.Sensor, error)
+	NearestFn  func(ctx context.Context, lat, lon float64) (*browser.Station, float64, error)
+	LandusesFn func(ctx context.Context) ([]string, error)
+	PingFn     func(ctx context.Context) error
+
+	// ReadyFn is optional. If not set Ready will always return true.
+	ReadyFn func() bool
+}
+
+func (s *StationService) Station(ctx context.Context, id int64) (*browser.Station, error) {
+	return s.StationFn(ctx, id)
+}
+
+func (s *StationService) Stations(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+	return s.StationsFn(ctx, filter)
+}
+
+func (s *StationService) Sensors(ctx context.Context, id int64) ([]*browser.Sensor, error) {
+	return s.SensorsFn(ctx, id)
+}
+
+func (s *StationService) Nearest(ctx context.Context, lat, lon float64) (*browser.Station, float64, error) {
+	return s.NearestFn(ctx, lat, lon)
+}
+
+func (s *StationService) Landuses(ctx context.Context) ([]string, error) {
+	return s.LandusesFn(ctx)
+}
+
+func (s *StationService) Ping(ctx context.Context) error {
+	return s.PingFn(ctx)
+}
+
+func (s *StationService) Ready() bool {
+	if s.ReadyFn != nil {
+		return s.ReadyFn()
+	}
+	return true
+}
+
+// Guarantee we implement browser.UserService.
+var _ browser.UserService = &UserService{}
+
+// UserService represents a mock implementation of browser.UserService.
+type UserService struct {
+	GetFn    func(ctx context.Context, u *browser.User) (*browser.User, error)
+	CreateFn func(ctx context.Context, u *browser.User) error
+	DeleteFn func(ctx context.Context, u *browser.User) error
+	UpdateFn func(ctx context.Context, u *browser.User) error
+}
+
+func (s *UserService) Get(ctx context.Context, u *browser.User) (*browser.User, error) {
+	return s.GetFn(ctx, u)
+}
+
+func (s *UserService) Create(ctx context.Context, u *browser.User) error {
+	return s.CreateFn(ctx, u)
+}
+
+func (s *UserService) Delete(ctx context.Context, u *browser.User) error {
+	return s.DeleteFn(ctx, u)
+}
+
+func (s *UserService) Update(ctx context.Context, u *browser.User) error {
+	return s.UpdateFn(ctx, u)
+}
@@ -18,7 +18,7 @@ import (
 )
 
 const (
-	// DefaultCookieName is the name of the stored cookie
+	// DefaultCookieName is the default name of the stored cookie
 	DefaultCookieName = "browser_lter_session"
 
 	// DefaultLifespan is the duration a token and cookie is valid
@@ -42,6 +42,17 @@ type Cookie struct {
 	Secret string
 	// Cookie used for storing JWT token in a secure manner.
 	Cookie *securecookie.SecureCookie
+	// Name of the stored cookie. If empty DefaultCookieName is used.
+	// Instances sharing a domain need distinct names.
+	Name string
+}
+
+// name returns the name of the stored cookie.
+func (c *Cookie) name() string {
+	if c.Name == "" {
+		return DefaultCookieName
+	}
+	return c.Name
 }
 
 func (c *Cookie) Authorize(ctx context.Context, w http.ResponseWriter, u *browser.User) error {
@@ -54,13 +65,13 @@ func (c *Cookie) Authorize(ctx context.Context, w http.ResponseWriter, u *browse
 		return err
 	}
 
-	encoded, err := c.Cookie.Encode(DefaultCookieName, token)
+	encoded, err := c.Cookie.Encode(c.name(), token)
 	if err != nil {
 		return err
 	}
 
 	http.SetCookie(w, &http.Cookie{
-		Name:    DefaultCookieName,
+		Name:    c.name(),
 		Value:   encoded,
 		Path:    "/",
 		Expires: time.Now().Add(DefaultLifespan),
@@ -71,7 +82,7 @@ func (c *Cookie) Authorize(ctx context.Context, w http.ResponseWriter, u *browse
 
 func (c *Cookie) Expire(w http.ResponseWriter) {
 	cookie := &http.Cookie{
-		Name:    DefaultCookieName,
+		Name:    c.name(),
 		Value:   "none",
 		Path:    "/",
 		Expires: time.Now().Add(-1 * time.Hour),
@@ -81,15 +92,16 @@ func (c *Cookie) Expire(w http.ResponseWriter) {
 }
 
 // Validate validates the JWT token stored in the cookie and return the user
-// information. It will not validate the user against the user service.
+// information. It will not validate the user against the user service, see
+// Handler.RevalidateInterval.
 func (c *Cookie) Validate(ctx context.Context, r *http.Request) (*browser.User, error) {
-	cookie, err := r.Cookie(DefaultCookieName)
+	cookie, err := r.Cookie(c.name())
 	if err != nil {
 		return nil, err
 	}
 
 	var value string
-	if err := c.Cookie.Decode(DefaultCookieName, cookie.Value, &value); err != nil {
+	if err := c.Cookie.Decode(c.name(), cookie.Value, &value); err != nil {
 		return nil, err
 	}
 
@@ -206,3 +206,50 @@ func TestValidatePartialUser(t *testing.T) {
 		t.Fatalf("Validate() mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestCookieName(t *testing.T) {
+	in := &browser.User{
+		Name: "test",
+		Role: browser.FullAccess,
+	}
+
+	c := &Cookie{
+		Secret: "testsecret",
+		Cookie: securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)),
+		Name:   "other_session",
+	}
+
+	w := httptest.NewRecorder()
+	if err := c.Authorize(context.Background(), w, in); err != nil {
+		t.Fatalf("Authorize: returned error: %v", err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != c.Name {
+		t.Fatalf("expected a single cookie named %s, got %v", c.Name, cookies)
+	}
+
+	req, _ := http.NewRequest("", "https://browser.lter.eurac.edu", nil)
+	req.AddCookie(cookies[0])
+
+	got, err := c.Validate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Validate: returned error: %v", err)
+	}
+	if diff := cmp.Diff(in, got); diff != "" {
+		t.Fatalf("Validate() mismatch (-want +got):\n%s", diff)
+	}
+
+	// A cookie of another instance using the default name is ignored.
+	req, _ = http.NewRequest("", "https://browser.lter.eurac.edu", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: cookies[0].Value})
+	if _, err := c.Validate(context.Background(), req); !errors.Is(err, http.ErrNoCookie) {
+		t.Fatalf("expected error %v, got %v", http.ErrNoCookie, err)
+	}
+
+	w = httptest.NewRecorder()
+	c.Expire(w)
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != c.Name {
+		t.Fatalf("expected the expired cookie named %s, got %v", c.Name, cookies)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/coreos/go-oidc"
 	"github.com/euracresearch/browser"
@@ -48,10 +50,28 @@ type Handler struct {
 	Auth  Authenticator
 	Users browser.UserService
 
+	// RevalidateInterval is the interval in which the user of a session is
+	// checked against Users. Sessions of users which no longer exist are
+	// expired, so that they must authenticate again. If zero, which is the
+	// default, sessions are not checked unless RefreshRole is set and remain
+	// valid until they expire.
+	RevalidateInterval time.Duration
+
+	// RefreshRole enables propagating role changes without signing in again.
+	// If the role stored in Users differs from the one of the session, the
+	// stored user is used and the session is issued again. The user is looked
+	// up every RevalidateInterval or, if zero, on every request.
+	RefreshRole bool
+
 	mux *http.ServeMux
+
+	mu        sync.Mutex
+	validated map[string]time.Time // last check by provider and email
 }
 
-// Register registers all the routes for the given provider.
+// Register registers all the routes for the given provider. Providers without
+// client ID or secret are not configured and are skipped, so that no broken
+// login routes are served.
 func (h *Handler) Register(p Provider) {
 	if h.mux == nil {
 		h.mux = http.NewServeMux()
@@ -59,9 +79,17 @@ func (h *Handler) Register(p Provider) {
 		//h.mux.HandleFunc("/auth/account/cancel", h.cancel())
 	}
 
-	h.mux.HandleFunc("/auth/"+p.Name()+"/login", h.login(p.Config()))
+	config := p.Config()
+	if config.ClientID == "" || config.ClientSecret == "" {
+		log.Printf("oauth2(%s): no client ID or secret, provider disabled", p.Name())
+		return
+	}
+
+	h.mux.HandleFunc("/auth/"+p.Name()+"/login", h.login(config))
 	h.mux.HandleFunc("/auth/"+p.Name()+"/callback", h.callback(p))
 	h.mux.HandleFunc("/auth/"+p.Name()+"/logout", h.logout())
+
+	log.Printf("oauth2(%s): provider enabled", p.Name())
 }
 
 func (h *Handler) login(config *oauth2.Config) http.HandlerFunc {
@@ -70,8 +98,16 @@ func (h *Handler) login(config *oauth2.Config) http.HandlerFunc {
 	}
 }
 
+// logout expires the session of the user. Only POST requests are accepted, so
+// that the XSRF token of the form is checked and other sites cannot log users
+// out, e.g. by embedding the route as image.
 func (h *Handler) logout() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Expected POST request", http.StatusMethodNotAllowed)
+			return
+		}
+
 		h.Auth.Expire(w)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 	}
@@ -194,6 +230,57 @@ func (h *Handler) license() http.HandlerFunc {
 //  }
 //}
 
+// revalidate checks the user of a session against Users at most once every
+// RevalidateInterval. It reports whether the user still exists and returns
+// the user of the session, which is the stored user if RefreshRole is set and
+// the role has changed. If the user cannot be retrieved for other reasons the
+// session is kept, so that an unavailable user store does not sign out all
+// users.
+func (h *Handler) revalidate(ctx context.Context, u *browser.User) (*browser.User, bool) {
+	if h.RevalidateInterval <= 0 && !h.RefreshRole {
+		return u, true
+	}
+
+	key := u.Provider + ":" + u.Email
+	now := time.Now()
+
+	h.mu.Lock()
+	last, ok := h.validated[key]
+	h.mu.Unlock()
+	if ok && now.Sub(last) < h.RevalidateInterval {
+		return u, true
+	}
+
+	stored, err := h.Users.Get(ctx, u)
+	if errors.Is(err, browser.ErrUserNotFound) {
+		h.mu.Lock()
+		delete(h.validated, key)
+		h.mu.Unlock()
+
+		log.Printf("oauth2: user %s of %s no longer exists, session expired", u.Email, u.Provider)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("oauth2: error revalidating user %s of %s: %v", u.Email, u.Provider, err)
+		return u, true
+	}
+
+	if h.RevalidateInterval > 0 {
+		h.mu.Lock()
+		if h.validated == nil {
+			h.validated = make(map[string]time.Time)
+		}
+		h.validated[key] = now
+		h.mu.Unlock()
+	}
+
+	if h.RefreshRole && stored.Role != u.Role {
+		log.Printf("oauth2: role of user %s of %s changed from %s to %s", u.Email, u.Provider, u.Role, stored.Role)
+		return stored, true
+	}
+	return u, true
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -205,11 +292,31 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		current, ok := h.revalidate(ctx, u)
+		if !ok {
+			h.Auth.Expire(w)
+			h.Next.ServeHTTP(w, r)
+			return
+		}
+
+		// Issue the session again, so that the changed user is kept for
+		// the following requests.
+		if current != u {
+			if err := h.Auth.Authorize(ctx, w, current); err != nil {
+				log.Printf("oauth2: error in authorizing user: %v", err)
+			}
+			u = current
+		}
+
 		// Attach user information to the context of the request
 		ctx = context.WithValue(ctx, browser.UserContextKey, u)
 		h.Next.ServeHTTP(w, r.WithContext(ctx))
 
 	case strings.HasPrefix(r.URL.Path, "/auth"):
+		if h.mux == nil {
+			http.NotFound(w, r)
+			return
+		}
 		h.mux.ServeHTTP(w, r)
 	}
 
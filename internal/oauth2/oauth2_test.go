@@ -0,0 +1,341 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/euracresearch/browser"
+	"github.com/euracresearch/browser/internal/middleware"
+	"github.com/euracresearch/browser/internal/mock"
+	"github.com/gorilla/securecookie"
+	"golang.org/x/net/xsrftoken"
+	"golang.org/x/oauth2"
+)
+
+// testProvider is a Provider with the given credentials.
+type testProvider struct {
+	clientID, secret string
+}
+
+func (p *testProvider) Name() string {
+	return "test"
+}
+
+func (p *testProvider) Config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.secret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  "https://example.com/authorize",
+			TokenURL: "https://example.com/token",
+		},
+	}
+}
+
+func (p *testProvider) User(ctx context.Context, token *oauth2.Token) (*browser.User, error) {
+	return &browser.User{}, nil
+}
+
+func TestRegister(t *testing.T) {
+	testCases := map[string]struct {
+		provider *testProvider
+		enabled  bool
+	}{
+		"Configured":    {&testProvider{"id", "secret"}, true},
+		"NoCredentials": {&testProvider{}, false},
+		"NoClientID":    {&testProvider{"", "secret"}, false},
+		"NoSecret":      {&testProvider{"id", ""}, false},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := &Handler{State: "state"}
+			h.Register(tc.provider)
+
+			for _, route := range []string{"/auth/test/login", "/auth/test/callback", "/auth/test/logout"} {
+				_, pattern := h.mux.Handler(httptest.NewRequest(http.MethodGet, route, nil))
+				if got := pattern == route; got != tc.enabled {
+					t.Errorf("route %q registered: got %t, want %t", route, got, tc.enabled)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/test/login", nil))
+			resp := w.Result()
+
+			if !tc.enabled {
+				if got, want := resp.StatusCode, http.StatusNotFound; got != want {
+					t.Fatalf("got unexpected status code: %d, want %d", got, want)
+				}
+				return
+			}
+			if got, want := resp.StatusCode, http.StatusTemporaryRedirect; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if got := resp.Header.Get("Location"); !strings.HasPrefix(got, "https://example.com/authorize?") {
+				t.Fatalf("got redirect to %q, want the authorization URL of the provider", got)
+			}
+		})
+	}
+}
+
+func TestServeHTTPWithoutProviders(t *testing.T) {
+	h := &Handler{}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/github/login", nil))
+
+	if got, want := w.Result().StatusCode, http.StatusNotFound; got != want {
+		t.Fatalf("got unexpected status code: %d, want %d", got, want)
+	}
+}
+
+// testAuthenticator records whether the session has been expired.
+type testAuthenticator struct {
+	Cookie
+	expired bool
+}
+
+func (a *testAuthenticator) Expire(w http.ResponseWriter) {
+	a.expired = true
+	a.Cookie.Expire(w)
+}
+
+func TestLogout(t *testing.T) {
+	const key = "xsrfkey"
+	valid := xsrftoken.Generate(key, "", "")
+
+	testCases := map[string]struct {
+		method     string
+		token      string
+		statusCode int
+		expired    bool
+	}{
+		"GET":          {http.MethodGet, valid, http.StatusMethodNotAllowed, false},
+		"HEAD":         {http.MethodHead, valid, http.StatusMethodNotAllowed, false},
+		"POST":         {http.MethodPost, valid, http.StatusTemporaryRedirect, true},
+		"NoToken":      {http.MethodPost, "", http.StatusForbidden, false},
+		"InvalidToken": {http.MethodPost, "invalid", http.StatusForbidden, false},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			auth := &testAuthenticator{}
+			h := &Handler{Auth: auth}
+			h.Register(&testProvider{"id", "secret"})
+
+			body := url.Values{"token": {tc.token}}.Encode()
+			req := httptest.NewRequest(tc.method, "/auth/test/logout", strings.NewReader(body))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			middleware.XSRFProtect(key)(h).ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tc.statusCode; got != want {
+				t.Fatalf("got unexpected status code: %d, want %d", got, want)
+			}
+			if auth.expired != tc.expired {
+				t.Fatalf("session expired: got %t, want %t", auth.expired, tc.expired)
+			}
+			if !tc.expired {
+				return
+			}
+
+			var cookie *http.Cookie
+			for _, c := range resp.Cookies() {
+				if c.Name == DefaultCookieName {
+					cookie = c
+				}
+			}
+			if cookie == nil || !cookie.Expires.Before(time.Now()) {
+				t.Fatalf("got cookie %v, want an expired session cookie", cookie)
+			}
+		})
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	user := &browser.User{Name: "Jane", Email: "jane@example.com", Provider: "github", Role: browser.FullAccess, License: true}
+
+	auth := &Cookie{
+		Secret: "secret",
+		Cookie: securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)),
+	}
+	rec := httptest.NewRecorder()
+	if err := auth.Authorize(context.Background(), rec, user); err != nil {
+		t.Fatal(err)
+	}
+	session := rec.Result().Cookies()[0]
+
+	testCases := map[string]struct {
+		interval time.Duration
+		getErr   error
+		wantRole browser.Role
+		expired  bool
+		calls    int
+	}{
+		"Disabled":    {0, browser.ErrUserNotFound, browser.FullAccess, false, 0},
+		"Exists":      {time.Nanosecond, nil, browser.FullAccess, false, 1},
+		"Deleted":     {time.Nanosecond, browser.ErrUserNotFound, browser.Public, true, 1},
+		"Unavailable": {time.Nanosecond, errors.New("connection refused"), browser.FullAccess, false, 1},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			var calls int
+			var got *browser.User
+			h := &Handler{
+				Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					got = browser.UserFromContext(r.Context())
+				}),
+				Auth: auth,
+				Users: &mock.UserService{
+					GetFn: func(ctx context.Context, u *browser.User) (*browser.User, error) {
+						calls++
+						if tc.getErr != nil {
+							return nil, tc.getErr
+						}
+						return u, nil
+					},
+				},
+				RevalidateInterval: tc.interval,
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(session)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if calls != tc.calls {
+				t.Fatalf("got %d calls to the user service, want %d", calls, tc.calls)
+			}
+			if got.Role != tc.wantRole {
+				t.Fatalf("got role %q, want %q", got.Role, tc.wantRole)
+			}
+
+			var expired bool
+			for _, c := range w.Result().Cookies() {
+				if c.Name == DefaultCookieName && c.Expires.Before(time.Now()) {
+					expired = true
+				}
+			}
+			if expired != tc.expired {
+				t.Fatalf("session expired: got %t, want %t", expired, tc.expired)
+			}
+		})
+	}
+}
+
+func TestRevalidateInterval(t *testing.T) {
+	user := &browser.User{Name: "Jane", Email: "jane@example.com", Provider: "github"}
+
+	var calls int
+	h := &Handler{
+		Users: &mock.UserService{
+			GetFn: func(ctx context.Context, u *browser.User) (*browser.User, error) {
+				calls++
+				return u, nil
+			},
+		},
+		RevalidateInterval: time.Hour,
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, ok := h.revalidate(context.Background(), user); !ok {
+			t.Fatal("revalidate returned false for an existing user")
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("got %d calls to the user service within the interval, want 1", calls)
+	}
+}
+
+func TestRefreshRole(t *testing.T) {
+	user := &browser.User{Name: "Jane", Email: "jane@example.com", Provider: "github", Role: browser.External, License: true}
+	stored := *user
+
+	auth := &Cookie{
+		Secret: "secret",
+		Cookie: securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)),
+	}
+	rec := httptest.NewRecorder()
+	if err := auth.Authorize(context.Background(), rec, user); err != nil {
+		t.Fatal(err)
+	}
+	session := rec.Result().Cookies()[0]
+
+	var got *browser.User
+	newHandler := func(refresh bool) *Handler {
+		return &Handler{
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = browser.UserFromContext(r.Context())
+			}),
+			Auth: auth,
+			Users: &mock.UserService{
+				GetFn: func(ctx context.Context, u *browser.User) (*browser.User, error) {
+					s := stored
+					return &s, nil
+				},
+			},
+			RefreshRole: refresh,
+		}
+	}
+
+	serve := func(t *testing.T, h *Handler, cookie *http.Cookie) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// An admin changes the role in the store.
+	stored.Role = browser.FullAccess
+
+	serve(t, newHandler(false), session)
+	if got.Role != browser.External {
+		t.Fatalf("without refresh: got role %q, want %q", got.Role, browser.External)
+	}
+
+	resp := serve(t, newHandler(true), session)
+	if got.Role != browser.FullAccess {
+		t.Fatalf("got role %q, want %q", got.Role, browser.FullAccess)
+	}
+
+	// The session must be issued again with the new role.
+	var refreshed *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == DefaultCookieName && c.Expires.After(time.Now()) {
+			refreshed = c
+		}
+	}
+	if refreshed == nil {
+		t.Fatal("session was not issued again")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(refreshed)
+	u, err := auth.Validate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Role != browser.FullAccess {
+		t.Fatalf("reissued session: got role %q, want %q", u.Role, browser.FullAccess)
+	}
+
+	// An unchanged role does not issue the session again.
+	resp = serve(t, newHandler(true), refreshed)
+	if len(resp.Cookies()) != 0 {
+		t.Fatalf("got cookies %v for an unchanged role, want none", resp.Cookies())
+	}
+}
@@ -23,6 +23,8 @@ package ql
 import (
 	"bytes"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -215,16 +217,156 @@ func (sm *ShowMeasurementBuilder) Query() (string, []interface{}) {
 	return sm.b.String(), nil
 }
 
+// ShowSeriesBuilder is a builder for a 'SHOW SERIES' or 'SHOW SERIES
+// CARDINALITY' query.
+type ShowSeriesBuilder struct {
+	b           Builder
+	cardinality bool
+	from        []string
+	where       *WhereBuilder
+}
+
+// ShowSeries returns the base for building a 'SHOW SERIES' query.
+func ShowSeries() *ShowSeriesBuilder {
+	return &ShowSeriesBuilder{}
+}
+
+// ShowSeriesCardinality returns the base for building a 'SHOW SERIES
+// CARDINALITY' query.
+func ShowSeriesCardinality() *ShowSeriesBuilder {
+	return &ShowSeriesBuilder{cardinality: true}
+}
+
+func (ss *ShowSeriesBuilder) From(f ...string) *ShowSeriesBuilder {
+	if len(f) < 1 {
+		f = []string{"/.*/"}
+	}
+	ss.from = f
+
+	return ss
+}
+
+func (ss *ShowSeriesBuilder) Where(q ...Querier) *ShowSeriesBuilder {
+	if len(q) > 0 {
+		ss.where = Where(q...)
+	}
+	return ss
+}
+
+func (ss *ShowSeriesBuilder) Query() (string, []interface{}) {
+	ss.b.WriteString("SHOW SERIES")
+
+	if ss.cardinality {
+		ss.b.Append(" CARDINALITY")
+	}
+
+	if len(ss.from) > 0 {
+		ss.b.Append(" FROM ")
+		ss.b.AppendWithComma(ss.from...)
+	}
+
+	if ss.where != nil {
+		w, _ := ss.where.Query()
+		if len(w) > 0 {
+			ss.b.Append(" WHERE ")
+			ss.b.Append(w)
+		}
+	}
+
+	return ss.b.String(), nil
+}
+
+// ShowTagKeysBuilder is a builder for a 'SHOW TAG KEYS' query.
+type ShowTagKeysBuilder struct {
+	b     Builder
+	from  []string
+	where *WhereBuilder
+}
+
+// ShowTagKeys returns the base for building a 'SHOW TAG KEYS' query.
+func ShowTagKeys() *ShowTagKeysBuilder {
+	return &ShowTagKeysBuilder{}
+}
+
+func (sk *ShowTagKeysBuilder) From(f ...string) *ShowTagKeysBuilder {
+	if len(f) < 1 {
+		f = []string{"/.*/"}
+	}
+	sk.from = f
+
+	return sk
+}
+
+func (sk *ShowTagKeysBuilder) Where(q ...Querier) *ShowTagKeysBuilder {
+	if len(q) > 0 {
+		sk.where = Where(q...)
+	}
+	return sk
+}
+
+func (sk *ShowTagKeysBuilder) Query() (string, []interface{}) {
+	sk.b.WriteString("SHOW TAG KEYS")
+
+	if len(sk.from) > 0 {
+		sk.b.Append(" FROM ")
+		sk.b.AppendWithComma(sk.from...)
+	}
+
+	if sk.where != nil {
+		w, _ := sk.where.Query()
+		if len(w) > 0 {
+			sk.b.Append(" WHERE ")
+			sk.b.Append(w)
+		}
+	}
+
+	return sk.b.String(), nil
+}
+
+// ShowFieldKeysBuilder is a builder for a 'SHOW FIELD KEYS' query.
+type ShowFieldKeysBuilder struct {
+	b    Builder
+	from []string
+}
+
+// ShowFieldKeys returns the base for building a 'SHOW FIELD KEYS' query.
+func ShowFieldKeys() *ShowFieldKeysBuilder {
+	return &ShowFieldKeysBuilder{}
+}
+
+func (sf *ShowFieldKeysBuilder) From(f ...string) *ShowFieldKeysBuilder {
+	if len(f) < 1 {
+		f = []string{"/.*/"}
+	}
+	sf.from = f
+
+	return sf
+}
+
+func (sf *ShowFieldKeysBuilder) Query() (string, []interface{}) {
+	sf.b.WriteString("SHOW FIELD KEYS")
+
+	if len(sf.from) > 0 {
+		sf.b.Append(" FROM ")
+		sf.b.AppendWithComma(sf.from...)
+	}
+
+	return sf.b.String(), nil
+}
+
 // SelectBuilder is a builder for a 'SELECT' query.
 type SelectBuilder struct {
 	b        Builder
 	columns  []string
 	from     []string
+	rp       string
 	where    *WhereBuilder
 	order    string
 	group    string
 	orderDir string
 	limit    string
+	offset   string
+	slimit   string
 	timezone string
 }
 
@@ -245,6 +387,14 @@ func (sb *SelectBuilder) From(f ...string) *SelectBuilder {
 	return sb
 }
 
+// RetentionPolicy qualifies all measurements in the 'FROM' clause with the
+// given retention policy, e.g. "rp"."measurement". An empty policy selects
+// from the default retention policy.
+func (sb *SelectBuilder) RetentionPolicy(rp string) *SelectBuilder {
+	sb.rp = rp
+	return sb
+}
+
 func (sb *SelectBuilder) Where(q ...Querier) *SelectBuilder {
 	if len(q) > 0 {
 		sb.where = Where(q...)
@@ -267,6 +417,11 @@ func (sb *SelectBuilder) ASC() *SelectBuilder {
 	return sb
 }
 
+func (sb *SelectBuilder) DESC() *SelectBuilder {
+	sb.orderDir = " DESC"
+	return sb
+}
+
 func (sb *SelectBuilder) Limit(l int64) *SelectBuilder {
 	if l > 0 {
 		sb.limit = fmt.Sprintf(" LIMIT %d", l)
@@ -274,6 +429,20 @@ func (sb *SelectBuilder) Limit(l int64) *SelectBuilder {
 	return sb
 }
 
+func (sb *SelectBuilder) Offset(o int64) *SelectBuilder {
+	if o > 0 {
+		sb.offset = fmt.Sprintf(" OFFSET %d", o)
+	}
+	return sb
+}
+
+func (sb *SelectBuilder) SLimit(l int64) *SelectBuilder {
+	if l > 0 {
+		sb.slimit = fmt.Sprintf(" SLIMIT %d", l)
+	}
+	return sb
+}
+
 func (sb *SelectBuilder) TZ(tz string) *SelectBuilder {
 	sb.timezone = fmt.Sprintf(" TZ('%s')", tz)
 	return sb
@@ -286,7 +455,7 @@ func (sb *SelectBuilder) Query() (string, []interface{}) {
 
 	if len(sb.from) > 0 {
 		sb.b.Append(" FROM ")
-		sb.b.AppendWithComma(sb.from...)
+		sb.b.AppendWithComma(qualify(sb.rp, sb.from)...)
 	}
 
 	if sb.where != nil {
@@ -312,6 +481,14 @@ func (sb *SelectBuilder) Query() (string, []interface{}) {
 		sb.b.Append(sb.limit)
 	}
 
+	if sb.offset != "" {
+		sb.b.Append(sb.offset)
+	}
+
+	if sb.slimit != "" {
+		sb.b.Append(sb.slimit)
+	}
+
 	if sb.timezone != "" {
 		sb.b.Append(sb.timezone)
 	}
@@ -319,6 +496,24 @@ func (sb *SelectBuilder) Query() (string, []interface{}) {
 	return sb.b.String(), sb.b.args
 }
 
+// qualify returns the given measurements qualified with the given retention
+// policy. Identifiers are quoted using quoteIdent, regular expressions are not
+// quoted.
+func qualify(rp string, measurements []string) []string {
+	if rp == "" {
+		return measurements
+	}
+
+	q := make([]string, len(measurements))
+	for i, m := range measurements {
+		if !strings.HasPrefix(m, "/") {
+			m = quoteIdent(m)
+		}
+		q[i] = quoteIdent(rp) + "." + m
+	}
+	return q
+}
+
 // WhereBuilder is a builder for the 'WHERE' clause of a query.
 type WhereBuilder struct {
 	b       Builder
@@ -330,21 +525,28 @@ func Where(q ...Querier) *WhereBuilder {
 }
 
 func (wb *WhereBuilder) Query() (string, []interface{}) {
+	// Operators are only written between two non empty query parts, so that
+	// empty parts can be omitted without leaving a dangling operator.
+	var op Querier
 	for _, query := range wb.queries {
 		if query == nil {
 			continue
 		}
 
+		if _, ok := query.(*OperatorBuilder); ok {
+			op = query
+			continue
+		}
+
 		q, _ := query.Query()
+		if len(q) == 0 {
+			continue
+		}
 
-		if len(wb.b.String()) == 0 {
-			// If the buffer is empty and the next query
-			// is an operator skip it.
-			_, ok := query.(*OperatorBuilder)
-			if ok {
-				continue
-			}
+		if op != nil && len(wb.b.String()) > 0 {
+			wb.b.merge(op)
 		}
+		op = nil
 
 		wb.b.Append(q)
 	}
@@ -407,19 +609,57 @@ func comp(join *OperatorBuilder, operator, column string, values ...string) stri
 		if i > 0 && len(b.String()) > 0 {
 			b.merge(join)
 		}
-		fmt.Fprintf(&b, "%s%s'%s'", column, operator, v)
+		fmt.Fprintf(&b, "%s%s'%s'", quoteIdent(column), operator, escapeValue(v))
 	}
 
 	return b.String()
 }
 
+// Paren encloses the given query part in parentheses, e.g. for joining
+// conditions combined with OR to others using AND. An empty query part stays
+// empty.
+//
+//   Paren(Eq(Or(), "a", "b", "c")) -> (a='b' OR a='c')
+func Paren(q Querier) Querier {
+	return QueryFunc(func() (string, []interface{}) {
+		s, args := q.Query()
+		if len(s) == 0 {
+			return "", args
+		}
+		return "(" + s + ")", args
+	})
+}
+
 func TimeRange(from, to time.Time) Querier {
 	var b Builder
 	return QueryFunc(func() (string, []interface{}) {
-		fmt.Fprintf(&b, "time >= '%s' AND time <= '%s'",
-			from.Format("2006-01-02T15:04:05Z"),
-			to.Format("2006-01-02T15:04:05Z"),
+		fmt.Fprintf(&b, "%[1]s >= '%[2]s' AND %[1]s <= '%[3]s'",
+			quoteIdent("time"),
+			escapeValue(from.Format("2006-01-02T15:04:05Z")),
+			escapeValue(to.Format("2006-01-02T15:04:05Z")),
 		)
 		return b.String(), nil
 	})
 }
+
+// identRegexp matches identifiers which can be used without quotes.
+var identRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteIdent returns the given identifier unchanged if it is a valid unquoted
+// InfluxQL identifier. Otherwise it is returned double quoted with all double
+// quotes and backslashes escaped, so it can never end the identifier.
+func quoteIdent(s string) string {
+	if identRegexp.MatchString(s) {
+		return s
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// escapeValue escapes backslashes and single quotes in the given value, so it
+// can safely be used inside a single quoted string literal.
+func escapeValue(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return r.Replace(s)
+}
@@ -22,6 +22,10 @@ func TestWhereBuilder(t *testing.T) {
 		{Where(And(), Eq(Or(), "a", "b")), "a='b'"},
 		{Where(Eq(Or(), "x", ""), And(), Eq(And(), "a", "b")), "a='b'"},
 		{Where(Eq(Or(), "x", "a"), And(), Lte(And(), "y", "1")), "x='a' AND y<='1'"},
+		{Where(Eq(Or(), "x", "a"), And(), Eq(Or(), "z", ""), And(), Lte(And(), "y", "1")), "x='a' AND y<='1'"},
+		{Where(Eq(Or(), "x", "a"), And()), "x='a'"},
+		{Where(Paren(Eq(Or(), "x", "a", "b")), And(), Paren(Eq(Or(), "y", "c", "d"))), "(x='a' OR x='b') AND (y='c' OR y='d')"},
+		{Where(Paren(Eq(Or(), "x")), And(), Lte(And(), "y", "1")), "y<='1'"},
 	}
 
 	for _, tc := range testCases {
@@ -63,6 +67,19 @@ func TestSelectBuilder(t *testing.T) {
 		{Select("a", "b"), "SELECT a, b"},
 		{Select("a", "b").From("c"), "SELECT a, b FROM c"},
 		{Select("a", "b").From("c").Where(Eq(And(), "x", "b")).GroupBy("t").OrderBy("a").ASC(), "SELECT a, b FROM c WHERE x='b' GROUP BY t ORDER BY a ASC"},
+		{Select("a").OrderBy("time").DESC(), "SELECT a ORDER BY time DESC"},
+		{Select("a").Limit(10).Offset(20), "SELECT a LIMIT 10 OFFSET 20"},
+		{Select("a").SLimit(2), "SELECT a SLIMIT 2"},
+		{Select("a").Offset(0).SLimit(0), "SELECT a"},
+		{Select("a").From("c").OrderBy("time").ASC().TZ("Etc/GMT-1").SLimit(3).Offset(5).Limit(10), "SELECT a FROM c ORDER BY time ASC LIMIT 10 OFFSET 5 SLIMIT 3 TZ('Etc/GMT-1')"},
+		{Select("a").OrderBy("time").ASC().DESC(), "SELECT a ORDER BY time DESC"},
+		{Select("a").OrderBy("time").DESC().ASC(), "SELECT a ORDER BY time ASC"},
+		{Select("a").From("c").RetentionPolicy(""), "SELECT a FROM c"},
+		{Select("a").From("c").RetentionPolicy("raw"), `SELECT a FROM raw.c`},
+		{Select("a", "b").From("c", "d").RetentionPolicy("raw"), `SELECT a, b FROM raw.c, raw.d`},
+		{Select("a").From().RetentionPolicy("downsampled"), `SELECT a FROM downsampled./.*/`},
+		{Select("a").From(`c"d`).RetentionPolicy("30d-raw"), `SELECT a FROM "30d-raw"."c\"d"`},
+		{Select("a").From("c").RetentionPolicy(`raw\" OR`), `SELECT a FROM "raw\\\" OR".c`},
 	}
 	for _, tc := range testCases {
 		if got, _ := tc.in.Query(); got != tc.want {
@@ -89,3 +106,81 @@ func TestShowMeasurementBuilder(t *testing.T) {
 		}
 	}
 }
+
+func TestShowSeriesBuilder(t *testing.T) {
+	testCases := []struct {
+		in   Querier
+		want string
+	}{
+		{ShowSeries(), "SHOW SERIES"},
+		{ShowSeries().From(), "SHOW SERIES FROM /.*/"},
+		{ShowSeries().From("a", "b"), "SHOW SERIES FROM a, b"},
+		{ShowSeries().Where(), "SHOW SERIES"},
+		{ShowSeries().From("a").Where(Eq(And(), "x", "b")), "SHOW SERIES FROM a WHERE x='b'"},
+		{ShowSeriesCardinality(), "SHOW SERIES CARDINALITY"},
+		{ShowSeriesCardinality().From("a"), "SHOW SERIES CARDINALITY FROM a"},
+		{ShowSeriesCardinality().Where(Eq(Or(), "x", "b", "c")), "SHOW SERIES CARDINALITY WHERE x='b' OR x='c'"},
+	}
+	for _, tc := range testCases {
+		if got, _ := tc.in.Query(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestShowTagKeysBuilder(t *testing.T) {
+	testCases := []struct {
+		in   Querier
+		want string
+	}{
+		{ShowTagKeys(), "SHOW TAG KEYS"},
+		{ShowTagKeys().From(), "SHOW TAG KEYS FROM /.*/"},
+		{ShowTagKeys().From("a", "b"), "SHOW TAG KEYS FROM a, b"},
+		{ShowTagKeys().Where(), "SHOW TAG KEYS"},
+		{ShowTagKeys().From("a").Where(Eq(And(), "station", "b")), "SHOW TAG KEYS FROM a WHERE station='b'"},
+		{ShowTagKeys().Where(Eq(Or(), "x", "b", "c")), "SHOW TAG KEYS WHERE x='b' OR x='c'"},
+	}
+	for _, tc := range testCases {
+		if got, _ := tc.in.Query(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestShowFieldKeysBuilder(t *testing.T) {
+	testCases := []struct {
+		in   Querier
+		want string
+	}{
+		{ShowFieldKeys(), "SHOW FIELD KEYS"},
+		{ShowFieldKeys().From(), "SHOW FIELD KEYS FROM /.*/"},
+		{ShowFieldKeys().From("a"), "SHOW FIELD KEYS FROM a"},
+	}
+	for _, tc := range testCases {
+		if got, _ := tc.in.Query(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	testCases := []struct {
+		in   Querier
+		want string
+	}{
+		{Eq(And(), "x", "a'b"), `x='a\'b'`},
+		{Eq(And(), "x", "a'; DROP DATABASE lter; --"), `x='a\'; DROP DATABASE lter; --'`},
+		{Eq(Or(), "x", `a\'`, "b"), `x='a\\\'' OR x='b'`},
+		{Lte(And(), "x", "1' OR '1'='1"), `x<='1\' OR \'1\'=\'1'`},
+		{Gte(And(), "x", "2;"), `x>='2;'`},
+		{Eq(And(), "x=1 OR y", "a"), `"x=1 OR y"='a'`},
+		{Eq(And(), `x"; DROP`, "a"), `"x\"; DROP"='a'`},
+		{Eq(And(), "snipeit_location_ref", "1"), `snipeit_location_ref='1'`},
+		{Where(Eq(Or(), "x", "a';"), And(), Lte(And(), "y", "1")), `x='a\';' AND y<='1'`},
+	}
+	for _, tc := range testCases {
+		if got, _ := tc.in.Query(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
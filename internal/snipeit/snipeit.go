@@ -8,10 +8,13 @@ package snipeit
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/euracresearch/browser"
 	"github.com/euracresearch/go-snipeit"
@@ -20,26 +23,125 @@ import (
 // Ensure StationService implements browser.StationService.
 var _ browser.StationService = &StationService{}
 
+// MeasurementsField is the name of the custom field of SnipeIT assets listing
+// the labels of the measurements recorded by a sensor, separated by commas.
+const MeasurementsField = "Measurements"
+
+// DefaultExcluded is the default list of location names which are not
+// stations but parent locations grouping them.
+var DefaultExcluded = []string{"LTER"}
+
 // StationService represents a service for retriving information stored in
 // SnipeIT.
 type StationService struct {
 	client *snipeit.Client
+
+	// excluded is a list of location names which will not be returned as
+	// stations.
+	excluded []string
+
+	// intervals maps station IDs to their collection interval.
+	intervals map[int64]time.Duration
+
+	// ttl is the time stations are cached before being refreshed. A zero ttl
+	// disables the cache.
+	ttl time.Duration
+
+	mu    sync.RWMutex
+	cache browser.Stations
 }
 
 // NewStationService returns a new instance of SnipeITService.
-func NewStationService(baseurl, token string) (*StationService, error) {
+func NewStationService(baseurl, token string, options ...Option) (*StationService, error) {
 	c, err := snipeit.NewClient(baseurl, token)
 	if err != nil {
 		return nil, err
 	}
 
-	return &StationService{
-		client: c,
-	}, nil
+	s := &StationService{
+		client:   c,
+		excluded: DefaultExcluded,
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	if s.ttl > 0 {
+		go s.refreshCache()
+	}
+
+	return s, nil
+}
+
+// Option controls some aspects of the StationService.
+type Option func(s *StationService)
+
+// WithExcluded returns an option function for setting the location names which
+// will be excluded from the list of stations. The names are compared case
+// insensitive.
+func WithExcluded(names ...string) Option {
+	return func(s *StationService) {
+		s.excluded = names
+	}
+}
+
+// ParseExcluded parses a comma separated list of location names, as used by
+// WithExcluded. Surrounding whitespace is trimmed and empty names are dropped.
+func ParseExcluded(s string) []string {
+	var names []string
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// WithCollectionIntervals returns an option function for setting the
+// collection interval of stations, keyed by their ID. Stations not listed use
+// browser.DefaultCollectionInterval.
+func WithCollectionIntervals(intervals map[int64]time.Duration) Option {
+	return func(s *StationService) {
+		s.intervals = intervals
+	}
+}
+
+// WithCacheTTL returns an option function for caching the stations in memory
+// for the given duration. The cache is refreshed in the background; if a
+// refresh fails the stale stations are served. By default stations are not
+// cached.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(s *StationService) {
+		s.ttl = ttl
+	}
+}
+
+// isExcluded checks if the given location name is excluded.
+func (s *StationService) isExcluded(name string) bool {
+	for _, e := range s.excluded {
+		if strings.EqualFold(name, e) {
+			return true
+		}
+	}
+	return false
 }
 
-// Station implements browser.StationService.
+// Station implements browser.StationService. If the cache is enabled the
+// station is looked up in the cached stations first.
 func (s *StationService) Station(ctx context.Context, id int64) (*browser.Station, error) {
+	if s.ttl > 0 {
+		stations, err := s.cachedStations()
+		if err == nil {
+			for _, station := range stations {
+				if station.ID == id {
+					st := *station
+					return &st, nil
+				}
+			}
+		}
+	}
+
 	location, resp, err := s.client.Location(id)
 	if err != nil {
 		return nil, err
@@ -53,6 +155,7 @@ func (s *StationService) Station(ctx context.Context, id int64) (*browser.Statio
 	if err != nil {
 		return nil, err
 	}
+	station.CollectionInterval = s.intervals[station.ID]
 
 	return station, nil
 }
@@ -85,8 +188,200 @@ func parseStation(l *snipeit.Location) (*browser.Station, error) {
 	}, nil
 }
 
-// Stations implements browser.StationService.
-func (s *StationService) Stations(ctx context.Context) (browser.Stations, error) {
+// Sensors implements browser.StationService. Sensors are the assets located
+// at the station, sorted by name and id.
+func (s *StationService) Sensors(ctx context.Context, id int64) ([]*browser.Sensor, error) {
+	opts := &snipeit.HardwareOptions{
+		LocationID: int(id),
+		Limit:      500,
+	}
+
+	assets, resp, err := s.client.Hardware(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SnipeIT API returned an error: %s", resp.Status)
+	}
+
+	sensors := make([]*browser.Sensor, 0, len(assets))
+	for _, a := range assets {
+		sensors = append(sensors, parseSensor(a, id))
+	}
+
+	sort.Slice(sensors, func(i, j int) bool {
+		if sensors[i].Name == sensors[j].Name {
+			return sensors[i].ID < sensors[j].ID
+		}
+		return sensors[i].Name < sensors[j].Name
+	})
+
+	return sensors, nil
+}
+
+// parseSensor parses a browser.Sensor located at the station with the given
+// id from a snipeit.Hardware.
+func parseSensor(h *snipeit.Hardware, station int64) *browser.Sensor {
+	sensor := &browser.Sensor{
+		ID:        h.ID,
+		Name:      h.Name,
+		Serial:    h.Serial,
+		Model:     h.Model.Name,
+		StationID: station,
+	}
+
+	for _, l := range strings.Split(h.CustomFields[MeasurementsField].Value, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			sensor.Measurements = append(sensor.Measurements, l)
+		}
+	}
+
+	return sensor
+}
+
+// Nearest implements browser.StationService. The distance to all stations
+// with valid coordinates is computed, so stations are best cached.
+func (s *StationService) Nearest(ctx context.Context, lat, lon float64) (*browser.Station, float64, error) {
+	if !browser.ValidCoordinates(lat, lon) {
+		return nil, 0, browser.ErrInvalidCoordinates
+	}
+
+	stations, err := s.cachedStations()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		nearest *browser.Station
+		min     float64
+	)
+	for _, station := range stations {
+		if !station.ValidCoordinates() {
+			continue
+		}
+		if d := station.Distance(lat, lon); nearest == nil || d < min {
+			nearest, min = station, d
+		}
+	}
+	if nearest == nil {
+		return nil, 0, browser.ErrStationNotFound
+	}
+
+	st := *nearest
+	return &st, min, nil
+}
+
+// Landuses implements browser.StationService.
+func (s *StationService) Landuses(ctx context.Context) ([]string, error) {
+	stations, err := s.cachedStations()
+	if err != nil {
+		return nil, err
+	}
+	return stations.Landuse(), nil
+}
+
+// Ping implements browser.StationService.
+func (s *StationService) Ping(ctx context.Context) error {
+	_, resp, err := s.client.Locations(&snipeit.LocationOptions{Limit: 1})
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SnipeIT API returned an error: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Stations implements browser.StationService. SnipeIT offers no search on the
+// station metadata, therefore the filter is applied after fetching all
+// locations.
+func (s *StationService) Stations(ctx context.Context, filter *browser.StationFilter) (browser.Stations, error) {
+	all, err := s.cachedStations()
+	if err != nil {
+		return nil, err
+	}
+
+	var stations browser.Stations
+	for _, station := range all {
+		if filter.Match(station) {
+			stations = append(stations, station)
+		}
+	}
+
+	return stations, nil
+}
+
+// cachedStations returns all stations from the cache, filling it on first
+// use. If the cache is disabled the stations are fetched from SnipeIT.
+func (s *StationService) cachedStations() (browser.Stations, error) {
+	if s.ttl <= 0 {
+		return s.fetchStations()
+	}
+
+	s.mu.RLock()
+	cache := s.cache
+	s.mu.RUnlock()
+
+	if cache != nil {
+		return cache, nil
+	}
+
+	return s.loadCache()
+}
+
+// loadCache fetches all stations from SnipeIT and stores them in the cache. If
+// fetching fails and the cache holds stations from a previous load, they are
+// returned instead of the error.
+func (s *StationService) loadCache() (browser.Stations, error) {
+	stations, err := s.fetchStations()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		if s.cache == nil {
+			return nil, err
+		}
+		log.Printf("snipeit: could not refresh stations, serving stale cache: %v", err)
+		return s.cache, nil
+	}
+
+	// An empty but non nil cache marks it as loaded.
+	if stations == nil {
+		stations = browser.Stations{}
+	}
+	s.cache = stations
+	return stations, nil
+}
+
+// refreshCache loads the cache immediately and reloads it every ttl.
+func (s *StationService) refreshCache() {
+	for {
+		if _, err := s.loadCache(); err != nil {
+			log.Printf("snipeit: could not load stations: %v", err)
+		}
+		time.Sleep(s.ttl)
+	}
+}
+
+// Ready reports whether the cache has been loaded. Without a cache the
+// stations are fetched on every request and the service is always ready.
+func (s *StationService) Ready() bool {
+	if s.ttl <= 0 {
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cache != nil
+}
+
+// fetchStations retrieves all stations from SnipeIT sorted by name.
+func (s *StationService) fetchStations() (browser.Stations, error) {
 	opts := &snipeit.LocationOptions{
 		Search: "LTER",
 		Limit:  100,
@@ -103,7 +398,7 @@ func (s *StationService) Stations(ctx context.Context) (browser.Stations, error)
 
 	var stations browser.Stations
 	for _, l := range locations {
-		if strings.EqualFold(l.Name, "LTER") {
+		if s.isExcluded(l.Name) {
 			continue
 		}
 
@@ -111,12 +406,16 @@ func (s *StationService) Stations(ctx context.Context) (browser.Stations, error)
 		if err != nil {
 			continue
 		}
+		station.CollectionInterval = s.intervals[station.ID]
 
 		stations = append(stations, station)
 	}
 
-	// Sort stations by name.
+	// Sort stations by name and by id for stations sharing the same name.
 	sort.Slice(stations, func(i, j int) bool {
+		if stations[i].Name == stations[j].Name {
+			return stations[i].ID < stations[j].ID
+		}
 		return stations[i].Name < stations[j].Name
 	})
 
@@ -6,13 +6,17 @@ package snipeit
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/euracresearch/browser"
 	"github.com/google/go-cmp/cmp"
@@ -102,7 +106,7 @@ func TestStations(t *testing.T) {
 	})
 	ctx := context.Background()
 	t.Run("Ok", func(t *testing.T) {
-		stations, err := testClient.Stations(ctx)
+		stations, err := testClient.Stations(ctx, nil)
 		if err != nil {
 			t.Fatalf("Stations returned error: %v", err)
 		}
@@ -112,6 +116,326 @@ func TestStations(t *testing.T) {
 			t.Fatalf("mismatch want %d, got %d", want, got)
 		}
 	})
+
+	t.Run("CustomExclusion", func(t *testing.T) {
+		s := &StationService{client: testClient.client}
+		WithExcluded("LTER", "p1")(s)
+
+		stations, err := s.Stations(ctx, nil)
+		if err != nil {
+			t.Fatalf("Stations returned error: %v", err)
+		}
+
+		var got []string
+		for _, station := range stations {
+			got = append(got, station.Name)
+		}
+
+		want := []string{"I1", "S3"}
+		diff := cmp.Diff(want, got)
+		if diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestStationsSameName(t *testing.T) {
+	s := newTestStationService(t, "testdata/duplicate.json")
+
+	stations, err := s.Stations(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Stations returned error: %v", err)
+	}
+
+	var got []int64
+	for _, station := range stations {
+		got = append(got, station.ID)
+	}
+
+	want := []int64{7, 4, 9}
+	diff := cmp.Diff(want, got)
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStationsFilter(t *testing.T) {
+	s := newTestStationService(t, "testdata/multiple.json")
+
+	testCases := map[string]struct {
+		filter *browser.StationFilter
+		want   []string
+	}{
+		"nil":          {nil, []string{"I1", "P1", "S3"}},
+		"landuse":      {&browser.StationFilter{Landuse: []string{"pa"}}, []string{"P1", "S3"}},
+		"landuseMulti": {&browser.StationFilter{Landuse: []string{"me", "pa"}}, []string{"I1", "P1", "S3"}},
+		"landuseNone":  {&browser.StationFilter{Landuse: []string{"xx"}}, nil},
+		"name":         {&browser.StationFilter{Name: "s"}, []string{"S3"}},
+		"minElevation": {&browser.StationFilter{MinElevation: 1500}, []string{"P1", "S3"}},
+		"maxElevation": {&browser.StationFilter{MaxElevation: 1526}, []string{"I1", "P1"}},
+		"elevation":    {&browser.StationFilter{MinElevation: 1500, MaxElevation: 2000}, []string{"P1"}},
+		"combined":     {&browser.StationFilter{Landuse: []string{"pa"}, MaxElevation: 2000}, []string{"P1"}},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			stations, err := s.Stations(context.Background(), tc.filter)
+			if err != nil {
+				t.Fatalf("Stations returned error: %v", err)
+			}
+
+			var got []string
+			for _, station := range stations {
+				got = append(got, station.Name)
+			}
+
+			diff := cmp.Diff(tc.want, got)
+			if diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStationsCache(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		hits int
+		fail bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		hits++
+		if fail {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		b, err := ioutil.ReadFile("testdata/multiple.json")
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits
+	}
+
+	const ttl = 100 * time.Millisecond
+	s, err := NewStationService(srv.URL, "testtoken", WithCacheTTL(ttl))
+	if err != nil {
+		t.Fatalf("NewStationService returned error: %v", err)
+	}
+
+	// The cache is loaded in the background without any request.
+	deadline := time.Now().Add(time.Second)
+	for !s.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("cache was not loaded after creating the service")
+		}
+		time.Sleep(ttl / 50)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		if _, err := s.Stations(ctx, nil); err != nil {
+			t.Fatalf("Stations returned error: %v", err)
+		}
+		if _, err := s.Station(ctx, 2); err != nil {
+			t.Fatalf("Station returned error: %v", err)
+		}
+	}
+	if got := count(); got != 1 {
+		t.Fatalf("SnipeIT API hit %d times within the TTL, want 1", got)
+	}
+
+	// Wait for the background refresh.
+	deadline = time.Now().Add(time.Second)
+	for count() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("cache was not refreshed after the TTL")
+		}
+		time.Sleep(ttl / 5)
+	}
+
+	// A failing refresh keeps serving the stale stations.
+	mu.Lock()
+	fail = true
+	before := hits
+	mu.Unlock()
+
+	deadline = time.Now().Add(time.Second)
+	for count() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("cache was not refreshed after the TTL")
+		}
+		time.Sleep(ttl / 5)
+	}
+
+	stations, err := s.Stations(ctx, nil)
+	if err != nil {
+		t.Fatalf("Stations returned error with stale cache: %v", err)
+	}
+	if got, want := len(stations), 3; got != want {
+		t.Fatalf("got %d stale stations, want %d", got, want)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	s := newTestStationService(t, "testdata/multiple.json")
+
+	testCases := map[string]struct {
+		lat, lon float64
+		want     string
+		distance float64
+		err      error
+	}{
+		"P1":        {46.7, 10.6, "P1", 2.040, nil},
+		"I1":        {46.687, 10.579, "I1", 0.053, nil},
+		"S3":        {46.76, 10.7, "S3", 1.110, nil},
+		"Far":       {47, 11, "S3", 34.001, nil},
+		"Exact":     {46.76671, 10.71079, "S3", 0, nil},
+		"Latitude":  {91, 10.6, "", 0, browser.ErrInvalidCoordinates},
+		"Longitude": {46.7, -181, "", 0, browser.ErrInvalidCoordinates},
+		"NaN":       {math.NaN(), 10.6, "", 0, browser.ErrInvalidCoordinates},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			station, distance, err := s.Nearest(context.Background(), tc.lat, tc.lon)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if tc.err != nil {
+				return
+			}
+
+			if got := station.Name; got != tc.want {
+				t.Errorf("got station %q, want %q", got, tc.want)
+			}
+			if math.Abs(distance-tc.distance) > 0.001 {
+				t.Errorf("got distance %.3f km, want %.3f km", distance, tc.distance)
+			}
+		})
+	}
+
+	t.Run("NoStations", func(t *testing.T) {
+		s := &StationService{ttl: time.Hour, cache: browser.Stations{}}
+		if _, _, err := s.Nearest(context.Background(), 46.7, 10.6); !errors.Is(err, browser.ErrStationNotFound) {
+			t.Fatalf("got error %v, want %v", err, browser.ErrStationNotFound)
+		}
+	})
+}
+
+func TestLanduses(t *testing.T) {
+	s := newTestStationService(t, "testdata/multiple.json")
+
+	got, err := s.Landuses(context.Background())
+	if err != nil {
+		t.Fatalf("Landuses returned an error: %v", err)
+	}
+
+	want := []string{"me", "pa"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSensors(t *testing.T) {
+	var location string
+	mux.HandleFunc("/hardware", func(w http.ResponseWriter, r *http.Request) {
+		location = r.URL.Query().Get("location_id")
+
+		b, err := ioutil.ReadFile("testdata/hardware.json")
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+	})
+
+	got, err := testClient.Sensors(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Sensors returned error: %v", err)
+	}
+
+	if location != "2" {
+		t.Fatalf("got location_id %q, want %q", location, "2")
+	}
+
+	want := []*browser.Sensor{
+		{
+			ID:        7,
+			Name:      "Datalogger",
+			Serial:    "CR1000-42",
+			Model:     "CR1000",
+			StationID: 2,
+		},
+		{
+			ID:           12,
+			Name:         "Thermohygrometer",
+			Serial:       "TH-0815",
+			Model:        "HC2A-S3",
+			StationID:    2,
+			Measurements: []string{"air_t_avg", "air_rh_avg"},
+		},
+	}
+
+	diff := cmp.Diff(want, got)
+	if diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// newTestStationService returns a StationService backed by a mock SnipeIT API
+// serving the given file as list of locations.
+func newTestStationService(t *testing.T, file string) *StationService {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := NewStationService(srv.URL, "testtoken")
+	if err != nil {
+		t.Fatalf("NewStationService returned error: %v", err)
+	}
+	return s
+}
+
+func TestParseExcluded(t *testing.T) {
+	testCases := map[string]struct {
+		in   string
+		want []string
+	}{
+		"empty":      {"", nil},
+		"blank":      {" , ,", nil},
+		"single":     {"LTER", []string{"LTER"}},
+		"multi":      {"LTER, Matsch ,Mazia", []string{"LTER", "Matsch", "Mazia"}},
+		"emptyItems": {"LTER,,Matsch,", []string{"LTER", "Matsch"}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := ParseExcluded(tc.in)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
 }
 
 func TestMain(m *testing.M) {
@@ -0,0 +1,52 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package browser
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+)
+
+// localeFS holds a JSON file for each language mapping texts to their
+// translation.
+//
+//go:embed locale/*.json
+var localeFS embed.FS
+
+// Translate returns the translation of the given key into the given language.
+// Keys without translation and languages without locale file return the key.
+func Translate(key, lang string) string {
+	j, err := localeFS.ReadFile(path.Join("locale", fmt.Sprintf("%s.json", lang)))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Println(err)
+		}
+		return key
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal(j, &m); err != nil {
+		log.Printf("translation: %v\n", err)
+		return key
+	}
+
+	v, ok := m[key]
+	if !ok {
+		return key
+	}
+
+	return v
+}
+
+// Landuse returns the label of the given landuse code in the given language,
+// e.g. "Meadows" for "me" in English. Unknown codes are returned unchanged.
+func Landuse(code, lang string) string {
+	return Translate(code, lang)
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package browser
+
+import "testing"
+
+func TestLanduse(t *testing.T) {
+	testCases := map[string]struct {
+		code string
+		lang string
+		want string
+	}{
+		"English":         {"me", "en", "Meadows"},
+		"German":          {"me", "de", "Wiese"},
+		"Italian":         {"me", "it", "Prati"},
+		"GermanForest":    {"fo", "de", "Wald"},
+		"ItalianPasture":  {"pa", "it", "Pascoli"},
+		"UnknownCode":     {"xx", "de", "xx"},
+		"UnknownLanguage": {"me", "fr", "me"},
+		"Empty":           {"", "it", ""},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			if got := Landuse(tc.code, tc.lang); got != tc.want {
+				t.Errorf("Landuse(%q, %q) = %q, want %q", tc.code, tc.lang, got, tc.want)
+			}
+		})
+	}
+}
@@ -7,7 +7,14 @@ package browser
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Station represents a meteorological station of the LTER project.
@@ -20,6 +27,169 @@ type Station struct {
 	Longitude float64
 	Image     string
 	Dashboard string
+
+	// CollectionInterval is the interval with which the station aggregates
+	// measured points. If zero DefaultCollectionInterval applies.
+	CollectionInterval time.Duration
+}
+
+// Interval returns the collection interval of the station, falling back to
+// DefaultCollectionInterval.
+func (s *Station) Interval() time.Duration {
+	if s == nil || s.CollectionInterval <= 0 {
+		return DefaultCollectionInterval
+	}
+	return s.CollectionInterval
+}
+
+// ValidCoordinates reports whether the latitude and longitude of the station
+// are within [-90, 90] and [-180, 180]. The coordinates -1, -1 used in place of
+// coordinates which could not be parsed are invalid as well.
+func (s *Station) ValidCoordinates() bool {
+	if s == nil {
+		return false
+	}
+	if s.Latitude == -1 && s.Longitude == -1 {
+		return false
+	}
+	return ValidCoordinates(s.Latitude, s.Longitude)
+}
+
+// ValidCoordinates reports whether the given latitude and longitude are within
+// [-90, 90] and [-180, 180].
+func ValidCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// earthRadius is the mean radius of the earth in kilometers.
+const earthRadius = 6371.0
+
+// Distance returns the great-circle distance in kilometers between the station
+// and the given coordinates, computed with the Haversine formula.
+func (s *Station) Distance(lat, lon float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(lat - s.Latitude)
+	dLon := rad(lon - s.Longitude)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(s.Latitude))*math.Cos(rad(lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ParseCollectionIntervals parses a comma separated list of station=interval
+// pairs, e.g. "12=10m,15=5m", into a map of station IDs to their collection
+// interval.
+func ParseCollectionIntervals(s string) (map[int64]time.Duration, error) {
+	intervals := make(map[int64]time.Duration)
+	if strings.TrimSpace(s) == "" {
+		return intervals, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid collection interval %q", pair)
+		}
+
+		id, err := strconv.ParseInt(strings.TrimSpace(kv[0]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid station id in collection interval %q", pair)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration in collection interval %q", pair)
+		}
+
+		intervals[id] = d
+	}
+
+	return intervals, nil
+}
+
+// StationFilter represents a filter for narrowing down Stations. Zero values
+// of its fields match all stations.
+type StationFilter struct {
+	// Landuse selects stations with one of the given landuse.
+	Landuse []string
+
+	// Name selects stations whose name contains the given string, compared
+	// case insensitive.
+	Name string
+
+	// MinElevation and MaxElevation select stations within the given
+	// elevation range in meters, bounds included. A value of 0 denotes an
+	// open bound.
+	MinElevation int64
+	MaxElevation int64
+}
+
+// Match reports whether the given station is selected by the filter. A nil
+// filter matches all stations.
+func (f *StationFilter) Match(s *Station) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Landuse) > 0 && !containsString(f.Landuse, s.Landuse) {
+		return false
+	}
+
+	if f.Name != "" && !strings.Contains(strings.ToLower(s.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+
+	if f.MinElevation != 0 && s.Elevation < f.MinElevation {
+		return false
+	}
+
+	if f.MaxElevation != 0 && s.Elevation > f.MaxElevation {
+		return false
+	}
+
+	return true
+}
+
+// ParseStationFilterFromRequest parses the query parameters landuse, name,
+// minElevation and maxElevation from the given http.Request and returns a
+// StationFilter or an error.
+func ParseStationFilterFromRequest(r *http.Request) (*StationFilter, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	f := &StationFilter{
+		Landuse: r.Form["landuse"],
+		Name:    strings.TrimSpace(r.FormValue("name")),
+	}
+
+	var err error
+	if f.MinElevation, err = parseElevation(r.FormValue("minElevation")); err != nil {
+		return nil, err
+	}
+	if f.MaxElevation, err = parseElevation(r.FormValue("maxElevation")); err != nil {
+		return nil, err
+	}
+
+	if f.MinElevation != 0 && f.MaxElevation != 0 && f.MinElevation > f.MaxElevation {
+		return nil, errors.New("minimum elevation is greater than maximum elevation")
+	}
+
+	return f, nil
+}
+
+// parseElevation parses an elevation bound. An empty string is an open bound.
+func parseElevation(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	e, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse elevation %q", s)
+	}
+	return e, nil
 }
 
 // StationService represents a service for retriving stations.
@@ -27,8 +197,39 @@ type StationService interface {
 	// Station returns the station by the given id or an error.
 	Station(ctx context.Context, id int64) (*Station, error)
 
-	// Stations retrieves metadata about all stations.
-	Stations(ctx context.Context) (Stations, error)
+	// Stations retrieves metadata about all stations matching the given
+	// filter. A nil filter returns all stations.
+	Stations(ctx context.Context, filter *StationFilter) (Stations, error)
+
+	// Sensors returns the sensors installed at the station with the given id.
+	Sensors(ctx context.Context, id int64) ([]*Sensor, error)
+
+	// Nearest returns the station closest to the given coordinates together
+	// with its distance in kilometers. Invalid coordinates return
+	// ErrInvalidCoordinates, if no station has valid coordinates
+	// ErrStationNotFound is returned.
+	Nearest(ctx context.Context, lat, lon float64) (*Station, float64, error)
+
+	// Landuses returns the sorted landuse codes of all stations, removing
+	// duplicates.
+	Landuses(ctx context.Context) ([]string, error)
+
+	// Ping checks if the StationService is reachable.
+	Ping(ctx context.Context) error
+}
+
+// Sensor represents an individual sensor installed at a station, recording
+// one or more measurements.
+type Sensor struct {
+	ID        int64
+	Name      string
+	Serial    string
+	Model     string
+	StationID int64
+
+	// Measurements are the labels of the measurements recorded by the
+	// sensor.
+	Measurements []string
 }
 
 // Stations represents a group of meteorological stations.
@@ -58,6 +259,16 @@ func (s Stations) Landuse() []string {
 	return l
 }
 
+// containsString reports whether s is in slice.
+func containsString(slice []string, s string) bool {
+	for _, el := range slice {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
+
 // AppendStringIfMissing will append the given string to the given slice if it
 // is missing.
 func AppendStringIfMissing(slice []string, s string) []string {
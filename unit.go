@@ -0,0 +1,96 @@
+// Copyright 2021 Eurac Research. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package browser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unitNames maps the spellings of units used by the stations to a canonical
+// name.
+var unitNames = map[string]string{
+	"deg c": "°C",
+	"deg_c": "°C",
+	"degc":  "°C",
+	"°c":    "°C",
+	"deg f": "°F",
+	"deg_f": "°F",
+	"°f":    "°F",
+	"k":     "K",
+	"km/h":  "km/h",
+	"kmh":   "km/h",
+	"m/s":   "m/s",
+	"ms-1":  "m/s",
+}
+
+// conversions holds the functions converting values between the canonical
+// units.
+var conversions = map[[2]string]func(float64) float64{
+	{"km/h", "m/s"}: func(v float64) float64 { return v / 3.6 },
+	{"m/s", "km/h"}: func(v float64) float64 { return v * 3.6 },
+	{"°C", "K"}:     func(v float64) float64 { return v + 273.15 },
+	{"K", "°C"}:     func(v float64) float64 { return v - 273.15 },
+	{"°C", "°F"}:    func(v float64) float64 { return v*9/5 + 32 },
+	{"°F", "°C"}:    func(v float64) float64 { return (v - 32) * 5 / 9 },
+	{"K", "°F"}:     func(v float64) float64 { return (v-273.15)*9/5 + 32 },
+	{"°F", "K"}:     func(v float64) float64 { return (v-32)*5/9 + 273.15 },
+}
+
+// canonicalUnit returns the canonical name of the given unit or the unit
+// itself if it is unknown.
+func canonicalUnit(unit string) string {
+	if c, ok := unitNames[strings.ToLower(strings.TrimSpace(unit))]; ok {
+		return c
+	}
+	return unit
+}
+
+// ConvertUnit returns a function converting values from one unit to another.
+// Units are compared case insensitive and the spellings used by the stations,
+// e.g. "deg c", are accepted. Supported are conversions between km/h and m/s
+// and between °C, K and °F. ErrUnsupportedConversion is returned for all
+// other units.
+func ConvertUnit(from, to string) (func(float64) float64, error) {
+	f, t := canonicalUnit(from), canonicalUnit(to)
+	if f == t {
+		return func(v float64) float64 { return v }, nil
+	}
+
+	conv, ok := conversions[[2]string{f, t}]
+	if !ok {
+		return nil, fmt.Errorf("%w from %q to %q", ErrUnsupportedConversion, from, to)
+	}
+	return conv, nil
+}
+
+// ConvertUnits converts the values of the given measurement to the unit
+// requested for its group by the filter and rewrites the unit of the
+// measurement. If the measurement is part of multiple groups with a requested
+// unit, e.g. Wind and WindSpeed, the first group in logical order is used.
+func (f *SeriesFilter) ConvertUnits(m *Measurement) error {
+	if len(f.Units) == 0 {
+		return nil
+	}
+
+	for g, re := range groupRegexps {
+		unit, ok := f.Units[Group(g)]
+		if !ok || !re.MatchString(m.Label) {
+			continue
+		}
+
+		conv, err := ConvertUnit(m.Unit, unit)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Label, err)
+		}
+		for _, p := range m.Points {
+			p.Value = conv(p.Value)
+		}
+		m.Unit = unit
+		return nil
+	}
+
+	return nil
+}